@@ -0,0 +1,156 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// privateNetworks are the unspecified, loopback, private, carrier-grade
+// NAT, and link-local networks. Whoever requests a certificate chooses its
+// domains and where they resolve, so enrichers visiting them refuse these
+// by default rather than let a certificate point them at the watcher's own
+// network, like a cloud provider's metadata service.
+var privateNetworks = func() []*net.IPNet {
+	networks := []*net.IPNet{}
+	for _, cidr := range []string{
+		"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12", "192.168.0.0/16",
+		"::/128", "::1/128", "fc00::/7", "fe80::/10",
+	} {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+// privateAddress reports whether ip is in one of the private networks.
+func privateAddress(ip net.IP) bool {
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvePublic resolves host, which may be an IP address, returning its
+// addresses unless any of them are private.
+func resolvePublic(ctx context.Context, host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		if privateAddress(ip) {
+			return nil, errors.Errorf("refusing to connect to private address %s", ip)
+		}
+		return []net.IP{ip}, nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := []net.IP{}
+	for _, addr := range addrs {
+		if privateAddress(addr.IP) {
+			return nil, errors.Errorf("refusing to connect to %s, which resolves to private address %s", host, addr.IP)
+		}
+		ips = append(ips, addr.IP)
+	}
+	return ips, nil
+}
+
+// refusePrivateDial is a net.Dialer's Control function refusing to connect
+// to private addresses. It's called once the host name is resolved, so DNS
+// can't point a connection around it.
+func refusePrivateDial(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || privateAddress(ip) {
+		return errors.Errorf("refusing to connect to private address %s", host)
+	}
+	return nil
+}
+
+// publicDialer connects to hosts unless they resolve to private addresses.
+var publicDialer = &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: refusePrivateDial}
+
+// dialPublic connects to addr, through the proxy if it has one, unless its
+// host resolves to a private address.
+func dialPublic(ctx context.Context, addr string) (net.Conn, error) {
+	proxy, err := proxyFor(&url.URL{Scheme: "https", Host: addr})
+	if err != nil {
+		return nil, err
+	}
+	if proxy == nil {
+		return publicDialer.DialContext(ctx, "tcp", addr)
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := resolvePublic(ctx, host); err != nil {
+		return nil, err
+	}
+	conn, err := dialProxy(proxy, addr)
+	return conn, errors.Wrapf(err, "proxy %s", proxy.Host)
+}
+
+// refusePrivateAddresses makes transport refuse to connect to private
+// addresses. The addresses it connects to directly are checked as it
+// connects, and the hosts it requests through a proxy, which resolves them
+// itself, are resolved and checked before the request goes to the proxy.
+// The proxies themselves may well be private.
+func refusePrivateAddresses(transport *http.Transport) {
+	var proxies sync.Map
+	proxy := transport.Proxy
+	if proxy == nil {
+		proxy = func(*http.Request) (*url.URL, error) { return nil, nil }
+	}
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		u, err := proxy(req)
+		if err != nil || u == nil {
+			return u, err
+		}
+		if _, err := resolvePublic(req.Context(), req.URL.Hostname()); err != nil {
+			return nil, err
+		}
+		port := u.Port()
+		if port == "" {
+			port = map[string]string{"http": "80", "https": "443", "socks5": "1080"}[u.Scheme]
+		}
+		proxies.Store(net.JoinHostPort(u.Hostname(), port), true)
+		return u, nil
+	}
+
+	direct := *publicDialer
+	direct.Control = nil
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if _, ok := proxies.Load(addr); ok {
+			return direct.DialContext(ctx, network, addr)
+		}
+		return publicDialer.DialContext(ctx, network, addr)
+	}
+}
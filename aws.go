@@ -0,0 +1,401 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// awsCredentials are AWS access keys, which expire if they're temporary.
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expires         time.Time // zero for keys that don't expire
+}
+
+// awsCredentialChain finds credentials the way the AWS SDKs do, trying in
+// turn environment variables, the shared credentials file, a web identity
+// token (as on EKS), the ECS container endpoint, and the EC2 instance
+// metadata service. Credentials are cached until shortly before they expire.
+type awsCredentialChain struct {
+	mu    sync.Mutex
+	creds *awsCredentials
+}
+
+// awsCredentialsCache is shared by every AWS sink.
+var awsCredentialsCache = &awsCredentialChain{}
+
+// metadataClient is used for the instance metadata service and container
+// endpoint, which answer quickly or not at all, and never through a proxy.
+var metadataClient = &http.Client{Timeout: 2 * time.Second, Transport: directTransport()}
+
+func (c *awsCredentialChain) get() (*awsCredentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.creds != nil && (c.creds.Expires.IsZero() || time.Until(c.creds.Expires) > 5*time.Minute) {
+		return c.creds, nil
+	}
+	providers := []struct {
+		name string
+		get  func() (*awsCredentials, error)
+	}{
+		{"environment", awsEnvCredentials},
+		{"shared credentials file", awsSharedCredentials},
+		{"web identity", awsWebIdentityCredentials},
+		{"container", awsContainerCredentials},
+		{"instance metadata", awsInstanceCredentials},
+	}
+	failures := []string{}
+	for _, p := range providers {
+		creds, err := p.get()
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", p.name, err))
+			continue
+		}
+		if creds != nil {
+			c.creds = creds
+			return creds, nil
+		}
+	}
+	if len(failures) > 0 {
+		return nil, errors.Errorf("no AWS credentials found (%s)", strings.Join(failures, "; "))
+	}
+	return nil, errors.New("no AWS credentials found")
+}
+
+// The providers return nil credentials and no error if they don't apply.
+
+func awsEnvCredentials() (*awsCredentials, error) {
+	id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if id == "" || secret == "" {
+		return nil, nil
+	}
+	return &awsCredentials{AccessKeyID: id, SecretAccessKey: secret, SessionToken: os.Getenv("AWS_SESSION_TOKEN")}, nil
+}
+
+// awsSharedCredentials reads static keys for AWS_PROFILE (or "default") from
+// ~/.aws/credentials or AWS_SHARED_CREDENTIALS_FILE.
+func awsSharedCredentials() (*awsCredentials, error) {
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := map[string]string{}
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = strings.TrimSpace(line[1 : len(line)-1])
+		case section == profile:
+			if eq := strings.Index(line, "="); eq > 0 {
+				values[strings.TrimSpace(line[:eq])] = strings.TrimSpace(line[eq+1:])
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if values["aws_access_key_id"] == "" {
+		return nil, nil
+	}
+	return &awsCredentials{
+		AccessKeyID:     values["aws_access_key_id"],
+		SecretAccessKey: values["aws_secret_access_key"],
+		SessionToken:    values["aws_session_token"],
+	}, nil
+}
+
+// awsWebIdentityCredentials exchanges the token in AWS_WEB_IDENTITY_TOKEN_FILE
+// for temporary credentials for AWS_ROLE_ARN, as set up by EKS for IAM roles
+// for service accounts.
+func awsWebIdentityCredentials() (*awsCredentials, error) {
+	tokenFile, role := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"), os.Getenv("AWS_ROLE_ARN")
+	if tokenFile == "" || role == "" {
+		return nil, nil
+	}
+	token, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return nil, err
+	}
+	session := os.Getenv("AWS_ROLE_SESSION_NAME")
+	if session == "" {
+		session = fmt.Sprintf("certstream-slack-%d", time.Now().Unix())
+	}
+	endpoint := "https://sts.amazonaws.com/"
+	if region := awsRegionFromEnv(); region != "" {
+		endpoint = fmt.Sprintf("https://sts.%s.amazonaws.com/", region)
+	}
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {role},
+		"RoleSessionName":  {session},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	resp, err := httpClient.PostForm(endpoint, form)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := readResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.Unmarshal(body, &result); err != nil {
+		return nil, errors.Wrap(err, "could not parse AssumeRoleWithWebIdentity response")
+	}
+	c := result.Credentials
+	return &awsCredentials{AccessKeyID: c.AccessKeyID, SecretAccessKey: c.SecretAccessKey, SessionToken: c.SessionToken, Expires: c.Expiration}, nil
+}
+
+// awsContainerCredentials gets credentials from the endpoint that ECS (or
+// EKS Pod Identity) provides to containers.
+func awsContainerCredentials() (*awsCredentials, error) {
+	endpoint := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		endpoint = "http://169.254.170.2" + uri
+	}
+	if endpoint == "" {
+		return nil, nil
+	}
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if path := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	return awsMetadataCredentials(req)
+}
+
+// awsInstanceCredentials gets the credentials of the EC2 instance's role
+// from the instance metadata service, using IMDSv2.
+func awsInstanceCredentials() (*awsCredentials, error) {
+	if strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+		return nil, nil
+	}
+	const base = "http://169.254.169.254/latest"
+	req, err := http.NewRequest("PUT", base+"/api/token", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+	resp, err := metadataClient.Do(req)
+	if err != nil {
+		return nil, nil // not on EC2
+	}
+	tokenBody, err := readResponse(resp)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	token := string(tokenBody)
+
+	get := func(path string) (*http.Request, error) {
+		req, err := http.NewRequest("GET", base+path, nil)
+		if err == nil {
+			req.Header.Set("X-aws-ec2-metadata-token", token)
+		}
+		return req, err
+	}
+	req, err = get("/meta-data/iam/security-credentials/")
+	if err != nil {
+		return nil, err
+	}
+	resp, err = metadataClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := readResponse(resp)
+	resp.Body.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "no instance role")
+	}
+	role := strings.SplitN(strings.TrimSpace(string(roles)), "\n", 2)[0]
+	req, err = get("/meta-data/iam/security-credentials/" + role)
+	if err != nil {
+		return nil, err
+	}
+	return awsMetadataCredentials(req)
+}
+
+// awsMetadataCredentials makes a request to a credentials endpoint that
+// responds with JSON, like the container endpoint and instance metadata.
+func awsMetadataCredentials(req *http.Request) (*awsCredentials, error) {
+	resp, err := metadataClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := readResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		AccessKeyID     string    `json:"AccessKeyId"`
+		SecretAccessKey string    `json:"SecretAccessKey"`
+		Token           string    `json:"Token"`
+		Expiration      time.Time `json:"Expiration"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, errors.Wrap(err, "could not parse credentials")
+	}
+	if result.AccessKeyID == "" {
+		return nil, errors.New("response has no credentials")
+	}
+	return &awsCredentials{AccessKeyID: result.AccessKeyID, SecretAccessKey: result.SecretAccessKey, SessionToken: result.Token, Expires: result.Expiration}, nil
+}
+
+// awsRegionFromEnv returns AWS_REGION or AWS_DEFAULT_REGION.
+func awsRegionFromEnv() string {
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+	return os.Getenv("AWS_DEFAULT_REGION")
+}
+
+// awsRequest makes a request to an AWS API signed with Signature Version 4
+// and returns the response body, or an *httpError for a response other than
+// 2xx.
+func awsRequest(service, region, endpoint string, headers map[string]string, body []byte) ([]byte, error) {
+	creds, err := awsCredentialsCache.get()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	awsSign(req, body, creds, service, region, time.Now())
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return readResponse(resp)
+}
+
+// awsSign adds Signature Version 4 headers to req.
+func awsSign(req *http.Request, body []byte, creds *awsCredentials, service, region string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	names := []string{"host"}
+	canonical := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		names = append(names, lower)
+		canonical[lower] = strings.Join(strings.Fields(strings.Join(values, ",")), " ")
+	}
+	sort.Strings(names)
+	var headers bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&headers, "%s:%s\n", name, canonical[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	query := strings.Replace(req.URL.Query().Encode(), "+", "%20", -1)
+	canonicalRequest := strings.Join([]string{req.Method, path, query, headers.String(), signedHeaders, payloadHash}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
@@ -0,0 +1,409 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/heptiolabs/certstream-slack/pkg/stream"
+)
+
+// caaIdentifiers are the issuer domains CAs use in CAA records (RFC 8659),
+// keyed by the organization in the issuer names of their certificates,
+// lowercased. CAs that issue under several brands accept all of them.
+var caaIdentifiers = map[string][]string{
+	"let's encrypt":                {"letsencrypt.org"},
+	"digicert inc":                 {"digicert.com", "symantec.com", "geotrust.com", "thawte.com", "rapidssl.com", "digitalcertvalidation.com"},
+	"digicert, inc.":               {"digicert.com", "symantec.com", "geotrust.com", "thawte.com", "rapidssl.com", "digitalcertvalidation.com"},
+	"geotrust inc.":                {"digicert.com", "geotrust.com"},
+	"thawte, inc.":                 {"digicert.com", "thawte.com"},
+	"sectigo limited":              {"sectigo.com", "comodoca.com", "comodo.com", "usertrust.com", "trust-provider.com"},
+	"comodo ca limited":            {"sectigo.com", "comodoca.com", "comodo.com"},
+	"zerossl":                      {"sectigo.com", "zerossl.com"},
+	"globalsign nv-sa":             {"globalsign.com"},
+	"google trust services":        {"pki.goog"},
+	"google trust services llc":    {"pki.goog"},
+	"amazon":                       {"amazon.com", "amazontrust.com", "awstrust.com", "amazonaws.com"},
+	"godaddy.com, inc.":            {"godaddy.com", "starfieldtech.com"},
+	"starfield technologies, inc.": {"starfieldtech.com", "godaddy.com"},
+	"entrust, inc.":                {"entrust.net"},
+	"entrust limited":              {"entrust.net"},
+	"identrust":                    {"identrust.com"},
+	"buypass as-983163327":         {"buypass.com", "buypass.no"},
+	"ssl corporation":              {"ssl.com"},
+	"asseco data systems s.a.":     {"certum.pl"},
+	"unizeto technologies s.a.":    {"certum.pl"},
+	"actalis s.p.a.":               {"actalis.it"},
+	"actalis s.p.a./03358520967":   {"actalis.it"},
+	"microsoft corporation":        {"microsoft.com", "digicert.com"},
+	"harica (hellenic academic and research institutions cert. authority)": {"harica.gr"},
+	"hellenic academic and research institutions ca":                       {"harica.gr"},
+}
+
+// caaChecker looks for certificates that CAA records don't authorize: ones
+// for domains whose CAA records name other CAs.
+type caaChecker struct {
+	// domains are the domains whose certificates are checked, along with
+	// their subdomains
+	domains zoneList
+	// issuers are the CAA identifiers of CAs, by organization, lowercased
+	issuers map[string][]string
+	// resolver is the DNS server to look up CAA records with
+	resolver string
+}
+
+func newCAAChecker(domains []string, issuers map[string][]string, resolver string) (*caaChecker, error) {
+	zones, err := parseZones(domains)
+	if err != nil {
+		return nil, err
+	}
+	c := &caaChecker{domains: zones, issuers: map[string][]string{}, resolver: resolver}
+	for org, ids := range caaIdentifiers {
+		c.issuers[org] = ids
+	}
+	for org, ids := range issuers {
+		org = strings.ToLower(strings.TrimSpace(org))
+		for _, id := range ids {
+			c.issuers[org] = append(c.issuers[org], strings.ToLower(strings.TrimSpace(id)))
+		}
+	}
+	if c.resolver == "" {
+		c.resolver = systemResolver()
+	}
+	if _, _, err := net.SplitHostPort(c.resolver); err != nil {
+		c.resolver = net.JoinHostPort(c.resolver, "53")
+	}
+	return c, nil
+}
+
+// caaMatch finds the domains a certificate names that CAA doesn't authorize
+// its issuer for. The CAA records for a domain are the first found looking
+// up it and then each of its parents in turn. If any of them are "issue"
+// records (or "issuewild" records, for wildcard domains when there are
+// any), one must name the issuer.
+func caaMatch(r *rule, domains []string, u *stream.CertificateUpdate) ([]foundDomain, alertRoute, error) {
+	c := r.caa
+	owned := []string{}
+	for _, domain := range domains {
+		if c.domains.contains(domain) && (r.matcher.Exclude == nil || !r.matcher.Exclude.MatchString(domain)) {
+			owned = append(owned, domain)
+		}
+	}
+	if len(owned) == 0 {
+		return nil, alertRoute{}, nil
+	}
+
+	org := ""
+	if u != nil {
+		org = u.LeafCert.Issuer.O
+	}
+	ids, known := c.issuers[strings.ToLower(strings.TrimSpace(org))]
+	if !known {
+		log.WithField("rule", r.Name).WithField("issuer", org).Warn("can't check CAA for a certificate from an unknown CA (add it to caa_issuers)")
+		return nil, alertRoute{}, nil
+	}
+
+	found := []foundDomain{}
+	for _, domain := range owned {
+		wildcard := strings.HasPrefix(domain, "*.")
+		name, records, err := c.lookup(strings.TrimPrefix(strings.ToLower(domain), "*."))
+		if err != nil {
+			return nil, alertRoute{}, errors.Wrapf(err, "could not look up CAA records for %s", domain)
+		}
+		allowed, ok := caaAuthorizes(records, ids, wildcard)
+		if !ok {
+			reason := fmt.Sprintf("CAA for %s allows no CAs", name)
+			if len(allowed) > 0 {
+				reason = fmt.Sprintf("CAA for %s only allows %s, not %s", name, strings.Join(allowed, ", "), org)
+			}
+			found = append(found, foundDomain{Domain: domain, Reason: reason})
+		}
+	}
+	return found, alertRoute{}, nil
+}
+
+// caaAuthorizes reports whether records authorize a CA with the given
+// identifiers, and lists the identifiers they do authorize.
+func caaAuthorizes(records []caaRecord, ids []string, wildcard bool) ([]string, bool) {
+	tag := "issue"
+	if wildcard {
+		for _, rec := range records {
+			if rec.tag == "issuewild" {
+				tag = "issuewild"
+			}
+		}
+	}
+	allowed := []string{}
+	restricted := false
+	for _, rec := range records {
+		if rec.tag != tag {
+			continue
+		}
+		restricted = true
+		id := strings.ToLower(strings.TrimSpace(strings.SplitN(rec.value, ";", 2)[0]))
+		if id == "" {
+			continue // no CA may issue
+		}
+		allowed = append(allowed, id)
+		for _, want := range ids {
+			if id == want {
+				return allowed, true
+			}
+		}
+	}
+	return allowed, !restricted
+}
+
+// caaRecord is a CAA resource record.
+type caaRecord struct {
+	tag, value string
+}
+
+// caaCacheTTL is how long CAA records are remembered, so each certificate
+// for a busy domain doesn't need DNS lookups.
+const caaCacheTTL = time.Hour
+
+var caaCache = struct {
+	sync.Mutex
+	entries map[string]caaCacheEntry
+}{entries: map[string]caaCacheEntry{}}
+
+type caaCacheEntry struct {
+	records []caaRecord
+	expires time.Time
+}
+
+// lookup finds the CAA records relevant to domain: those of the domain
+// itself or else of its closest parent that has any, returning the name
+// they're for. It doesn't look up top-level domains.
+func (c *caaChecker) lookup(domain string) (string, []caaRecord, error) {
+	for name := domain; strings.Contains(name, "."); name = name[strings.Index(name, ".")+1:] {
+		records, err := c.cachedLookup(name)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(records) > 0 {
+			return name, records, nil
+		}
+	}
+	return domain, nil, nil
+}
+
+func (c *caaChecker) cachedLookup(name string) ([]caaRecord, error) {
+	key := c.resolver + "/" + name
+	now := time.Now()
+	caaCache.Lock()
+	entry, ok := caaCache.entries[key]
+	caaCache.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.records, nil
+	}
+	records, err := queryCAA(c.resolver, name)
+	if err != nil {
+		return nil, err
+	}
+	caaCache.Lock()
+	defer caaCache.Unlock()
+	for k, e := range caaCache.entries {
+		if now.After(e.expires) {
+			delete(caaCache.entries, k)
+		}
+	}
+	caaCache.entries[key] = caaCacheEntry{records: records, expires: now.Add(caaCacheTTL)}
+	return records, nil
+}
+
+// systemResolver returns the first nameserver in /etc/resolv.conf, since
+// the Go resolver can't look up CAA records.
+func systemResolver() string {
+	f, err := os.Open("/etc/resolv.conf")
+	if err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == "nameserver" {
+				return net.JoinHostPort(fields[1], "53")
+			}
+		}
+	}
+	return "127.0.0.1:53"
+}
+
+const (
+	dnsTypeCAA = 257
+	dnsTypeOPT = 41
+)
+
+// queryCAA asks a recursive DNS server for the CAA records of name, over
+// UDP and then over TCP if the response is truncated.
+func queryCAA(server, name string) ([]caaRecord, error) {
+	id := uint16(rand.Intn(1 << 16))
+	query, err := dnsQuery(id, name, dnsTypeCAA)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialTimeout("udp", server, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	response := make([]byte, 4096)
+	for {
+		n, err := conn.Read(response)
+		if err != nil {
+			return nil, err
+		}
+		if n >= 2 && binary.BigEndian.Uint16(response) == id {
+			response = response[:n]
+			break
+		}
+	}
+	if len(response) >= 4 && response[2]&0x02 != 0 {
+		if response, err = queryTCP(server, query); err != nil {
+			return nil, err
+		}
+	}
+	return parseCAAResponse(response, id)
+}
+
+func queryTCP(server string, query []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("tcp", server, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	framed := make([]byte, 2, 2+len(query))
+	binary.BigEndian.PutUint16(framed, uint16(len(query)))
+	if _, err := conn.Write(append(framed, query...)); err != nil {
+		return nil, err
+	}
+	var length uint16
+	if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	response := make([]byte, length)
+	_, err = io.ReadFull(conn, response)
+	return response, err
+}
+
+// dnsQuery builds a recursive query for records of a type, advertising
+// (with EDNS) that responses up to 4096 bytes can be received over UDP.
+func dnsQuery(id uint16, name string, qtype uint16) ([]byte, error) {
+	msg := make([]byte, 12)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[2:], 0x0100) // recursion desired
+	binary.BigEndian.PutUint16(msg[4:], 1)      // one question
+	binary.BigEndian.PutUint16(msg[10:], 1)     // one additional record
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" || len(label) > 63 {
+			return nil, errors.Errorf("invalid domain %q", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = append(msg, byte(qtype>>8), byte(qtype), 0, 1) // class IN
+	// the OPT record: the root name, type, UDP size, and no flags or data
+	msg = append(msg, 0, 0, dnsTypeOPT, 0x10, 0, 0, 0, 0, 0, 0, 0)
+	return msg, nil
+}
+
+// parseCAAResponse returns the CAA records in the answer to a query,
+// treating a name that doesn't exist as having none.
+func parseCAAResponse(msg []byte, id uint16) ([]caaRecord, error) {
+	if len(msg) < 12 || binary.BigEndian.Uint16(msg) != id {
+		return nil, errors.New("invalid DNS response")
+	}
+	switch rcode := msg[3] & 0x0f; rcode {
+	case 0, 3: // no error, or no such name
+	default:
+		return nil, errors.Errorf("DNS server responded with error code %d", rcode)
+	}
+	questions := int(binary.BigEndian.Uint16(msg[4:]))
+	answers := int(binary.BigEndian.Uint16(msg[6:]))
+
+	off := 12
+	var err error
+	for i := 0; i < questions; i++ {
+		if off, err = skipDNSName(msg, off); err != nil {
+			return nil, err
+		}
+		off += 4
+	}
+	records := []caaRecord{}
+	for i := 0; i < answers; i++ {
+		if off, err = skipDNSName(msg, off); err != nil {
+			return nil, err
+		}
+		if off+10 > len(msg) {
+			return nil, errors.New("truncated DNS response")
+		}
+		rtype := binary.BigEndian.Uint16(msg[off:])
+		length := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+length > len(msg) {
+			return nil, errors.New("truncated DNS response")
+		}
+		data := msg[off : off+length]
+		off += length
+		// answers can include the CNAMEs leading to the records
+		if rtype != dnsTypeCAA || len(data) < 2 || 2+int(data[1]) > len(data) {
+			continue
+		}
+		// skipping the flags
+		records = append(records, caaRecord{
+			tag:   strings.ToLower(string(data[2 : 2+data[1]])),
+			value: string(data[2+data[1]:]),
+		})
+	}
+	return records, nil
+}
+
+// skipDNSName returns the offset after the (possibly compressed) name at
+// off.
+func skipDNSName(msg []byte, off int) (int, error) {
+	for {
+		if off >= len(msg) {
+			return 0, errors.New("truncated DNS response")
+		}
+		length := int(msg[off])
+		switch {
+		case length == 0:
+			return off + 1, nil
+		case length&0xc0 == 0xc0:
+			return off + 2, nil // a pointer ends the name
+		}
+		off += 1 + length
+	}
+}
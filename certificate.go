@@ -0,0 +1,186 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/heptiolabs/certstream-slack/pkg/notify"
+	"github.com/heptiolabs/certstream-slack/pkg/stream"
+)
+
+// certificateDetails are what a certificate's DER encoding tells us beyond
+// what certstream describes.
+type certificateDetails struct {
+	keyAlgorithm string
+	keySize      int
+	extKeyUsages []string
+	scts         []notify.SCT
+}
+
+// parseLeafDER parses the DER encoding of an update's leaf certificate, which
+// the full stream includes, and replaces certstream's description of the
+// certificate with one from the certificate itself, so that rules match on
+// what was actually issued. It returns nil if there's no DER encoding.
+func parseLeafDER(u *stream.CertificateUpdate) (*certificateDetails, error) {
+	leaf := &u.LeafCert
+	if leaf.AsDER == "" {
+		return nil, nil
+	}
+	der, err := base64.StdEncoding.DecodeString(leaf.AsDER)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not decode as_der")
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse as_der")
+	}
+
+	parsed := leafCert(cert, der)
+	if leaf.Fingerprint != "" && leaf.Fingerprint != parsed.Fingerprint {
+		return nil, errors.Errorf("as_der has fingerprint %s, not %s", parsed.Fingerprint, leaf.Fingerprint)
+	}
+	parsed.Extensions = leaf.Extensions
+	parsed.AsDER = leaf.AsDER
+	*leaf = parsed
+
+	details := &certificateDetails{extKeyUsages: extKeyUsageNames(cert)}
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		details.keyAlgorithm, details.keySize = "RSA", key.N.BitLen()
+	case *ecdsa.PublicKey:
+		details.keyAlgorithm, details.keySize = "ECDSA", key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		details.keyAlgorithm, details.keySize = "Ed25519", 256
+	default:
+		details.keyAlgorithm = cert.PublicKeyAlgorithm.String()
+	}
+	if details.scts, err = embeddedSCTs(cert); err != nil {
+		return nil, err
+	}
+	return details, nil
+}
+
+// parseChainDER parses the DER encodings of an update's chain, which the
+// full stream includes, and replaces certstream's descriptions of the CA
+// certificates with ones from the certificates themselves. Certificates
+// without DER encodings are left as they are.
+func parseChainDER(u *stream.CertificateUpdate) error {
+	for i := range u.Chain {
+		c := &u.Chain[i]
+		if c.AsDER == "" {
+			continue
+		}
+		der, err := base64.StdEncoding.DecodeString(c.AsDER)
+		if err != nil {
+			return errors.Wrapf(err, "could not decode as_der of chain certificate %d", i)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return errors.Wrapf(err, "could not parse as_der of chain certificate %d", i)
+		}
+		parsed := leafCert(cert, der)
+		parsed.Extensions = c.Extensions
+		*c = parsed
+	}
+	return nil
+}
+
+// extKeyUsages name the extended key usages, the way OpenSSL describes them.
+var extKeyUsages = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:             "any purpose",
+	x509.ExtKeyUsageServerAuth:      "server auth",
+	x509.ExtKeyUsageClientAuth:      "client auth",
+	x509.ExtKeyUsageCodeSigning:     "code signing",
+	x509.ExtKeyUsageEmailProtection: "email protection",
+	x509.ExtKeyUsageTimeStamping:    "time stamping",
+	x509.ExtKeyUsageOCSPSigning:     "OCSP signing",
+}
+
+// extKeyUsageNames lists what a certificate may be used for, with usages we
+// don't have a name for as their OIDs.
+func extKeyUsageNames(cert *x509.Certificate) []string {
+	names := []string{}
+	for _, usage := range cert.ExtKeyUsage {
+		if name, ok := extKeyUsages[usage]; ok {
+			names = append(names, name)
+		}
+	}
+	for _, oid := range cert.UnknownExtKeyUsage {
+		names = append(names, oid.String())
+	}
+	return names
+}
+
+// oidSCTList is the extension holding a certificate's embedded SCTs.
+var oidSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// embeddedSCTs reads the signed certificate timestamps embedded in a
+// certificate (RFC 6962 section 3.3). Precertificates don't have any.
+func embeddedSCTs(cert *x509.Certificate) ([]notify.SCT, error) {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidSCTList) {
+			continue
+		}
+		var list []byte
+		if _, err := asn1.Unmarshal(ext.Value, &list); err != nil {
+			return nil, errors.Wrap(err, "could not parse SCT list")
+		}
+		list, _, err := readUint16Prefixed(list)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not parse SCT list")
+		}
+		scts := []notify.SCT{}
+		for len(list) > 0 {
+			var sct []byte
+			if sct, list, err = readUint16Prefixed(list); err != nil {
+				return nil, errors.Wrap(err, "could not parse SCT list")
+			}
+			// version, log_id, and timestamp
+			if len(sct) < 41 || sct[0] != 0 {
+				continue
+			}
+			ms := binary.BigEndian.Uint64(sct[33:41])
+			scts = append(scts, notify.SCT{
+				LogID:     base64.StdEncoding.EncodeToString(sct[1:33]),
+				Timestamp: time.Unix(0, int64(ms)*int64(time.Millisecond)).UTC(),
+			})
+		}
+		return scts, nil
+	}
+	return nil, nil
+}
+
+// readUint16Prefixed reads a TLS-style opaque value with a 2 byte length.
+func readUint16Prefixed(b []byte) (value, rest []byte, err error) {
+	if len(b) < 2 {
+		return nil, nil, errors.New("truncated length")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return nil, nil, errors.New("truncated value")
+	}
+	return b[2 : 2+n], b[2+n:], nil
+}
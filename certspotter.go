@@ -0,0 +1,266 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/heptiolabs/certstream-slack/pkg/stream"
+)
+
+const defaultCertspotterURL = "https://api.certspotter.com/v1/issuances"
+
+// certspotterSource polls SSLMate's Cert Spotter issuance API for the
+// certificates issued for some domains and their subdomains. Unlike
+// certstream, Cert Spotter doesn't miss certificates, so this suits
+// domains you own. Each domain starts after the certificates Cert Spotter
+// already has, unless state has a position token for it.
+type certspotterSource struct {
+	url          string
+	token        string
+	domains      []string
+	pollInterval time.Duration
+	state        *ctState // nil unless positions are saved
+
+	mu          sync.Mutex
+	healthy     bool
+	lastMessage time.Time
+
+	stopOnce sync.Once
+	stopped  chan struct{}
+}
+
+func newCertspotterSource(url, token string, domains []string, pollInterval time.Duration) *certspotterSource {
+	return &certspotterSource{
+		url:          url,
+		token:        token,
+		domains:      domains,
+		pollInterval: pollInterval,
+		stopped:      make(chan struct{}),
+	}
+}
+
+func (s *certspotterSource) stop() {
+	s.stopOnce.Do(func() { close(s.stopped) })
+}
+
+// status reports the source as connected if the last poll succeeded.
+func (s *certspotterSource) status() (bool, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.healthy, s.lastMessage
+}
+
+func (s *certspotterSource) run(handle func(msg *stream.Message)) error {
+	log.WithField("domains", s.domains).Info("polling Cert Spotter")
+	after := map[string]string{}
+	if s.state != nil {
+		for _, domain := range s.domains {
+			if token, ok := s.state.token(s.stateKey(domain)); ok {
+				after[domain] = token
+			}
+		}
+	}
+	for {
+		healthy := true
+		for _, domain := range s.domains {
+			if err := s.poll(domain, after, handle); err != nil {
+				log.WithError(err).WithField("domain", domain).Warn("could not get issuances from Cert Spotter")
+				healthy = false
+			}
+			if s.isStopped() {
+				break
+			}
+		}
+		s.mu.Lock()
+		s.healthy = healthy
+		s.mu.Unlock()
+		if s.state != nil {
+			if err := s.state.save(); err != nil {
+				log.WithError(err).Error("could not save Cert Spotter positions")
+			}
+		}
+
+		select {
+		case <-time.After(s.pollInterval):
+		case <-s.stopped:
+			log.Info("stopped polling Cert Spotter")
+			return nil
+		}
+	}
+}
+
+// poll delivers the issuances for a domain after its position token,
+// page by page, until there are no more. Without a token, it only pages
+// through the issuances Cert Spotter already has to find where to start.
+func (s *certspotterSource) poll(domain string, after map[string]string, handle func(msg *stream.Message)) error {
+	token, started := after[domain]
+	skipped := 0
+	for !s.isStopped() {
+		issuances, err := s.issuances(domain, token)
+		if err != nil {
+			return err
+		}
+		if len(issuances) == 0 {
+			break
+		}
+		for _, i := range issuances {
+			token = i.ID
+			if !started {
+				skipped++
+				continue
+			}
+			msg, err := s.message(i)
+			if err != nil {
+				log.WithError(err).WithField("id", i.ID).Debug("skipping unparseable Cert Spotter issuance")
+				malformedMessages.inc()
+				continue
+			}
+			s.deliver(handle, msg)
+		}
+		after[domain] = token
+		if s.state != nil {
+			s.state.setToken(s.stateKey(domain), token)
+		}
+	}
+	if !started {
+		log.WithField("domain", domain).WithField("issuances", skipped).Debug("starting after the issuances Cert Spotter already has")
+		after[domain] = token
+		if s.state != nil {
+			s.state.setToken(s.stateKey(domain), token)
+		}
+	}
+	return nil
+}
+
+// stateKey is where a domain's position token is saved.
+func (s *certspotterSource) stateKey(domain string) string {
+	return "certspotter:" + domain
+}
+
+// certspotterIssuance is an issuance from the Cert Spotter API, with the
+// dns_names, issuer, and cert_der expansions.
+type certspotterIssuance struct {
+	ID         string    `json:"id"`
+	CertSHA256 string    `json:"cert_sha256"` // hex
+	DNSNames   []string  `json:"dns_names"`
+	NotBefore  time.Time `json:"not_before"`
+	NotAfter   time.Time `json:"not_after"`
+	Issuer     struct {
+		Name string `json:"name"` // like "C=US, O=Let's Encrypt, CN=R3"
+	} `json:"issuer"`
+	CertDER string `json:"cert_der"` // base64
+}
+
+// issuances gets a page of issuances for a domain and its subdomains after
+// a position token, or from the beginning if it's empty.
+func (s *certspotterSource) issuances(domain, after string) ([]certspotterIssuance, error) {
+	query := url.Values{
+		"domain":             {domain},
+		"include_subdomains": {"true"},
+		"match_wildcards":    {"true"},
+		"expand":             {"dns_names", "issuer", "cert_der"},
+	}
+	if after != "" {
+		query.Set("after", after)
+	}
+	req, err := http.NewRequest("GET", s.url+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := readResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	issuances := []certspotterIssuance{}
+	if err := json.Unmarshal(body, &issuances); err != nil {
+		return nil, errors.Wrap(err, "could not decode Cert Spotter issuances")
+	}
+	return issuances, nil
+}
+
+// message describes an issuance as a certstream-style certificate_update
+// message, from the certificate itself if Cert Spotter included it.
+func (s *certspotterSource) message(i certspotterIssuance) (*stream.Message, error) {
+	var leaf stream.Certificate
+	if i.CertDER != "" {
+		der, err := base64.StdEncoding.DecodeString(i.CertDER)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not decode cert_der")
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not parse cert_der")
+		}
+		leaf = leafCert(cert, der)
+	} else {
+		leaf = stream.Certificate{
+			Issuer:     parseDN(i.Issuer.Name),
+			AllDomains: i.DNSNames,
+			NotBefore:  float64(i.NotBefore.Unix()),
+			NotAfter:   float64(i.NotAfter.Unix()),
+		}
+		if sum, err := hex.DecodeString(i.CertSHA256); err == nil {
+			leaf.SHA256 = colonHex(sum)
+		}
+	}
+
+	u := &stream.CertificateUpdate{
+		LeafCert:  leaf,
+		CertIndex: -1,
+		Source:    stream.Source{Name: "Cert Spotter", URL: s.url},
+	}
+	if leaf.Fingerprint == "" && i.CertSHA256 != "" {
+		u.CertLink = "https://crt.sh/?q=" + i.CertSHA256
+	}
+	return &stream.Message{MessageType: "certificate_update", Data: u, Received: time.Now()}, nil
+}
+
+func (s *certspotterSource) isStopped() bool {
+	select {
+	case <-s.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// deliver hands a message to the watcher.
+func (s *certspotterSource) deliver(handle func(msg *stream.Message), msg *stream.Message) {
+	now := time.Now()
+	s.mu.Lock()
+	s.lastMessage = now
+	s.mu.Unlock()
+	lastMessageTime.set(float64(now.UnixNano()) / 1e9)
+	handle(msg)
+}
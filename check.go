@@ -0,0 +1,184 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// checker is implemented by notifiers whose settings can be malformed in
+// ways that only show up when sending, like credentials in the wrong format.
+// Only the validate command calls it, so that a format we don't expect (such
+// as a proxy in front of a webhook) never stops the watcher from starting.
+type checker interface {
+	check() error
+}
+
+// uuidPattern matches the UUIDs that several services use as API keys.
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// checkURL returns an error unless s is an absolute HTTP or HTTPS URL.
+func checkURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return errors.Errorf("%q must be an http or https URL", s)
+	}
+	if u.Host == "" {
+		return errors.Errorf("%q must include a host", s)
+	}
+	return nil
+}
+
+// checkConfig runs the checks of every sink in a loaded config and then
+// matches each sample against the rules, printing what matched. A sample is
+// a domain, optionally followed by "=" and the comma-separated names of the
+// rules expected to match it (none, if the list is empty). It returns every
+// problem found.
+func checkConfig(cfg *config, samples []string) []string {
+	problems := []string{}
+	for i, s := range cfg.sinks {
+		if c, ok := s.notifier.(checker); ok {
+			if err := c.check(); err != nil {
+				problems = append(problems, fmt.Sprintf("%s.%s", cfg.Sinks[i].key, err))
+			}
+		}
+	}
+
+	for _, r := range cfg.Rules {
+		if len(r.Plugin) > 0 {
+			if err := checkPluginCommand(r.Plugin); err != nil {
+				problems = append(problems, fmt.Sprintf("%s.plugin: %s", r.key, err))
+			}
+		}
+	}
+
+	rules := newRuleSet(cfg.Rules)
+	for _, sample := range samples {
+		domain, expected, expecting := sample, "", false
+		if i := strings.Index(sample, "="); i >= 0 {
+			domain, expected, expecting = sample[:i], sample[i+1:], true
+		}
+		matched := []string{}
+		if cfg.NormalizeDomains {
+			domain = normalizeDomain(domain)
+		}
+		if cfg.exclude == nil || !cfg.exclude.MatchString(domain) {
+			for _, m := range rules.matchCertificate([]string{domain}, nil) {
+				matched = append(matched, m.rule.Name)
+			}
+		}
+		if len(matched) == 0 {
+			fmt.Printf("%s: no rules match\n", domain)
+		} else {
+			fmt.Printf("%s: matches %s\n", domain, strings.Join(matched, ", "))
+		}
+		if !expecting {
+			continue
+		}
+		want := splitList(expected)
+		sort.Strings(want)
+		sort.Strings(matched)
+		if strings.Join(matched, ",") != strings.Join(want, ",") {
+			if len(want) == 0 {
+				want = []string{"no rules"}
+			}
+			problems = append(problems, fmt.Sprintf("%s: expected %s to match", domain, strings.Join(want, ", ")))
+		}
+	}
+	return problems
+}
+
+// testNotify sends a made-up alert through every sink in a loaded config,
+// including each rule's webhook_url, printing whether each one worked. It
+// returns a problem for each sink that failed.
+//
+// The alert has the least severity each sink takes and a random fingerprint
+// and serial, so that sinks which skip certificates they've already seen
+// (like MISP, TheHive, and JIRA) take it every time.
+func testNotify(cfg *config) []string {
+	sinks := append([]*sink{}, cfg.sinks...)
+	for _, r := range cfg.Rules {
+		for _, s := range r.sinks {
+			if strings.HasPrefix(s.name, "rule:") {
+				sinks = append(sinks, s)
+			}
+		}
+	}
+
+	problems := []string{}
+	for _, s := range sinks {
+		a := testAlert(s.minSeverity)
+		err := s.Notify(withMessage(a, s.template))
+		if f, ok := s.notifier.(flusher); ok && err == nil {
+			err = f.Flush()
+		}
+		if c, ok := s.notifier.(closer); ok {
+			if cerr := c.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			fmt.Printf("%s: failed\n", s.name)
+			problems = append(problems, fmt.Sprintf("%s: %s", s.name, err))
+			continue
+		}
+		fmt.Printf("%s: sent\n", s.name)
+	}
+	return problems
+}
+
+// testAlert returns an alert for a certificate that doesn't exist.
+func testAlert(sev severity) *alert {
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		rand.Read(b)
+		return b
+	}
+	domains := []string{"certstream-slack-test.example.com", "www.certstream-slack-test.example.com"}
+	fingerprint := colonHex(random(20))
+	now := time.Now()
+	return &alert{
+		Rule:        "test",
+		Pattern:     "a test alert from certstream-slack test-notify",
+		Severity:    sev,
+		Domains:     domains,
+		AllDomains:  domains,
+		Fingerprint: fingerprint,
+		SHA256:      colonHex(random(32)),
+		CertURL:     fmt.Sprintf("https://crt.sh/?q=%s", strings.Replace(fingerprint, ":", "", -1)),
+		Issuer:      "CN=certstream-slack test, O=certstream-slack",
+		IssuerCN:    "certstream-slack test",
+		IssuerOrg:   "certstream-slack",
+		Serial:      hex.EncodeToString(random(16)),
+		NotBefore:   now,
+		NotAfter:    now.Add(90 * 24 * time.Hour),
+		Seen:        now,
+		SourceName:  "certstream-slack test-notify",
+		CertIndex:   -1,
+	}
+}
@@ -0,0 +1,279 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dustin/go-humanize/english"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// version and commit identify the build, and are set when building, like:
+//
+//	go build -ldflags "-X main.version=v0.1.0 -X main.commit=$(git rev-parse --short HEAD)"
+var (
+	version = "dev"
+	commit  = "unknown"
+)
+
+// runCommand runs the command named by the first argument, or watch if the
+// first argument is a flag, as it was before there were commands.
+func runCommand(args []string) {
+	root := newRootCommand()
+	root.SetArgs(doubleDashFlags(args))
+	if err := root.Execute(); err != nil {
+		os.Exit(2)
+	}
+}
+
+// newRootCommand returns the commands. The root command runs watch, so it
+// takes watch's flags too. Cobra adds help, and completion, which prints
+// shell completion scripts.
+func newRootCommand() *cobra.Command {
+	root := watchCommand(&cobra.Command{
+		Use:     "certstream-slack",
+		Short:   "Alert on certificates matching the rules",
+		Long:    "Watch for certificates matching the rules and alert the sinks. Without a command, certstream-slack runs watch.",
+		Args:    cobra.NoArgs,
+		Version: version,
+	}, false)
+	root.SetVersionTemplate(versionString() + "\n")
+	root.AddCommand(
+		watchCommand(&cobra.Command{
+			Use:   "watch",
+			Short: "Watch for matching certificates and alert the sinks (the default)",
+			Args:  cobra.NoArgs,
+		}, false),
+		watchCommand(&cobra.Command{
+			Use:   "replay FILE",
+			Short: "Match the certstream messages in FILE (- for standard input) instead of connecting",
+			Args:  cobra.ExactArgs(1),
+		}, true),
+		serveCommand(),
+		validateCommand(),
+		testNotifyCommand(),
+		versionCommand(),
+	)
+	return root
+}
+
+// doubleDashFlags adds a dash to flags given with one, like -config, which
+// the commands took before they used cobra, since none of the flags have
+// shorthands. It leaves alone the arguments of cobra's hidden completion
+// command, and anything after "--".
+func doubleDashFlags(args []string) []string {
+	if len(args) > 0 && strings.HasPrefix(args[0], "__complete") {
+		return args
+	}
+	fixed := []string{}
+	for i, arg := range args {
+		if arg == "--" {
+			return append(fixed, args[i:]...)
+		}
+		if len(arg) > 2 && arg[0] == '-' && arg[1] >= 'a' && arg[1] <= 'z' {
+			arg = "-" + arg
+		}
+		fixed = append(fixed, arg)
+	}
+	return fixed
+}
+
+// envFlags are the environment variables with a matching flag, named like
+// --slack-webhook-url for SLACK_WEBHOOK_URL, which sets the variable so
+// that any of them can be given on the command line instead. DB_PATH,
+// DRY_RUN, RECORD_PATH, and REPLAY_FILE are left out, since --db,
+// --dry-run, --record, and the replay command cover them.
+var envFlags = []string{
+	"CERTSTREAM_URL", "CERTSTREAM_HEADERS",
+	"STREAM_CA_FILE", "STREAM_CLIENT_CERT", "STREAM_CLIENT_KEY", "STREAM_SERVER_NAME", "STREAM_MIN_TLS_VERSION",
+	"SOURCE", "CT_LOGS", "CT_LOG_LIST", "CT_POLL_INTERVAL", "CT_STATE_FILE",
+	"RECORD_ROTATE", "RECORD_KEEP",
+	"LOG_LEVEL", "LOG_FORMAT",
+	"LISTEN_ADDR", "SERVE_ADDR", "DASHBOARD_ADDR", "DASHBOARD_USER", "DASHBOARD_PASSWORD", "HEALTH_TIMEOUT",
+	"SLACK_SIGNING_SECRET", "WATCHES_FILE", "WATCH_SINKS", "REPORT_SCHEDULE",
+	"WORKERS", "QUEUE_SIZE",
+	"DEDUP_SIZE", "DEDUP_TTL", "DEDUP_KEY",
+	"COOLDOWN", "COOLDOWN_SIZE", "COOLDOWN_NOTES",
+	"MAX_RECONNECT_ATTEMPTS", "STREAM_PING_INTERVAL", "STREAM_READ_TIMEOUT", "DB_RETENTION",
+	"SLACK_WEBHOOK_URL", "DISCORD_WEBHOOK_URL", "TEAMS_WEBHOOK_URL", "GENERIC_WEBHOOK_URL", "GENERIC_WEBHOOK_HEADERS",
+	"PAGERDUTY_ROUTING_KEY", "OPSGENIE_API_KEY", "TELEGRAM_BOT_TOKEN", "TELEGRAM_CHAT_ID",
+	"SLACK_BLOCKS", "SLACK_DIGEST", "SLACK_RATE_LIMIT", "SLACK_SAN_LIST", "SLACK_TOKEN", "SLACK_CHANNEL",
+	"SINK",
+	"DOMAIN_PATTERN", "PATTERN_MODE", "KEYWORDS", "KEYWORDS_FILE", "KEYWORD_MODE", "LOOKALIKE_DOMAINS", "LOOKALIKE_DISTANCE", "SEVERITY",
+	"NORMALIZE_DOMAINS", "MAX_DOMAINS_IN_ALERT", "EXCLUDE_PATTERN",
+	"RULES_FILE",
+}
+
+func envFlagName(env string) string {
+	return strings.Replace(strings.ToLower(env), "_", "-", -1)
+}
+
+// configLoader loads the config once the flags defined by addConfigFlags
+// are parsed.
+type configLoader struct {
+	fs   *pflag.FlagSet
+	path *string
+
+	// override applies command-specific flags to the config
+	override func(c *config)
+}
+
+// addConfigFlags defines --config and the flags in envFlags.
+func addConfigFlags(fs *pflag.FlagSet) *configLoader {
+	l := &configLoader{fs: fs, path: fs.String("config", "", "path to a YAML config file")}
+	for _, env := range envFlags {
+		fs.String(envFlagName(env), "", "sets "+env)
+	}
+	return l
+}
+
+// load sets the environment variables of any flags given, loads the config,
+// and sets up logging, exiting if the config is invalid.
+func (l *configLoader) load() *config {
+	envs := map[string]string{}
+	for _, env := range envFlags {
+		envs[envFlagName(env)] = env
+	}
+	l.fs.Visit(func(f *pflag.Flag) {
+		if env, ok := envs[f.Name]; ok {
+			os.Setenv(env, f.Value.String())
+		}
+	})
+	cfg, err := loadConfig(*l.path, l.override, nil)
+	if err != nil {
+		log.WithError(err).Fatal("invalid configuration")
+	}
+	log.SetLevel(cfg.logLevel)
+	log.Formatter = cfg.logFormatter
+	setProxy(cfg.proxy, cfg.NoProxy)
+	return cfg
+}
+
+// watchCommand defines the flags of the watch command, and runs it, or
+// the replay command, which is the same but for reading messages from a
+// file.
+func watchCommand(cmd *cobra.Command, replay bool) *cobra.Command {
+	fs := cmd.Flags()
+	l := addConfigFlags(fs)
+	dbPath := fs.String("db", "", "path to a file to record matches in (overrides db_path)")
+	dryRun := fs.Bool("dry-run", false, "print alerts to standard output instead of sending them")
+	record := fs.String("record", "", "path to record every message from the source to (overrides record_path)")
+	replayFile := new(string)
+	if !replay {
+		replayFile = fs.String("replay", "", "path to a file of certstream messages to replay instead of connecting (- for standard input)")
+	}
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		if replay {
+			*replayFile = args[0]
+		}
+		l.override = func(c *config) {
+			if *dbPath != "" {
+				c.DBPath = *dbPath
+			}
+			if *dryRun {
+				c.DryRun = true
+			}
+			if *record != "" {
+				c.RecordPath = *record
+			}
+			if *replayFile != "" {
+				c.Source = "replay"
+				c.ReplayFile = *replayFile
+			}
+		}
+		watch(l.load(), l.override)
+	}
+	return cmd
+}
+
+// serveCommand tails CT logs, unless other sources are configured, and
+// serves them as a certstream server.
+func serveCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Tail CT logs and serve them as a certstream server",
+		Args:  cobra.NoArgs,
+	}
+	l := addConfigFlags(cmd.Flags())
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		l.override = func(c *config) {
+			c.serving = true
+			if c.Source == "certstream" && len(c.Sources) == 0 {
+				c.Source = "ct"
+			}
+		}
+		serve(l.load())
+	}
+	return cmd
+}
+
+func validateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate [DOMAIN[=RULE,...] ...]",
+		Short: "Check the config, and match any domains against the rules",
+	}
+	l := addConfigFlags(cmd.Flags())
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		cfg := l.load()
+		problems := checkConfig(cfg, args)
+		for _, problem := range problems {
+			fmt.Fprintln(os.Stderr, problem)
+		}
+		if len(problems) > 0 {
+			os.Exit(1)
+		}
+		fmt.Printf("configuration OK: %s, %s\n", english.Plural(len(cfg.Rules), "rule", ""), english.Plural(len(cfg.sinks), "sink", ""))
+	}
+	return cmd
+}
+
+func testNotifyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "test-notify",
+		Short: "Send a test alert through every sink",
+		Args:  cobra.NoArgs,
+	}
+	l := addConfigFlags(cmd.Flags())
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		problems := testNotify(l.load())
+		for _, problem := range problems {
+			fmt.Fprintln(os.Stderr, problem)
+		}
+		if len(problems) > 0 {
+			os.Exit(1)
+		}
+	}
+	return cmd
+}
+
+func versionCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Print the version and commit",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Println(versionString())
+		},
+	}
+}
+
+func versionString() string {
+	return fmt.Sprintf("certstream-slack %s (commit %s)", version, commit)
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDoubleDashFlags(t *testing.T) {
+	tests := []struct {
+		args, want []string
+	}{
+		{[]string{"-config", "c.yaml", "-dry-run"}, []string{"--config", "c.yaml", "--dry-run"}},
+		{[]string{"validate", "-config=c.yaml", "example.com"}, []string{"validate", "--config=c.yaml", "example.com"}},
+		{[]string{"--config", "c.yaml", "-h", "-v"}, []string{"--config", "c.yaml", "-h", "-v"}},
+		{[]string{"--max-reconnect-attempts", "-10", "-", "--", "-x"}, []string{"--max-reconnect-attempts", "-10", "-", "--", "-x"}},
+		{[]string{"__complete", "-con"}, []string{"__complete", "-con"}},
+	}
+	for _, test := range tests {
+		if got := doubleDashFlags(test.args); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("doubleDashFlags(%q) = %q, want %q", test.args, got, test.want)
+		}
+	}
+}
+
+func TestCommandFlags(t *testing.T) {
+	root := newRootCommand()
+	for _, args := range [][]string{
+		{"--config", "c.yaml", "--dry-run"},
+		{"watch", "--db", "matches.db", "--slack-webhook-url", "https://hooks.slack.com/x"},
+		{"validate", "--config", "c.yaml", "example.com=example"},
+	} {
+		cmd, rest, err := root.Find(args)
+		if err != nil {
+			t.Fatalf("%q: %v", args, err)
+		}
+		if err := cmd.ParseFlags(rest); err != nil {
+			t.Errorf("%q: %v", args, err)
+		}
+	}
+	if cmd, _, _ := root.Find([]string{"replay", "capture.jsonl"}); cmd.Flags().Lookup("replay") != nil {
+		t.Error("replay has a --replay flag")
+	}
+	if cmd, _, _ := root.Find([]string{"serve"}); cmd.Flags().Lookup("db") != nil {
+		t.Error("serve has watch's --db flag")
+	}
+}
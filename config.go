@@ -0,0 +1,1450 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/heptiolabs/certstream-slack/pkg/enrich"
+)
+
+// config is the top level configuration, loaded from an optional YAML file
+// and then overridden by environment variables.
+type config struct {
+	// StreamURL is the certstream websocket URL, either wss:// or ws://. A
+	// user name and password in the URL are sent using basic auth.
+	StreamURL string `yaml:"stream_url"`
+
+	// StreamURLs are certstream websocket URLs to read all at once, in
+	// place of StreamURL, for when any one server might miss certificates
+	StreamURLs []string `yaml:"stream_urls"`
+
+	// StreamHeaders are extra HTTP headers for the websocket handshake
+	StreamHeaders map[string]string `yaml:"stream_headers"`
+
+	// StreamCAFile is a PEM bundle of CAs to trust for wss:// URLs in place
+	// of the system roots, StreamClientCert and StreamClientKey are a PEM
+	// certificate and key to authenticate to a server requiring mutual TLS,
+	// StreamServerName is the name to send with SNI and check the server's
+	// certificate for in place of the URL's host, and StreamMinTLSVersion
+	// is the oldest TLS version to accept ("1.0" to "1.3")
+	StreamCAFile        string `yaml:"stream_ca_file"`
+	StreamClientCert    string `yaml:"stream_client_cert"`
+	StreamClientKey     string `yaml:"stream_client_key"`
+	StreamServerName    string `yaml:"stream_server_name"`
+	StreamMinTLSVersion string `yaml:"stream_min_tls_version"`
+
+	// StreamMode selects which of certstream's streams to read: "lite" (the
+	// default), "full", which adds the certificates' DER and chains, or
+	// "domains-only", which only has the certificates' domains but uses
+	// far less bandwidth
+	StreamMode string `yaml:"stream_mode"`
+
+	// LogLevel is the minimum logrus level to log (e.g., "debug")
+	LogLevel string `yaml:"log_level"`
+
+	// LogFormat is "text" for human readable logs or "json" for log shippers
+	LogFormat string `yaml:"log_format"`
+
+	// MaxReconnectAttempts is the number of consecutive failed connection
+	// attempts before giving up (zero means retry forever)
+	MaxReconnectAttempts int `yaml:"max_reconnect_attempts"`
+
+	// StreamPingInterval is how often to ping the certstream server (zero
+	// disables pings), and StreamReadTimeout how long to go without a
+	// message or a pong before reconnecting (zero waits forever), so that a
+	// connection silently dropped by a NAT or load balancer doesn't hang
+	// the watcher
+	StreamPingInterval time.Duration `yaml:"stream_ping_interval"`
+	StreamReadTimeout  time.Duration `yaml:"stream_read_timeout"`
+
+	// Proxy is the proxy for outbound HTTP and websocket connections, like
+	// "http://proxy.internal:3128" or "socks5://proxy.internal:1080", except
+	// to the hosts in NoProxy (domains, IP addresses, and CIDR ranges). If
+	// it's empty, HTTPS_PROXY, HTTP_PROXY, and NO_PROXY apply instead.
+	Proxy   string   `yaml:"proxy"`
+	NoProxy []string `yaml:"no_proxy"`
+
+	// Source is where certificates come from: "certstream", "ct" to tail
+	// CT logs directly, "crtsh" to poll crt.sh, "certspotter" to poll Cert
+	// Spotter, or "replay" to read a file
+	Source string `yaml:"source"`
+
+	// Sources are several sources to use at once, in place of Source, like
+	// ["certstream", "ct"]. A certificate more than one of them delivers
+	// is only processed once.
+	Sources []string `yaml:"sources"`
+
+	// RecordPath, if set, is where to record every message from the source,
+	// in gzipped files of JSON lines named after it and the time they were
+	// started. A new file is started every RecordRotate, and only the
+	// newest RecordKeep files are kept (zero keeps them all).
+	RecordPath   string        `yaml:"record_path"`
+	RecordRotate time.Duration `yaml:"record_rotate"`
+	RecordKeep   int           `yaml:"record_keep"`
+
+	// ReplayFile is the file of certstream messages to read in "replay"
+	// mode, one JSON object per line ("-" reads standard input)
+	ReplayFile string `yaml:"replay_file"`
+
+	// CTLogs are the URLs of the logs to tail in "ct" mode. If empty, the
+	// usable logs in CTLogList are tailed.
+	CTLogs    []string `yaml:"ct_logs"`
+	CTLogList string   `yaml:"ct_log_list"`
+
+	// CTPollInterval is how often to poll each log for new entries, and
+	// CTBatchSize is the most entries to request at once
+	CTPollInterval time.Duration `yaml:"ct_poll_interval"`
+	CTBatchSize    int           `yaml:"ct_batch_size"`
+
+	// CTStateFile, if set, is where the position in each log is saved so
+	// that after a restart the watcher catches up on entries it missed
+	CTStateFile string `yaml:"ct_state_file"`
+
+	// CrtshIdentities are what to search crt.sh for in "crtsh" mode, like
+	// "%.example.com", and CrtshPollInterval is how often to search for
+	// each. CrtshURL is crt.sh's URL.
+	CrtshIdentities   []string      `yaml:"crtsh_identities"`
+	CrtshPollInterval time.Duration `yaml:"crtsh_poll_interval"`
+	CrtshURL          string        `yaml:"crtsh_url"`
+
+	// CertspotterDomains are the domains, with their subdomains, to get
+	// issuances for from Cert Spotter in "certspotter" mode, using
+	// CertspotterToken (an SSLMate API key), every CertspotterPollInterval.
+	// CertspotterURL is the issuances API's URL.
+	CertspotterDomains      []string      `yaml:"certspotter_domains"`
+	CertspotterToken        string        `yaml:"certspotter_token"`
+	CertspotterPollInterval time.Duration `yaml:"certspotter_poll_interval"`
+	CertspotterURL          string        `yaml:"certspotter_url"`
+
+	// ListenAddr is the address to serve /metrics, /healthz, and /readyz on
+	// (empty disables the HTTP server)
+	ListenAddr string `yaml:"listen_addr"`
+
+	// ServeAddr is the address the serve command serves certstream's
+	// streams on
+	ServeAddr string `yaml:"serve_addr"`
+
+	// DashboardAddr is the address to serve the web dashboard on (empty
+	// disables it), which requires DashboardUser and DashboardPassword using
+	// basic auth if they're set
+	DashboardAddr     string `yaml:"dashboard_addr"`
+	DashboardUser     string `yaml:"dashboard_user"`
+	DashboardPassword string `yaml:"dashboard_password"`
+
+	// SlackSigningSecret is the Slack app's signing secret, which enables
+	// its interactivity endpoint, /slack/interactions on ListenAddr, for the
+	// buttons of interactive Slack sinks. The domains muted and alerts
+	// acknowledged from Slack are kept in the DBPath database, or only in
+	// memory without one.
+	SlackSigningSecret string `yaml:"slack_signing_secret"`
+
+	// WatchesFile is a JSON file to save the patterns watched for with the
+	// Slack app's slash command in (empty keeps them in memory), and
+	// WatchSinks are the names of the sinks their alerts go to (without
+	// any, watches can't be added)
+	WatchesFile string   `yaml:"watches_file"`
+	WatchSinks  []string `yaml:"watch_sinks"`
+
+	// Reports are summaries of the certificates processed and matches found
+	// posted to Slack on a schedule
+	Reports []*statsReport `yaml:"reports"`
+
+	// DebugAddr is the address to serve Go's pprof profiles and expvar
+	// variables on (empty disables them)
+	DebugAddr string `yaml:"debug_addr"`
+
+	// HealthTimeout is how long /healthz tolerates receiving no messages
+	HealthTimeout time.Duration `yaml:"health_timeout"`
+
+	// OTLPEndpoint is the OpenTelemetry collector to export traces of how
+	// certificates are processed to using OTLP over HTTP, like
+	// "http://localhost:4318" (empty disables tracing), adding OTLPHeaders
+	// to each request. TraceSampleRatio is the fraction of certificates
+	// traced.
+	OTLPEndpoint     string            `yaml:"otlp_endpoint"`
+	OTLPHeaders      map[string]string `yaml:"otlp_headers"`
+	TraceSampleRatio float64           `yaml:"trace_sample_ratio"`
+
+	// Workers is the number of messages processed at once, and QueueSize is
+	// how many more can wait to be processed. When the queue is full,
+	// certstream messages are dropped rather than holding up the websocket.
+	Workers   int `yaml:"workers"`
+	QueueSize int `yaml:"queue_size"`
+
+	// DedupSize is the number of recently alerted certificates to remember
+	// so that each only alerts once (zero disables deduplication)
+	DedupSize int `yaml:"dedup_size"`
+
+	// DedupTTL is how long to remember an alerted certificate
+	DedupTTL time.Duration `yaml:"dedup_ttl"`
+
+	// DedupKey is how certificates are identified for deduplication: by
+	// "serial" (issuer and serial number), "fingerprint", or "sans" (the
+	// normalized set of domains, which renewals share)
+	DedupKey string `yaml:"dedup_key"`
+
+	// Cooldown is how long after a rule alerts on a registrable domain,
+	// like "example.com", to suppress its alerts for that domain, such as
+	// for regular renewals (zero alerts on every certificate). CooldownSize
+	// is the number of domains to remember, and CooldownNotes notes in the
+	// next alert how many certificates were suppressed.
+	Cooldown      time.Duration `yaml:"cooldown"`
+	CooldownSize  int           `yaml:"cooldown_size"`
+	CooldownNotes bool          `yaml:"cooldown_notes"`
+
+	// DBPath is a database file to record every match in (see
+	// matchStore), and the Slack app's suppressions, and DBRetention is how
+	// long to keep the matches (zero keeps them forever)
+	DBPath      string        `yaml:"db_path"`
+	DBRetention time.Duration `yaml:"db_retention"`
+
+	// SlackWebhookURL is shorthand for a Slack sink named "slack"
+	SlackWebhookURL string `yaml:"slack_webhook_url"`
+
+	// Sinks are the destinations alerts are sent to
+	Sinks []*sinkConfig `yaml:"sinks"`
+
+	// Rules map domain patterns to sinks
+	Rules []*rule `yaml:"rules"`
+
+	// Enrichers look up context about each alert before it's sent, in
+	// order, each giving up after EnrichTimeout unless it sets its own
+	Enrichers     []*enricherConfig `yaml:"enrichers"`
+	EnrichTimeout time.Duration     `yaml:"enrich_timeout"`
+
+	// EnrichBreakerFailures is how many times in a row an enricher can
+	// fail before it's skipped for EnrichBreakerCooldown (zero never skips
+	// enrichers)
+	EnrichBreakerFailures int           `yaml:"enrich_breaker_failures"`
+	EnrichBreakerCooldown time.Duration `yaml:"enrich_breaker_cooldown"`
+
+	// EnrichWorkers is the number of alerts enriched and sent at once, and
+	// EnrichQueueSize is how many more can wait. Enriching happens apart
+	// from processing messages so that slow lookups don't fill the message
+	// queue; when the enrichment queue is full, alerts are sent without
+	// enrichment rather than waiting.
+	EnrichWorkers   int `yaml:"enrich_workers"`
+	EnrichQueueSize int `yaml:"enrich_queue_size"`
+
+	// NormalizeDomains lowercases domains and decodes punycode to Unicode
+	// before matching, so patterns can be written in lowercase Unicode
+	NormalizeDomains bool `yaml:"normalize_domains"`
+
+	// MaxDomainsInAlert limits how many matching domains alerts list
+	// (zero lists them all)
+	MaxDomainsInAlert int `yaml:"max_domains_in_alert"`
+
+	// ExcludePattern matches domains that never alert, whatever the rule
+	ExcludePattern string `yaml:"exclude_pattern"`
+
+	// DryRun prints alerts to standard output instead of sending them to
+	// the configured sinks, for trying out rules against live traffic
+	DryRun bool `yaml:"dry_run"`
+
+	// WatchConfig reloads the config when it, the RULES_FILE, or a
+	// keywords file changes, as SIGHUP does
+	WatchConfig bool `yaml:"watch_config"`
+
+	streams      []certstreamEndpoint
+	streamTLS    *tls.Config
+	proxy        *url.URL
+	sources      []string
+	logLevel     logrus.Level
+	logFormatter logrus.Formatter
+	exclude      *regexp.Regexp
+	sinks        []*sink
+	enrichment   *enrich.Pipeline
+
+	// serving is whether the config is for the serve command, which
+	// doesn't need any rules
+	serving bool
+
+	// path is the config file (if any), and previous is the config this one
+	// reloads (if any), whose sinks are reused where they haven't changed
+	path     string
+	previous *config
+}
+
+// sinkConfig configures a single sink. Apart from the name and type, its
+// options depend on the type and are decoded by the sink's factory.
+type sinkConfig struct {
+	Name string
+	Type string
+
+	// MinSeverity is the least severe alert the sink is sent ("info",
+	// "warning", or "critical"), which works with every type of sink
+	MinSeverity string
+
+	// MessageTemplate customizes the sink's messages (see messageData),
+	// which also works with every type of sink
+	MessageTemplate string
+
+	options map[string]interface{}
+
+	// key is where the sink was configured, for error messages
+	key string
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler, keeping any type-specific
+// options to be decoded once the type is known.
+func (s *sinkConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	options := map[string]interface{}{}
+	if err := unmarshal(&options); err != nil {
+		return err
+	}
+	s.Name, _ = options["name"].(string)
+	s.Type, _ = options["type"].(string)
+	s.MinSeverity, _ = options["min_severity"].(string)
+	s.MessageTemplate, _ = options["message_template"].(string)
+	delete(options, "name")
+	delete(options, "type")
+	delete(options, "min_severity")
+	delete(options, "message_template")
+	s.options = options
+	return nil
+}
+
+// decode strictly unmarshals the sink's type-specific options into out.
+func (s *sinkConfig) decode(out interface{}) error {
+	data, err := yaml.Marshal(s.options)
+	if err != nil {
+		return err
+	}
+	return yaml.UnmarshalStrict(data, out)
+}
+
+// loadConfig reads the config file at path (if any), applies environment
+// variable overrides and then override (if not nil, for command line flags),
+// and validates the result. When reloading, previous is the config in use,
+// and any of its sinks configured the same way are reused rather than
+// built again.
+func loadConfig(path string, override func(c *config), previous *config) (*config, error) {
+	c := &config{
+		path:     path,
+		previous: previous,
+
+		StreamURL:  "wss://certstream.calidog.io",
+		StreamMode: "lite",
+		LogLevel:   "info",
+		LogFormat:  "text",
+
+		StreamMinTLSVersion: "1.2",
+
+		StreamPingInterval: 10 * time.Second,
+		StreamReadTimeout:  30 * time.Second,
+
+		HealthTimeout: 5 * time.Minute,
+		ServeAddr:     ":4000",
+
+		TraceSampleRatio: 1,
+
+		Source:         "certstream",
+		CTLogList:      defaultCTLogList,
+		CTPollInterval: 10 * time.Second,
+		CTBatchSize:    256,
+
+		CrtshPollInterval: 5 * time.Minute,
+		CrtshURL:          defaultCrtshURL,
+
+		CertspotterPollInterval: 5 * time.Minute,
+		CertspotterURL:          defaultCertspotterURL,
+
+		RecordRotate: time.Hour,
+
+		Workers:   4,
+		QueueSize: 1000,
+
+		DedupSize: 10000,
+		DedupTTL:  24 * time.Hour,
+		DedupKey:  "serial",
+
+		CooldownSize:  10000,
+		CooldownNotes: true,
+
+		DBRetention: 30 * 24 * time.Hour,
+
+		MaxDomainsInAlert: 10,
+
+		EnrichTimeout:         10 * time.Second,
+		EnrichBreakerFailures: 5,
+		EnrichBreakerCooldown: time.Minute,
+		EnrichWorkers:         4,
+		EnrichQueueSize:       100,
+	}
+
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not read config file")
+		}
+		if err := yaml.UnmarshalStrict(data, c); err != nil {
+			return nil, errors.Wrapf(err, "could not parse %s", path)
+		}
+		for i, s := range c.Sinks {
+			s.key = fmt.Sprintf("%s: sinks[%d]", path, i)
+		}
+		for i, r := range c.Rules {
+			r.key = fmt.Sprintf("%s: rules[%d]", path, i)
+		}
+		for i, e := range c.Enrichers {
+			e.key = fmt.Sprintf("%s: enrichers[%d]", path, i)
+		}
+	}
+
+	if err := c.applyEnv(); err != nil {
+		return nil, err
+	}
+	if override != nil {
+		override(c)
+	}
+	if err := c.resolveSecrets(); err != nil {
+		return nil, err
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// applyEnv overrides settings from environment variables:
+//
+//   - CERTSTREAM_URL overrides stream_url, or with several comma-separated
+//     URLs, stream_urls. CERTSTREAM_HEADERS adds comma-separated
+//     "Name=value" pairs to stream_headers. STREAM_MODE overrides
+//     stream_mode.
+//   - STREAM_CA_FILE, STREAM_CLIENT_CERT, STREAM_CLIENT_KEY,
+//     STREAM_SERVER_NAME, and STREAM_MIN_TLS_VERSION override
+//     stream_ca_file, stream_client_cert, stream_client_key,
+//     stream_server_name, and stream_min_tls_version.
+//   - SOURCE overrides source, or with several comma-separated sources,
+//     sources.
+//   - REPLAY_FILE, CT_LOGS (a comma-separated list), CT_LOG_LIST,
+//     CT_POLL_INTERVAL, and CT_STATE_FILE override replay_file, ct_logs,
+//     ct_log_list, ct_poll_interval, and ct_state_file.
+//   - CRTSH_IDENTITIES (a comma-separated list) and CRTSH_POLL_INTERVAL
+//     override crtsh_identities and crtsh_poll_interval.
+//   - CERTSPOTTER_DOMAINS (a comma-separated list), CERTSPOTTER_TOKEN, and
+//     CERTSPOTTER_POLL_INTERVAL override certspotter_domains,
+//     certspotter_token, and certspotter_poll_interval.
+//   - RECORD_PATH, RECORD_ROTATE, and RECORD_KEEP override record_path,
+//     record_rotate, and record_keep.
+//   - LOG_LEVEL and LOG_FORMAT override log_level and log_format.
+//   - LISTEN_ADDR overrides listen_addr, and SERVE_ADDR serve_addr.
+//   - DASHBOARD_ADDR, DASHBOARD_USER, and DASHBOARD_PASSWORD override
+//     dashboard_addr, dashboard_user, and dashboard_password.
+//   - SLACK_SIGNING_SECRET and WATCHES_FILE override slack_signing_secret
+//     and watches_file, and WATCH_SINKS (a comma-separated list) overrides
+//     watch_sinks.
+//   - REPORT_SCHEDULE adds a report on that schedule to reports.
+//   - DEBUG_ADDR overrides debug_addr.
+//   - HEALTH_TIMEOUT overrides health_timeout.
+//   - OTEL_EXPORTER_OTLP_ENDPOINT overrides otlp_endpoint, and
+//     OTEL_EXPORTER_OTLP_HEADERS adds comma-separated "Name=value" pairs to
+//     otlp_headers, as with the OpenTelemetry SDKs.
+//   - WORKERS and QUEUE_SIZE override workers and queue_size.
+//   - DEDUP_SIZE, DEDUP_TTL, and DEDUP_KEY override dedup_size, dedup_ttl,
+//     and dedup_key.
+//   - COOLDOWN, COOLDOWN_SIZE, and COOLDOWN_NOTES override cooldown,
+//     cooldown_size, and cooldown_notes.
+//   - MAX_RECONNECT_ATTEMPTS overrides max_reconnect_attempts, and
+//     STREAM_PING_INTERVAL and STREAM_READ_TIMEOUT override
+//     stream_ping_interval and stream_read_timeout.
+//   - DB_PATH and DB_RETENTION override db_path and db_retention.
+//   - SLACK_WEBHOOK_URL, DISCORD_WEBHOOK_URL, TEAMS_WEBHOOK_URL, and
+//     GENERIC_WEBHOOK_URL set the URL of the sink named "slack", "discord",
+//     "teams", or "webhook", adding it if needed. GENERIC_WEBHOOK_HEADERS adds
+//     comma-separated "Name=value" pairs to the headers of the "webhook" sink.
+//   - PAGERDUTY_ROUTING_KEY and OPSGENIE_API_KEY set the routing key or API
+//     key of the sink named "pagerduty" or "opsgenie", adding it if needed.
+//   - TELEGRAM_BOT_TOKEN and TELEGRAM_CHAT_ID set the token and chat_id of
+//     the sink named "telegram", adding it if needed.
+//   - SLACK_BLOCKS sets whether the "slack" sink uses Block Kit formatting,
+//     SLACK_DIGEST sets its digest window, SLACK_RATE_LIMIT sets its rate
+//     limit in messages per minute, and SLACK_SAN_LIST, SLACK_TOKEN, and
+//     SLACK_CHANNEL set san_list, token, and channel.
+//   - SINK is a comma-separated list of sink names to use, ignoring others.
+//     The "stdout" sink is added if it's listed.
+//   - DOMAIN_PATTERN and PATTERN_MODE set the pattern and pattern_mode of
+//     the rule named "default", and KEYWORDS (a comma-separated list),
+//     KEYWORDS_FILE, and KEYWORD_MODE set its keywords, keywords_file, and
+//     keyword_mode. LOOKALIKE_DOMAINS (a
+//     comma-separated list) and LOOKALIKE_DISTANCE set its lookalikes and
+//     lookalike_distance, and SEVERITY sets its severity.
+//   - DOMAIN_PATTERN_<NAME> and SLACK_WEBHOOK_URL_<NAME> set the pattern and
+//     Slack webhook URL of the rule named <name>, adding it if needed.
+//   - NORMALIZE_DOMAINS overrides normalize_domains.
+//   - MAX_DOMAINS_IN_ALERT overrides max_domains_in_alert.
+//   - EXCLUDE_PATTERN overrides exclude_pattern.
+//   - DRY_RUN overrides dry_run.
+//   - RULES_FILE names a YAML file containing a list of additional rules.
+//
+// The variables in secretEnvs can instead be read from a file named by the
+// variable with _FILE added.
+func (c *config) applyEnv() error {
+	if err := loadSecretFiles(); err != nil {
+		return err
+	}
+	if v := os.Getenv("CERTSTREAM_URL"); v != "" {
+		if urls := splitList(v); len(urls) > 1 {
+			c.StreamURLs = urls
+		} else {
+			c.StreamURL = v
+			c.StreamURLs = nil
+		}
+	}
+	if v := os.Getenv("STREAM_MODE"); v != "" {
+		c.StreamMode = v
+	}
+	if v := os.Getenv("STREAM_CA_FILE"); v != "" {
+		c.StreamCAFile = v
+	}
+	if v := os.Getenv("STREAM_CLIENT_CERT"); v != "" {
+		c.StreamClientCert = v
+	}
+	if v := os.Getenv("STREAM_CLIENT_KEY"); v != "" {
+		c.StreamClientKey = v
+	}
+	if v := os.Getenv("STREAM_SERVER_NAME"); v != "" {
+		c.StreamServerName = v
+	}
+	if v := os.Getenv("STREAM_MIN_TLS_VERSION"); v != "" {
+		c.StreamMinTLSVersion = v
+	}
+	if v := os.Getenv("CERTSTREAM_HEADERS"); v != "" {
+		headers, err := parseHeaders(v)
+		if err != nil {
+			return errors.Wrap(err, "CERTSTREAM_HEADERS")
+		}
+		if c.StreamHeaders == nil {
+			c.StreamHeaders = map[string]string{}
+		}
+		for name, value := range headers {
+			c.StreamHeaders[name] = value
+		}
+	}
+
+	if v := os.Getenv("SOURCE"); v != "" {
+		if sources := splitList(v); len(sources) > 1 {
+			c.Sources = sources
+		} else {
+			c.Source = v
+			c.Sources = nil
+		}
+	}
+	if v := os.Getenv("RECORD_PATH"); v != "" {
+		c.RecordPath = v
+	}
+	if v := os.Getenv("RECORD_ROTATE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return errors.Wrap(err, "RECORD_ROTATE")
+		}
+		c.RecordRotate = d
+	}
+	if v := os.Getenv("RECORD_KEEP"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return errors.Wrap(err, "RECORD_KEEP")
+		}
+		c.RecordKeep = n
+	}
+	if v := os.Getenv("REPLAY_FILE"); v != "" {
+		c.ReplayFile = v
+	}
+	if v := os.Getenv("CT_LOGS"); v != "" {
+		c.CTLogs = splitList(v)
+	}
+	if v := os.Getenv("CT_LOG_LIST"); v != "" {
+		c.CTLogList = v
+	}
+	if v := os.Getenv("CT_STATE_FILE"); v != "" {
+		c.CTStateFile = v
+	}
+	if v := os.Getenv("CRTSH_IDENTITIES"); v != "" {
+		c.CrtshIdentities = splitList(v)
+	}
+	if v := os.Getenv("CRTSH_POLL_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return errors.Wrap(err, "CRTSH_POLL_INTERVAL")
+		}
+		c.CrtshPollInterval = d
+	}
+	if v := os.Getenv("CERTSPOTTER_DOMAINS"); v != "" {
+		c.CertspotterDomains = splitList(v)
+	}
+	if v := os.Getenv("CERTSPOTTER_TOKEN"); v != "" {
+		c.CertspotterToken = v
+	}
+	if v := os.Getenv("CERTSPOTTER_POLL_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return errors.Wrap(err, "CERTSPOTTER_POLL_INTERVAL")
+		}
+		c.CertspotterPollInterval = d
+	}
+	if v := os.Getenv("CT_POLL_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return errors.Wrap(err, "CT_POLL_INTERVAL")
+		}
+		c.CTPollInterval = d
+	}
+
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		c.LogLevel = v
+	}
+	if v := os.Getenv("LOG_FORMAT"); v != "" {
+		c.LogFormat = v
+	}
+
+	if v := os.Getenv("LISTEN_ADDR"); v != "" {
+		c.ListenAddr = v
+	}
+	if v := os.Getenv("SERVE_ADDR"); v != "" {
+		c.ServeAddr = v
+	}
+	if v := os.Getenv("DASHBOARD_ADDR"); v != "" {
+		c.DashboardAddr = v
+	}
+	if v := os.Getenv("DASHBOARD_USER"); v != "" {
+		c.DashboardUser = v
+	}
+	if v := os.Getenv("DASHBOARD_PASSWORD"); v != "" {
+		c.DashboardPassword = v
+	}
+	if v := os.Getenv("SLACK_SIGNING_SECRET"); v != "" {
+		c.SlackSigningSecret = v
+	}
+	if v := os.Getenv("WATCHES_FILE"); v != "" {
+		c.WatchesFile = v
+	}
+	if v := os.Getenv("WATCH_SINKS"); v != "" {
+		c.WatchSinks = splitList(v)
+	}
+	if v := os.Getenv("REPORT_SCHEDULE"); v != "" {
+		c.Reports = append(c.Reports, &statsReport{Schedule: v})
+	}
+
+	if v := os.Getenv("DEBUG_ADDR"); v != "" {
+		c.DebugAddr = v
+	}
+
+	if v := os.Getenv("HEALTH_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return errors.Wrap(err, "HEALTH_TIMEOUT")
+		}
+		c.HealthTimeout = d
+	}
+
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); v != "" {
+		c.OTLPEndpoint = v
+	}
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"); v != "" {
+		headers, err := parseHeaders(v)
+		if err != nil {
+			return errors.Wrap(err, "OTEL_EXPORTER_OTLP_HEADERS")
+		}
+		if c.OTLPHeaders == nil {
+			c.OTLPHeaders = map[string]string{}
+		}
+		for name, value := range headers {
+			c.OTLPHeaders[name] = value
+		}
+	}
+
+	if v := os.Getenv("WORKERS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return errors.Wrap(err, "WORKERS")
+		}
+		c.Workers = n
+	}
+
+	if v := os.Getenv("QUEUE_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return errors.Wrap(err, "QUEUE_SIZE")
+		}
+		c.QueueSize = n
+	}
+
+	if v := os.Getenv("DB_PATH"); v != "" {
+		c.DBPath = v
+	}
+
+	if v := os.Getenv("DB_RETENTION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return errors.Wrap(err, "DB_RETENTION")
+		}
+		c.DBRetention = d
+	}
+
+	if v := os.Getenv("DEDUP_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return errors.Wrap(err, "DEDUP_SIZE")
+		}
+		c.DedupSize = n
+	}
+
+	if v := os.Getenv("DEDUP_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return errors.Wrap(err, "DEDUP_TTL")
+		}
+		c.DedupTTL = d
+	}
+
+	if v := os.Getenv("DEDUP_KEY"); v != "" {
+		c.DedupKey = v
+	}
+
+	if v := os.Getenv("COOLDOWN"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return errors.Wrap(err, "COOLDOWN")
+		}
+		c.Cooldown = d
+	}
+
+	if v := os.Getenv("COOLDOWN_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return errors.Wrap(err, "COOLDOWN_SIZE")
+		}
+		c.CooldownSize = n
+	}
+
+	if v := os.Getenv("COOLDOWN_NOTES"); v != "" {
+		notes, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.Wrap(err, "COOLDOWN_NOTES")
+		}
+		c.CooldownNotes = notes
+	}
+
+	if v := os.Getenv("MAX_RECONNECT_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return errors.Wrap(err, "MAX_RECONNECT_ATTEMPTS")
+		}
+		c.MaxReconnectAttempts = n
+	}
+	if v := os.Getenv("STREAM_PING_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return errors.Wrap(err, "STREAM_PING_INTERVAL")
+		}
+		c.StreamPingInterval = d
+	}
+	if v := os.Getenv("STREAM_READ_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return errors.Wrap(err, "STREAM_READ_TIMEOUT")
+		}
+		c.StreamReadTimeout = d
+	}
+
+	if v := os.Getenv("SLACK_WEBHOOK_URL"); v != "" {
+		c.SlackWebhookURL = v
+	}
+	if c.SlackWebhookURL != "" {
+		c.sink("slack", "slack", "SLACK_WEBHOOK_URL").options["url"] = c.SlackWebhookURL
+	}
+	if v := os.Getenv("SLACK_BLOCKS"); v != "" {
+		blocks, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.Wrap(err, "SLACK_BLOCKS")
+		}
+		c.sink("slack", "slack", "SLACK_BLOCKS").options["blocks"] = blocks
+	}
+	if v := os.Getenv("SLACK_DIGEST"); v != "" {
+		c.sink("slack", "slack", "SLACK_DIGEST").options["digest"] = v
+	}
+	if v := os.Getenv("SLACK_RATE_LIMIT"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return errors.Wrap(err, "SLACK_RATE_LIMIT")
+		}
+		c.sink("slack", "slack", "SLACK_RATE_LIMIT").options["rate_limit"] = rate
+	}
+	if v := os.Getenv("SLACK_SAN_LIST"); v != "" {
+		c.sink("slack", "slack", "SLACK_SAN_LIST").options["san_list"] = v
+	}
+	if v := os.Getenv("SLACK_TOKEN"); v != "" {
+		c.sink("slack", "slack", "SLACK_TOKEN").options["token"] = v
+	}
+	if v := os.Getenv("SLACK_CHANNEL"); v != "" {
+		c.sink("slack", "slack", "SLACK_CHANNEL").options["channel"] = v
+	}
+	if v := os.Getenv("DISCORD_WEBHOOK_URL"); v != "" {
+		c.sink("discord", "discord", "DISCORD_WEBHOOK_URL").options["url"] = v
+	}
+	if v := os.Getenv("TEAMS_WEBHOOK_URL"); v != "" {
+		c.sink("teams", "teams", "TEAMS_WEBHOOK_URL").options["url"] = v
+	}
+	if v := os.Getenv("PAGERDUTY_ROUTING_KEY"); v != "" {
+		c.sink("pagerduty", "pagerduty", "PAGERDUTY_ROUTING_KEY").options["routing_key"] = v
+	}
+	if v := os.Getenv("OPSGENIE_API_KEY"); v != "" {
+		c.sink("opsgenie", "opsgenie", "OPSGENIE_API_KEY").options["api_key"] = v
+	}
+	if v := os.Getenv("TELEGRAM_BOT_TOKEN"); v != "" {
+		c.sink("telegram", "telegram", "TELEGRAM_BOT_TOKEN").options["token"] = v
+	}
+	if v := os.Getenv("TELEGRAM_CHAT_ID"); v != "" {
+		c.sink("telegram", "telegram", "TELEGRAM_CHAT_ID").options["chat_id"] = v
+	}
+	if v := os.Getenv("GENERIC_WEBHOOK_URL"); v != "" {
+		c.sink("webhook", "webhook", "GENERIC_WEBHOOK_URL").options["url"] = v
+	}
+	if v := os.Getenv("GENERIC_WEBHOOK_HEADERS"); v != "" {
+		s := c.sink("webhook", "webhook", "GENERIC_WEBHOOK_HEADERS")
+		headers, _ := s.options["headers"].(map[interface{}]interface{})
+		if headers == nil {
+			headers = map[interface{}]interface{}{}
+			s.options["headers"] = headers
+		}
+		pairs, err := parseHeaders(v)
+		if err != nil {
+			return errors.Wrap(err, "GENERIC_WEBHOOK_HEADERS")
+		}
+		for name, value := range pairs {
+			headers[name] = value
+		}
+	}
+
+	if v := os.Getenv("SINK"); v != "" {
+		enabled := map[string]bool{}
+		for _, name := range splitList(v) {
+			enabled[name] = true
+		}
+		if enabled["stdout"] {
+			c.sink("stdout", "stdout", "SINK")
+		}
+		sinks := []*sinkConfig{}
+		for _, s := range c.Sinks {
+			if enabled[s.Name] {
+				sinks = append(sinks, s)
+			}
+		}
+		c.Sinks = sinks
+	}
+
+	if v := os.Getenv("DOMAIN_PATTERN"); v != "" {
+		r := c.rule("default", "DOMAIN_PATTERN")
+		r.Pattern = v
+		r.setFromEnv("pattern", "DOMAIN_PATTERN")
+	}
+	if v := os.Getenv("KEYWORDS"); v != "" {
+		r := c.rule("default", "KEYWORDS")
+		r.Keywords = splitList(v)
+		r.setFromEnv("keywords", "KEYWORDS")
+	}
+	if v := os.Getenv("SEVERITY"); v != "" {
+		r := c.rule("default", "SEVERITY")
+		r.Severity = v
+		r.setFromEnv("severity", "SEVERITY")
+	}
+	if v := os.Getenv("KEYWORDS_FILE"); v != "" {
+		r := c.rule("default", "KEYWORDS_FILE")
+		r.KeywordsFile = v
+		r.setFromEnv("keywords_file", "KEYWORDS_FILE")
+	}
+	if v := os.Getenv("LOOKALIKE_DOMAINS"); v != "" {
+		r := c.rule("default", "LOOKALIKE_DOMAINS")
+		r.Lookalikes = splitList(v)
+		r.setFromEnv("lookalikes", "LOOKALIKE_DOMAINS")
+	}
+	if v := os.Getenv("LOOKALIKE_DISTANCE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return errors.Wrap(err, "LOOKALIKE_DISTANCE")
+		}
+		r := c.rule("default", "LOOKALIKE_DISTANCE")
+		r.LookalikeDistance = n
+		r.setFromEnv("lookalike_distance", "LOOKALIKE_DISTANCE")
+	}
+	if v := os.Getenv("PATTERN_MODE"); v != "" {
+		r := c.rule("default", "PATTERN_MODE")
+		r.PatternMode = v
+		r.setFromEnv("pattern_mode", "PATTERN_MODE")
+	}
+	if v := os.Getenv("KEYWORD_MODE"); v != "" {
+		r := c.rule("default", "KEYWORD_MODE")
+		r.KeywordMode = v
+		r.setFromEnv("keyword_mode", "KEYWORD_MODE")
+	}
+
+	suffixes := []string{}
+	for _, kv := range os.Environ() {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 2 && parts[1] != "" && strings.HasPrefix(parts[0], "DOMAIN_PATTERN_") {
+			suffixes = append(suffixes, strings.TrimPrefix(parts[0], "DOMAIN_PATTERN_"))
+		}
+	}
+	// os.Environ() is unordered, so sort for stable logs
+	sort.Strings(suffixes)
+	for _, suffix := range suffixes {
+		r := c.rule(strings.ToLower(suffix), "DOMAIN_PATTERN_"+suffix)
+		r.Pattern = os.Getenv("DOMAIN_PATTERN_" + suffix)
+		r.setFromEnv("pattern", "DOMAIN_PATTERN_"+suffix)
+		if v := os.Getenv("SLACK_WEBHOOK_URL_" + suffix); v != "" {
+			r.WebhookURL = v
+			r.setFromEnv("webhook_url", "SLACK_WEBHOOK_URL_"+suffix)
+		}
+	}
+
+	if v := os.Getenv("NORMALIZE_DOMAINS"); v != "" {
+		normalize, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.Wrap(err, "NORMALIZE_DOMAINS")
+		}
+		c.NormalizeDomains = normalize
+	}
+	if v := os.Getenv("DRY_RUN"); v != "" {
+		dryRun, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.Wrap(err, "DRY_RUN")
+		}
+		c.DryRun = dryRun
+	}
+	if v := os.Getenv("MAX_DOMAINS_IN_ALERT"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return errors.Wrap(err, "MAX_DOMAINS_IN_ALERT")
+		}
+		c.MaxDomainsInAlert = n
+	}
+	if v := os.Getenv("EXCLUDE_PATTERN"); v != "" {
+		c.ExcludePattern = v
+	}
+
+	if path := os.Getenv("RULES_FILE"); path != "" {
+		fileRules, err := readRulesFile(path)
+		if err != nil {
+			return err
+		}
+		c.Rules = append(c.Rules, fileRules...)
+	}
+	return nil
+}
+
+// sink returns the sink with the given name, adding one of the given type if
+// needed. The key describes where a new sink was configured.
+func (c *config) sink(name, typ, key string) *sinkConfig {
+	for _, s := range c.Sinks {
+		if s.Name == name {
+			return s
+		}
+	}
+	s := &sinkConfig{Name: name, Type: typ, options: map[string]interface{}{}, key: key}
+	c.Sinks = append(c.Sinks, s)
+	return s
+}
+
+// rule returns the rule with the given name, adding an empty one if needed.
+// The key describes where a new rule was configured.
+func (c *config) rule(name, key string) *rule {
+	for _, r := range c.Rules {
+		if r.Name == name {
+			return r
+		}
+	}
+	r := &rule{Name: name, key: key}
+	c.Rules = append(c.Rules, r)
+	return r
+}
+
+// streamPaths are the paths of certstream's streams, by stream mode.
+var streamPaths = map[string]string{
+	"lite":         "",
+	"full":         "/full-stream",
+	"domains-only": "/domains-only",
+}
+
+// streamPath returns the path of the stream to read in mode, relative to
+// the path of the stream URL, which may already name it.
+func streamPath(path, mode string) (string, error) {
+	suffix, ok := streamPaths[mode]
+	if !ok {
+		return "", errors.Errorf("stream_mode: must be \"lite\", \"full\", or \"domains-only\", not %q", mode)
+	}
+	base := path
+	for _, p := range streamPaths {
+		if p != "" && strings.HasSuffix(base, p) {
+			base = strings.TrimSuffix(base, p)
+		}
+	}
+	if suffix == "" {
+		if base == path {
+			return path, nil
+		}
+		return base + "/", nil
+	}
+	return strings.TrimSuffix(base, "/") + suffix, nil
+}
+
+// parseHeaders parses comma-separated "Name=value" pairs.
+func parseHeaders(s string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, errors.Errorf("invalid header %q (expected Name=value)", pair)
+		}
+		headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return headers, nil
+}
+
+// splitList splits a comma-separated list, trimming spaces and dropping
+// empty items.
+func splitList(s string) []string {
+	items := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// validate checks the config, builds sinks, and compiles rule patterns.
+// Errors are prefixed with the key of the offending setting.
+func (c *config) validate() error {
+	urls, key := c.StreamURLs, "stream_urls"
+	if len(urls) == 0 {
+		urls, key = []string{c.StreamURL}, "stream_url"
+	}
+	var err error
+	if c.streamTLS, err = c.streamTLSConfig(); err != nil {
+		return err
+	}
+	c.streams = nil
+	for i, raw := range urls {
+		settingKey := key
+		if key == "stream_urls" {
+			settingKey = fmt.Sprintf("%s[%d]", key, i)
+		}
+		endpoint, err := c.certstreamEndpoint(settingKey, raw)
+		if err != nil {
+			return err
+		}
+		c.streams = append(c.streams, endpoint)
+	}
+
+	if c.StreamPingInterval < 0 {
+		return errors.New("stream_ping_interval: must not be negative")
+	}
+	if c.StreamReadTimeout < 0 {
+		return errors.New("stream_read_timeout: must not be negative")
+	}
+	if c.StreamReadTimeout > 0 && c.StreamPingInterval > 0 && c.StreamReadTimeout <= c.StreamPingInterval {
+		return errors.New("stream_read_timeout: must be longer than stream_ping_interval")
+	}
+
+	c.proxy = nil
+	if c.Proxy != "" {
+		u, err := url.Parse(c.Proxy)
+		if err != nil || u.Host == "" {
+			return errors.Errorf("proxy: must be a URL like http://proxy.internal:3128, not %q", c.Proxy)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return errors.Errorf("proxy: scheme must be \"http\", \"https\", or \"socks5\", not %q", u.Scheme)
+		}
+		c.proxy = u
+	}
+
+	c.sources = c.Sources
+	if len(c.sources) == 0 {
+		c.sources = []string{c.Source}
+	}
+	listed := map[string]bool{}
+	for _, source := range c.sources {
+		if listed[source] {
+			return errors.Errorf("sources: %q is listed twice (set stream_urls to read several certstream servers)", source)
+		}
+		listed[source] = true
+		if source == "replay" && len(c.sources) > 1 {
+			return errors.New("sources: replay can't be used with other sources")
+		}
+		if err := c.validateSource(source); err != nil {
+			return err
+		}
+	}
+
+	if c.RecordPath != "" {
+		if c.RecordRotate <= 0 {
+			return errors.New("record_rotate: must be positive")
+		}
+		if c.RecordKeep < 0 {
+			return errors.New("record_keep: must not be negative")
+		}
+	}
+
+	level, err := logrus.ParseLevel(c.LogLevel)
+	if err != nil {
+		return errors.Wrap(err, "log_level")
+	}
+	c.logLevel = level
+
+	switch c.LogFormat {
+	case "text":
+		c.logFormatter = &logrus.TextFormatter{}
+	case "json":
+		c.logFormatter = &logrus.JSONFormatter{}
+	default:
+		return errors.Errorf("log_format: must be \"text\" or \"json\", not %q", c.LogFormat)
+	}
+
+	if (c.DashboardUser == "") != (c.DashboardPassword == "") {
+		return errors.New("dashboard_password: dashboard_user and dashboard_password must be set together")
+	}
+
+	if c.HealthTimeout <= 0 {
+		return errors.New("health_timeout: must be positive")
+	}
+
+	if c.OTLPEndpoint != "" {
+		u, err := url.Parse(c.OTLPEndpoint)
+		if err != nil {
+			return errors.Wrap(err, "otlp_endpoint")
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return errors.Errorf("otlp_endpoint: must be an http or https URL, not %q", c.OTLPEndpoint)
+		}
+	}
+	if c.TraceSampleRatio <= 0 || c.TraceSampleRatio > 1 {
+		return errors.New("trace_sample_ratio: must be more than 0 and at most 1")
+	}
+
+	if c.Workers < 1 {
+		return errors.New("workers: must be at least 1")
+	}
+	if c.QueueSize < 0 {
+		return errors.New("queue_size: must not be negative")
+	}
+
+	if c.DedupSize < 0 {
+		return errors.New("dedup_size: must not be negative")
+	}
+	if c.DedupSize > 0 && c.DedupTTL <= 0 {
+		return errors.New("dedup_ttl: must be positive")
+	}
+	if c.Cooldown < 0 {
+		return errors.New("cooldown: must not be negative")
+	}
+	if c.CooldownSize < 1 {
+		return errors.New("cooldown_size: must be at least 1")
+	}
+	if c.DBRetention < 0 {
+		return errors.New("db_retention: must not be negative")
+	}
+
+	switch c.DedupKey {
+	case "serial", "fingerprint", "sans":
+	default:
+		return errors.Errorf("dedup_key: must be \"serial\", \"fingerprint\", or \"sans\", not %q", c.DedupKey)
+	}
+
+	if c.MaxDomainsInAlert < 0 {
+		return errors.New("max_domains_in_alert: must not be negative")
+	}
+
+	if c.MaxReconnectAttempts < 0 {
+		return errors.New("max_reconnect_attempts: must not be negative")
+	}
+
+	if c.DryRun {
+		// send everything to a stdout sink, ignoring the configured ones
+		c.Sinks = []*sinkConfig{{Name: "stdout", Type: "stdout", options: map[string]interface{}{}, key: "dry_run"}}
+		for _, r := range c.Rules {
+			r.Sinks = nil
+			r.WebhookURL = ""
+		}
+	}
+
+	sinksByName := map[string]*sink{}
+	for _, sc := range c.Sinks {
+		if sc.Name == "" {
+			sc.Name = sc.Type
+		}
+		if sinksByName[sc.Name] != nil {
+			return errors.Errorf("%s.name: duplicate sink name %q", sc.key, sc.Name)
+		}
+		s := c.previousSink(sc)
+		if s == nil {
+			var err error
+			if s, err = newSink(sc); err != nil {
+				return err
+			}
+		}
+		if ss, ok := s.notifier.(*slackSink); ok && ss.Interactive && (c.SlackSigningSecret == "" || c.ListenAddr == "") {
+			return errors.Errorf("%s.interactive: requires slack_signing_secret and listen_addr", sc.key)
+		}
+		sinksByName[s.name] = s
+		c.sinks = append(c.sinks, s)
+	}
+	for i, name := range c.WatchSinks {
+		if sinksByName[name] == nil && !c.DryRun {
+			return errors.Errorf("watch_sinks[%d]: unknown sink %q", i, name)
+		}
+	}
+	for i, r := range c.Reports {
+		if err := r.compile(c.sinks, c.DryRun); err != nil {
+			return errors.Wrapf(err, "reports[%d]", i)
+		}
+	}
+
+	if c.EnrichTimeout <= 0 {
+		return errors.New("enrich_timeout: must be positive")
+	}
+	if c.EnrichBreakerFailures < 0 {
+		return errors.New("enrich_breaker_failures: must not be negative")
+	}
+	if c.EnrichBreakerFailures > 0 && c.EnrichBreakerCooldown <= 0 {
+		return errors.New("enrich_breaker_cooldown: must be positive")
+	}
+	if c.EnrichWorkers < 1 {
+		return errors.New("enrich_workers: must be at least 1")
+	}
+	if c.EnrichQueueSize < 0 {
+		return errors.New("enrich_queue_size: must not be negative")
+	}
+	enrichers := []enrich.Enricher{}
+	for _, ec := range c.Enrichers {
+		e, err := newEnricher(ec)
+		if err != nil {
+			return err
+		}
+		enrichers = append(enrichers, e)
+	}
+	if c.enrichment, err = newEnrichPipeline(c, enrichers); err != nil {
+		return err
+	}
+
+	if c.ExcludePattern != "" {
+		exclude, err := regexp.Compile(c.ExcludePattern)
+		if err != nil {
+			return errors.Wrap(err, "exclude_pattern")
+		}
+		c.exclude = exclude
+	}
+
+	if len(c.Rules) == 0 && !c.serving {
+		return errors.New("rules: no rules configured (set DOMAIN_PATTERN, KEYWORDS, LOOKALIKE_DOMAINS, DOMAIN_PATTERN_<NAME>, RULES_FILE, or rules in the config file)")
+	}
+	seen := map[string]bool{}
+	for _, r := range c.Rules {
+		if r.Name == "" {
+			return errors.Errorf("%s.name: must be set", r.key)
+		}
+		if seen[r.Name] {
+			return errors.Errorf("%s.name: duplicate rule name %q", r.key, r.Name)
+		}
+		seen[r.Name] = true
+		if err := r.compile(sinksByName, c.sinks); err != nil {
+			return err
+		}
+		if r.cooldown == 0 {
+			r.cooldown = c.Cooldown
+		}
+		if c.hasSource("certstream") && c.StreamMode == "domains-only" && (r.hasConditions() || len(r.CAADomains) > 0) {
+			log.WithField("rule", r.Name).Warn("the domains-only stream only has certificates' domains, so this rule's other conditions can't match")
+		}
+	}
+	return nil
+}
+
+// certstreamEndpoint parses a certstream websocket URL, with the path of
+// the stream mode's stream, and the headers to connect with.
+func (c *config) certstreamEndpoint(key, raw string) (certstreamEndpoint, error) {
+	if raw == "" {
+		return certstreamEndpoint{}, errors.Errorf("%s: must be set", key)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return certstreamEndpoint{}, errors.Wrap(err, key)
+	}
+	if u.Scheme != "wss" && u.Scheme != "ws" {
+		return certstreamEndpoint{}, errors.Errorf("%s: scheme must be \"wss\" or \"ws\", not %q", key, u.Scheme)
+	}
+	if u.Host == "" {
+		return certstreamEndpoint{}, errors.Errorf("%s: must include a host", key)
+	}
+	if u.Path, err = streamPath(u.Path, c.StreamMode); err != nil {
+		return certstreamEndpoint{}, err
+	}
+	header := http.Header{}
+	for name, value := range c.StreamHeaders {
+		header.Set(name, value)
+	}
+	// websocket URLs can't carry credentials, so send them as a header
+	if u.User != nil {
+		password, _ := u.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + password))
+		header.Set("Authorization", "Basic "+credentials)
+		u.User = nil
+	}
+	return certstreamEndpoint{url: u.String(), header: header}, nil
+}
+
+// tlsVersions are the TLS versions stream_min_tls_version accepts.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// streamTLSConfig returns the TLS config for wss:// stream URLs.
+func (c *config) streamTLSConfig() (*tls.Config, error) {
+	config, err := newTLSConfig(c.StreamCAFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "stream_ca_file")
+	}
+	version, ok := tlsVersions[c.StreamMinTLSVersion]
+	if !ok {
+		return nil, errors.Errorf("stream_min_tls_version: must be \"1.0\", \"1.1\", \"1.2\", or \"1.3\", not %q", c.StreamMinTLSVersion)
+	}
+	config.MinVersion = version
+	config.ServerName = c.StreamServerName
+	if (c.StreamClientCert == "") != (c.StreamClientKey == "") {
+		return nil, errors.New("stream_client_cert: must be set along with stream_client_key")
+	}
+	if c.StreamClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(c.StreamClientCert, c.StreamClientKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "stream_client_cert")
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// validateSource checks the settings of a source.
+func (c *config) validateSource(source string) error {
+	switch source {
+	case "certstream":
+	case "ct":
+		if len(c.CTLogs) == 0 && c.CTLogList == "" {
+			return errors.New("ct_logs: must be set unless ct_log_list is")
+		}
+		if c.CTPollInterval <= 0 {
+			return errors.New("ct_poll_interval: must be positive")
+		}
+		if c.CTBatchSize <= 0 {
+			return errors.New("ct_batch_size: must be positive")
+		}
+	case "crtsh":
+		if len(c.CrtshIdentities) == 0 {
+			return errors.New("crtsh_identities: must be set")
+		}
+		if c.CrtshPollInterval < time.Minute {
+			return errors.New("crtsh_poll_interval: must be at least 1m")
+		}
+		u, err := url.Parse(c.CrtshURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return errors.Errorf("crtsh_url: must be an http:// or https:// URL, not %q", c.CrtshURL)
+		}
+	case "certspotter":
+		if len(c.CertspotterDomains) == 0 {
+			return errors.New("certspotter_domains: must be set")
+		}
+		if c.CertspotterPollInterval < time.Minute {
+			return errors.New("certspotter_poll_interval: must be at least 1m")
+		}
+		u, err := url.Parse(c.CertspotterURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return errors.Errorf("certspotter_url: must be an http:// or https:// URL, not %q", c.CertspotterURL)
+		}
+	case "replay":
+		if c.ReplayFile == "" {
+			return errors.New("replay_file: must be set")
+		}
+	default:
+		return errors.Errorf("source: must be \"certstream\", \"ct\", \"crtsh\", \"certspotter\", or \"replay\", not %q", source)
+	}
+	return nil
+}
+
+// hasSource reports whether source is one of the sources in use.
+func (c *config) hasSource(source string) bool {
+	for _, s := range c.sources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+// previousSink returns the sink of the previous config with exactly the same
+// configuration as sc, if there is one.
+func (c *config) previousSink(sc *sinkConfig) *sink {
+	if c.previous == nil {
+		return nil
+	}
+	for i, old := range c.previous.Sinks {
+		if old.Name == sc.Name && old.Type == sc.Type && old.MinSeverity == sc.MinSeverity &&
+			old.MessageTemplate == sc.MessageTemplate && reflect.DeepEqual(old.options, sc.options) {
+			return c.previous.sinks[i]
+		}
+	}
+	return nil
+}
+
+// files returns the files the config was loaded from, to watch for changes.
+func (c *config) files() []string {
+	files := []string{}
+	if c.path != "" {
+		files = append(files, c.path)
+	}
+	if path := os.Getenv("RULES_FILE"); path != "" {
+		files = append(files, path)
+	}
+	for _, r := range c.Rules {
+		if r.KeywordsFile != "" {
+			files = append(files, r.KeywordsFile)
+		}
+		if r.OPABundle != "" {
+			files = append(files, r.OPABundle)
+		}
+	}
+	return files
+}
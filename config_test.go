@@ -0,0 +1,58 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// testConfig loads a config with a rule and the settings in yaml.
+func testConfig(t *testing.T, yaml string) (*config, error) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "dry_run: true\nrules:\n- name: example\n  pattern: example\n" + yaml
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return loadConfig(path, nil, nil)
+}
+
+func TestStreamTimeouts(t *testing.T) {
+	tests := []struct {
+		ping, read string
+		err        string
+	}{
+		{ping: "10s", read: "30s"},
+		{ping: "10s", read: "0s"},
+		{ping: "0s", read: "5s"},
+		{ping: "0s", read: "0s"},
+		{ping: "10s", read: "10s", err: "stream_read_timeout: must be longer than stream_ping_interval"},
+		{ping: "10s", read: "5s", err: "stream_read_timeout: must be longer than stream_ping_interval"},
+		{ping: "10s", read: "-1s", err: "stream_read_timeout: must not be negative"},
+		{ping: "-1s", read: "30s", err: "stream_ping_interval: must not be negative"},
+	}
+	for _, test := range tests {
+		_, err := testConfig(t, fmt.Sprintf("stream_ping_interval: %s\nstream_read_timeout: %s\n", test.ping, test.read))
+		if test.err == "" && err != nil {
+			t.Errorf("ping interval %s, read timeout %s: %v", test.ping, test.read, err)
+		}
+		if test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("ping interval %s, read timeout %s: error %v, want %q", test.ping, test.read, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize/english"
+
+	"github.com/heptiolabs/certstream-slack/pkg/match"
+)
+
+// cooldownCache remembers when each rule last alerted on each registrable
+// domain, so a domain that keeps getting new certificates, like with
+// regular renewals, only alerts once per cooldown. It holds at most size
+// domains, evicting the least recently alerted first.
+type cooldownCache struct {
+	size int
+
+	mu    sync.Mutex
+	order *list.List // of *cooldownEntry, most recently alerted at the front
+	keys  map[string]*list.Element
+}
+
+type cooldownEntry struct {
+	key string
+
+	// alerted is when the domain last alerted, and until is when its
+	// cooldown ends
+	alerted time.Time
+	until   time.Time
+
+	// repeats counts the certificates suppressed since it last alerted
+	repeats int
+}
+
+// cooldownRepeat describes the certificates for a registrable domain that
+// were suppressed since it last alerted.
+type cooldownRepeat struct {
+	count int
+	since time.Time
+}
+
+func newCooldownCache(size int) *cooldownCache {
+	return &cooldownCache{
+		size:  size,
+		order: list.New(),
+		keys:  map[string]*list.Element{},
+	}
+}
+
+// check reports whether every one of a rule's matching registrable domains
+// is cooling down, counting the certificate as a repeat for them if so.
+// Otherwise it starts their cooldowns over and returns the repeats that
+// were suppressed since each last alerted, keyed by registrable domain.
+func (c *cooldownCache) check(rule string, registrables []string, cooldown time.Duration) (bool, map[string]cooldownRepeat) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	cooling := true
+	for _, registrable := range registrables {
+		elem, ok := c.keys[rule+labelSep+registrable]
+		cooling = cooling && ok && now.Before(elem.Value.(*cooldownEntry).until)
+	}
+	if cooling {
+		for _, registrable := range registrables {
+			c.keys[rule+labelSep+registrable].Value.(*cooldownEntry).repeats++
+		}
+		return true, nil
+	}
+
+	repeats := map[string]cooldownRepeat{}
+	for _, registrable := range registrables {
+		key := rule + labelSep + registrable
+		if elem, ok := c.keys[key]; ok {
+			entry := elem.Value.(*cooldownEntry)
+			if entry.repeats > 0 {
+				repeats[registrable] = cooldownRepeat{count: entry.repeats, since: entry.alerted}
+			}
+			entry.alerted, entry.until, entry.repeats = now, now.Add(cooldown), 0
+			c.order.MoveToFront(elem)
+			continue
+		}
+		c.keys[key] = c.order.PushFront(&cooldownEntry{key: key, alerted: now, until: now.Add(cooldown)})
+	}
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.keys, oldest.Value.(*cooldownEntry).key)
+	}
+	return false, repeats
+}
+
+// registrableDomains returns the distinct registrable domains of domains,
+// like "example.com" for "login.example.com", in order, using the domain
+// itself when it has none (like an IP address).
+func registrableDomains(domains []string) []string {
+	seen := map[string]bool{}
+	registrables := []string{}
+	for _, domain := range domains {
+		registrable := strings.ToLower(domain)
+		if net.ParseIP(registrable) == nil {
+			if r := match.RegistrableDomain(registrable); r != "" {
+				registrable = r
+			}
+		}
+		if !seen[registrable] {
+			seen[registrable] = true
+			registrables = append(registrables, registrable)
+		}
+	}
+	return registrables
+}
+
+// noteRepeats notes, on the first of an alert's domains under each
+// registrable domain with repeats, how many certificates for it were
+// suppressed during its cooldown, like "seen 3 more times since Oct 7
+// 09:15 UTC".
+func noteRepeats(a *alert, repeats map[string]cooldownRepeat) {
+	reasons := map[string]string{}
+	for domain, reason := range a.Reasons {
+		reasons[domain] = reason
+	}
+	for _, domain := range a.Domains {
+		registrable := registrableDomains([]string{domain})[0]
+		repeat, ok := repeats[registrable]
+		if !ok {
+			continue
+		}
+		delete(repeats, registrable)
+		note := fmt.Sprintf("seen %s since %s", english.Plural(repeat.count, "more time", "more times"), repeat.since.UTC().Format("Jan 2 15:04 MST"))
+		if reason := reasons[domain]; reason != "" {
+			note = reason + ", " + note
+		}
+		reasons[domain] = note
+	}
+	a.Reasons = reasons
+}
@@ -0,0 +1,255 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// cronSchedule is when something happens, parsed from a cron expression:
+// the minutes, hours, days of the month, months, and days of the week it
+// happens in.
+type cronSchedule struct {
+	minutes, hours, days, months, weekdays map[int]bool
+
+	// anyDay and anyWeekday are whether the day of the month and day of the
+	// week are "*", since like cron, when both are restricted, either
+	// matching is enough
+	anyDay, anyWeekday bool
+}
+
+// cronMacros are the shorthands cron expressions can be given by.
+var cronMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// cronMonths are the names months can be given by.
+var cronMonths = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+// parseCron parses a cron expression with five fields, like "0 9 * * mon"
+// (minute, hour, day of month, month, and day of week), or a shorthand like
+// "@daily". Fields can be lists, ranges, and steps, like "1,15", "mon-fri",
+// and "*/15", and months and days of the week can be given by name.
+func parseCron(expr string) (*cronSchedule, error) {
+	if macro, ok := cronMacros[strings.ToLower(strings.TrimSpace(expr))]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, errors.Errorf("%q must have five fields (minute, hour, day of month, month, and day of week) or be @hourly, @daily, @weekly, or @monthly", expr)
+	}
+	weekdayNames := map[string]int{}
+	for name, day := range weekdays {
+		weekdayNames[name] = int(day)
+	}
+
+	c := &cronSchedule{anyDay: fields[2] == "*", anyWeekday: fields[4] == "*"}
+	var err error
+	if c.minutes, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, errors.Wrap(err, "minute")
+	}
+	if c.hours, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, errors.Wrap(err, "hour")
+	}
+	if c.days, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, errors.Wrap(err, "day of month")
+	}
+	if c.months, err = parseCronField(fields[3], 1, 12, cronMonths); err != nil {
+		return nil, errors.Wrap(err, "month")
+	}
+	// Sunday is 0, or 7 as in some crons
+	if c.weekdays, err = parseCronField(fields[4], 0, 7, weekdayNames); err != nil {
+		return nil, errors.Wrap(err, "day of week")
+	}
+	if c.weekdays[7] {
+		c.weekdays[0] = true
+	}
+	return c, nil
+}
+
+// parseCronField parses one field of a cron expression, a comma-separated
+// list of values, ranges, or "*", each optionally with a step, between min
+// and max. Values can also be given by names.
+func parseCronField(field string, min, max int, names map[string]int) (map[int]bool, error) {
+	value := func(s string) (int, error) {
+		if n, ok := names[strings.ToLower(s)]; ok {
+			return n, nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < min || n > max {
+			if names != nil {
+				return 0, errors.Errorf("%q must be from %d to %d, or a name", s, min, max)
+			}
+			return 0, errors.Errorf("%q must be from %d to %d", s, min, max)
+		}
+		return n, nil
+	}
+	values := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return nil, errors.Errorf("step %q must be a positive number", part[i+1:])
+			}
+			part, step = part[:i], n
+		}
+		from, to := min, max
+		if part != "*" {
+			var err error
+			bounds := strings.SplitN(part, "-", 2)
+			if from, err = value(bounds[0]); err != nil {
+				return nil, err
+			}
+			to = from
+			if len(bounds) == 2 {
+				if to, err = value(bounds[1]); err != nil {
+					return nil, err
+				}
+			} else if step > 1 {
+				// like "5/15", for every 15 from 5
+				to = max
+			}
+			if to < from {
+				return nil, errors.Errorf("range %q is backwards", part)
+			}
+		}
+		for n := from; n <= to; n += step {
+			values[n] = true
+		}
+	}
+	return values, nil
+}
+
+// next returns the first time after t that the schedule matches, in t's
+// location, or the zero time if there isn't one in the next few years (like
+// for February 31st). Like cron, a schedule for particular hours matches
+// times the clocks skip when they go forward as soon as they have, and
+// times they repeat when they go back only once, while a schedule for
+// every hour goes by the time that's passed.
+func (c *cronSchedule) next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for limit := t.AddDate(5, 0, 0); t.Before(limit); {
+		var next time.Time
+		switch {
+		case !c.months[int(t.Month())]:
+			next = cronDate(t.Year(), t.Month()+1, 1, 0, loc)
+		case !c.day(t):
+			next = cronDate(t.Year(), t.Month(), t.Day()+1, 0, loc)
+		case !c.hours[t.Hour()]:
+			next = cronDate(t.Year(), t.Month(), t.Day(), t.Hour()+1, loc)
+		case !c.minutes[t.Minute()] || c.repeated(t):
+			next = t.Truncate(time.Minute).Add(time.Minute)
+		default:
+			return t
+		}
+		if forward, ok := c.skipped(t, next); ok {
+			return forward
+		}
+		t = next
+	}
+	return time.Time{}
+}
+
+// cronDate is the start of the hour in loc, or if the clocks skipped it
+// going forward, as long after they did as it would have been after the
+// hour (where time.Date would give a time before).
+func cronDate(year int, month time.Month, day, hour int, loc *time.Location) time.Time {
+	t := time.Date(year, month, day, hour, 0, 0, 0, loc)
+	wall := time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+	if t.Day() == wall.Day() && t.Hour() == wall.Hour() {
+		return t
+	}
+	_, offset := t.Zone()
+	return wall.Add(-time.Duration(offset) * time.Second).In(loc)
+}
+
+// repeated reports whether the clocks went back shortly before t, so that
+// it's the second time today the clocks have shown t's time, for schedules
+// for particular hours.
+func (c *cronSchedule) repeated(t time.Time) bool {
+	if len(c.hours) == 24 {
+		return false
+	}
+	_, now := t.Zone()
+	_, before := t.Add(-3 * time.Hour).Zone()
+	if before <= now {
+		return false
+	}
+	earlier := t.Add(-time.Duration(before-now) * time.Second)
+	return earlier.Day() == t.Day() && earlier.Hour() == t.Hour() && earlier.Minute() == t.Minute()
+}
+
+// skipped returns when the clocks went forward, if they did between from
+// and to and skipped a time the schedule matches, for schedules for
+// particular hours.
+func (c *cronSchedule) skipped(from, to time.Time) (time.Time, bool) {
+	if len(c.hours) == 24 {
+		return time.Time{}, false
+	}
+	_, before := from.Zone()
+	_, after := to.Zone()
+	if after <= before {
+		return time.Time{}, false
+	}
+	// find the minute the clocks went forward in
+	lo, hi := 0, int(to.Sub(from)/time.Minute)
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		if _, offset := from.Add(time.Duration(mid) * time.Minute).Zone(); offset == before {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	forward := from.Add(time.Duration(hi) * time.Minute)
+
+	// check the times the clocks never showed, as if they were UTC
+	gap := forward.In(time.FixedZone("", before))
+	gap = time.Date(gap.Year(), gap.Month(), gap.Day(), gap.Hour(), gap.Minute(), 0, 0, time.UTC)
+	for end := gap.Add(time.Duration(after-before) * time.Second); gap.Before(end); gap = gap.Add(time.Minute) {
+		if c.months[int(gap.Month())] && c.day(gap) && c.hours[gap.Hour()] && c.minutes[gap.Minute()] {
+			return forward, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// day reports whether the schedule matches t's day.
+func (c *cronSchedule) day(t time.Time) bool {
+	day, weekday := c.days[t.Day()], c.weekdays[int(t.Weekday())]
+	switch {
+	case c.anyDay && c.anyWeekday:
+		return true
+	case c.anyDay:
+		return weekday
+	case c.anyWeekday:
+		return day
+	}
+	return day || weekday
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+	// the DST tests need time zones wherever they run
+	_ "time/tzdata"
+)
+
+// numbers are the numbers from and to, inclusive.
+func numbers(from, to int) []int {
+	n := []int{}
+	for i := from; i <= to; i++ {
+		n = append(n, i)
+	}
+	return n
+}
+
+func numberSet(n []int) map[int]bool {
+	s := map[int]bool{}
+	for _, i := range n {
+		s[i] = true
+	}
+	return s
+}
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr                                   string
+		minutes, hours, days, months, weekdays []int
+		err                                    string
+	}{
+		{
+			expr:    "0 9 * * mon",
+			minutes: []int{0}, hours: []int{9}, days: numbers(1, 31), months: numbers(1, 12), weekdays: []int{1},
+		},
+		{
+			expr:    "*/15 0-6/2 1,15 jan-MAR sun,7",
+			minutes: []int{0, 15, 30, 45}, hours: []int{0, 2, 4, 6}, days: []int{1, 15}, months: []int{1, 2, 3}, weekdays: []int{0, 7},
+		},
+		{
+			expr:    "5/20 23 31 12 1-5",
+			minutes: []int{5, 25, 45}, hours: []int{23}, days: []int{31}, months: []int{12}, weekdays: numbers(1, 5),
+		},
+		{
+			expr:    " @HOURLY ",
+			minutes: []int{0}, hours: numbers(0, 23), days: numbers(1, 31), months: numbers(1, 12), weekdays: numbers(0, 7),
+		},
+		{
+			expr:    "@weekly",
+			minutes: []int{0}, hours: []int{0}, days: numbers(1, 31), months: numbers(1, 12), weekdays: []int{0},
+		},
+		{expr: "* * * *", err: `"* * * *" must have five fields (minute, hour, day of month, month, and day of week) or be @hourly, @daily, @weekly, or @monthly`},
+		{expr: "@yearly", err: `"@yearly" must have five fields (minute, hour, day of month, month, and day of week) or be @hourly, @daily, @weekly, or @monthly`},
+		{expr: "60 * * * *", err: `minute: "60" must be from 0 to 59`},
+		{expr: "* 24 * * *", err: `hour: "24" must be from 0 to 23`},
+		{expr: "* * 0 * *", err: `day of month: "0" must be from 1 to 31`},
+		{expr: "* * * foo *", err: `month: "foo" must be from 1 to 12, or a name`},
+		{expr: "* * * * 8", err: `day of week: "8" must be from 0 to 7, or a name`},
+		{expr: "*/0 * * * *", err: `minute: step "0" must be a positive number`},
+		{expr: "* 5-2 * * *", err: `hour: range "5-2" is backwards`},
+	}
+	for _, test := range tests {
+		c, err := parseCron(test.expr)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("parseCron(%q) returned error %v, want %q", test.expr, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseCron(%q) returned error %v", test.expr, err)
+			continue
+		}
+		for _, field := range []struct {
+			name      string
+			got, want map[int]bool
+		}{
+			{"minutes", c.minutes, numberSet(test.minutes)},
+			{"hours", c.hours, numberSet(test.hours)},
+			{"days", c.days, numberSet(test.days)},
+			{"months", c.months, numberSet(test.months)},
+			{"weekdays", c.weekdays, numberSet(test.weekdays)},
+		} {
+			if !reflect.DeepEqual(field.got, field.want) {
+				t.Errorf("parseCron(%q) %s = %v, want %v", test.expr, field.name, field.got, field.want)
+			}
+		}
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     string
+		zone     string
+		from     string
+		want     string // empty for the zero time
+		interval time.Duration
+	}{
+		{name: "strictly after", expr: "0 9 * * mon", from: "2024-01-01T09:00:00Z", want: "2024-01-08T09:00:00Z"},
+		{name: "within the minute", expr: "0 9 * * mon", from: "2024-01-01T08:59:30Z", want: "2024-01-01T09:00:00Z"},
+		{name: "step", expr: "*/15 * * * *", from: "2024-01-01T10:07:00Z", want: "2024-01-01T10:15:00Z"},
+		{name: "next month", expr: "0 0 1 * *", from: "2024-01-31T12:00:00Z", want: "2024-02-01T00:00:00Z"},
+		{name: "next year", expr: "0 0 1 jan *", from: "2024-06-01T00:00:00Z", want: "2025-01-01T00:00:00Z"},
+		{name: "leap day", expr: "0 0 29 2 *", from: "2024-03-01T00:00:00Z", want: "2028-02-29T00:00:00Z"},
+		{name: "never", expr: "0 0 31 2 *", from: "2024-01-01T00:00:00Z", want: ""},
+		{name: "day or weekday", expr: "0 12 13 * fri", from: "2024-01-01T00:00:00Z", want: "2024-01-05T12:00:00Z"},
+		{name: "day only", expr: "0 12 13 * *", from: "2024-01-01T00:00:00Z", want: "2024-01-13T12:00:00Z"},
+		{name: "sunday as 7", expr: "0 0 * * 7", from: "2024-01-01T00:00:00Z", want: "2024-01-07T00:00:00Z"},
+		{name: "in the location", expr: "0 9 * * *", zone: "Asia/Tokyo", from: "2024-01-01T09:00:00+09:00", want: "2024-01-02T09:00:00+09:00"},
+
+		// New York's clocks went forward from 2:00 EST to 3:00 EDT on
+		// 2024-03-10, and back from 2:00 EDT to 1:00 EST on 2024-11-03
+		{name: "skipped time", expr: "30 2 * * *", zone: "America/New_York", from: "2024-03-10T01:00:00-05:00", want: "2024-03-10T03:00:00-04:00"},
+		{name: "after a skipped time", expr: "30 2 * * *", zone: "America/New_York", from: "2024-03-10T03:00:00-04:00", want: "2024-03-11T02:30:00-04:00"},
+		{name: "skipped time at the start of the hour", expr: "0 2 * * *", zone: "America/New_York", from: "2024-03-09T02:00:00-05:00", want: "2024-03-10T03:00:00-04:00"},
+		{name: "daily across spring forward", expr: "0 9 * * *", zone: "America/New_York", from: "2024-03-09T09:00:00-05:00", want: "2024-03-10T09:00:00-04:00", interval: 23 * time.Hour},
+		{name: "hourly across spring forward", expr: "30 * * * *", zone: "America/New_York", from: "2024-03-10T01:30:00-05:00", want: "2024-03-10T03:30:00-04:00", interval: time.Hour},
+		{name: "every 15 minutes across spring forward", expr: "*/15 * * * *", zone: "America/New_York", from: "2024-03-10T01:45:00-05:00", want: "2024-03-10T03:00:00-04:00", interval: 15 * time.Minute},
+		{name: "first of a repeated time", expr: "30 1 * * *", zone: "America/New_York", from: "2024-11-03T00:00:00-04:00", want: "2024-11-03T01:30:00-04:00"},
+		{name: "repeated time only once", expr: "30 1 * * *", zone: "America/New_York", from: "2024-11-03T01:30:00-04:00", want: "2024-11-04T01:30:00-05:00"},
+		{name: "hourly across fall back", expr: "30 * * * *", zone: "America/New_York", from: "2024-11-03T01:30:00-04:00", want: "2024-11-03T01:30:00-05:00", interval: time.Hour},
+		{name: "daily across fall back", expr: "0 9 * * *", zone: "America/New_York", from: "2024-11-02T09:00:00-04:00", want: "2024-11-03T09:00:00-05:00", interval: 25 * time.Hour},
+
+		// Havana's clocks went forward from midnight CST to 1:00 CDT on
+		// 2024-03-10, so the day started at 1:00
+		{name: "skipped midnight", expr: "@daily", zone: "America/Havana", from: "2024-03-09T00:00:00-05:00", want: "2024-03-10T01:00:00-04:00"},
+		{name: "after a skipped midnight", expr: "@daily", zone: "America/Havana", from: "2024-03-10T01:00:00-04:00", want: "2024-03-11T00:00:00-04:00"},
+		{name: "monthly", expr: "@monthly", zone: "America/Havana", from: "2024-02-15T00:00:00-05:00", want: "2024-03-01T00:00:00-05:00"},
+	}
+	for _, test := range tests {
+		c, err := parseCron(test.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		loc := time.UTC
+		if test.zone != "" {
+			if loc, err = time.LoadLocation(test.zone); err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+		}
+		from, err := time.Parse(time.RFC3339, test.from)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		from = from.In(loc)
+
+		got := c.next(from)
+		if test.want == "" {
+			if !got.IsZero() {
+				t.Errorf("%s: %q next(%s) = %s, want the zero time", test.name, test.expr, test.from, got.Format(time.RFC3339))
+			}
+			continue
+		}
+		want, err := time.Parse(time.RFC3339, test.want)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !got.Equal(want) || got.Location() != loc {
+			t.Errorf("%s: %q next(%s) = %s in %s, want %s in %s", test.name, test.expr, test.from, got.Format(time.RFC3339), got.Location(), test.want, loc)
+		}
+		if test.interval != 0 && got.Sub(from) != test.interval {
+			t.Errorf("%s: %q next(%s) is %s later, want %s", test.name, test.expr, test.from, got.Sub(from), test.interval)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/heptiolabs/certstream-slack/pkg/stream"
+)
+
+const defaultCrtshURL = "https://crt.sh/"
+
+// crtshClient allows for crt.sh's searches, which are often slow.
+var crtshClient = &http.Client{Timeout: 2 * time.Minute}
+
+// crtshSource polls crt.sh's JSON API for certificates matching some
+// identities, as an alternative to certstream for networks that can't hold
+// a websocket open. Each identity starts with the certificates crt.sh
+// already has, unless state says where it left off, and only those crt.sh
+// adds later are delivered.
+type crtshSource struct {
+	url          string
+	identities   []string
+	pollInterval time.Duration
+	state        *ctState // nil unless positions are saved
+
+	mu          sync.Mutex
+	healthy     bool
+	lastMessage time.Time
+
+	stopOnce sync.Once
+	stopped  chan struct{}
+}
+
+func newCrtshSource(url string, identities []string, pollInterval time.Duration) *crtshSource {
+	return &crtshSource{
+		url:          url,
+		identities:   identities,
+		pollInterval: pollInterval,
+		stopped:      make(chan struct{}),
+	}
+}
+
+func (s *crtshSource) stop() {
+	s.stopOnce.Do(func() { close(s.stopped) })
+}
+
+// status reports the source as connected if the last search succeeded.
+func (s *crtshSource) status() (bool, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.healthy, s.lastMessage
+}
+
+// run searches for each identity in turn, rather than all at once, to go
+// easy on crt.sh.
+func (s *crtshSource) run(handle func(msg *stream.Message)) error {
+	log.WithField("identities", s.identities).Info("polling crt.sh")
+	next := map[string]int64{}
+	if s.state != nil {
+		for _, identity := range s.identities {
+			if position, ok := s.state.position(s.searchURL(identity)); ok {
+				next[identity] = position
+			}
+		}
+	}
+	for {
+		healthy := true
+		for _, identity := range s.identities {
+			if err := s.poll(identity, next, handle); err != nil {
+				log.WithError(err).WithField("identity", identity).Warn("could not search crt.sh")
+				healthy = false
+			}
+			if s.isStopped() {
+				break
+			}
+		}
+		s.mu.Lock()
+		s.healthy = healthy
+		s.mu.Unlock()
+		if s.state != nil {
+			if err := s.state.save(); err != nil {
+				log.WithError(err).Error("could not save crt.sh positions")
+			}
+		}
+
+		select {
+		case <-time.After(s.pollInterval):
+		case <-s.stopped:
+			log.Info("stopped polling crt.sh")
+			return nil
+		}
+	}
+}
+
+// poll searches for an identity and delivers the certificates with IDs
+// from next onwards, oldest first. The first search only finds where to
+// start.
+func (s *crtshSource) poll(identity string, next map[string]int64, handle func(msg *stream.Message)) error {
+	entries, err := s.search(identity)
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+
+	start, ok := next[identity]
+	if !ok {
+		start = 1
+		if n := len(entries); n > 0 {
+			start = entries[n-1].ID + 1
+		}
+		log.WithField("identity", identity).WithField("certificates", len(entries)).Debug("starting after the certificates crt.sh already has")
+	} else {
+		for _, e := range entries {
+			if e.ID < start {
+				continue
+			}
+			msg, err := s.message(e)
+			if err != nil {
+				log.WithError(err).WithField("id", e.ID).Debug("skipping unparseable crt.sh entry")
+				malformedMessages.inc()
+			} else {
+				s.deliver(handle, msg)
+			}
+			start = e.ID + 1
+			if s.isStopped() {
+				break
+			}
+		}
+	}
+	next[identity] = start
+	if s.state != nil {
+		s.state.setPosition(s.searchURL(identity), start)
+	}
+	return nil
+}
+
+// crtshEntry is a certificate in crt.sh's search results.
+type crtshEntry struct {
+	ID             int64  `json:"id"`
+	IssuerName     string `json:"issuer_name"` // like "C=US, O=Let's Encrypt, CN=R3"
+	CommonName     string `json:"common_name"`
+	NameValue      string `json:"name_value"` // the domains, one per line
+	SerialNumber   string `json:"serial_number"`
+	EntryTimestamp string `json:"entry_timestamp"`
+	NotBefore      string `json:"not_before"`
+	NotAfter       string `json:"not_after"`
+}
+
+// searchURL is the crt.sh JSON API URL searching for an identity's
+// unexpired certificates.
+func (s *crtshSource) searchURL(identity string) string {
+	query := url.Values{"q": {identity}, "output": {"json"}, "exclude": {"expired"}}
+	return s.url + "?" + query.Encode()
+}
+
+func (s *crtshSource) search(identity string) ([]crtshEntry, error) {
+	resp, err := crtshClient.Get(s.searchURL(identity))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &httpError{Status: resp.Status, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(msg))}
+	}
+	entries := []crtshEntry{}
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, errors.Wrap(err, "could not decode crt.sh results")
+	}
+	return entries, nil
+}
+
+// message describes a crt.sh entry as a certstream-style certificate_update
+// message. crt.sh doesn't say which log the certificate is in, or give its
+// fingerprint, so alerts link to the certificate on crt.sh instead.
+func (s *crtshSource) message(e crtshEntry) (*stream.Message, error) {
+	domains := []string{}
+	seen := map[string]bool{}
+	for _, name := range append([]string{e.CommonName}, strings.Split(e.NameValue, "\n")...) {
+		name = strings.TrimSpace(name)
+		if name != "" && !seen[name] {
+			seen[name] = true
+			domains = append(domains, name)
+		}
+	}
+	times := map[string]float64{}
+	for field, value := range map[string]string{"entry_timestamp": e.EntryTimestamp, "not_before": e.NotBefore, "not_after": e.NotAfter} {
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse("2006-01-02T15:04:05", value)
+		if err != nil {
+			return nil, errors.Wrap(err, field)
+		}
+		times[field] = float64(t.UnixNano()) / 1e9
+	}
+
+	return &stream.Message{
+		MessageType: "certificate_update",
+		Data: &stream.CertificateUpdate{
+			LeafCert: stream.Certificate{
+				Subject:      pkixName(pkix.Name{CommonName: e.CommonName}),
+				Issuer:       parseDN(e.IssuerName),
+				AllDomains:   domains,
+				NotBefore:    times["not_before"],
+				NotAfter:     times["not_after"],
+				SerialNumber: strings.ToUpper(e.SerialNumber),
+			},
+			CertIndex: -1,
+			CertLink:  s.url + "?id=" + strconv.FormatInt(e.ID, 10),
+			Seen:      times["entry_timestamp"],
+			Source:    stream.Source{Name: "crt.sh", URL: s.url},
+		},
+		Received: time.Now(),
+	}, nil
+}
+
+// parseDN parses a distinguished name the way crt.sh writes them, like
+// `C=US, O="DigiCert, Inc.", CN=DigiCert TLS RSA SHA256 2020 CA1`.
+func parseDN(dn string) stream.Name {
+	n := pkix.Name{}
+	for _, attr := range splitDN(dn) {
+		i := strings.Index(attr, "=")
+		if i < 0 {
+			continue
+		}
+		key, value := strings.TrimSpace(attr[:i]), strings.Trim(strings.TrimSpace(attr[i+1:]), `"`)
+		switch key {
+		case "C":
+			n.Country = append(n.Country, value)
+		case "ST":
+			n.Province = append(n.Province, value)
+		case "L":
+			n.Locality = append(n.Locality, value)
+		case "O":
+			n.Organization = append(n.Organization, value)
+		case "OU":
+			n.OrganizationalUnit = append(n.OrganizationalUnit, value)
+		case "CN":
+			n.CommonName = value
+		}
+	}
+	return pkixName(n)
+}
+
+// splitDN splits a distinguished name at the commas that aren't quoted.
+func splitDN(dn string) []string {
+	attrs := []string{}
+	quoted, start := false, 0
+	for i, c := range dn {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			attrs = append(attrs, dn[start:i])
+			start = i + 1
+		}
+	}
+	return append(attrs, dn[start:])
+}
+
+func (s *crtshSource) isStopped() bool {
+	select {
+	case <-s.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// deliver hands a message to the watcher.
+func (s *crtshSource) deliver(handle func(msg *stream.Message), msg *stream.Message) {
+	now := time.Now()
+	s.mu.Lock()
+	s.lastMessage = now
+	s.mu.Unlock()
+	lastMessageTime.set(float64(now.UnixNano()) / 1e9)
+	handle(msg)
+}
@@ -0,0 +1,469 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/heptiolabs/certstream-slack/pkg/stream"
+)
+
+// defaultCTLogList is Google's list of CT logs trusted by Chrome.
+const defaultCTLogList = "https://www.gstatic.com/ct/log_list/v3/log_list.json"
+
+// ctLog is a Certificate Transparency log to tail.
+type ctLog struct {
+	URL  string // like "https://ct.googleapis.com/logs/us1/argon2025h1/"
+	Name string
+}
+
+// ctSource tails CT logs directly using the RFC 6962 get-sth and
+// get-entries APIs, as an alternative to certstream. It starts where state
+// says it left off, or else at the head of each log, and polls for new
+// entries.
+type ctSource struct {
+	logs         []ctLog
+	logList      string // URL of a log list, used if logs is empty
+	pollInterval time.Duration
+	batchSize    int
+	state        *ctState // nil unless positions are saved
+
+	mu          sync.Mutex
+	healthy     map[string]bool
+	lastMessage time.Time
+
+	stopOnce sync.Once
+	stopped  chan struct{}
+}
+
+func newCTSource(logs []ctLog, logList string, pollInterval time.Duration, batchSize int) *ctSource {
+	return &ctSource{
+		logs:         logs,
+		logList:      logList,
+		pollInterval: pollInterval,
+		batchSize:    batchSize,
+		healthy:      map[string]bool{},
+		stopped:      make(chan struct{}),
+	}
+}
+
+func (s *ctSource) stop() {
+	s.stopOnce.Do(func() { close(s.stopped) })
+}
+
+// status reports the source as connected while any log is being polled
+// successfully.
+func (s *ctSource) status() (bool, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ok := range s.healthy {
+		if ok {
+			return true, s.lastMessage
+		}
+	}
+	return false, s.lastMessage
+}
+
+func (s *ctSource) run(handle func(msg *stream.Message)) error {
+	logs := s.logs
+	if len(logs) == 0 {
+		var err error
+		logs, err = fetchCTLogList(s.logList)
+		if err != nil {
+			return errors.Wrap(err, "could not get CT log list")
+		}
+		if len(logs) == 0 {
+			return errors.Errorf("no usable logs in %s", s.logList)
+		}
+	}
+	log.WithField("logs", len(logs)).Info("tailing CT logs")
+
+	// save positions periodically, and once more when stopping
+	saved := make(chan struct{})
+	if s.state != nil {
+		go func() {
+			defer close(saved)
+			for {
+				select {
+				case <-time.After(5 * time.Second):
+				case <-s.stopped:
+				}
+				if err := s.state.save(); err != nil {
+					log.WithError(err).Error("could not save CT log positions")
+				}
+				if s.isStopped() {
+					return
+				}
+			}
+		}()
+	} else {
+		close(saved)
+	}
+
+	var wg sync.WaitGroup
+	for _, l := range logs {
+		wg.Add(1)
+		go func(l ctLog) {
+			defer wg.Done()
+			s.tail(l, handle)
+		}(l)
+	}
+	wg.Wait()
+	s.stop()
+	<-saved
+	log.Info("stopped tailing CT logs")
+	return nil
+}
+
+// tail polls a single log until the source is stopped.
+func (s *ctSource) tail(l ctLog, handle func(msg *stream.Message)) {
+	logger := log.WithField("log", l.URL)
+	next := int64(-1)
+	if s.state != nil {
+		if position, ok := s.state.position(l.URL); ok {
+			next = position
+		}
+	}
+	for {
+		treeSize, err := getTreeSize(l.URL)
+		s.setHealthy(l.URL, err == nil)
+		if err != nil {
+			logger.WithError(err).Warn("could not get CT log size")
+		} else {
+			if next < 0 {
+				// only new entries are interesting
+				next = treeSize
+				logger.WithField("tree_size", treeSize).Debug("starting at the head of the CT log")
+				if s.state != nil {
+					s.state.setPosition(l.URL, next)
+				}
+			} else if backlog := treeSize - next; backlog > int64(s.batchSize) {
+				logger.WithField("entries", backlog).Info("catching up on CT log")
+			}
+			for next < treeSize {
+				end := next + int64(s.batchSize) - 1
+				if end >= treeSize {
+					end = treeSize - 1
+				}
+				entries, err := getEntries(l.URL, next, end)
+				if err != nil {
+					logger.WithError(err).Warn("could not get CT log entries")
+					break
+				}
+				if len(entries) == 0 {
+					break
+				}
+				for i, e := range entries {
+					msg, err := ctMessage(l, next+int64(i), e)
+					if err != nil {
+						logger.WithError(err).WithField("index", next+int64(i)).Debug("skipping unparseable CT log entry")
+						malformedMessages.inc()
+						continue
+					}
+					s.deliver(handle, msg)
+				}
+				// logs may return fewer entries than asked for
+				next += int64(len(entries))
+				if s.state != nil {
+					s.state.setPosition(l.URL, next)
+				}
+				if s.isStopped() {
+					return
+				}
+			}
+		}
+
+		select {
+		case <-time.After(s.pollInterval):
+		case <-s.stopped:
+			return
+		}
+	}
+}
+
+func (s *ctSource) isStopped() bool {
+	select {
+	case <-s.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *ctSource) setHealthy(url string, ok bool) {
+	s.mu.Lock()
+	s.healthy[url] = ok
+	s.mu.Unlock()
+}
+
+// deliver hands a message to the watcher. Logs are tailed concurrently, so
+// handle must be safe to call from several goroutines.
+func (s *ctSource) deliver(handle func(msg *stream.Message), msg *stream.Message) {
+	now := time.Now()
+	s.mu.Lock()
+	s.lastMessage = now
+	s.mu.Unlock()
+	lastMessageTime.set(float64(now.UnixNano()) / 1e9)
+	handle(msg)
+}
+
+// fetchCTLogList gets the usable logs from a log list in the format of
+// Google's v3 log_list.json.
+func fetchCTLogList(url string) ([]ctLog, error) {
+	var list struct {
+		Operators []struct {
+			Logs []struct {
+				Description string                     `json:"description"`
+				URL         string                     `json:"url"`
+				State       map[string]json.RawMessage `json:"state"`
+			} `json:"logs"`
+		} `json:"operators"`
+	}
+	if err := getJSON(url, &list); err != nil {
+		return nil, err
+	}
+	logs := []ctLog{}
+	for _, operator := range list.Operators {
+		for _, l := range operator.Logs {
+			// skip logs that are pending, read only, retired, or rejected
+			_, usable := l.State["usable"]
+			_, qualified := l.State["qualified"]
+			if usable || qualified {
+				logs = append(logs, ctLog{URL: l.URL, Name: l.Description})
+			}
+		}
+	}
+	return logs, nil
+}
+
+// getTreeSize returns the size of a log's latest signed tree head.
+func getTreeSize(logURL string) (int64, error) {
+	var sth struct {
+		TreeSize int64 `json:"tree_size"`
+	}
+	err := getJSON(ctEndpoint(logURL, "get-sth"), &sth)
+	return sth.TreeSize, err
+}
+
+// ctEntry is a raw entry from get-entries.
+type ctEntry struct {
+	LeafInput []byte `json:"leaf_input"`
+	ExtraData []byte `json:"extra_data"`
+}
+
+// getEntries returns the log entries from start to end inclusive, or fewer
+// if the log limits the batch size.
+func getEntries(logURL string, start, end int64) ([]ctEntry, error) {
+	var resp struct {
+		Entries []ctEntry `json:"entries"`
+	}
+	url := fmt.Sprintf("%s?start=%d&end=%d", ctEndpoint(logURL, "get-entries"), start, end)
+	err := getJSON(url, &resp)
+	return resp.Entries, err
+}
+
+func ctEndpoint(logURL, method string) string {
+	if !strings.HasSuffix(logURL, "/") {
+		logURL += "/"
+	}
+	return logURL + "ct/v1/" + method
+}
+
+// getJSON GETs url and decodes the JSON response into out.
+func getJSON(url string, out interface{}) error {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &httpError{Status: resp.Status, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(msg))}
+	}
+	return errors.Wrapf(json.NewDecoder(resp.Body).Decode(out), "could not decode %s", url)
+}
+
+// ctMessage parses a log entry into a certstream-style certificate_update
+// message.
+func ctMessage(l ctLog, index int64, e ctEntry) (*stream.Message, error) {
+	der, chainDER, precert, timestamp, err := parseLeaf(e.LeafInput, e.ExtraData)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse certificate")
+	}
+	chain := []stream.Certificate{}
+	for _, der := range chainDER {
+		ca, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not parse chain certificate")
+		}
+		chain = append(chain, leafCert(ca, der))
+	}
+
+	updateType := "X509LogEntry"
+	if precert {
+		updateType = "PrecertLogEntry"
+	}
+	return &stream.Message{
+		MessageType: "certificate_update",
+		Data: &stream.CertificateUpdate{
+			UpdateType: updateType,
+			LeafCert:   leafCert(cert, der),
+			Chain:      chain,
+			CertIndex:  index,
+			Seen:       float64(timestamp) / 1000,
+			Source: stream.Source{
+				URL:  strings.TrimPrefix(strings.TrimPrefix(l.URL, "https://"), "http://"),
+				Name: l.Name,
+			},
+		},
+		Received: time.Now(),
+	}, nil
+}
+
+// parseLeaf extracts the certificate from an RFC 6962 MerkleTreeLeaf, and
+// its chain from the entry's extra_data. For precertificates this is the
+// precertificate from extra_data, which unlike the TBSCertificate in the
+// leaf can be parsed as a certificate.
+func parseLeaf(leafInput, extraData []byte) (der []byte, chain [][]byte, precert bool, timestamp uint64, err error) {
+	// version, leaf_type, timestamp, and entry_type
+	if len(leafInput) < 12 {
+		return nil, nil, false, 0, errors.New("leaf_input is too short")
+	}
+	if leafInput[0] != 0 || leafInput[1] != 0 {
+		return nil, nil, false, 0, errors.Errorf("unsupported leaf version %d or type %d", leafInput[0], leafInput[1])
+	}
+	timestamp = binary.BigEndian.Uint64(leafInput[2:10])
+	switch entryType := binary.BigEndian.Uint16(leafInput[10:12]); entryType {
+	case 0: // x509_entry
+		if der, _, err = readUint24Prefixed(leafInput[12:]); err != nil {
+			return nil, nil, false, 0, err
+		}
+	case 1: // precert_entry
+		if der, extraData, err = readUint24Prefixed(extraData); err != nil {
+			return nil, nil, false, 0, err
+		}
+		precert = true
+	default:
+		return nil, nil, false, 0, errors.Errorf("unknown entry type %d", entryType)
+	}
+
+	// the chain is a list of certificates, each with its own length
+	if len(extraData) == 0 {
+		return der, nil, precert, timestamp, nil
+	}
+	list, _, err := readUint24Prefixed(extraData)
+	if err != nil {
+		return nil, nil, false, 0, errors.Wrap(err, "could not read chain")
+	}
+	for len(list) > 0 {
+		var cert []byte
+		if cert, list, err = readUint24Prefixed(list); err != nil {
+			return nil, nil, false, 0, errors.Wrap(err, "could not read chain")
+		}
+		chain = append(chain, cert)
+	}
+	return der, chain, precert, timestamp, nil
+}
+
+// readUint24Prefixed reads a TLS-style opaque value with a 3 byte length.
+func readUint24Prefixed(b []byte) (value, rest []byte, err error) {
+	if len(b) < 3 {
+		return nil, nil, errors.New("truncated length")
+	}
+	n := int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+	if len(b) < 3+n {
+		return nil, nil, errors.New("truncated value")
+	}
+	return b[3 : 3+n], b[3+n:], nil
+}
+
+// leafCert describes a certificate the way certstream does.
+func leafCert(cert *x509.Certificate, der []byte) stream.Certificate {
+	domains := []string{}
+	seen := map[string]bool{}
+	for _, name := range append([]string{cert.Subject.CommonName}, cert.DNSNames...) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			domains = append(domains, name)
+		}
+	}
+
+	sha1Sum := sha1.Sum(der)
+	sha256Sum := sha256.Sum256(der)
+
+	algorithm := strings.ToLower(strings.Replace(cert.SignatureAlgorithm.String(), "-", ", ", -1))
+	return stream.Certificate{
+		Subject:            pkixName(cert.Subject),
+		Issuer:             pkixName(cert.Issuer),
+		AllDomains:         domains,
+		NotBefore:          float64(cert.NotBefore.Unix()),
+		NotAfter:           float64(cert.NotAfter.Unix()),
+		SerialNumber:       fmt.Sprintf("%X", cert.SerialNumber),
+		SignatureAlgorithm: algorithm,
+		Fingerprint:        colonHex(sha1Sum[:]),
+		SHA256:             colonHex(sha256Sum[:]),
+		AsDER:              base64.StdEncoding.EncodeToString(der),
+	}
+}
+
+// colonHex formats a fingerprint as colon-separated uppercase hex, the way
+// certstream does.
+func colonHex(sum []byte) string {
+	hex := []string{}
+	for _, b := range sum {
+		hex = append(hex, fmt.Sprintf("%02X", b))
+	}
+	return strings.Join(hex, ":")
+}
+
+// pkixName describes a distinguished name the way certstream does, with an
+// "aggregated" form like "/C=US/O=Let's Encrypt/CN=R3".
+func pkixName(n pkix.Name) stream.Name {
+	name := stream.Name{}
+	add := func(key string, field *string, values []string) {
+		if len(values) > 0 {
+			*field = values[0]
+			name.Aggregated += "/" + key + "=" + values[0]
+		}
+	}
+	add("C", &name.C, n.Country)
+	add("ST", &name.ST, n.Province)
+	add("L", &name.L, n.Locality)
+	add("O", &name.O, n.Organization)
+	add("OU", &name.OU, n.OrganizationalUnit)
+	if n.CommonName != "" {
+		add("CN", &name.CN, []string{n.CommonName})
+	}
+	return name
+}
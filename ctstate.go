@@ -0,0 +1,137 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ctState remembers the next entry to process in each CT log, saved to a
+// JSON file so that a restarted watcher catches up on the entries it
+// missed instead of skipping them. Sources that page through APIs with
+// opaque position tokens, like Cert Spotter's, save those too.
+type ctState struct {
+	path string
+
+	mu     sync.Mutex
+	next   map[string]int64  // keyed by log URL
+	tokens map[string]string // keyed by source and query
+	dirty  bool
+}
+
+// loadCTState reads the state file at path, which needn't exist yet.
+func loadCTState(path string) (*ctState, error) {
+	s := &ctState{path: path, next: map[string]int64{}, tokens: map[string]string{}}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Logs   map[string]int64  `json:"logs"`
+		Tokens map[string]string `json:"tokens"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, errors.Wrapf(err, "could not parse %s", path)
+	}
+	if file.Logs != nil {
+		s.next = file.Logs
+	}
+	if file.Tokens != nil {
+		s.tokens = file.Tokens
+	}
+	return s, nil
+}
+
+// position returns the next entry to process in a log, if known.
+func (s *ctState) position(url string) (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next, ok := s.next[url]
+	return next, ok
+}
+
+// setPosition records the next entry to process in a log.
+func (s *ctState) setPosition(url string, next int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.next[url] != next {
+		s.next[url] = next
+		s.dirty = true
+	}
+}
+
+// token returns the position token saved for key, if any.
+func (s *ctState) token(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.tokens[key]
+	return token, ok
+}
+
+// setToken records the position token for key.
+func (s *ctState) setToken(key, token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tokens[key] != token {
+		s.tokens[key] = token
+		s.dirty = true
+	}
+}
+
+// save writes the state file if anything changed, replacing it atomically
+// so a crash can't leave it half written.
+func (s *ctState) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dirty {
+		return nil
+	}
+	data, err := json.MarshalIndent(struct {
+		Logs   map[string]int64  `json:"logs"`
+		Tokens map[string]string `json:"tokens,omitempty"`
+	}{s.next, s.tokens}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	s.dirty = false
+	return nil
+}
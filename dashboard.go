@@ -0,0 +1,271 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// dashboardMatches and dashboardErrors are how many recent matches and
+	// errors the dashboard shows
+	dashboardMatches = 50
+	dashboardErrors  = 20
+)
+
+// dashboard is a small web UI showing recent matches, how many each rule
+// has found, the state of the source, and recent errors.
+type dashboard struct {
+	source source
+	start  time.Time
+
+	mu      sync.Mutex
+	matches []*matchRecord // newest last
+	counts  map[string]int
+	errors  []dashboardError // newest last
+}
+
+type dashboardError struct {
+	Time    time.Time     `json:"time"`
+	Level   string        `json:"level"`
+	Message string        `json:"message"`
+	Fields  logrus.Fields `json:"fields,omitempty"`
+}
+
+func newDashboard(s source) *dashboard {
+	return &dashboard{source: s, start: time.Now(), counts: map[string]int{}}
+}
+
+// observe shows a match in the feed.
+func (d *dashboard) observe(r *matchRecord) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.counts[r.Rule]++
+	d.matches = append(d.matches, r)
+	if len(d.matches) > dashboardMatches {
+		d.matches = d.matches[len(d.matches)-dashboardMatches:]
+	}
+}
+
+// Levels and Fire make the dashboard a logrus hook, collecting errors and
+// warnings (like losing the connection to certstream).
+func (d *dashboard) Levels() []logrus.Level {
+	return []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel, logrus.WarnLevel}
+}
+
+func (d *dashboard) Fire(entry *logrus.Entry) error {
+	fields := logrus.Fields{}
+	for k, v := range entry.Data {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		fields[k] = v
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.errors = append(d.errors, dashboardError{Time: entry.Time, Level: entry.Level.String(), Message: entry.Message, Fields: fields})
+	if len(d.errors) > dashboardErrors {
+		d.errors = d.errors[len(d.errors)-dashboardErrors:]
+	}
+	return nil
+}
+
+// snapshot is what the dashboard page shows, newest first.
+type dashboardSnapshot struct {
+	Connected   bool             `json:"connected"`
+	LastMessage *time.Time       `json:"last_message,omitempty"`
+	Uptime      string           `json:"uptime"`
+	Rules       []dashboardRule  `json:"rules"`
+	Matches     []*matchRecord   `json:"matches"`
+	Errors      []dashboardError `json:"errors"`
+}
+
+type dashboardRule struct {
+	Name    string `json:"name"`
+	Matches int    `json:"matches"`
+}
+
+func (d *dashboard) snapshot() *dashboardSnapshot {
+	connected, lastMessage := d.source.status()
+	snap := &dashboardSnapshot{
+		Connected: connected,
+		Uptime:    time.Since(d.start).Truncate(time.Second).String(),
+		Rules:     []dashboardRule{},
+		Matches:   []*matchRecord{},
+		Errors:    []dashboardError{},
+	}
+	if !lastMessage.IsZero() {
+		snap.LastMessage = &lastMessage
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for name, n := range d.counts {
+		snap.Rules = append(snap.Rules, dashboardRule{Name: name, Matches: n})
+	}
+	sort.Slice(snap.Rules, func(i, j int) bool { return snap.Rules[i].Name < snap.Rules[j].Name })
+	for i := len(d.matches) - 1; i >= 0; i-- {
+		snap.Matches = append(snap.Matches, d.matches[i])
+	}
+	for i := len(d.errors) - 1; i >= 0; i-- {
+		snap.Errors = append(snap.Errors, d.errors[i])
+	}
+	return snap
+}
+
+// serve serves the dashboard on addr, requiring basic auth if user is set.
+// It never returns.
+func (d *dashboard) serve(addr, user, password string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, dashboardPage)
+	})
+	mux.HandleFunc("/status.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(d.snapshot())
+	})
+
+	var handler http.Handler = mux
+	if user != "" {
+		handler = basicAuth(mux, user, password)
+	}
+	log.WithField("addr", addr).Info("serving dashboard")
+	err := http.ListenAndServe(addr, handler)
+	log.WithError(err).Fatal("dashboard server failed")
+}
+
+// basicAuth wraps h to require the given user name and password.
+func basicAuth(h http.Handler, user, password string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(u), []byte(user)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(p), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="certstream-slack"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// dashboardPage renders the snapshot from /status.json, refreshing it every
+// few seconds.
+const dashboardPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>certstream-slack</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.4em; }
+h2 { font-size: 1.1em; margin-top: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 0.3em 0.8em 0.3em 0; border-bottom: 1px solid #eee; vertical-align: top; }
+.ok { color: #2a7d2a; }
+.bad { color: #b22; }
+.muted { color: #888; }
+code { font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>certstream-slack</h1>
+<p id="status" class="muted">Loading&hellip;</p>
+
+<h2>Rules</h2>
+<table><thead><tr><th>Rule</th><th>Matches</th></tr></thead><tbody id="rules"></tbody></table>
+
+<h2>Recent Matches</h2>
+<table><thead><tr><th>Found</th><th>Rule</th><th>Domains</th><th>Issuer</th></tr></thead><tbody id="matches"></tbody></table>
+
+<h2>Recent Errors</h2>
+<table><thead><tr><th>Time</th><th>Level</th><th>Error</th></tr></thead><tbody id="errors"></tbody></table>
+
+<script>
+function cell(row, text, link) {
+  var td = row.insertCell();
+  if (link) {
+    var a = document.createElement("a");
+    a.href = link;
+    a.textContent = text;
+    td.appendChild(a);
+  } else {
+    td.textContent = text;
+  }
+  return td;
+}
+
+function fill(id, items, render, empty) {
+  var body = document.getElementById(id);
+  body.innerHTML = "";
+  if (items.length == 0) {
+    cell(body.insertRow(), empty).className = "muted";
+  }
+  items.forEach(function(item) { render(body.insertRow(), item); });
+}
+
+function time(t) {
+  return new Date(t).toLocaleString();
+}
+
+function refresh() {
+  fetch("status.json").then(function(r) { return r.json(); }).then(function(s) {
+    var status = document.getElementById("status");
+    status.className = s.connected ? "ok" : "bad";
+    status.textContent = (s.connected ? "Connected" : "Disconnected") +
+      (s.last_message ? ", last message " + time(s.last_message) : "") +
+      ", up " + s.uptime;
+    fill("rules", s.rules, function(row, r) {
+      cell(row, r.name);
+      cell(row, r.matches);
+    }, "No matches yet");
+    fill("matches", s.matches, function(row, m) {
+      cell(row, time(m.time));
+      cell(row, m.rule);
+      cell(row, m.domains.join(", "), m.cert_url);
+      cell(row, m.issuer);
+    }, "No matches yet");
+    fill("errors", s.errors, function(row, e) {
+      cell(row, time(e.time));
+      cell(row, e.level).className = e.level == "warning" ? "muted" : "bad";
+      var fields = Object.keys(e.fields || {}).map(function(k) { return k + "=" + e.fields[k]; });
+      cell(row, e.message + (fields.length ? " (" + fields.join(", ") + ")" : ""));
+    }, "No errors");
+  }).catch(function() {
+    var status = document.getElementById("status");
+    status.className = "bad";
+    status.textContent = "Could not reach certstream-slack";
+  });
+}
+
+refresh();
+setInterval(refresh, 5000);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,47 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+)
+
+// serveDebug serves the Go runtime's profiles and variables on addr, for
+// profiling the watcher in production, like its memory while certstream is
+// busy. They reveal a lot about the process, so addr is best kept private,
+// like "localhost:6060". It never returns.
+func serveDebug(addr string) {
+	expvar.Publish("goroutines", expvar.Func(func() interface{} { return runtime.NumGoroutine() }))
+	expvar.Publish("queue_length", expvar.Func(func() interface{} { return queueLength.get() }))
+	expvar.Publish("enrich_queue_length", expvar.Func(func() interface{} { return enrichQueueLength.get() }))
+
+	// net/http/pprof registers its handlers with the default mux, which
+	// nothing else serves, so register them with our own
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	log.WithField("addr", addr).Info("serving debug endpoints")
+	err := http.ListenAndServe(addr, mux)
+	log.WithError(err).Fatal("debug server failed")
+}
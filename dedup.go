@@ -0,0 +1,93 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// dedupCache remembers recently alerted certificates so each one only alerts
+// once. It holds at most size keys, evicting the least recently seen first,
+// and forgets keys after ttl.
+type dedupCache struct {
+	size int
+	ttl  time.Duration
+
+	mu    sync.Mutex
+	order *list.List // of *dedupEntry, most recently seen at the front
+	keys  map[string]*list.Element
+}
+
+type dedupEntry struct {
+	key     string
+	expires time.Time
+}
+
+func newDedupCache(size int, ttl time.Duration) *dedupCache {
+	return &dedupCache{
+		size:  size,
+		ttl:   ttl,
+		order: list.New(),
+		keys:  map[string]*list.Element{},
+	}
+}
+
+// duplicate reports whether key was already seen within the TTL, and records
+// it as seen either way.
+func (c *dedupCache) duplicate(key string) bool {
+	return c.duplicateOf([]string{key}, []string{key})
+}
+
+// duplicateOf reports whether any of the check keys were seen within the
+// TTL, and records every one of keys as seen either way, so that something
+// known by several keys is found by whichever one the next thing has.
+func (c *dedupCache) duplicateOf(check, keys []string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	duplicate := false
+	for _, key := range check {
+		if elem, ok := c.keys[key]; ok && now.Before(elem.Value.(*dedupEntry).expires) {
+			duplicate = true
+		}
+	}
+	for _, key := range keys {
+		c.remember(key, now)
+	}
+	return duplicate
+}
+
+// remember records key as seen at now, keeping when it expires unless it
+// already has.
+func (c *dedupCache) remember(key string, now time.Time) {
+	if elem, ok := c.keys[key]; ok {
+		if entry := elem.Value.(*dedupEntry); !now.Before(entry.expires) {
+			entry.expires = now.Add(c.ttl)
+		}
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.keys[key] = c.order.PushFront(&dedupEntry{key: key, expires: now.Add(c.ttl)})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.keys, oldest.Value.(*dedupEntry).key)
+	}
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// digest accumulates alerts and sends them as a batch once per window, so
+// that broad patterns don't flood a channel.
+type digest struct {
+	window time.Duration
+	send   func(alerts []*alert) error
+
+	mu      sync.Mutex
+	pending []*alert
+	stop    chan struct{} // closed by close
+}
+
+// newDigest starts a digest that calls send with the alerts accumulated in
+// each window (skipping empty windows).
+func newDigest(window time.Duration, send func(alerts []*alert) error) *digest {
+	d := &digest{window: window, send: send, stop: make(chan struct{})}
+	go func() {
+		ticker := time.NewTicker(window)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-d.stop:
+				return
+			}
+			if err := d.flush(); err != nil {
+				log.WithError(err).Error("error sending digest")
+			}
+		}
+	}()
+	return d
+}
+
+// close stops sending digests, without flushing.
+func (d *digest) close() {
+	close(d.stop)
+}
+
+// add queues an alert for the next digest.
+func (d *digest) add(a *alert) {
+	d.mu.Lock()
+	d.pending = append(d.pending, a)
+	d.mu.Unlock()
+}
+
+// flush sends any pending alerts immediately.
+func (d *digest) flush() error {
+	d.mu.Lock()
+	alerts := d.pending
+	d.pending = nil
+	d.mu.Unlock()
+
+	if len(alerts) == 0 {
+		return nil
+	}
+	return d.send(alerts)
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/heptiolabs/certstream-slack/pkg/enrich"
+	"github.com/heptiolabs/certstream-slack/pkg/notify"
+)
+
+// enricherFactory builds an enricher, using decode to unmarshal its
+// type-specific options from the enricher config.
+type enricherFactory func(decode func(interface{}) error) (enrich.Enricher, error)
+
+// enricherTypes is the registry of enricher types, keyed by the "type"
+// setting.
+var enricherTypes = map[string]enricherFactory{}
+
+// registerEnricherType makes an enricher type available to the config. It's
+// meant to be called from init functions.
+func registerEnricherType(typ string, factory enricherFactory) {
+	enricherTypes[typ] = factory
+}
+
+// enricherConfig configures a single enricher. Apart from the type and the
+// options every enricher shares, its options depend on the type and are
+// decoded by the enricher's factory.
+type enricherConfig struct {
+	Type string `yaml:"type"`
+
+	// EnrichTimeout limits the enricher, in place of the config's
+	// enrich_timeout
+	EnrichTimeout time.Duration `yaml:"enrich_timeout"`
+
+	// BreakerFailures and BreakerCooldown override the config's
+	// enrich_breaker_failures and enrich_breaker_cooldown
+	BreakerFailures *int          `yaml:"breaker_failures"`
+	BreakerCooldown time.Duration `yaml:"breaker_cooldown"`
+
+	options map[string]interface{}
+
+	// key is where the enricher was configured, for error messages
+	key string
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler, decoding the shared options
+// and keeping any type-specific options to be decoded once the type is
+// known.
+func (e *enricherConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	options := map[string]interface{}{}
+	if err := unmarshal(&options); err != nil {
+		return err
+	}
+	shared := map[string]interface{}{}
+	for _, key := range []string{"type", "enrich_timeout", "breaker_failures", "breaker_cooldown"} {
+		if v, ok := options[key]; ok {
+			shared[key] = v
+			delete(options, key)
+		}
+	}
+	data, err := yaml.Marshal(shared)
+	if err != nil {
+		return err
+	}
+	type plain enricherConfig
+	if err := yaml.UnmarshalStrict(data, (*plain)(e)); err != nil {
+		return err
+	}
+	e.options = options
+	return nil
+}
+
+// decode strictly unmarshals the enricher's type-specific options into out.
+func (e *enricherConfig) decode(out interface{}) error {
+	data, err := yaml.Marshal(e.options)
+	if err != nil {
+		return err
+	}
+	return yaml.UnmarshalStrict(data, out)
+}
+
+// newEnricher builds an enricher from its config using the registered
+// factory.
+func newEnricher(ec *enricherConfig) (enrich.Enricher, error) {
+	factory := enricherTypes[ec.Type]
+	if factory == nil {
+		types := []string{}
+		for typ := range enricherTypes {
+			types = append(types, typ)
+		}
+		sort.Strings(types)
+		return nil, errors.Errorf("%s.type: unknown enricher type %q (must be one of %s)", ec.key, ec.Type, strings.Join(types, ", "))
+	}
+	e, err := factory(ec.decode)
+	if err != nil {
+		return nil, errors.Wrap(err, ec.key)
+	}
+	return e, nil
+}
+
+// newEnrichPipeline builds the pipeline of the config's enrichers, with
+// their timeouts and circuit breakers, or returns nil if there are none.
+func newEnrichPipeline(c *config, enrichers []enrich.Enricher) (*enrich.Pipeline, error) {
+	if len(enrichers) == 0 {
+		return nil, nil
+	}
+	p := &enrich.Pipeline{
+		Failed: func(e enrich.Enricher, a *notify.Alert, err error) {
+			log.WithError(err).WithField("enricher", e.Name()).WithField("fingerprint", a.Fingerprint).Warn("could not enrich alert")
+			enrichmentsFailed.inc(e.Name())
+		},
+		Skipped: func(e enrich.Enricher, a *notify.Alert) {
+			log.WithField("enricher", e.Name()).WithField("fingerprint", a.Fingerprint).Debug("skipping enricher that keeps failing")
+			enrichmentsSkipped.inc(e.Name())
+		},
+	}
+	for i, e := range enrichers {
+		ec := c.Enrichers[i]
+		s := &enrich.Stage{Enricher: tracedEnricher{e}, Timeout: c.EnrichTimeout}
+		if ec.EnrichTimeout != 0 {
+			if ec.EnrichTimeout < 0 {
+				return nil, errors.Errorf("%s.enrich_timeout: must be positive", ec.key)
+			}
+			s.Timeout = ec.EnrichTimeout
+		}
+		failures, cooldown := c.EnrichBreakerFailures, c.EnrichBreakerCooldown
+		if ec.BreakerFailures != nil {
+			failures = *ec.BreakerFailures
+		}
+		if ec.BreakerCooldown != 0 {
+			cooldown = ec.BreakerCooldown
+		}
+		if failures < 0 {
+			return nil, errors.Errorf("%s.breaker_failures: must not be negative", ec.key)
+		}
+		if failures > 0 {
+			if cooldown <= 0 {
+				return nil, errors.Errorf("%s.breaker_cooldown: must be positive", ec.key)
+			}
+			name := e.Name()
+			s.Breaker = &enrich.Breaker{
+				Failures: failures,
+				Cooldown: cooldown,
+				OnChange: func(open bool) {
+					if open {
+						log.WithField("enricher", name).WithField("cooldown", cooldown).Warn("enricher keeps failing, skipping it for a while")
+					} else {
+						log.WithField("enricher", name).Info("enricher recovered")
+					}
+				},
+			}
+		}
+		p.Stages = append(p.Stages, s)
+	}
+	return p, nil
+}
+
+// enrichableDomains returns the matching domains of an alert to look up, at
+// most max of them (if positive), with wildcards standing for the domain
+// they cover, like "example.com" for "*.example.com".
+func enrichableDomains(a *alert, max int) []string {
+	seen := map[string]bool{}
+	domains := []string{}
+	for _, domain := range a.Domains {
+		domain = strings.TrimPrefix(domain, "*.")
+		if seen[domain] {
+			continue
+		}
+		seen[domain] = true
+		domains = append(domains, domain)
+		if max > 0 && len(domains) == max {
+			break
+		}
+	}
+	return domains
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize/english"
+	"github.com/pkg/errors"
+
+	"github.com/heptiolabs/certstream-slack/pkg/enrich"
+	"github.com/heptiolabs/certstream-slack/pkg/notify"
+)
+
+// censysEnricher looks up the certificate in Censys's certificate search,
+// reporting when Censys first saw it and which hosts present it, if any.
+type censysEnricher struct {
+	APIID     string `yaml:"api_id"`
+	APISecret string `yaml:"api_secret"`
+
+	// APIURL is the Censys Search API, "https://search.censys.io/api/v2/"
+	// by default
+	APIURL string `yaml:"api_url"`
+
+	// MaxHosts is how many of the hosts presenting the certificate to list
+	// (5 by default)
+	MaxHosts int `yaml:"max_hosts"`
+}
+
+func init() {
+	registerEnricherType("censys", func(decode func(interface{}) error) (enrich.Enricher, error) {
+		e := &censysEnricher{APIURL: "https://search.censys.io/api/v2/", MaxHosts: 5}
+		if err := decode(e); err != nil {
+			return nil, err
+		}
+		if e.APIID == "" || e.APISecret == "" {
+			return nil, errors.New("api_id and api_secret: must be set")
+		}
+		if !strings.HasSuffix(e.APIURL, "/") {
+			e.APIURL += "/"
+		}
+		if e.MaxHosts < 1 {
+			return nil, errors.New("max_hosts: must be at least 1")
+		}
+		return e, nil
+	})
+}
+
+func (e *censysEnricher) Name() string {
+	return "censys"
+}
+
+// Enrich reports when Censys first saw the certificate, with a link to it,
+// like "2024-05-01, 3 days ago: https://search.censys.io/certificates/...",
+// and the hosts presenting it, like "192.0.2.1 and 192.0.2.2". It needs
+// the certificate's SHA-256 fingerprint, so alerts from sources without
+// one aren't looked up.
+func (e *censysEnricher) Enrich(ctx context.Context, a *notify.Alert) ([]notify.Enrichment, error) {
+	if a.SHA256 == "" {
+		return nil, nil
+	}
+	fingerprint := strings.ToLower(strings.Replace(a.SHA256, ":", "", -1))
+	link := "https://search.censys.io/certificates/" + fingerprint
+
+	var cert struct {
+		Result struct {
+			AddedAt time.Time `json:"added_at"`
+		} `json:"result"`
+	}
+	found, err := e.get(ctx, "certificates/"+url.PathEscape(fingerprint), &cert)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not look up the certificate")
+	}
+	if !found {
+		return []notify.Enrichment{{Name: "Censys", Value: "not seen yet"}}, nil
+	}
+	first := "unknown"
+	if added := cert.Result.AddedAt; !added.IsZero() {
+		first = added.UTC().Format("2006-01-02")
+		if age := time.Since(added); age > 0 {
+			first += ", " + formatAge(age) + " ago"
+		}
+	}
+	enrichments := []notify.Enrichment{{Name: "Censys first seen", Value: first + ": " + link}}
+
+	var hosts struct {
+		Result struct {
+			Hosts []struct {
+				IP   string `json:"ip"`
+				Name string `json:"name"`
+			} `json:"hosts"`
+			Links struct {
+				Next string `json:"next"`
+			} `json:"links"`
+		} `json:"result"`
+	}
+	if _, err := e.get(ctx, "certificates/"+url.PathEscape(fingerprint)+"/hosts", &hosts); err != nil {
+		return enrichments, errors.Wrap(err, "could not look up the hosts presenting the certificate")
+	}
+	names := []string{}
+	for _, h := range hosts.Result.Hosts {
+		if len(names) == e.MaxHosts {
+			break
+		}
+		name := h.IP
+		if h.Name != "" {
+			name = fmt.Sprintf("%s (%s)", h.Name, h.IP)
+		}
+		names = append(names, name)
+	}
+	value := "none"
+	if len(names) > 0 {
+		switch more := len(hosts.Result.Hosts) - len(names); {
+		case hosts.Result.Links.Next != "":
+			names = append(names, "more")
+		case more > 0:
+			names = append(names, english.Plural(more, "other", ""))
+		}
+		value = english.OxfordWordSeries(names, "and")
+	}
+	return append(enrichments, notify.Enrichment{Name: "Censys hosts", Value: value}), nil
+}
+
+// get decodes a Censys API response into out, reporting false if Censys
+// doesn't have what was asked for.
+func (e *censysEnricher) get(ctx context.Context, path string, out interface{}) (bool, error) {
+	req, err := http.NewRequest("GET", e.APIURL+path, nil)
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	req.SetBasicAuth(e.APIID, e.APISecret)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	body, err := readResponse(resp)
+	if err != nil {
+		return false, err
+	}
+	return true, errors.Wrap(json.Unmarshal(body, out), "could not parse the response")
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/heptiolabs/certstream-slack/pkg/enrich"
+	"github.com/heptiolabs/certstream-slack/pkg/match"
+	"github.com/heptiolabs/certstream-slack/pkg/notify"
+)
+
+// dnsEnricher resolves the matching domains, so whoever gets an alert can
+// see whether they're already live.
+type dnsEnricher struct {
+	// Records are the record types to look up: any of "A", "AAAA", "MX",
+	// and "NS" (all of them by default). NS records are looked up for the
+	// registrable domain, like "example.com" for "login.example.com".
+	Records []string `yaml:"records"`
+
+	// Resolver is the DNS server to use, like "192.0.2.53", instead of the
+	// system's
+	Resolver string `yaml:"resolver"`
+
+	// Concurrency is how many lookups run at once (4 by default), and
+	// MaxDomains is how many of an alert's domains to look up (10 by
+	// default)
+	Concurrency int `yaml:"concurrency"`
+	MaxDomains  int `yaml:"max_domains"`
+
+	resolver *net.Resolver
+}
+
+func init() {
+	registerEnricherType("dns", func(decode func(interface{}) error) (enrich.Enricher, error) {
+		e := &dnsEnricher{Concurrency: 4, MaxDomains: 10}
+		if err := decode(e); err != nil {
+			return nil, err
+		}
+		if len(e.Records) == 0 {
+			e.Records = []string{"A", "AAAA", "MX", "NS"}
+		}
+		for i, typ := range e.Records {
+			e.Records[i] = strings.ToUpper(typ)
+			switch e.Records[i] {
+			case "A", "AAAA", "MX", "NS":
+			default:
+				return nil, errors.Errorf("records[%d]: must be \"A\", \"AAAA\", \"MX\", or \"NS\", not %q", i, typ)
+			}
+		}
+		if e.Concurrency < 1 {
+			return nil, errors.New("concurrency: must be at least 1")
+		}
+		if e.MaxDomains < 1 {
+			return nil, errors.New("max_domains: must be at least 1")
+		}
+		e.resolver = net.DefaultResolver
+		if e.Resolver != "" {
+			addr := e.Resolver
+			if _, _, err := net.SplitHostPort(addr); err != nil {
+				addr = net.JoinHostPort(addr, "53")
+			}
+			e.resolver = &net.Resolver{
+				PreferGo: true,
+				Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, network, addr)
+				},
+			}
+		}
+		return e, nil
+	})
+}
+
+func (e *dnsEnricher) Name() string {
+	return "dns"
+}
+
+// Enrich looks up the records of each domain, reporting domains without
+// any of the addresses or mail servers looked up as not resolving.
+func (e *dnsEnricher) Enrich(ctx context.Context, a *notify.Alert) ([]notify.Enrichment, error) {
+	type lookup struct {
+		domain, typ string
+		found       []notify.Enrichment
+		err         error
+	}
+	lookups := []*lookup{}
+	registrables := map[string]bool{}
+	domains := enrichableDomains(a, e.MaxDomains)
+	for _, domain := range domains {
+		for _, typ := range e.Records {
+			if typ == "NS" {
+				registrable := match.RegistrableDomain(domain)
+				if registrable == "" || registrables[registrable] {
+					continue
+				}
+				registrables[registrable] = true
+				domain = registrable
+			}
+			lookups = append(lookups, &lookup{domain: domain, typ: typ})
+		}
+	}
+
+	sem := make(chan struct{}, e.Concurrency)
+	var wg sync.WaitGroup
+	for _, l := range lookups {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(l *lookup) {
+			defer func() { <-sem; wg.Done() }()
+			values, err := e.lookup(ctx, l.domain, l.typ)
+			if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+				err = nil
+			}
+			for _, value := range values {
+				l.found = append(l.found, notify.Enrichment{Domain: l.domain, Name: l.typ, Value: value})
+			}
+			l.err = err
+		}(l)
+	}
+	wg.Wait()
+
+	var found []notify.Enrichment
+	var err error
+	resolves := map[string]bool{}
+	for _, l := range lookups {
+		found = append(found, l.found...)
+		if len(l.found) > 0 && l.typ != "NS" {
+			resolves[l.domain] = true
+		}
+		if l.err != nil && err == nil {
+			err = errors.Wrapf(l.err, "could not look up %s records of %s", l.typ, l.domain)
+		}
+	}
+	if !e.only("NS") {
+		for _, domain := range domains {
+			if !resolves[domain] && err == nil {
+				found = append(found, notify.Enrichment{Domain: domain, Name: "DNS", Value: "doesn't resolve"})
+			}
+		}
+	}
+	return found, err
+}
+
+// only reports whether typ is the only record type looked up.
+func (e *dnsEnricher) only(typ string) bool {
+	return len(e.Records) == 1 && e.Records[0] == typ
+}
+
+// lookup returns the records of a type for domain: the addresses for A and
+// AAAA, and the hosts for MX and NS.
+func (e *dnsEnricher) lookup(ctx context.Context, domain, typ string) ([]string, error) {
+	values := []string{}
+	switch typ {
+	case "A", "AAAA":
+		network := "ip4"
+		if typ == "AAAA" {
+			network = "ip6"
+		}
+		ips, err := e.resolver.LookupIP(ctx, network, domain)
+		for _, ip := range ips {
+			values = append(values, ip.String())
+		}
+		return values, err
+	case "MX":
+		mxs, err := e.resolver.LookupMX(ctx, domain)
+		for _, mx := range mxs {
+			values = append(values, strings.TrimSuffix(mx.Host, "."))
+		}
+		return values, err
+	default:
+		nss, err := e.resolver.LookupNS(ctx, domain)
+		for _, ns := range nss {
+			values = append(values, strings.TrimSuffix(ns.Host, "."))
+		}
+		return values, err
+	}
+}
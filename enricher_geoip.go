@@ -0,0 +1,176 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/heptiolabs/certstream-slack/pkg/enrich"
+	"github.com/heptiolabs/certstream-slack/pkg/notify"
+)
+
+// geoipEnricher looks up where the matching domains' addresses are and
+// which networks they're in, in MaxMind databases like GeoLite2.
+type geoipEnricher struct {
+	// CountryDB is a GeoLite2 or GeoIP2 Country or City database, and ASNDB
+	// is a GeoLite2 or GeoIP2 ASN database
+	CountryDB string `yaml:"country_db"`
+	ASNDB     string `yaml:"asn_db"`
+
+	// MaxDomains is how many of an alert's domains to look up (10 by
+	// default), and MaxAddresses how many of each domain's addresses (4 by
+	// default)
+	MaxDomains   int `yaml:"max_domains"`
+	MaxAddresses int `yaml:"max_addresses"`
+
+	country, asn *mmdbReader
+}
+
+func init() {
+	registerEnricherType("geoip", func(decode func(interface{}) error) (enrich.Enricher, error) {
+		e := &geoipEnricher{MaxDomains: 10, MaxAddresses: 4}
+		if err := decode(e); err != nil {
+			return nil, err
+		}
+		if e.CountryDB == "" && e.ASNDB == "" {
+			return nil, errors.New("country_db: country_db or asn_db must be set")
+		}
+		if e.MaxDomains < 1 {
+			return nil, errors.New("max_domains: must be at least 1")
+		}
+		if e.MaxAddresses < 1 {
+			return nil, errors.New("max_addresses: must be at least 1")
+		}
+		var err error
+		if e.CountryDB != "" {
+			if e.country, err = openMMDB(e.CountryDB); err != nil {
+				return nil, errors.Wrap(err, "country_db")
+			}
+		}
+		if e.ASNDB != "" {
+			if e.asn, err = openMMDB(e.ASNDB); err != nil {
+				return nil, errors.Wrap(err, "asn_db")
+			}
+		}
+		return e, nil
+	})
+}
+
+func (e *geoipEnricher) Name() string {
+	return "geoip"
+}
+
+// Enrich reports the countries (and cities, if the database has them) and
+// autonomous systems of each domain's addresses. It uses the addresses the
+// dns enricher found, if it ran first, and otherwise resolves them.
+func (e *geoipEnricher) Enrich(ctx context.Context, a *notify.Alert) ([]notify.Enrichment, error) {
+	resolved := map[string][]string{}
+	dnsRan := false
+	for _, f := range a.Enrichments {
+		dnsRan = dnsRan || f.Source == "dns"
+		if f.Source == "dns" && (f.Name == "A" || f.Name == "AAAA") {
+			resolved[f.Domain] = append(resolved[f.Domain], f.Value)
+		}
+	}
+
+	found := []notify.Enrichment{}
+	var err error
+	for _, domain := range enrichableDomains(a, e.MaxDomains) {
+		addrs := resolved[domain]
+		if !dnsRan {
+			ips, lookupErr := net.DefaultResolver.LookupIPAddr(ctx, domain)
+			if dnsErr, ok := lookupErr.(*net.DNSError); ok && dnsErr.IsNotFound {
+				lookupErr = nil
+			}
+			if lookupErr != nil && err == nil {
+				err = errors.Wrapf(lookupErr, "could not resolve %s", domain)
+			}
+			for _, ip := range ips {
+				addrs = append(addrs, ip.String())
+			}
+		}
+		if len(addrs) > e.MaxAddresses {
+			addrs = addrs[:e.MaxAddresses]
+		}
+
+		seen := map[string]bool{}
+		add := func(name, value string) {
+			if value != "" && !seen[name+value] {
+				seen[name+value] = true
+				found = append(found, notify.Enrichment{Domain: domain, Name: name, Value: value})
+			}
+		}
+		for _, addr := range addrs {
+			ip := net.ParseIP(addr)
+			if ip == nil {
+				continue
+			}
+			if e.country != nil {
+				record, lookupErr := e.country.lookup(ip)
+				if lookupErr != nil && err == nil {
+					err = errors.Wrapf(lookupErr, "could not look up %s in %s", addr, e.CountryDB)
+				}
+				add("Location", geoipLocation(record))
+			}
+			if e.asn != nil {
+				record, lookupErr := e.asn.lookup(ip)
+				if lookupErr != nil && err == nil {
+					err = errors.Wrapf(lookupErr, "could not look up %s in %s", addr, e.ASNDB)
+				}
+				add("AS", geoipNetwork(record))
+			}
+		}
+	}
+	return found, err
+}
+
+// geoipLocation describes the location in a Country or City record, like
+// "United States (US)" or "Mountain View, United States (US)".
+func geoipLocation(record interface{}) string {
+	country := mmdbPath(record, "country")
+	if country == nil {
+		country = mmdbPath(record, "registered_country")
+	}
+	name, _ := mmdbPath(country, "names", "en").(string)
+	code, _ := mmdbPath(country, "iso_code").(string)
+	location := name
+	switch {
+	case name != "" && code != "":
+		location = fmt.Sprintf("%s (%s)", name, code)
+	case name == "":
+		location = code
+	}
+	if city, _ := mmdbPath(record, "city", "names", "en").(string); city != "" && location != "" {
+		location = city + ", " + location
+	}
+	return location
+}
+
+// geoipNetwork describes the autonomous system in an ASN record, like
+// "AS15169 Google LLC".
+func geoipNetwork(record interface{}) string {
+	number, ok := mmdbUint(mmdbPath(record, "autonomous_system_number"))
+	org, _ := mmdbPath(record, "autonomous_system_organization").(string)
+	if !ok {
+		return org
+	}
+	return strings.TrimSpace(fmt.Sprintf("AS%d %s", number, org))
+}
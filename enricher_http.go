@@ -0,0 +1,223 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/heptiolabs/certstream-slack/pkg/enrich"
+	"github.com/heptiolabs/certstream-slack/pkg/notify"
+)
+
+// httpEnricher requests the matching domains' home pages, so whoever gets
+// an alert can see whether a site, perhaps a phishing page, is already
+// being served.
+type httpEnricher struct {
+	// Method is "GET" (the default), which finds the page's title, or
+	// "HEAD"
+	Method string `yaml:"method"`
+
+	// Schemes are tried in turn until one responds, "https" and then
+	// "http" by default
+	Schemes []string `yaml:"schemes"`
+
+	// Timeout limits each request (5s by default), and MaxRedirects is how
+	// many redirects to follow (2 by default) before reporting the redirect
+	Timeout      time.Duration `yaml:"timeout"`
+	MaxRedirects int           `yaml:"max_redirects"`
+
+	// MaxDomains is how many of an alert's domains to request (3 by
+	// default)
+	MaxDomains int `yaml:"max_domains"`
+
+	// UserAgent is sent with requests, "certstream-slack" by default
+	UserAgent string `yaml:"user_agent"`
+
+	// InsecureSkipVerify requests pages even if their certificates can't
+	// be verified, such as while a new certificate is being rolled out
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+
+	// AllowPrivateAddresses requests pages from domains resolving to
+	// loopback, private, and link-local addresses too, such as to see
+	// internal sites
+	AllowPrivateAddresses bool `yaml:"allow_private_addresses"`
+
+	client *http.Client
+}
+
+func init() {
+	registerEnricherType("http", func(decode func(interface{}) error) (enrich.Enricher, error) {
+		e := &httpEnricher{
+			Method:       "GET",
+			Schemes:      []string{"https", "http"},
+			Timeout:      5 * time.Second,
+			MaxRedirects: 2,
+			MaxDomains:   3,
+			UserAgent:    "certstream-slack",
+		}
+		if err := decode(e); err != nil {
+			return nil, err
+		}
+		e.Method = strings.ToUpper(e.Method)
+		if e.Method != "GET" && e.Method != "HEAD" {
+			return nil, errors.Errorf("method: must be \"GET\" or \"HEAD\", not %q", e.Method)
+		}
+		if len(e.Schemes) == 0 {
+			return nil, errors.New("schemes: must not be empty")
+		}
+		for i, scheme := range e.Schemes {
+			if scheme != "https" && scheme != "http" {
+				return nil, errors.Errorf("schemes[%d]: must be \"https\" or \"http\", not %q", i, scheme)
+			}
+		}
+		if e.Timeout <= 0 {
+			return nil, errors.New("timeout: must be positive")
+		}
+		if e.MaxRedirects < 0 {
+			return nil, errors.New("max_redirects: must not be negative")
+		}
+		if e.MaxDomains < 1 {
+			return nil, errors.New("max_domains: must be at least 1")
+		}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: e.InsecureSkipVerify}
+		transport.DisableKeepAlives = true
+		if !e.AllowPrivateAddresses {
+			refusePrivateAddresses(transport)
+		}
+		e.client = &http.Client{
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) > e.MaxRedirects {
+					return http.ErrUseLastResponse
+				}
+				return nil
+			},
+		}
+		return e, nil
+	})
+}
+
+func (e *httpEnricher) Name() string {
+	return "http"
+}
+
+// Enrich requests each domain's home page, reporting the status, Server
+// header, and title of the first scheme to respond, along with where it was
+// redirected to. Domains that don't respond at all are reported as not
+// serving rather than as errors, since many won't be live yet.
+func (e *httpEnricher) Enrich(ctx context.Context, a *notify.Alert) ([]notify.Enrichment, error) {
+	found := []notify.Enrichment{}
+	for _, domain := range enrichableDomains(a, e.MaxDomains) {
+		var failure error
+		responded := false
+		for _, scheme := range e.Schemes {
+			facts, err := e.probe(ctx, scheme+"://"+domain+"/")
+			if err != nil {
+				if ctx.Err() != nil {
+					return found, ctx.Err()
+				}
+				if failure == nil {
+					failure = err
+				}
+				continue
+			}
+			for _, f := range facts {
+				f.Domain = domain
+				found = append(found, f)
+			}
+			responded = true
+			break
+		}
+		if !responded {
+			found = append(found, notify.Enrichment{Domain: domain, Name: "HTTP", Value: "not serving (" + probeFailure(failure) + ")"})
+		}
+	}
+	return found, nil
+}
+
+// probe requests url, returning what it found about the response.
+func (e *httpEnricher) probe(ctx context.Context, url string) ([]notify.Enrichment, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.Timeout)
+	defer cancel()
+	req, err := http.NewRequest(e.Method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", e.UserAgent)
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	facts := []notify.Enrichment{{Name: "HTTP", Value: fmt.Sprintf("%s from %s", resp.Status, resp.Request.URL)}}
+	if location := resp.Header.Get("Location"); location != "" && resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		facts = append(facts, notify.Enrichment{Name: "Redirect", Value: location})
+	}
+	if server := resp.Header.Get("Server"); server != "" {
+		facts = append(facts, notify.Enrichment{Name: "Server", Value: truncate(server, 100)})
+	}
+	if e.Method == "GET" && strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 256<<10))
+		if title := pageTitle(body); title != "" {
+			facts = append(facts, notify.Enrichment{Name: "Title", Value: title})
+		}
+	}
+	return facts, nil
+}
+
+var titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// pageTitle returns an HTML page's title, with entities decoded and
+// whitespace collapsed.
+func pageTitle(body []byte) string {
+	m := titlePattern.FindSubmatch(body)
+	if m == nil {
+		return ""
+	}
+	return truncate(strings.Join(strings.Fields(html.UnescapeString(string(m[1]))), " "), 150)
+}
+
+// probeFailure briefly describes why a request failed, like "connection
+// refused" or "timed out".
+func probeFailure(err error) string {
+	if err == nil {
+		return "no response"
+	}
+	cause := errors.Cause(err)
+	if t, ok := cause.(interface{ Timeout() bool }); ok && t.Timeout() {
+		return "timed out"
+	}
+	msg := err.Error()
+	if i := strings.LastIndex(msg, ": "); i >= 0 {
+		msg = msg[i+2:]
+	}
+	return msg
+}
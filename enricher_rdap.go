@@ -0,0 +1,316 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize/english"
+	"github.com/pkg/errors"
+
+	"github.com/heptiolabs/certstream-slack/pkg/enrich"
+	"github.com/heptiolabs/certstream-slack/pkg/match"
+	"github.com/heptiolabs/certstream-slack/pkg/notify"
+)
+
+// rdapEnricher looks up when the matching domains' registrable domains were
+// registered, and by which registrar, using RDAP (the successor to WHOIS).
+// Newly registered domains imitating a brand are prime phishing candidates,
+// which rules can alert on more severely (see rule.NewDomainSeverity).
+type rdapEnricher struct {
+	// Server is an RDAP server to ask about every domain, like
+	// "https://rdap.org/", instead of the registry's server found in
+	// BootstrapURL, IANA's bootstrap file
+	Server       string `yaml:"server"`
+	BootstrapURL string `yaml:"bootstrap_url"`
+
+	// MaxDomains is how many registrable domains of an alert to look up (3
+	// by default)
+	MaxDomains int `yaml:"max_domains"`
+
+	mu sync.Mutex
+	// servers maps TLDs to their registries' RDAP servers, from the
+	// bootstrap file fetched at bootstrapped
+	servers      map[string]string
+	bootstrapped time.Time
+	// cache remembers what was found about registrable domains, since it
+	// rarely changes
+	cache map[string]rdapCacheEntry
+}
+
+type rdapCacheEntry struct {
+	found   []notify.Enrichment
+	expires time.Time
+}
+
+const (
+	defaultRDAPBootstrapURL = "https://data.iana.org/rdap/dns.json"
+	rdapBootstrapTTL        = 24 * time.Hour
+	rdapCacheTTL            = 6 * time.Hour
+	rdapCacheSize           = 10000
+)
+
+func init() {
+	registerEnricherType("rdap", func(decode func(interface{}) error) (enrich.Enricher, error) {
+		e := &rdapEnricher{BootstrapURL: defaultRDAPBootstrapURL, MaxDomains: 3}
+		if err := decode(e); err != nil {
+			return nil, err
+		}
+		if e.Server != "" && !strings.HasSuffix(e.Server, "/") {
+			e.Server += "/"
+		}
+		if e.MaxDomains < 1 {
+			return nil, errors.New("max_domains: must be at least 1")
+		}
+		e.cache = map[string]rdapCacheEntry{}
+		return e, nil
+	})
+}
+
+func (e *rdapEnricher) Name() string {
+	return "rdap"
+}
+
+// Enrich reports when each registrable domain was registered (like
+// "2024-05-01, 3 days ago") and by which registrar.
+func (e *rdapEnricher) Enrich(ctx context.Context, a *notify.Alert) ([]notify.Enrichment, error) {
+	found := []notify.Enrichment{}
+	seen := map[string]bool{}
+	for _, domain := range enrichableDomains(a, 0) {
+		registrable := match.RegistrableDomain(strings.ToLower(domain))
+		if registrable == "" || seen[registrable] {
+			continue
+		}
+		seen[registrable] = true
+		if len(seen) > e.MaxDomains {
+			break
+		}
+		facts, err := e.lookup(ctx, registrable)
+		if err != nil {
+			return found, errors.Wrapf(err, "could not look up %s", registrable)
+		}
+		found = append(found, facts...)
+	}
+	return found, nil
+}
+
+// lookup asks about a registrable domain, or returns what was found last
+// time.
+func (e *rdapEnricher) lookup(ctx context.Context, domain string) ([]notify.Enrichment, error) {
+	now := time.Now()
+	e.mu.Lock()
+	entry, ok := e.cache[domain]
+	e.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.found, nil
+	}
+
+	server, err := e.server(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	var found []notify.Enrichment
+	if server == "" {
+		found = []notify.Enrichment{{Domain: domain, Name: "RDAP", Value: "no RDAP server for this TLD"}}
+	} else {
+		var response rdapDomain
+		status, err := rdapGet(ctx, server+"domain/"+domain, &response)
+		switch {
+		case err != nil:
+			return nil, err
+		case status == http.StatusNotFound:
+			found = []notify.Enrichment{{Domain: domain, Name: "RDAP", Value: "not registered"}}
+		default:
+			found = response.enrichments(domain, now)
+		}
+	}
+
+	e.mu.Lock()
+	if len(e.cache) >= rdapCacheSize {
+		e.cache = map[string]rdapCacheEntry{}
+	}
+	e.cache[domain] = rdapCacheEntry{found: found, expires: now.Add(rdapCacheTTL)}
+	e.mu.Unlock()
+	return found, nil
+}
+
+// server returns the RDAP server for a domain, or "" if its TLD has none.
+func (e *rdapEnricher) server(ctx context.Context, domain string) (string, error) {
+	if e.Server != "" {
+		return e.Server, nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.servers == nil || time.Since(e.bootstrapped) > rdapBootstrapTTL {
+		var bootstrap struct {
+			Services [][][]string `json:"services"`
+		}
+		if _, err := rdapGet(ctx, e.BootstrapURL, &bootstrap); err != nil {
+			if e.servers == nil {
+				return "", errors.Wrap(err, "could not fetch the RDAP bootstrap file")
+			}
+			// keep using the old servers until the next try
+			log.WithError(err).Warn("could not refresh the RDAP bootstrap file")
+		} else {
+			e.servers = map[string]string{}
+			for _, service := range bootstrap.Services {
+				if len(service) < 2 || len(service[1]) == 0 {
+					continue
+				}
+				url := service[1][0]
+				for _, u := range service[1] {
+					if strings.HasPrefix(u, "https://") {
+						url = u
+						break
+					}
+				}
+				if !strings.HasSuffix(url, "/") {
+					url += "/"
+				}
+				for _, tld := range service[0] {
+					e.servers[strings.ToLower(tld)] = url
+				}
+			}
+		}
+		e.bootstrapped = time.Now()
+	}
+	return e.servers[domain[strings.LastIndex(domain, ".")+1:]], nil
+}
+
+// rdapGet fetches an RDAP JSON response into out, returning the status. A
+// 404 isn't an error, since that's how RDAP says a domain isn't registered.
+func rdapGet(ctx context.Context, url string, out interface{}) (int, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/rdap+json, application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return resp.StatusCode, nil
+	}
+	body, err := readResponse(resp)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	return resp.StatusCode, errors.Wrap(json.Unmarshal(body, out), "could not parse the response")
+}
+
+// rdapDomain is the part of an RDAP domain response we report.
+type rdapDomain struct {
+	Events []struct {
+		Action string `json:"eventAction"`
+		Date   string `json:"eventDate"`
+	} `json:"events"`
+	Entities []rdapEntity `json:"entities"`
+}
+
+type rdapEntity struct {
+	Roles      []string      `json:"roles"`
+	VCardArray []interface{} `json:"vcardArray"`
+	Entities   []rdapEntity  `json:"entities"`
+}
+
+// rdapRegistered is the layout of registration dates in enrichments.
+const rdapRegistered = "2006-01-02"
+
+// enrichments returns the registration date, with how long ago that was,
+// and the registrar's name.
+func (d *rdapDomain) enrichments(domain string, now time.Time) []notify.Enrichment {
+	found := []notify.Enrichment{}
+	for _, event := range d.Events {
+		if event.Action != "registration" {
+			continue
+		}
+		registered, err := time.Parse(time.RFC3339, event.Date)
+		if err != nil {
+			continue
+		}
+		value := registered.UTC().Format(rdapRegistered)
+		if age := now.Sub(registered); age > 0 {
+			value += ", " + formatAge(age) + " ago"
+		}
+		found = append(found, notify.Enrichment{Domain: domain, Name: "Registered", Value: value})
+		break
+	}
+	if registrar := rdapRegistrar(d.Entities); registrar != "" {
+		found = append(found, notify.Enrichment{Domain: domain, Name: "Registrar", Value: registrar})
+	}
+	return found
+}
+
+// formatAge describes how long ago a domain was registered, in years if
+// it's been a while.
+func formatAge(d time.Duration) string {
+	if year := 365 * 24 * time.Hour; d >= 2*year {
+		return english.Plural(int(d/year), "year", "")
+	}
+	return formatValidity(d)
+}
+
+// rdapRegistrar returns the formatted name of the entity with the
+// registrar role, if any.
+func rdapRegistrar(entities []rdapEntity) string {
+	for _, entity := range entities {
+		for _, role := range entity.Roles {
+			if role != "registrar" || len(entity.VCardArray) < 2 {
+				continue
+			}
+			properties, _ := entity.VCardArray[1].([]interface{})
+			for _, p := range properties {
+				property, _ := p.([]interface{})
+				if len(property) == 4 && property[0] == "fn" {
+					if name, ok := property[3].(string); ok {
+						return name
+					}
+				}
+			}
+		}
+		if name := rdapRegistrar(entity.Entities); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// registrationAge returns how recently the youngest of an alert's domains
+// was registered, if the rdap enricher found out.
+func registrationAge(a *notify.Alert, now time.Time) (time.Duration, bool) {
+	age, found := time.Duration(0), false
+	for _, f := range a.Enrichments {
+		if f.Source != "rdap" || f.Name != "Registered" || len(f.Value) < len(rdapRegistered) {
+			continue
+		}
+		registered, err := time.Parse(rdapRegistered, f.Value[:len(rdapRegistered)])
+		if err != nil {
+			continue
+		}
+		if d := now.Sub(registered); !found || d < age {
+			age, found = d, true
+		}
+	}
+	return age, found
+}
@@ -0,0 +1,293 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/heptiolabs/certstream-slack/pkg/enrich"
+	"github.com/heptiolabs/certstream-slack/pkg/notify"
+)
+
+// screenshotEnricher captures the matching domains' home pages with a
+// headless Chrome or Chromium, so whoever gets an alert can see what a
+// site, perhaps a phishing page, looks like without visiting it. Sinks that
+// can share files, like Slack with upload_screenshots, attach the images.
+type screenshotEnricher struct {
+	// Browser is the Chrome or Chromium binary to run, by default the first
+	// of chromium, chromium-browser, google-chrome, or headless_shell found
+	// in the PATH
+	Browser string `yaml:"browser"`
+
+	// NoSandbox runs the browser without its sandbox, which it needs when
+	// running as root, as in most containers
+	NoSandbox bool `yaml:"no_sandbox"`
+
+	// Delay is how long to wait for the page to render before capturing it
+	// (2s by default), and Timeout limits each capture altogether (20s by
+	// default)
+	Delay   time.Duration `yaml:"delay"`
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Width and Height are the size of the browser window, 1280 by 800 by
+	// default
+	Width  int `yaml:"width"`
+	Height int `yaml:"height"`
+
+	// MaxDomains is how many of an alert's domains to capture (1 by
+	// default, since each takes a browser)
+	MaxDomains int `yaml:"max_domains"`
+
+	// AllowPrivateAddresses lets the browser load pages, and anything they
+	// load, from loopback, private, and link-local addresses too
+	AllowPrivateAddresses bool `yaml:"allow_private_addresses"`
+
+	// transport forwards the browser's plain HTTP requests, unless private
+	// addresses are allowed
+	transport *http.Transport
+}
+
+// defaultBrowsers are tried in turn when no browser is configured.
+var defaultBrowsers = []string{"chromium", "chromium-browser", "google-chrome", "headless_shell"}
+
+func init() {
+	registerEnricherType("screenshot", func(decode func(interface{}) error) (enrich.Enricher, error) {
+		e := &screenshotEnricher{
+			Delay:      2 * time.Second,
+			Timeout:    20 * time.Second,
+			Width:      1280,
+			Height:     800,
+			MaxDomains: 1,
+		}
+		if err := decode(e); err != nil {
+			return nil, err
+		}
+		if e.Browser == "" {
+			for _, name := range defaultBrowsers {
+				if path, err := exec.LookPath(name); err == nil {
+					e.Browser = path
+					break
+				}
+			}
+			if e.Browser == "" {
+				return nil, errors.New("browser: no Chrome or Chromium found in the PATH")
+			}
+		} else if _, err := exec.LookPath(e.Browser); err != nil {
+			return nil, errors.Wrap(err, "browser")
+		}
+		if e.Delay < 0 {
+			return nil, errors.New("delay: must not be negative")
+		}
+		if e.Timeout <= e.Delay {
+			return nil, errors.New("timeout: must be longer than delay")
+		}
+		if e.Width < 1 || e.Height < 1 {
+			return nil, errors.New("width and height: must be positive")
+		}
+		if e.MaxDomains < 1 {
+			return nil, errors.New("max_domains: must be at least 1")
+		}
+		if !e.AllowPrivateAddresses {
+			e.transport = http.DefaultTransport.(*http.Transport).Clone()
+			e.transport.DisableKeepAlives = true
+			refusePrivateAddresses(e.transport)
+		}
+		return e, nil
+	})
+}
+
+func (e *screenshotEnricher) Name() string {
+	return "screenshot"
+}
+
+// Enrich captures each domain's home page over HTTPS. Pages that can't be
+// captured are reported with the browser's error rather than failing the
+// enricher, since many new domains won't be serving yet, as are domains
+// resolving to private addresses, unless they're allowed.
+func (e *screenshotEnricher) Enrich(ctx context.Context, a *notify.Alert) ([]notify.Enrichment, error) {
+	found := []notify.Enrichment{}
+	for _, domain := range enrichableDomains(a, e.MaxDomains) {
+		var png []byte
+		var err error
+		if e.transport != nil {
+			_, err = resolvePublic(ctx, domain)
+		}
+		if err == nil {
+			png, err = e.capture(ctx, "https://"+domain+"/")
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return found, ctx.Err()
+			}
+			found = append(found, notify.Enrichment{Domain: domain, Name: "Screenshot", Value: "not captured (" + truncate(err.Error(), 100) + ")"})
+			continue
+		}
+		found = append(found, notify.Enrichment{
+			Domain: domain,
+			Name:   "Screenshot",
+			Value:  fmt.Sprintf("captured (%dx%d)", e.Width, e.Height),
+			Data:   png,
+		})
+	}
+	return found, nil
+}
+
+// capture runs the browser to screenshot url, returning the PNG.
+func (e *screenshotEnricher) capture(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.Timeout)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "certstream-slack-screenshot")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "screenshot.png")
+
+	args := []string{
+		"--headless",
+		"--disable-gpu",
+		"--hide-scrollbars",
+		"--mute-audio",
+		"--no-first-run",
+		"--user-data-dir=" + filepath.Join(dir, "profile"),
+		"--window-size=" + strconv.Itoa(e.Width) + "," + strconv.Itoa(e.Height),
+		"--virtual-time-budget=" + strconv.FormatInt(int64(e.Delay/time.Millisecond), 10),
+		"--screenshot=" + path,
+	}
+	if e.NoSandbox {
+		args = append(args, "--no-sandbox")
+	}
+	if e.transport != nil {
+		// the page can redirect or load from anywhere, so every connection
+		// goes through a proxy checking where it's to, without the usual
+		// exception for loopback addresses or WebRTC's own connections
+		proxy, err := e.startProxy(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not start proxy")
+		}
+		defer proxy.Close()
+		args = append(args,
+			"--proxy-server=http://"+proxy.Addr().String(),
+			"--proxy-bypass-list=<-loopback>",
+			"--force-webrtc-ip-handling-policy=disable_non_proxied_udp",
+		)
+	}
+	cmd := exec.CommandContext(ctx, e.Browser, append(args, url)...)
+	// don't wait for the browser's own processes to close its output
+	// once it's been killed
+	cmd.WaitDelay = time.Second
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	png, readErr := ioutil.ReadFile(path)
+	if readErr != nil || len(png) == 0 {
+		if err != nil {
+			return nil, errors.Errorf("%s: %s", err, lastLine(out))
+		}
+		return nil, errors.Errorf("no screenshot written: %s", lastLine(out))
+	}
+	return png, nil
+}
+
+// startProxy starts an HTTP proxy for the browser on a loopback port,
+// refusing to connect to private addresses. It stops when the listener it
+// returns is closed, and tunnels end with the browser's connections.
+func (e *screenshotEnricher) startProxy(ctx context.Context) (net.Listener, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "CONNECT" {
+			e.tunnel(ctx, w, r)
+			return
+		}
+		r.RequestURI = ""
+		r.Header.Del("Proxy-Connection")
+		resp, err := e.transport.RoundTrip(r.WithContext(ctx))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		for name, values := range resp.Header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	})}
+	go server.Serve(listener)
+	return listener, nil
+}
+
+// tunnel connects the browser to the host it asks its proxy for, unless
+// the host resolves to a private address.
+func (e *screenshotEnricher) tunnel(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	upstream, err := dialPublic(ctx, r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "can't tunnel", http.StatusInternalServerError)
+		return
+	}
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+		conn.Close()
+		upstream.Close()
+		return
+	}
+	go func() {
+		io.Copy(upstream, buffered)
+		upstream.Close()
+		conn.Close()
+	}()
+	io.Copy(conn, upstream)
+	conn.Close()
+	upstream.Close()
+}
+
+// lastLine returns the last non-empty line of a command's output, which is
+// usually its error, or "no output".
+func lastLine(out []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		return truncate(last, 100)
+	}
+	return "no output"
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/heptiolabs/certstream-slack/pkg/enrich"
+	"github.com/heptiolabs/certstream-slack/pkg/notify"
+)
+
+// urlscanEnricher submits the matching domains to urlscan.io, linking to
+// the scans and, if they finish in time, their verdicts.
+type urlscanEnricher struct {
+	APIKey string `yaml:"api_key"`
+
+	// APIURL is the urlscan.io API, "https://urlscan.io/api/v1/" by default
+	APIURL string `yaml:"api_url"`
+
+	// Visibility is "public", "unlisted" (the default), or "private"
+	Visibility string `yaml:"visibility"`
+
+	// Wait, if set, is how long to wait for each scan's verdict, within the
+	// enrich_timeout. Scans usually take 10 to 30 seconds.
+	Wait time.Duration `yaml:"wait"`
+
+	// MaxDomains is how many of an alert's domains to submit (1 by
+	// default)
+	MaxDomains int `yaml:"max_domains"`
+
+	// poll is how often to check whether a scan has finished
+	poll time.Duration
+}
+
+func init() {
+	registerEnricherType("urlscan", func(decode func(interface{}) error) (enrich.Enricher, error) {
+		e := &urlscanEnricher{APIURL: "https://urlscan.io/api/v1/", Visibility: "unlisted", MaxDomains: 1, poll: 2 * time.Second}
+		if err := decode(e); err != nil {
+			return nil, err
+		}
+		if e.APIKey == "" {
+			return nil, errors.New("api_key: must be set")
+		}
+		if !strings.HasSuffix(e.APIURL, "/") {
+			e.APIURL += "/"
+		}
+		switch e.Visibility {
+		case "public", "unlisted", "private":
+		default:
+			return nil, errors.Errorf("visibility: must be \"public\", \"unlisted\", or \"private\", not %q", e.Visibility)
+		}
+		if e.Wait < 0 {
+			return nil, errors.New("wait: must not be negative")
+		}
+		if e.MaxDomains < 1 {
+			return nil, errors.New("max_domains: must be at least 1")
+		}
+		return e, nil
+	})
+}
+
+func (e *urlscanEnricher) Name() string {
+	return "urlscan"
+}
+
+// Enrich submits https://<domain>/ for each domain, reporting the link to
+// the scan with its verdict, like "malicious (score 100)", if it's ready
+// within Wait.
+func (e *urlscanEnricher) Enrich(ctx context.Context, a *notify.Alert) ([]notify.Enrichment, error) {
+	found := []notify.Enrichment{}
+	for _, domain := range enrichableDomains(a, e.MaxDomains) {
+		var submitted struct {
+			UUID   string `json:"uuid"`
+			Result string `json:"result"`
+		}
+		request := map[string]interface{}{"url": "https://" + domain + "/", "visibility": e.Visibility, "tags": []string{"certstream-slack", a.Rule}}
+		if _, err := e.call(ctx, "POST", "scan/", request, &submitted); err != nil {
+			return found, errors.Wrapf(err, "could not submit %s", domain)
+		}
+		value := submitted.Result
+		if e.Wait > 0 && submitted.UUID != "" {
+			if verdict := e.verdict(ctx, submitted.UUID); verdict != "" {
+				value = verdict + ": " + value
+			}
+		}
+		found = append(found, notify.Enrichment{Domain: domain, Name: "urlscan.io", Value: value})
+	}
+	return found, nil
+}
+
+// verdict polls for a scan's result until it's ready or Wait is up,
+// returning its overall verdict, or "" if it isn't ready.
+func (e *urlscanEnricher) verdict(ctx context.Context, uuid string) string {
+	ctx, cancel := context.WithTimeout(ctx, e.Wait)
+	defer cancel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ""
+		case <-time.After(e.poll):
+		}
+		var result struct {
+			Verdicts struct {
+				Overall struct {
+					Score     int  `json:"score"`
+					Malicious bool `json:"malicious"`
+				} `json:"overall"`
+			} `json:"verdicts"`
+		}
+		status, err := e.call(ctx, "GET", "result/"+uuid+"/", nil, &result)
+		if status == http.StatusNotFound {
+			// not finished yet
+			continue
+		}
+		if err != nil {
+			return ""
+		}
+		overall := result.Verdicts.Overall
+		if overall.Malicious {
+			return fmt.Sprintf("malicious (score %d)", overall.Score)
+		}
+		return fmt.Sprintf("not malicious (score %d)", overall.Score)
+	}
+}
+
+// call makes an API request, decoding the response into out, and returns
+// the status.
+func (e *urlscanEnricher) call(ctx context.Context, method, path string, request, out interface{}) (int, error) {
+	var body []byte
+	if request != nil {
+		var err error
+		if body, err = json.Marshal(request); err != nil {
+			return 0, err
+		}
+	}
+	req, err := http.NewRequest(method, e.APIURL+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("API-Key", e.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	data, err := readResponse(resp)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	return resp.StatusCode, errors.Wrap(json.Unmarshal(data, out), "could not parse the response")
+}
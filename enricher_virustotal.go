@@ -0,0 +1,123 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/heptiolabs/certstream-slack/pkg/enrich"
+	"github.com/heptiolabs/certstream-slack/pkg/notify"
+)
+
+// virusTotalEnricher looks up what VirusTotal's engines make of the
+// matching domains, linking to its report on each.
+type virusTotalEnricher struct {
+	APIKey string `yaml:"api_key"`
+
+	// APIURL is the VirusTotal API, "https://www.virustotal.com/api/v3/" by
+	// default
+	APIURL string `yaml:"api_url"`
+
+	// MaxDomains is how many of an alert's domains to look up (3 by
+	// default, since the public API allows 4 requests a minute)
+	MaxDomains int `yaml:"max_domains"`
+}
+
+func init() {
+	registerEnricherType("virustotal", func(decode func(interface{}) error) (enrich.Enricher, error) {
+		e := &virusTotalEnricher{APIURL: "https://www.virustotal.com/api/v3/", MaxDomains: 3}
+		if err := decode(e); err != nil {
+			return nil, err
+		}
+		if e.APIKey == "" {
+			return nil, errors.New("api_key: must be set")
+		}
+		if !strings.HasSuffix(e.APIURL, "/") {
+			e.APIURL += "/"
+		}
+		if e.MaxDomains < 1 {
+			return nil, errors.New("max_domains: must be at least 1")
+		}
+		return e, nil
+	})
+}
+
+func (e *virusTotalEnricher) Name() string {
+	return "virustotal"
+}
+
+// Enrich reports how many engines flag each domain as malicious or
+// suspicious, with a link to its report, like "2 malicious, 1 suspicious of
+// 94 engines: https://www.virustotal.com/gui/domain/example.com".
+func (e *virusTotalEnricher) Enrich(ctx context.Context, a *notify.Alert) ([]notify.Enrichment, error) {
+	found := []notify.Enrichment{}
+	for _, domain := range enrichableDomains(a, e.MaxDomains) {
+		report := "https://www.virustotal.com/gui/domain/" + url.PathEscape(domain)
+		req, err := http.NewRequest("GET", e.APIURL+"domains/"+url.PathEscape(domain), nil)
+		if err != nil {
+			return found, err
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("x-apikey", e.APIKey)
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return found, errors.Wrapf(err, "could not look up %s", domain)
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			found = append(found, notify.Enrichment{Domain: domain, Name: "VirusTotal", Value: "not seen yet: " + report})
+			continue
+		}
+		body, err := readResponse(resp)
+		resp.Body.Close()
+		if err != nil {
+			return found, errors.Wrapf(err, "could not look up %s", domain)
+		}
+		var response struct {
+			Data struct {
+				Attributes struct {
+					Stats map[string]int `json:"last_analysis_stats"`
+				} `json:"attributes"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return found, errors.Wrapf(err, "could not parse the report on %s", domain)
+		}
+		stats := response.Data.Attributes.Stats
+		engines := 0
+		for _, n := range stats {
+			engines += n
+		}
+		verdict := "clean"
+		switch {
+		case stats["malicious"] > 0 && stats["suspicious"] > 0:
+			verdict = fmt.Sprintf("%d malicious, %d suspicious", stats["malicious"], stats["suspicious"])
+		case stats["malicious"] > 0:
+			verdict = fmt.Sprintf("%d malicious", stats["malicious"])
+		case stats["suspicious"] > 0:
+			verdict = fmt.Sprintf("%d suspicious", stats["suspicious"])
+		}
+		found = append(found, notify.Enrichment{Domain: domain, Name: "VirusTotal", Value: fmt.Sprintf("%s of %d engines: %s", verdict, engines, report)})
+	}
+	return found, nil
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// matchObserver is told about every match, such as to record or display it.
+type matchObserver interface {
+	observe(r *matchRecord)
+}
+
+// matchFeed rebroadcasts matches to subscribers of /stream, as server-sent
+// events or over a websocket, so that other tools can follow just the
+// certificates that matched rather than the whole certstream firehose.
+type matchFeed struct {
+	mu          sync.Mutex
+	subscribers map[chan *matchRecord]bool
+}
+
+// feedBuffer is how many matches can wait for a slow subscriber before more
+// are dropped.
+const feedBuffer = 100
+
+func newMatchFeed() *matchFeed {
+	return &matchFeed{subscribers: map[chan *matchRecord]bool{}}
+}
+
+func (f *matchFeed) observe(r *matchRecord) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subscribers {
+		select {
+		case ch <- r:
+		default:
+			log.WithField("fingerprint", r.Fingerprint).Debug("dropping match for slow /stream subscriber")
+		}
+	}
+}
+
+func (f *matchFeed) subscribe() chan *matchRecord {
+	ch := make(chan *matchRecord, feedBuffer)
+	f.mu.Lock()
+	f.subscribers[ch] = true
+	f.mu.Unlock()
+	return ch
+}
+
+func (f *matchFeed) unsubscribe(ch chan *matchRecord) {
+	f.mu.Lock()
+	delete(f.subscribers, ch)
+	f.mu.Unlock()
+}
+
+var feedUpgrader = websocket.Upgrader{
+	// the feed is read-only, so any page may subscribe to it
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// ServeHTTP streams matches, optionally only those for the rule named by the
+// "rule" query parameter, over a websocket if the client asks to upgrade or
+// else as server-sent events.
+func (f *matchFeed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rule := r.URL.Query().Get("rule")
+	if websocket.IsWebSocketUpgrade(r) {
+		f.serveWebsocket(w, r, rule)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	ch := f.subscribe()
+	defer f.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// comment lines keep proxies from timing out an idle stream
+	keepalive := time.NewTicker(30 * time.Second)
+	defer keepalive.Stop()
+	for {
+		select {
+		case m := <-ch:
+			if rule != "" && m.Rule != rule {
+				continue
+			}
+			data, err := json.Marshal(m)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: match\ndata: %s\n\n", data); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func (f *matchFeed) serveWebsocket(w http.ResponseWriter, r *http.Request, rule string) {
+	conn, err := feedUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already replied with an error
+		return
+	}
+	defer conn.Close()
+
+	ch := f.subscribe()
+	defer f.unsubscribe(ch)
+
+	// read (and ignore) messages so that a close from the client is noticed
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(30 * time.Second)
+	defer ping.Stop()
+	for {
+		select {
+		case m := <-ch:
+			if rule != "" && m.Rule != rule {
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := conn.WriteJSON(m); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
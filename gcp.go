@@ -0,0 +1,259 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// gcpTokenSource gets OAuth access tokens using Google's Application Default
+// Credentials: the JSON key file named by GOOGLE_APPLICATION_CREDENTIALS,
+// then gcloud's application default credentials, then the metadata server
+// on GCE and GKE (including Workload Identity). Tokens are cached until
+// shortly before they expire.
+type gcpTokenSource struct {
+	scope string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// gcpCredentialsFile is a JSON key file, for either a service account or a
+// user who ran "gcloud auth application-default login".
+type gcpCredentialsFile struct {
+	Type string `json:"type"`
+
+	// for service accounts
+	ProjectID    string `json:"project_id"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+
+	// for users
+	ClientID       string `json:"client_id"`
+	ClientSecret   string `json:"client_secret"`
+	RefreshToken   string `json:"refresh_token"`
+	QuotaProjectID string `json:"quota_project_id"`
+}
+
+// gcpTokenURL is Google's OAuth token endpoint.
+const gcpTokenURL = "https://oauth2.googleapis.com/token"
+
+func newGCPTokenSource(scope string) *gcpTokenSource {
+	return &gcpTokenSource{scope: scope}
+}
+
+// get returns a valid access token.
+func (s *gcpTokenSource) get() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Until(s.expires) > 5*time.Minute {
+		return s.token, nil
+	}
+
+	creds, err := gcpReadCredentialsFile()
+	if err != nil {
+		return "", err
+	}
+	var token string
+	var lifetime time.Duration
+	switch {
+	case creds == nil:
+		token, lifetime, err = gcpMetadataToken(s.scope)
+	case creds.Type == "service_account":
+		token, lifetime, err = gcpServiceAccountToken(creds, s.scope)
+	case creds.Type == "authorized_user":
+		token, lifetime, err = gcpExchangeToken(gcpTokenURL, url.Values{
+			"grant_type":    {"refresh_token"},
+			"client_id":     {creds.ClientID},
+			"client_secret": {creds.ClientSecret},
+			"refresh_token": {creds.RefreshToken},
+		})
+	default:
+		err = errors.Errorf("unsupported credentials type %q", creds.Type)
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "could not get Google Cloud access token")
+	}
+	s.token, s.expires = token, time.Now().Add(lifetime)
+	return token, nil
+}
+
+// gcpReadCredentialsFile reads GOOGLE_APPLICATION_CREDENTIALS or gcloud's
+// application default credentials, returning nil if there are neither.
+func gcpReadCredentialsFile() (*gcpCredentialsFile, error) {
+	path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	explicit := path != ""
+	if !explicit {
+		dir := os.Getenv("CLOUDSDK_CONFIG")
+		if dir == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, nil
+			}
+			dir = filepath.Join(home, ".config", "gcloud")
+		}
+		path = filepath.Join(dir, "application_default_credentials.json")
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && !explicit {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "could not read Google Cloud credentials")
+	}
+	creds := &gcpCredentialsFile{}
+	if err := json.Unmarshal(data, creds); err != nil {
+		return nil, errors.Wrapf(err, "could not parse %s", path)
+	}
+	return creds, nil
+}
+
+// gcpProjectID returns the default project: GOOGLE_CLOUD_PROJECT, else the
+// credentials file's, else the metadata server's.
+func gcpProjectID() string {
+	if project := os.Getenv("GOOGLE_CLOUD_PROJECT"); project != "" {
+		return project
+	}
+	if creds, err := gcpReadCredentialsFile(); err == nil && creds != nil {
+		if creds.ProjectID != "" {
+			return creds.ProjectID
+		}
+		return creds.QuotaProjectID
+	}
+	data, err := gcpMetadata("project/project-id")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// gcpServiceAccountToken signs a JWT with the service account's key and
+// exchanges it for an access token.
+func gcpServiceAccountToken(creds *gcpCredentialsFile, scope string) (string, time.Duration, error) {
+	block, _ := pem.Decode([]byte(creds.PrivateKey))
+	if block == nil {
+		return "", 0, errors.New("service account private_key is not PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return "", 0, errors.Wrap(err, "could not parse service account private_key")
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", 0, errors.New("service account private_key is not an RSA key")
+	}
+
+	tokenURI := valueOr(creds.TokenURI, gcpTokenURL)
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": creds.PrivateKeyID})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   creds.ClientEmail,
+		"scope": scope,
+		"aud":   tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", 0, err
+	}
+	return gcpExchangeToken(tokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {unsigned + "." + enc.EncodeToString(signature)},
+	})
+}
+
+// gcpExchangeToken makes an OAuth token request.
+func gcpExchangeToken(tokenURL string, form url.Values) (string, time.Duration, error) {
+	resp, err := httpClient.PostForm(tokenURL, form)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	body, err := readResponse(resp)
+	if err != nil {
+		return "", 0, err
+	}
+	return gcpParseToken(body)
+}
+
+// gcpMetadataToken gets the access token of the instance's (or, on GKE
+// with Workload Identity, the pod's) service account.
+func gcpMetadataToken(scope string) (string, time.Duration, error) {
+	body, err := gcpMetadata("instance/service-accounts/default/token?scopes=" + url.QueryEscape(scope))
+	if err != nil {
+		return "", 0, errors.Wrap(err, "no credentials file and no metadata server")
+	}
+	return gcpParseToken(body)
+}
+
+// gcpMetadata gets a value from the GCE metadata server.
+func gcpMetadata(path string) ([]byte, error) {
+	host := os.Getenv("GCE_METADATA_HOST")
+	if host == "" {
+		host = "169.254.169.254"
+	}
+	req, err := http.NewRequest("GET", "http://"+host+"/computeMetadata/v1/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := metadataClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return readResponse(resp)
+}
+
+func gcpParseToken(body []byte) (string, time.Duration, error) {
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", 0, errors.Wrap(err, "could not parse token response")
+	}
+	if result.AccessToken == "" {
+		return "", 0, errors.New("token response has no access_token")
+	}
+	return result.AccessToken, time.Duration(result.ExpiresIn) * time.Second, nil
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"strings"
+
+	"github.com/heptiolabs/certstream-slack/pkg/stream"
+)
+
+// issuerSpec describes the CAs a rule is limited to, or skips, by the
+// attributes of the certificates' issuer names. Every attribute that's set
+// must match, ignoring case.
+type issuerSpec struct {
+	CommonName   string `yaml:"common_name"`
+	Organization string `yaml:"organization"`
+	Country      string `yaml:"country"`
+}
+
+// matches reports whether an issuer fits the spec.
+func (s issuerSpec) matches(issuer stream.Name) bool {
+	for _, attr := range []struct{ want, got string }{{s.CommonName, issuer.CN}, {s.Organization, issuer.O}, {s.Country, issuer.C}} {
+		if attr.want != "" && !strings.EqualFold(strings.TrimSpace(attr.got), attr.want) {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the spec like an issuer name, such as "/O=Let's Encrypt".
+func (s issuerSpec) String() string {
+	name := ""
+	for _, attr := range []struct{ key, value string }{{"C", s.Country}, {"O", s.Organization}, {"CN", s.CommonName}} {
+		if attr.value != "" {
+			name += "/" + attr.key + "=" + attr.value
+		}
+	}
+	return name
+}
+
+// issuerAllowed reports whether the rule matches certificates from issuer:
+// one of its Issuers, if any, and none of its ExcludeIssuers.
+func (r *rule) issuerAllowed(issuer stream.Name) bool {
+	for _, s := range r.ExcludeIssuers {
+		if s.matches(issuer) {
+			return false
+		}
+	}
+	if len(r.Issuers) == 0 {
+		return true
+	}
+	for _, s := range r.Issuers {
+		if s.matches(issuer) {
+			return true
+		}
+	}
+	return false
+}
+
+// chainAllowed reports whether the rule matches certificates with the CAs
+// in cas: one matching any of its ChainsTo, if any, and none matching its
+// ExcludeChainsTo.
+func (r *rule) chainAllowed(cas []stream.Name) bool {
+	for _, s := range r.ExcludeChainsTo {
+		for _, ca := range cas {
+			if s.matches(ca) {
+				return false
+			}
+		}
+	}
+	if len(r.ChainsTo) == 0 {
+		return true
+	}
+	for _, s := range r.ChainsTo {
+		for _, ca := range cas {
+			if s.matches(ca) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// chainCAs lists the names of the CAs in an update's chain, from the
+// leaf's issuer up to the root, which is named by the issuer of the last
+// certificate in the chain if the chain doesn't include it.
+func chainCAs(u *stream.CertificateUpdate) []stream.Name {
+	cas := []stream.Name{u.LeafCert.Issuer}
+	for _, c := range u.Chain {
+		if c.Subject.Aggregated != cas[len(cas)-1].Aggregated {
+			cas = append(cas, c.Subject)
+		}
+	}
+	if n := len(u.Chain); n > 0 && u.Chain[n-1].Issuer.Aggregated != cas[len(cas)-1].Aggregated {
+		cas = append(cas, u.Chain[n-1].Issuer)
+	}
+	return cas
+}
+
+// issuerNames lists issuer specs for descriptions.
+func issuerNames(specs []issuerSpec) string {
+	names := []string{}
+	for _, s := range specs {
+		names = append(names, s.String())
+	}
+	return strings.Join(names, ", ")
+}
@@ -16,112 +16,235 @@ limitations under the License.
 package main
 
 import (
-	"fmt"
+	"math/rand"
 	"os"
-	"regexp"
-	"sort"
-	"strings"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"github.com/dustin/go-humanize/english"
-
-	slack "github.com/ashwanthkumar/slack-go-webhook"
-	"github.com/gorilla/websocket"
-	"github.com/jmoiron/jsonq"
 	"github.com/sirupsen/logrus"
+
+	"github.com/heptiolabs/certstream-slack/pkg/stream"
 )
 
 var log = logrus.New()
-var certStreamURL = "wss://certstream.calidog.io"
 
 func main() {
-	// get the Slack webhook URL
-	webhookURL := os.Getenv("SLACK_WEBHOOK_URL")
-	if webhookURL == "" {
-		log.Fatal("SLACK_WEBHOOK_URL must be set")
+	runCommand(os.Args[1:])
+}
+
+// newSource returns the configured source, or a multiSource running each of
+// the configured sources and certstream servers.
+func newSource(cfg *config) source {
+	// the CT, crt.sh and Cert Spotter sources share the state file
+	var state *ctState
+	if cfg.CTStateFile != "" && (cfg.hasSource("ct") || cfg.hasSource("crtsh") || cfg.hasSource("certspotter")) {
+		var err error
+		state, err = loadCTState(cfg.CTStateFile)
+		if err != nil {
+			log.WithError(err).Fatal("could not load source positions")
+		}
 	}
 
-	// get and compile the domain pattern regex
-	domainPattern := os.Getenv("DOMAIN_PATTERN")
-	if domainPattern == "" {
-		log.Fatal("DOMAIN_PATTERN must be set")
+	sources, names := []source{}, []string{}
+	for _, name := range cfg.sources {
+		switch name {
+		case "certstream":
+			for _, endpoint := range cfg.streams {
+				sources = append(sources, newCertstreamSource(cfg, endpoint))
+				if len(cfg.streams) > 1 {
+					names = append(names, "certstream "+endpoint.url)
+				} else {
+					names = append(names, "certstream")
+				}
+			}
+			continue
+		case "replay":
+			sources = append(sources, newReplaySource(cfg.ReplayFile))
+		case "ct":
+			logs := []ctLog{}
+			for _, url := range cfg.CTLogs {
+				logs = append(logs, ctLog{URL: url, Name: url})
+			}
+			ct := newCTSource(logs, cfg.CTLogList, cfg.CTPollInterval, cfg.CTBatchSize)
+			ct.state = state
+			sources = append(sources, ct)
+		case "crtsh":
+			crtsh := newCrtshSource(cfg.CrtshURL, cfg.CrtshIdentities, cfg.CrtshPollInterval)
+			crtsh.state = state
+			sources = append(sources, crtsh)
+		case "certspotter":
+			certspotter := newCertspotterSource(cfg.CertspotterURL, cfg.CertspotterToken, cfg.CertspotterDomains, cfg.CertspotterPollInterval)
+			certspotter.state = state
+			sources = append(sources, certspotter)
+		}
+		names = append(names, name)
 	}
-	domainRegex, err := regexp.Compile(domainPattern)
-	if err != nil {
-		log.WithError(err).Fatal("invalid DOMAIN_PATTERN")
+	if len(sources) == 1 {
+		return sources[0]
 	}
+	log.WithField("sources", names).Info("merging certificates from several sources")
+	return newMultiSource(sources, names)
+}
 
-	// connect to certstream via secure websocket
-	conn, _, err := websocket.DefaultDialer.Dial(certStreamURL, nil)
-	if err != nil {
-		log.WithError(err).Fatal("could not connect to certstream")
+// watch watches the source for certificates matching the rules in cfg, and
+// alerts their sinks, until it's interrupted. Reloads apply override to the
+// reloaded config, like loading cfg did.
+func watch(cfg *config, override func(c *config)) {
+	var err error
+
+	// seed the PRNG used to jitter reconnection delays
+	rand.Seed(time.Now().UnixNano())
+
+	// connect to certstream via secure websocket, tail CT logs directly,
+	// poll crt.sh or Cert Spotter, or replay a file, or several of those
+	// at once
+	s := newSource(cfg)
+
+	if cfg.DryRun {
+		log.Info("dry run: printing alerts instead of sending them")
 	}
-	defer conn.Close()
 
-	// loop over each message sent in the websocket
-	log.WithField("domainPattern", domainRegex.String()).Info("watching for certificates")
-	for {
-		// read a JSON message from the websocket and parse it using jsonq
-		var msg interface{}
-		err = conn.ReadJSON(&msg)
-		if err != nil {
-			log.WithError(err).Fatalf("error decoding JSON")
+	// handle each certificate update
+	for _, r := range cfg.Rules {
+		sinks := []string{}
+		for _, s := range r.sinks {
+			sinks = append(sinks, s.name)
 		}
-		jq := jsonq.NewQuery(msg)
+		log.WithField("rule", r.Name).WithField("domainPattern", r.description()).WithField("sinks", sinks).Info("watching for certificates")
+	}
+	w := &watcher{
+		rules:      newRuleSet(cfg.Rules),
+		normalize:  cfg.NormalizeDomains,
+		maxDomains: cfg.MaxDomainsInAlert,
+		exclude:    cfg.exclude,
+		dedupKey:   cfg.DedupKey,
 
-		// skip everything that's not a "certificate_update" (e.g., heartbeats)
-		if t, _ := jq.String("message_type"); t != "certificate_update" {
-			continue
-		}
+		cooldownNotes: cfg.CooldownNotes,
 
-		// pull the list of all the domains named in the leaf certificate (CN and SANs)
-		domains, err := jq.ArrayOfStrings("data", "leaf_cert", "all_domains")
+		enrichment: cfg.enrichment,
+	}
+	w.held = newQuietHold(w.sendHeld)
+	w.startEnriching(cfg.EnrichWorkers, cfg.EnrichQueueSize, cfg.hasSource("certstream"))
+	if cfg.DedupSize > 0 {
+		w.dedup = newDedupCache(cfg.DedupSize, cfg.DedupTTL)
+	}
+	w.cooldowns = newCooldownCache(cfg.CooldownSize)
+	w.tracer = newTracer(cfg.OTLPEndpoint, cfg.OTLPHeaders, cfg.TraceSampleRatio)
+	if w.tracer != nil {
+		log.WithField("endpoint", cfg.OTLPEndpoint).Info("exporting traces")
+	}
+	var store *matchStore
+	if cfg.DBPath != "" {
+		store, err = openMatchStore(cfg.DBPath, cfg.DBRetention)
 		if err != nil {
-			log.WithError(err).Error("couldn't get domains")
-			continue
-		}
-
-		// collect a list of matching domains
-		matches := []string{}
-		for _, domain := range domains {
-			if !domainRegex.MatchString(domain) {
-				continue
-			}
-			// wrap each domain in backticks for a prettier Slack message
-			matches = append(matches, "`"+domain+"`")
+			log.WithError(err).Fatal("could not open match store")
 		}
+		defer store.close()
+		w.observers = append(w.observers, store)
+	}
 
-		// if none of the domains match our regex, we're done
-		if len(matches) == 0 {
-			continue
-		}
+	// reload the rules and sinks without interrupting the source on SIGHUP,
+	// or when the config's files change if they're watched
+	reload := newReloader(w, override, cfg)
+	if cfg.WatchConfig {
+		go reload.watch(2 * time.Second)
+	}
 
-		// report the matches in sorted order
-		sort.Strings(matches)
+	// post reports on their schedules, to the sinks in the config in use
+	if len(cfg.Reports) > 0 {
+		w.reports = newReporter(cfg.Reports, reload.config)
+	}
 
-		// generate a message like " and X others" if there are extra domains in
-		// the cert that didn't match
-		additionalDomains := len(domains) - len(matches)
-		if additionalDomains > 0 {
-			matches = append(matches, fmt.Sprintf("%d others", additionalDomains))
+	var app *slackApp
+	if cfg.SlackSigningSecret != "" {
+		suppressions, err := openSuppressionStore(store)
+		if err != nil {
+			log.WithError(err).Fatal("could not read suppressions from match store")
 		}
-
-		// pull the certificate fingerprint and use it to get the crt.sh URL
-		fingerprint, err := jq.String("data", "leaf_cert", "fingerprint")
+		watches, err := openWatchStore(cfg.WatchesFile)
 		if err != nil {
-			log.WithError(err).Error("could not parse fingerprint from matching certificate")
+			log.WithError(err).Fatal("could not open watches file")
 		}
-		certURL := fmt.Sprintf("https://crt.sh/?q=%s", strings.Replace(fingerprint, ":", "", -1))
-
-		// post the Slack message
-		payload := slack.Payload{
-			Text: fmt.Sprintf(
-				"Found matching certificate for %s: %s",
-				english.OxfordWordSeries(matches, "and"),
-				certURL,
-			),
+		w.suppressions, w.watches = suppressions, watches
+		reload.refresh()
+		for _, r := range w.watchRules(cfg) {
+			log.WithField("rule", r.Name).WithField("domainPattern", r.description()).Info("watching for certificates added from Slack")
 		}
-		for _, err := range slack.Send(webhookURL, "", payload) {
-			log.WithError(err).WithField("fingerprint", fingerprint).Error("error sending webhook")
+		app = &slackApp{signingSecret: cfg.SlackSigningSecret, suppressions: suppressions, watches: watches, reload: reload}
+	}
+
+	// serve metrics, health checks, match history, the feed of matches, and
+	// the Slack app in the background
+	if cfg.ListenAddr != "" {
+		feed := newMatchFeed()
+		w.observers = append(w.observers, feed)
+		go serveHTTP(cfg.ListenAddr, s, cfg.HealthTimeout, store, feed, app)
+	}
+	if cfg.DebugAddr != "" {
+		go serveDebug(cfg.DebugAddr)
+	}
+	if cfg.DashboardAddr != "" {
+		d := newDashboard(s)
+		log.Hooks.Add(d)
+		w.observers = append(w.observers, d)
+		go d.serve(cfg.DashboardAddr, cfg.DashboardUser, cfg.DashboardPassword)
+	}
+
+	// on SIGINT or SIGTERM, disconnect and finish up
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		for sig := range signals {
+			if sig == syscall.SIGHUP {
+				log.Info("received SIGHUP, reloading")
+				if err := reload.reload(); err != nil {
+					log.WithError(err).Error("could not reload configuration, keeping the current one")
+				}
+				continue
+			}
+			log.WithField("signal", sig.String()).Info("shutting down")
+			s.stop()
+			return
+		}
+	}()
+
+	// process messages in the background so that slow sinks don't hold up
+	// the source; only certstream can't wait, so other sources never drop
+	// messages unless they run alongside it
+	var dropMessage func(msg interface{})
+	if cfg.hasSource("certstream") {
+		dropMessage = func(msg interface{}) {
+			messagesDropped.inc()
+			log.Debug("dropping message because the processing queue is full")
 		}
 	}
+	pool := newWorkerPool(cfg.Workers, cfg.QueueSize, queueLength, dropMessage, w.handleMessage)
+	handle := func(msg *stream.Message) { pool.submit(msg) }
+	var rec *recorder
+	if cfg.RecordPath != "" {
+		rec = newRecorder(cfg.RecordPath, cfg.RecordRotate, cfg.RecordKeep)
+		handle = rec.wrap(handle)
+	}
+	err = s.run(handle)
+	if rec != nil {
+		if err := rec.close(); err != nil {
+			log.WithError(err).Error("could not finish recording")
+		}
+	}
+	pool.close()
+	w.close()
+	w.reports.close()
+	w.tracer.close()
+
+	// send anything still batched before exiting, to every sink however
+	// it's reached, and close their connections, even if the source gave up
+	for sk := range reload.config().allSinks() {
+		retireSink(sk)
+	}
+	if err != nil {
+		log.WithError(err).Error("gave up on certificate source")
+		os.Exit(1)
+	}
+	log.Info("shut down")
 }
@@ -0,0 +1,189 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/heptiolabs/certstream-slack/pkg/notify"
+)
+
+// messageData is what message templates are executed with.
+type messageData struct {
+	Rule     string
+	Pattern  string
+	Severity string
+
+	// Domains are the matching domains, and AllDomains are all the domains
+	// in the certificate. OtherDomains is the number that didn't match.
+	Domains      []string
+	AllDomains   []string
+	OtherDomains int
+
+	// Original and Reasons, keyed by domain, are how a matching domain was
+	// written before it was normalized and why it matched, where known
+	Original map[string]string
+	Reasons  map[string]string
+
+	// DomainList describes the matching domains in English, like
+	// "a.com, b.com, and 3 others"
+	DomainList string
+
+	Fingerprint string
+	SHA256      string
+	Serial      string
+
+	// Issuer is the issuer's organization and common name, like
+	// "Let's Encrypt (R3)", and IssuerDN is its distinguished name
+	Issuer   string
+	IssuerDN string
+
+	NotBefore time.Time
+	NotAfter  time.Time
+	Seen      time.Time
+
+	// KeyAlgorithm, KeySize, ExtKeyUsages, and SCTs describe the
+	// certificate's key, what it's for, and its embedded SCTs, if the
+	// source provides the certificate's DER encoding
+	KeyAlgorithm string
+	KeySize      int
+	ExtKeyUsages []string
+	SCTs         []notify.SCT
+
+	// Chain and RootCA are the distinguished names of the CAs in the
+	// certificate's chain and of its root CA, if the source provides them
+	Chain  []string
+	RootCA string
+
+	// Source describes where the certificate was logged, like "entry 1234 in
+	// Google 'Pilot' log"
+	Source   string
+	CertURL  string
+	EntryURL string
+
+	// Summary and Details are the built-in one line descriptions of the
+	// alert and of the certificate
+	Summary string
+	Details string
+
+	// Enrichments summarize what enrichers found, one line for the
+	// certificate and for each domain, like "login.example.com: A 192.0.2.1"
+	Enrichments []string
+}
+
+// messageFuncs are the functions available to message templates, in
+// addition to the text/template built-ins.
+var messageFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	// time formats a time with a Go layout, like {{time "2006-01-02" .Seen}}
+	"time": func(layout string, t time.Time) string {
+		return t.UTC().Format(layout)
+	},
+	"truncate": func(n int, s string) string {
+		return truncate(s, n)
+	},
+}
+
+// newMessageTemplate parses a message template, executing it with sample data
+// so that mistakes like unknown fields are caught up front.
+func newMessageTemplate(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(messageFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	sample := &messageData{
+		Rule:        "example",
+		Severity:    "warning",
+		Domains:     []string{"login.example.com"},
+		AllDomains:  []string{"login.example.com", "example.com"},
+		Original:    map[string]string{},
+		Reasons:     map[string]string{},
+		DomainList:  "login.example.com and 1 other",
+		Fingerprint: "00:11:22:33",
+		Seen:        time.Now(),
+	}
+	if err := t.Execute(ioutil.Discard, sample); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// renderMessage executes a message template for an alert.
+func renderMessage(t *template.Template, a *alert) (string, error) {
+	data := &messageData{
+		Rule:         a.Rule,
+		Pattern:      a.Pattern,
+		Severity:     a.Severity.String(),
+		Domains:      a.Domains,
+		AllDomains:   a.AllDomains,
+		OtherDomains: a.OtherDomains,
+		Original:     a.Original,
+		Reasons:      a.Reasons,
+		DomainList: a.DomainListWith(func(domain string) string {
+			return domain
+		}),
+		Fingerprint:  a.Fingerprint,
+		SHA256:       a.SHA256,
+		Serial:       a.Serial,
+		Issuer:       a.IssuerName(),
+		IssuerDN:     a.Issuer,
+		NotBefore:    a.NotBefore,
+		NotAfter:     a.NotAfter,
+		Seen:         a.Seen,
+		KeyAlgorithm: a.KeyAlgorithm,
+		KeySize:      a.KeySize,
+		ExtKeyUsages: a.ExtKeyUsages,
+		SCTs:         a.SCTs,
+		Chain:        a.Chain,
+		RootCA:       a.RootCA,
+		Source:       a.Source(),
+		CertURL:      a.CertURL,
+		EntryURL:     a.EntryURL(),
+		Summary:      a.Summary(),
+		Details:      a.Details(),
+		Enrichments:  a.EnrichmentLines(),
+	}
+	var out bytes.Buffer
+	if err := t.Execute(&out, data); err != nil {
+		return "", errors.Wrap(err, "error executing message template")
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// withMessage returns a copy of an alert with its Message from a template,
+// or the alert itself if there's no template. If the template fails, the
+// error is logged and the sink's built-in message is used instead.
+func withMessage(a *alert, t *template.Template) *alert {
+	if t == nil {
+		return a
+	}
+	message, err := renderMessage(t, a)
+	if err != nil {
+		log.WithError(err).WithField("rule", a.Rule).WithField("template", t.Name()).Error("could not render message, using the default")
+		return a
+	}
+	templated := *a
+	templated.Message = message
+	return &templated
+}
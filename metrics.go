@@ -0,0 +1,243 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The metrics exported at /metrics in the Prometheus text format. These are
+// simple enough that we implement the exposition format directly rather than
+// pulling in the Prometheus client library and its dependencies.
+var (
+	certificatesSeen = newCounter("certstream_slack_certificates_seen_total",
+		"Certificate updates received from certstream.")
+	matchesFound = newCounter("certstream_slack_matches_total",
+		"Certificates matching a rule.", "rule")
+	duplicatesSuppressed = newCounter("certstream_slack_duplicates_suppressed_total",
+		"Matching certificates skipped because they were already alerted on.")
+	cooldownSuppressed = newCounter("certstream_slack_cooldown_suppressed_total",
+		"Matching certificates skipped because the rule alerted on their domains within its cooldown.", "rule")
+	mutedSuppressed = newCounter("certstream_slack_muted_total",
+		"Matching certificates skipped because their domains were muted from Slack.", "rule")
+	acknowledgedSuppressed = newCounter("certstream_slack_acknowledged_total",
+		"Matching certificates skipped because the rule's alert for them was acknowledged from Slack.", "rule")
+	notificationsSent = newCounter("certstream_slack_notifications_sent_total",
+		"Notifications sent successfully.", "rule", "sink")
+	notificationsFailed = newCounter("certstream_slack_notifications_failed_total",
+		"Notifications that could not be sent.", "rule", "sink")
+	notificationsRateLimited = newCounter("certstream_slack_notifications_rate_limited_total",
+		"Notifications dropped to stay under a sink's rate limit.", "rule", "sink")
+	alertsHeld = newCounter("certstream_slack_alerts_held_total",
+		"Alerts held during their rule's quiet hours, to be sent when they end.", "rule", "sink")
+	malformedMessages = newCounter("certstream_slack_malformed_messages_total",
+		"Messages from certstream that couldn't be decoded and were skipped.")
+	enrichmentsFailed = newCounter("certstream_slack_enrichments_failed_total",
+		"Enrichers that failed or timed out looking up an alert.", "enricher")
+	enrichmentsSkipped = newCounter("certstream_slack_enrichments_skipped_total",
+		"Enrichers skipped because they kept failing.", "enricher")
+	alertsUnenriched = newCounter("certstream_slack_alerts_unenriched_total",
+		"Alerts sent without enrichment because the enrichment queue was full.")
+	sourceDuplicates = newCounter("certstream_slack_source_duplicates_total",
+		"Certificates skipped because another source already delivered them.", "source")
+	messagesDropped = newCounter("certstream_slack_messages_dropped_total",
+		"Messages dropped because the processing queue was full.")
+	serveMessagesDropped = newCounter("certstream_slack_serve_messages_dropped_total",
+		"Messages the serve command dropped for certstream clients that fell behind.", "stream")
+	spansDropped = newCounter("certstream_slack_spans_dropped_total",
+		"Trace spans dropped because they couldn't be exported.")
+	configReloads = newCounter("certstream_slack_config_reloads_total",
+		"Times the config was reloaded, by result (success or failure).", "result")
+	streamReconnects = newCounter("certstream_slack_stream_reconnects_total",
+		"Times the certstream websocket was re-established after a failure.")
+	lastMessageTime = newGauge("certstream_slack_last_message_timestamp_seconds",
+		"Unix time of the last message received from certstream.")
+	serveClients = newGauge("certstream_slack_serve_clients",
+		"Certstream clients connected to the serve command.")
+	queueLength = newGauge("certstream_slack_queue_length",
+		"Messages waiting to be processed.")
+	enrichQueueLength = newGauge("certstream_slack_enrich_queue_length",
+		"Alerts waiting to be enriched and sent.")
+	processingSeconds = newHistogram("certstream_slack_message_processing_seconds",
+		"Time spent matching and notifying for each certificate update.",
+		[]float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1, 5})
+)
+
+// metric is a single metric family that can write itself in the Prometheus
+// text format.
+type metric interface {
+	write(w io.Writer)
+}
+
+var allMetrics []metric
+
+// metricsHandler serves every metric in the Prometheus text format.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, m := range allMetrics {
+		m.write(w)
+	}
+}
+
+// counter is a monotonically increasing value, optionally partitioned by the
+// values of some labels.
+type counter struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	values map[string]float64 // keyed by label values joined with labelSep
+}
+
+const labelSep = "\xff"
+
+func newCounter(name, help string, labels ...string) *counter {
+	c := &counter{name: name, help: help, labels: labels, values: map[string]float64{}}
+	if len(labels) == 0 {
+		c.values[""] = 0
+	}
+	allMetrics = append(allMetrics, c)
+	return c
+}
+
+// inc adds one to the counter for the given label values (if any), which
+// must be in the same order as the labels passed to newCounter.
+func (c *counter) inc(labelValues ...string) {
+	c.add(1, labelValues...)
+}
+
+// add adds v to the counter for the given label values, like inc.
+func (c *counter) add(v float64, labelValues ...string) {
+	key := strings.Join(labelValues, labelSep)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+// get returns the counter's value for the given label values, like inc.
+func (c *counter) get(labelValues ...string) float64 {
+	key := strings.Join(labelValues, labelSep)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+func (c *counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if len(c.labels) == 0 {
+			fmt.Fprintf(w, "%s %s\n", c.name, formatFloat(c.values[k]))
+			continue
+		}
+		pairs := []string{}
+		for i, value := range strings.Split(k, labelSep) {
+			pairs = append(pairs, fmt.Sprintf("%s=%q", c.labels[i], value))
+		}
+		fmt.Fprintf(w, "%s{%s} %s\n", c.name, strings.Join(pairs, ","), formatFloat(c.values[k]))
+	}
+}
+
+// gauge is a single value that can go up and down.
+type gauge struct {
+	name, help string
+
+	mu    sync.Mutex
+	value float64
+}
+
+func newGauge(name, help string) *gauge {
+	g := &gauge{name: name, help: help}
+	allMetrics = append(allMetrics, g)
+	return g
+}
+
+func (g *gauge) set(v float64) {
+	g.mu.Lock()
+	g.value = v
+	g.mu.Unlock()
+}
+
+func (g *gauge) get() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.value
+}
+
+func (g *gauge) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.name, g.help, g.name, g.name, formatFloat(g.value))
+}
+
+// histogram counts observations in cumulative buckets.
+type histogram struct {
+	name, help string
+	buckets    []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(name, help string, buckets []float64) *histogram {
+	h := &histogram{name: name, help: help, buckets: buckets, counts: make([]uint64, len(buckets))}
+	allMetrics = append(allMetrics, h)
+	return h
+}
+
+// observeSince records the time elapsed since start, in seconds.
+func (h *histogram) observeSince(start time.Time) {
+	v := time.Since(start).Seconds()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for i, upper := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", h.name, formatFloat(upper), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n%s_count %d\n", h.name, formatFloat(h.sum), h.name, h.count)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,271 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// mmdbReader looks up IP addresses in a MaxMind DB file, like the GeoLite2
+// Country and ASN databases, following the format at
+// https://maxmind.github.io/MaxMind-DB/. The whole file is read into memory.
+type mmdbReader struct {
+	buf        []byte
+	data       []byte // the data section
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	dbType     string
+
+	// ipv4Start is the node where IPv4 addresses start in an IPv6 tree
+	ipv4Start uint
+}
+
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// openMMDB reads and checks a MaxMind DB file.
+func openMMDB(path string) (*mmdbReader, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	start := len(buf) - 128*1024
+	if start < 0 {
+		start = 0
+	}
+	i := bytes.LastIndex(buf[start:], mmdbMetadataMarker)
+	if i < 0 {
+		return nil, errors.Errorf("%s is not a MaxMind DB file", path)
+	}
+	metaStart := start + i + len(mmdbMetadataMarker)
+	d := &mmdbDecoder{buf: buf[metaStart:]}
+	v, _, err := d.decode(0)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read the metadata of %s", path)
+	}
+	meta, _ := v.(map[string]interface{})
+	r := &mmdbReader{buf: buf}
+	r.nodeCount, _ = mmdbUint(meta["node_count"])
+	r.recordSize, _ = mmdbUint(meta["record_size"])
+	r.ipVersion, _ = mmdbUint(meta["ip_version"])
+	r.dbType, _ = meta["database_type"].(string)
+	if r.recordSize != 24 && r.recordSize != 28 && r.recordSize != 32 {
+		return nil, errors.Errorf("%s has an unsupported record size of %d", path, r.recordSize)
+	}
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+16 > uint(start+i) {
+		return nil, errors.Errorf("%s is truncated", path)
+	}
+	r.data = buf[treeSize+16 : start+i]
+
+	// in an IPv6 tree, IPv4 addresses are under ::/96
+	if r.ipVersion == 6 {
+		for depth := 0; depth < 96 && r.ipv4Start < r.nodeCount; depth++ {
+			r.ipv4Start = r.record(r.ipv4Start, 0)
+		}
+	}
+	return r, nil
+}
+
+// lookup returns the record for ip, or nil if there isn't one.
+func (r *mmdbReader) lookup(ip net.IP) (interface{}, error) {
+	node := uint(0)
+	bits := []byte(ip.To16())
+	if ip4 := ip.To4(); ip4 != nil {
+		bits = ip4
+		node = r.ipv4Start
+	} else if r.ipVersion == 4 {
+		return nil, nil
+	}
+	for i := 0; i < len(bits)*8 && node < r.nodeCount; i++ {
+		bit := uint(bits[i/8]>>(7-uint(i%8))) & 1
+		node = r.record(node, bit)
+	}
+	if node <= r.nodeCount {
+		// node_count itself means there's no record
+		return nil, nil
+	}
+	offset := node - r.nodeCount - 16
+	if offset >= uint(len(r.data)) {
+		return nil, errors.New("corrupt search tree")
+	}
+	v, _, err := (&mmdbDecoder{buf: r.data}).decode(offset)
+	return v, err
+}
+
+// record returns the left (bit 0) or right (bit 1) record of a node.
+func (r *mmdbReader) record(node, bit uint) uint {
+	b := r.buf[node*r.recordSize/4:]
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// mmdbDecoder decodes values from a MaxMind DB data section.
+type mmdbDecoder struct {
+	buf []byte
+}
+
+// decode returns the value at offset and the offset after it.
+func (d *mmdbDecoder) decode(offset uint) (interface{}, uint, error) {
+	if offset >= uint(len(d.buf)) {
+		return nil, 0, errors.New("unexpected end of data")
+	}
+	ctrl := d.buf[offset]
+	offset++
+	typ := uint(ctrl >> 5)
+	if typ == 1 {
+		// a pointer to a value elsewhere in the data section
+		ss, vvv := uint(ctrl>>3)&3, uint(ctrl&7)
+		n := ss + 1
+		if offset+n > uint(len(d.buf)) {
+			return nil, 0, errors.New("unexpected end of data")
+		}
+		p := uint(0)
+		if ss < 3 {
+			p = vvv
+		}
+		for _, b := range d.buf[offset : offset+n] {
+			p = p<<8 | uint(b)
+		}
+		p += []uint{0, 2048, 526336, 0}[ss]
+		v, _, err := d.decode(p)
+		return v, offset + n, err
+	}
+	if typ == 0 {
+		if offset >= uint(len(d.buf)) {
+			return nil, 0, errors.New("unexpected end of data")
+		}
+		typ = 7 + uint(d.buf[offset])
+		offset++
+	}
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(d.buf)) {
+			return nil, 0, errors.New("unexpected end of data")
+		}
+		extra := uint(0)
+		for _, b := range d.buf[offset : offset+n] {
+			extra = extra<<8 | uint(b)
+		}
+		size = []uint{29, 285, 65821}[n-1] + extra
+		offset += n
+	}
+
+	switch typ {
+	case 7: // map
+		m := map[string]interface{}{}
+		for i := uint(0); i < size; i++ {
+			k, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			v, next, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, _ := k.(string)
+			m[key] = v
+			offset = next
+		}
+		return m, offset, nil
+	case 11: // array
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			v, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			offset = next
+		}
+		return a, offset, nil
+	case 14: // boolean, with the value as the size
+		return size != 0, offset, nil
+	case 13: // end marker
+		return nil, offset, nil
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, errors.New("unexpected end of data")
+	}
+	b := d.buf[offset : offset+size]
+	offset += size
+	switch typ {
+	case 2: // UTF-8 string
+		return string(b), offset, nil
+	case 3: // double
+		if size != 8 {
+			return nil, 0, errors.New("invalid double")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case 15: // float
+		if size != 4 {
+			return nil, 0, errors.New("invalid float")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	case 4: // bytes
+		return append([]byte{}, b...), offset, nil
+	case 5, 6, 9, 10: // unsigned integers of up to 16, 32, 64, and 128 bits
+		n := uint64(0)
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		return n, offset, nil
+	case 8: // int32
+		n := int32(0)
+		for _, c := range b {
+			n = n<<8 | int32(c)
+		}
+		return int64(n), offset, nil
+	}
+	return nil, 0, errors.Errorf("unknown data type %d", typ)
+}
+
+// mmdbUint converts a decoded unsigned integer.
+func mmdbUint(v interface{}) (uint, bool) {
+	n, ok := v.(uint64)
+	return uint(n), ok
+}
+
+// mmdbPath returns the value under the keys of nested maps in a record, or
+// nil.
+func mmdbPath(v interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
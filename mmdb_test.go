@@ -0,0 +1,284 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// unhex decodes hex that may be split up by spaces.
+func unhex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(strings.Replace(s, " ", "", -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestMMDBDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		at   uint // the offset to decode from
+		want interface{}
+		next uint
+		err  string
+	}{
+		{name: "empty string", data: "40", want: "", next: 1},
+		{name: "string", data: "45 48656c6c6f", want: "Hello", next: 6},
+		{name: "string with a size over 28", data: "5d 01" + strings.Repeat("61", 30), want: strings.Repeat("a", 30), next: 32},
+		{name: "string with a size over 284", data: "5e 0000" + strings.Repeat("62", 285), want: strings.Repeat("b", 285), next: 288},
+		{name: "double", data: "68 3ff8000000000000", want: 1.5, next: 9},
+		{name: "bytes", data: "82 dead", want: []byte{0xde, 0xad}, next: 3},
+		{name: "uint16", data: "a2 01f4", want: uint64(500), next: 3},
+		{name: "zero uint32", data: "c0", want: uint64(0), next: 1},
+		{name: "uint32", data: "c4 ffffffff", want: uint64(0xffffffff), next: 5},
+		{name: "map", data: "e2 42656e 47 4765726d616e79 42 6465 4b44657574736368 6c616e64", want: map[string]interface{}{"en": "Germany", "de": "Deutschland"}, next: 27},
+		{name: "int32", data: "04 01 ffffffff", want: int64(-1), next: 6},
+		{name: "short int32", data: "02 01 0100", want: int64(256), next: 4},
+		{name: "uint64", data: "08 02 0102030405060708", want: uint64(0x0102030405060708), next: 10},
+		{name: "array", data: "02 04 4161 c1 2a", want: []interface{}{"a", uint64(42)}, next: 6},
+		{name: "true", data: "01 07", want: true, next: 2},
+		{name: "false", data: "00 07", want: false, next: 2},
+		{name: "float", data: "04 08 3fc00000", want: 1.5, next: 6},
+		{name: "pointer", data: "43 666f6f 20 00", at: 4, want: "foo", next: 6},
+		{name: "pointer with one more byte", data: strings.Repeat("40", 2048+5) + "45 48656c6c6f" + "28 0005", at: 2048 + 11, want: "Hello", next: 2048 + 14},
+		{name: "pointer into a map", data: "45 48656c6c6f e1 42 6869 20 00", at: 6, want: map[string]interface{}{"hi": "Hello"}, next: 12},
+		{name: "past the end", data: "40", at: 1, err: "unexpected end of data"},
+		{name: "truncated string", data: "45 4865", err: "unexpected end of data"},
+		{name: "truncated extended type", data: "01", err: "unexpected end of data"},
+		{name: "truncated map", data: "e1 42656e", err: "unexpected end of data"},
+		{name: "invalid double", data: "64 3fc00000", err: "invalid double"},
+		{name: "unknown type", data: "00 09", err: "unknown data type 16"},
+	}
+	for _, test := range tests {
+		v, next, err := (&mmdbDecoder{buf: unhex(t, test.data)}).decode(test.at)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: decoding returned error %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: decoding returned error %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, test.want) || next != test.next {
+			t.Errorf("%s: decoded %#v ending at %d, want %#v ending at %d", test.name, v, next, test.want, test.next)
+		}
+	}
+}
+
+// mmdbPointer is a pointer to a data section offset, for mmdbEncode.
+type mmdbPointer uint
+
+// mmdbEncode encodes strings, uint32s, maps, and small pointers for test
+// databases.
+func mmdbEncode(v interface{}) []byte {
+	ctrl := func(typ, size int) []byte {
+		if size < 29 {
+			return []byte{byte(typ<<5 | size)}
+		}
+		return []byte{byte(typ<<5 | 29), byte(size - 29)}
+	}
+	switch v := v.(type) {
+	case string:
+		return append(ctrl(2, len(v)), v...)
+	case uint32:
+		return append(ctrl(6, 4), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	case map[string]interface{}:
+		b := ctrl(7, len(v))
+		for key, value := range v {
+			b = append(b, mmdbEncode(key)...)
+			b = append(b, mmdbEncode(value)...)
+		}
+		return b
+	case mmdbPointer:
+		return []byte{byte(1<<5 | v>>8), byte(v)}
+	}
+	panic("can't encode value")
+}
+
+// writeMMDB writes a database mapping networks, which mustn't overlap, to
+// records, given as offsets in data, and returns its path.
+func writeMMDB(t *testing.T, ipVersion, recordSize int, networks map[string]int, data []byte) string {
+	type node struct {
+		children [2]*node
+		record   int // the offset of the record, if this is a leaf
+	}
+	root := &node{}
+	for network, record := range networks {
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ip, ones := []byte(ipNet.IP), 0
+		if ipVersion == 6 {
+			// IPv4 networks are under ::/96
+			ip = ipNet.IP.To16()
+			if ip4 := ipNet.IP.To4(); ip4 != nil {
+				ip, ones = append(make([]byte, 12), ip4...), 96
+			}
+		}
+		n, _ := ipNet.Mask.Size()
+		ones += n
+		at := root
+		for i := 0; i < ones; i++ {
+			bit := ip[i/8] >> uint(7-i%8) & 1
+			if at.children[bit] == nil {
+				at.children[bit] = &node{}
+			}
+			at = at.children[bit]
+		}
+		at.record = record
+	}
+
+	// number the nodes that aren't leaves breadth first
+	nodes := []*node{root}
+	numbers := map[*node]int{root: 0}
+	for i := 0; i < len(nodes); i++ {
+		for _, child := range nodes[i].children {
+			if child != nil && (child.children[0] != nil || child.children[1] != nil) {
+				numbers[child] = len(nodes)
+				nodes = append(nodes, child)
+			}
+		}
+	}
+	count := len(nodes)
+	var buf []byte
+	for _, n := range nodes {
+		var records [2]int
+		for bit, child := range n.children {
+			switch number, ok := numbers[child]; {
+			case child == nil:
+				records[bit] = count
+			case ok:
+				records[bit] = number
+			default:
+				records[bit] = count + 16 + child.record
+			}
+		}
+		left, right := records[0], records[1]
+		switch recordSize {
+		case 24:
+			buf = append(buf, byte(left>>16), byte(left>>8), byte(left), byte(right>>16), byte(right>>8), byte(right))
+		case 28:
+			buf = append(buf, byte(left>>16), byte(left>>8), byte(left), byte(left>>24<<4|right>>24&0xf), byte(right>>16), byte(right>>8), byte(right))
+		case 32:
+			buf = append(buf, byte(left>>24), byte(left>>16), byte(left>>8), byte(left), byte(right>>24), byte(right>>16), byte(right>>8), byte(right))
+		}
+	}
+	buf = append(buf, make([]byte, 16)...)
+	buf = append(buf, data...)
+	buf = append(buf, mmdbMetadataMarker...)
+	buf = append(buf, mmdbEncode(map[string]interface{}{
+		"node_count":    uint32(count),
+		"record_size":   uint32(recordSize),
+		"ip_version":    uint32(ipVersion),
+		"database_type": "Test",
+	})...)
+
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := ioutil.WriteFile(path, buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMMDBLookup(t *testing.T) {
+	germany := mmdbEncode(map[string]interface{}{"iso_code": "DE", "names": map[string]interface{}{"en": "Germany"}})
+	asn := mmdbEncode(map[string]interface{}{"autonomous_system_number": uint32(64496), "autonomous_system_organization": "Example"})
+	data := append(append(append([]byte{}, germany...), asn...), mmdbEncode(mmdbPointer(0))...)
+	records := map[string]int{"germany": 0, "asn": len(germany), "pointer": len(germany) + len(asn)}
+	values := map[string]interface{}{
+		"germany": map[string]interface{}{"iso_code": "DE", "names": map[string]interface{}{"en": "Germany"}},
+		"asn":     map[string]interface{}{"autonomous_system_number": uint64(64496), "autonomous_system_organization": "Example"},
+	}
+	values["pointer"] = values["germany"]
+
+	v4 := map[string]int{"192.0.2.0/24": records["germany"], "198.51.100.128/25": records["asn"], "203.0.113.7/32": records["pointer"]}
+	v6 := map[string]int{"192.0.2.0/24": records["germany"], "2001:db8::/32": records["asn"], "2001:db9:1::/48": records["pointer"]}
+	tests := []struct {
+		ip string
+		v4 string // the record in the IPv4 database, if any
+		v6 string // the record in the IPv6 database, if any
+	}{
+		{ip: "192.0.2.1", v4: "germany", v6: "germany"},
+		{ip: "192.0.2.255", v4: "germany", v6: "germany"},
+		{ip: "192.0.3.0"},
+		{ip: "198.51.100.200", v4: "asn"},
+		{ip: "198.51.100.127"},
+		{ip: "203.0.113.7", v4: "pointer"},
+		{ip: "203.0.113.6"},
+		{ip: "::ffff:192.0.2.9", v4: "germany", v6: "germany"},
+		{ip: "2001:db8:ffff::1", v6: "asn"},
+		{ip: "2001:db9:1::1", v6: "pointer"},
+		{ip: "2001:db9::1"},
+		{ip: "::1"},
+	}
+	for _, recordSize := range []int{24, 28, 32} {
+		for _, db := range []struct {
+			ipVersion int
+			networks  map[string]int
+		}{{4, v4}, {6, v6}} {
+			r, err := openMMDB(writeMMDB(t, db.ipVersion, recordSize, db.networks, data))
+			if err != nil {
+				t.Fatalf("IPv%d, %d-bit records: %v", db.ipVersion, recordSize, err)
+			}
+			if r.dbType != "Test" {
+				t.Errorf("IPv%d, %d-bit records: database type %q, want %q", db.ipVersion, recordSize, r.dbType, "Test")
+			}
+			for _, test := range tests {
+				want := values[test.v4]
+				if db.ipVersion == 6 {
+					want = values[test.v6]
+				}
+				got, err := r.lookup(net.ParseIP(test.ip))
+				if err != nil || !reflect.DeepEqual(got, want) {
+					t.Errorf("IPv%d, %d-bit records: lookup(%s) = %v, %v, want %v", db.ipVersion, recordSize, test.ip, got, err, want)
+				}
+			}
+		}
+	}
+}
+
+func TestOpenMMDBErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"no metadata", []byte("not a database"), "is not a MaxMind DB file"},
+		{"bad record size", append(append([]byte{}, mmdbMetadataMarker...), mmdbEncode(map[string]interface{}{"node_count": uint32(0), "record_size": uint32(16)})...), "has an unsupported record size of 16"},
+		{"truncated", append(make([]byte, 20), append(append([]byte{}, mmdbMetadataMarker...), mmdbEncode(map[string]interface{}{"node_count": uint32(10), "record_size": uint32(24)})...)...), "is truncated"},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, strings.Replace(test.name, " ", "-", -1)+".mmdb")
+		if err := ioutil.WriteFile(path, test.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := openMMDB(path); err == nil || !strings.HasSuffix(err.Error(), test.err) {
+			t.Errorf("%s: openMMDB returned error %v, want one ending %q", test.name, err, test.err)
+		}
+	}
+}
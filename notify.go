@@ -0,0 +1,197 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/heptiolabs/certstream-slack/pkg/notify"
+	"github.com/pkg/errors"
+)
+
+// alert is a certificate matching a rule, and notifier, flusher, closer,
+// and threader are implemented by sinks to send, flush, close, and follow up
+// on them.
+type (
+	alert    = notify.Alert
+	notifier = notify.Notifier
+	flusher  = notify.Flusher
+	closer   = notify.Closer
+	threader = notify.Threader
+)
+
+// sinkFactory builds a notifier, using decode to unmarshal its type-specific
+// options from the sink config.
+type sinkFactory func(decode func(interface{}) error) (notifier, error)
+
+// sinkTypes is the registry of sink types, keyed by the "type" setting.
+var sinkTypes = map[string]sinkFactory{}
+
+// registerSinkType makes a sink type available to the config. It's meant to
+// be called from init functions.
+func registerSinkType(typ string, factory sinkFactory) {
+	sinkTypes[typ] = factory
+}
+
+// sink is a named notifier built from a sinkConfig.
+type sink struct {
+	name        string
+	typ         string
+	minSeverity severity
+	template    *template.Template // for messages, if configured
+	notifier
+}
+
+// newSink builds a sink from its config using the registered factory.
+func newSink(sc *sinkConfig) (*sink, error) {
+	factory := sinkTypes[sc.Type]
+	if factory == nil {
+		types := []string{}
+		for typ := range sinkTypes {
+			types = append(types, typ)
+		}
+		sort.Strings(types)
+		return nil, errors.Errorf("%s.type: unknown sink type %q (must be one of %s)", sc.key, sc.Type, strings.Join(types, ", "))
+	}
+	minSeverity := severityInfo
+	if sc.MinSeverity != "" {
+		sev, err := parseSeverity(sc.MinSeverity)
+		if err != nil {
+			return nil, errors.Wrap(err, sc.key+".min_severity")
+		}
+		minSeverity = sev
+	}
+	var tmpl *template.Template
+	if sc.MessageTemplate != "" {
+		t, err := newMessageTemplate(sc.Name, sc.MessageTemplate)
+		if err != nil {
+			return nil, errors.Wrap(err, sc.key+".message_template")
+		}
+		tmpl = t
+	}
+	n, err := factory(sc.decode)
+	if err != nil {
+		return nil, errors.Wrap(err, sc.key)
+	}
+	return &sink{name: sc.Name, typ: sc.Type, minSeverity: minSeverity, template: tmpl, notifier: n}, nil
+}
+
+// newTLSConfig returns a TLS client config trusting the certificates in
+// caFile, or the system roots if caFile is empty.
+func newTLSConfig(caFile string) (*tls.Config, error) {
+	config := &tls.Config{}
+	if caFile == "" {
+		return config, nil
+	}
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	config.RootCAs = x509.NewCertPool()
+	if !config.RootCAs.AppendCertsFromPEM(pem) {
+		return nil, errors.Errorf("no certificates found in %s", caFile)
+	}
+	return config, nil
+}
+
+// httpClient is used by sinks that talk HTTP directly.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// newHTTPClient returns httpClient, or a client like it trusting the
+// certificates in caFile if set, for self-hosted services with their own CA.
+func newHTTPClient(caFile string) (*http.Client, error) {
+	if caFile == "" {
+		return httpClient, nil
+	}
+	config, err := newTLSConfig(caFile)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	return &http.Client{Timeout: httpClient.Timeout, Transport: transport}, nil
+}
+
+// httpError is returned by postJSON for a response other than 2xx.
+type httpError struct {
+	Status     string
+	StatusCode int
+	Body       string
+
+	// RetryAfter is the delay requested by a Retry-After header, if any
+	RetryAfter time.Duration
+}
+
+func (e *httpError) Error() string {
+	return fmt.Sprintf("unexpected status %s: %s", e.Status, e.Body)
+}
+
+// postJSON POSTs payload as JSON to url with any extra headers and checks for
+// a 2xx response, returning an *httpError otherwise.
+func postJSON(url string, headers map[string]string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = readResponse(resp)
+	return err
+}
+
+// readResponse reads a response body (up to 1 MiB), returning an *httpError
+// for a response other than 2xx.
+func readResponse(resp *http.Response) ([]byte, error) {
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg := body
+		if len(msg) > 1024 {
+			msg = msg[:1024]
+		}
+		e := &httpError{Status: resp.Status, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(msg))}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			e.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return nil, e
+	}
+	return body, nil
+}
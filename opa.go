@@ -0,0 +1,99 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/open-policy-agent/opa/v1/rego"
+	"github.com/pkg/errors"
+
+	"github.com/heptiolabs/certstream-slack/pkg/stream"
+)
+
+// opaPolicy evaluates a decision in an Open Policy Agent bundle, embedded
+// in the watcher, so detection logic can be written in Rego and managed as
+// policy bundles like any other OPA policy.
+type opaPolicy struct {
+	query   rego.PreparedEvalQuery
+	timeout time.Duration
+}
+
+// newOPAPolicy loads the bundle at path, a directory of policy and data
+// files or a .tar.gz built by "opa build", and prepares the query for the
+// decision, like "data.certstream.match".
+func newOPAPolicy(path, query string, timeout time.Duration) (*opaPolicy, error) {
+	prepared, err := rego.New(rego.Query(query), rego.LoadBundle(path)).PrepareForEval(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &opaPolicy{query: prepared, timeout: timeout}, nil
+}
+
+// decide evaluates the decision for input, returning nil if the policy
+// leaves it undefined.
+func (p *opaPolicy) decide(input interface{}) (json.RawMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	results, err := p.query.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 || len(results[0].Expressions) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(results[0].Expressions[0].Value)
+}
+
+// opaMatch asks a rule's policy which of a certificate's domains match. Its
+// input is like {"rule": "phishing", "domains": [...], "data": {...}},
+// where data is the certstream message's data, and the decision can be a
+// bool (whether all the domains match), a set of the domains that match, or
+// an object like a plugin's response (see matchDecision).
+func opaMatch(r *rule, domains []string, u *stream.CertificateUpdate) ([]foundDomain, alertRoute, error) {
+	data := map[string]interface{}{}
+	if u != nil {
+		data = u.Fields()
+	}
+	result, err := r.opa.decide(map[string]interface{}{"rule": r.Name, "domains": domains, "data": data})
+	if err != nil {
+		return nil, alertRoute{}, errors.Wrap(err, "could not evaluate policy")
+	}
+
+	var decision matchDecision
+	var all bool
+	var some []foundDomain
+	switch {
+	case len(result) == 0 || string(result) == "null":
+		// undefined, so nothing matches
+	case json.Unmarshal(result, &all) == nil:
+		if all {
+			for _, domain := range domains {
+				decision.Matches = append(decision.Matches, foundDomain{Domain: domain})
+			}
+		}
+	case json.Unmarshal(result, &some) == nil:
+		decision.Matches = some
+	default:
+		if err := json.Unmarshal(result, &decision); err != nil {
+			return nil, alertRoute{}, errors.Errorf("policy decided %s, not a bool, set of domains, or object with matches", result)
+		}
+	}
+	found, route, err := decision.apply(r, domains)
+	return found, route, errors.Wrap(err, "policy made an invalid decision")
+}
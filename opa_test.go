@@ -0,0 +1,106 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heptiolabs/certstream-slack/pkg/stream"
+)
+
+const testPolicy = `package certstream
+
+match contains domain if {
+	some domain in input.domains
+	startswith(domain, "login.")
+}
+
+default everything := false
+
+everything if input.rule == "everything"
+
+logged := {"matches": [{"domain": input.domains[0]}]} if {
+	startswith(input.data.cert_link, "https://ct.example/")
+}
+`
+
+func testOPABundle(t *testing.T, policy string) string {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "policy.rego"), []byte(policy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestOPAMatch(t *testing.T) {
+	bundle := testOPABundle(t, testPolicy)
+	domains := []string{"login.example.com", "www.example.com"}
+
+	tests := []struct {
+		rule, query string
+		u           *stream.CertificateUpdate
+		want        []string
+	}{
+		{rule: "phishing", query: "data.certstream.match", want: []string{"login.example.com"}},
+		{rule: "everything", query: "data.certstream.everything", want: domains},
+		{rule: "nothing", query: "data.certstream.everything"},
+		{rule: "logged", query: "data.certstream.logged", u: &stream.CertificateUpdate{CertLink: "https://ct.example/entry"}, want: []string{"login.example.com"}},
+		// undefined, as the log doesn't match
+		{rule: "logged", query: "data.certstream.logged", u: &stream.CertificateUpdate{CertLink: "https://other.example/entry"}},
+		{rule: "logged", query: "data.certstream.logged"},
+	}
+	for _, test := range tests {
+		p, err := newOPAPolicy(bundle, test.query, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := &rule{Name: test.rule, opa: p}
+		found, _, err := opaMatch(r, domains, test.u)
+		if err != nil {
+			t.Errorf("%s: %v", test.query, err)
+			continue
+		}
+		var got []string
+		for _, f := range found {
+			got = append(got, f.Domain)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s for %s: matched %q, want %q", test.query, test.rule, got, test.want)
+		}
+	}
+}
+
+func TestOPABundleErrors(t *testing.T) {
+	tests := []struct {
+		rule, err string
+	}{
+		{rule: "opa_bundle: " + testOPABundle(t, "package certstream\n\nmatch contains d if {"), err: "rules[1].opa_bundle: "},
+		{rule: "opa_bundle: " + filepath.Join(t.TempDir(), "missing"), err: "rules[1].opa_bundle: "},
+		{rule: "pattern: login\n  opa_query: data.certstream.match", err: "rules[1].opa_query: requires opa_bundle"},
+		{rule: "opa_bundle: " + testOPABundle(t, testPolicy) + "\n  opa_timeout: -1s", err: "rules[1].opa_timeout: must be positive"},
+	}
+	for _, test := range tests {
+		_, err := testConfig(t, "- name: policy\n  "+test.rule+"\n")
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: error %v, want %q", test.rule, err, test.err)
+		}
+	}
+}
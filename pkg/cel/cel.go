@@ -0,0 +1,125 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Package cel compiles and evaluates expressions in Google's Common
+// Expression Language (https://github.com/google/cel-spec), with cel-go,
+// over JSON-like values, like those decoded from certstream's messages:
+// nil, bool, int64, float64, string, []interface{}, and
+// map[string]interface{}.
+//
+// Variables are declared as dyn, so expressions are type-checked only as
+// far as their literals go, and numbers of different types can be compared
+// but not mixed in arithmetic. Besides CEL's standard definitions, strings
+// have the lowerAscii and upperAscii methods of cel-go's strings extension.
+package cel
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Program is a compiled expression.
+type Program struct {
+	source  string
+	program cel.Program
+}
+
+// asciiCase defines lowerAscii and upperAscii, which change the case of
+// ASCII letters only, like cel-go's strings extension, which needs a newer
+// golang.org/x/text than the one vendored.
+var asciiCase = []cel.EnvOption{
+	cel.Function("lowerAscii", cel.MemberOverload("string_lower_ascii", []*cel.Type{cel.StringType}, cel.StringType,
+		cel.UnaryBinding(func(s ref.Val) ref.Val {
+			return types.String(mapASCII(string(s.(types.String)), 'A', 'Z', 'a'-'A'))
+		}))),
+	cel.Function("upperAscii", cel.MemberOverload("string_upper_ascii", []*cel.Type{cel.StringType}, cel.StringType,
+		cel.UnaryBinding(func(s ref.Val) ref.Val {
+			return types.String(mapASCII(string(s.(types.String)), 'a', 'z', 'A'-'a'))
+		}))),
+}
+
+// mapASCII shifts the runes of s from lo to hi by delta.
+func mapASCII(s string, lo, hi, delta rune) string {
+	return strings.Map(func(r rune) rune {
+		if r >= lo && r <= hi {
+			return r + delta
+		}
+		return r
+	}, s)
+}
+
+// Compile parses and checks an expression that can refer to the named
+// variables.
+func Compile(source string, variables ...string) (*Program, error) {
+	options := append([]cel.EnvOption{
+		// compare the doubles decoded from JSON with ints, like 7
+		cel.CrossTypeNumericComparisons(true),
+		cel.ASTValidators(cel.ValidateRegexLiterals()),
+	}, asciiCase...)
+	for _, v := range variables {
+		options = append(options, cel.Variable(v, cel.DynType))
+	}
+	env, err := cel.NewEnv(options...)
+	if err != nil {
+		return nil, err
+	}
+	ast, issues := env.Compile(source)
+	if issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+	return &Program{source: source, program: program}, nil
+}
+
+// Eval evaluates the expression with the variables set to vars, returning
+// the result as JSON would decode it, with numbers as float64s.
+func (p *Program) Eval(vars map[string]interface{}) (interface{}, error) {
+	out, _, err := p.program.Eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	v, err := out.ConvertToNative(reflect.TypeOf(&structpb.Value{}))
+	if err != nil {
+		return nil, errors.Errorf("evaluated to %s, which isn't JSON", out.Type().TypeName())
+	}
+	return v.(*structpb.Value).AsInterface(), nil
+}
+
+// EvalBool evaluates an expression that must be true or false.
+func (p *Program) EvalBool(vars map[string]interface{}) (bool, error) {
+	out, _, err := p.program.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := out.(types.Bool)
+	if !ok {
+		return false, errors.Errorf("evaluated to %s, not a bool", out.Type().TypeName())
+	}
+	return bool(b), nil
+}
+
+// String returns the expression's source.
+func (p *Program) String() string {
+	return p.source
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cel
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testVars are like a certstream message decoded from JSON.
+func testVars(t *testing.T) map[string]interface{} {
+	var data interface{}
+	err := json.Unmarshal([]byte(`{
+		"leaf_cert": {
+			"all_domains": ["example.com", "www.example.com", "*.Example.org"],
+			"not_after": 1700000000,
+			"subject": {"CN": "example.com", "O": null}
+		},
+		"cert_index": 12345,
+		"source": {"name": "Google 'Argon2024'"}
+	}`), &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]interface{}{"data": data, "domains": []string{"example.com", "shop.example.net"}, "count": 3}
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		// literals, with numbers returned as JSON decodes them
+		{`1 + 2 * 3`, 7.0},
+		{`7 / 2`, 3.0},
+		{`7.0 / 2.0`, 3.5},
+		{`-count`, -3.0},
+		{`!true`, false},
+		{`"a\tb\x41é\101"`, "a\tbAéA"},
+		{`r"a\tb"`, `a\tb`},
+		{`[1, "a", [true]]`, []interface{}{1.0, "a", []interface{}{true}}},
+		{`{"a": 1, "b": [2]}`, map[string]interface{}{"a": 1.0, "b": []interface{}{2.0}}},
+		{`null`, nil},
+
+		// variables, selection, and indexing
+		{`data.cert_index == 12345`, true},
+		{`data.cert_index + 1.0`, 12346.0},
+		{`data.leaf_cert.all_domains[1]`, "www.example.com"},
+		{`data["source"]["name"]`, "Google 'Argon2024'"},
+		{`data.leaf_cert.subject.O == null`, true},
+		{`has(data.leaf_cert.subject.O)`, true},
+		{`has(data.leaf_cert.issuer)`, false},
+		{`domains[1]`, "shop.example.net"},
+		{`count > 2 && count <= 3.0`, true},
+		{`(data.leaf_cert.not_after - 1699395200.0) / 86400.0 <= 7`, true},
+
+		// operators, functions, methods, and macros
+		{`"www.example.com" in data.leaf_cert.all_domains`, true},
+		{`"subject" in data.leaf_cert`, true},
+		{`count > 1 ? "many" : "one"`, "many"},
+		{`true || 1 / 0 == 1`, true},
+		{`size(domains) + size(data.leaf_cert)`, 5.0},
+		{`string(count) + string(true)`, "3true"},
+		{`domains[1].startsWith("shop.") && domains[1].contains("example")`, true},
+		{`domains[1].matches("^shop\\.")`, true},
+		{`"*.Example.org".lowerAscii()`, "*.example.org"},
+		{`"Straße".upperAscii()`, "STRAßE"},
+		{`domains.all(d, d.contains("example"))`, true},
+		{`data.leaf_cert.all_domains.exists_one(d, d.startsWith("*."))`, true},
+		{`data.leaf_cert.all_domains.filter(d, !d.startsWith("*."))`, []interface{}{"example.com", "www.example.com"}},
+		{`domains.map(d, size(d))`, []interface{}{11.0, 16.0}},
+	}
+	vars := testVars(t)
+	for _, test := range tests {
+		p, err := Compile(test.expr, "data", "domains", "count")
+		if err != nil {
+			t.Errorf("Compile(%q) returned error %v", test.expr, err)
+			continue
+		}
+		got, err := p.Eval(vars)
+		if err != nil {
+			t.Errorf("%q returned error %v", test.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q = %#v, want %#v", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{`1 +`, `ERROR: <input>:1:4: Syntax error: mismatched input '<EOF>'`},
+		{`"abc`, `ERROR: <input>:1:1: Syntax error: token recognition error`},
+		{`nope == 1`, `ERROR: <input>:1:1: undeclared reference to 'nope'`},
+		{`frob(1)`, `ERROR: <input>:1:5: undeclared reference to 'frob'`},
+		{`1 + "a"`, `ERROR: <input>:1:3: found no matching overload for '_+_' applied to '(int, string)'`},
+		{`7 / 2.0`, `ERROR: <input>:1:3: found no matching overload for '_/_' applied to '(int, double)'`},
+		{`7.0 / 2.0 > 3`, ``},
+		{`"a".matches("[")`, "ERROR: <input>:1:13: invalid matches argument"},
+	}
+	for _, test := range tests {
+		_, err := Compile(test.expr, "data", "domains")
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("Compile(%q) returned error %v", test.expr, err)
+			}
+			continue
+		}
+		if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+			t.Errorf("Compile(%q) returned error %v, want %q", test.expr, err, test.err)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{`data.nope`, `no such key: nope`},
+		{`data.leaf_cert.all_domains[3]`, `index out of bounds: 3`},
+		{`data.cert_index + 1`, `no such overload`},
+		{`1 / (count - 3)`, `division by zero`},
+		{`domains.all(d, d)`, `no such overload`},
+	}
+	vars := testVars(t)
+	for _, test := range tests {
+		p, err := Compile(test.expr, "data", "domains", "count")
+		if err != nil {
+			t.Errorf("Compile(%q) returned error %v", test.expr, err)
+			continue
+		}
+		if _, err := p.Eval(vars); err == nil || err.Error() != test.err {
+			t.Errorf("%q returned error %v, want %q", test.expr, err, test.err)
+		}
+	}
+}
+
+func TestEvalBool(t *testing.T) {
+	p, err := Compile(`count`, "count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.EvalBool(map[string]interface{}{"count": 1}); err == nil || err.Error() != "evaluated to int, not a bool" {
+		t.Errorf("EvalBool returned error %v, want %q", err, "evaluated to int, not a bool")
+	}
+	if p.String() != "count" {
+		t.Errorf("String() = %q, want %q", p.String(), "count")
+	}
+	p, err = Compile(`count == 1`, "count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := p.EvalBool(map[string]interface{}{"count": 1}); !b || err != nil {
+		t.Errorf("EvalBool returned %v, %v, want true", b, err)
+	}
+}
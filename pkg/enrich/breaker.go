@@ -0,0 +1,73 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package enrich
+
+import (
+	"sync"
+	"time"
+)
+
+// Breaker is a circuit breaker for an enricher whose service is down or
+// overloaded. After Failures failures in a row it opens, and the enricher is
+// skipped for Cooldown rather than slowing every alert down by timing out.
+// Then a single alert is let through to try it again: if that succeeds the
+// breaker closes, and otherwise it stays open for another Cooldown.
+type Breaker struct {
+	Failures int
+	Cooldown time.Duration
+
+	// OnChange, if set, is called when the breaker opens or closes
+	OnChange func(open bool)
+
+	mu       sync.Mutex
+	failures int       // in a row
+	openedAt time.Time // zero while closed
+	trying   bool      // while an alert is trying the enricher again
+}
+
+// Allow reports whether the enricher should be run.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openedAt.IsZero() {
+		return true
+	}
+	if b.trying || time.Since(b.openedAt) < b.Cooldown {
+		return false
+	}
+	b.trying = true
+	return true
+}
+
+// Record records the result of running the enricher.
+func (b *Breaker) Record(err error) {
+	b.mu.Lock()
+	changed, open := false, false
+	if err == nil {
+		changed = !b.openedAt.IsZero()
+		b.failures, b.openedAt, b.trying = 0, time.Time{}, false
+	} else {
+		b.failures++
+		if b.trying || (b.openedAt.IsZero() && b.failures >= b.Failures) {
+			changed, open = b.openedAt.IsZero(), true
+			b.openedAt, b.trying = time.Now(), false
+		}
+	}
+	b.mu.Unlock()
+	if changed && b.OnChange != nil {
+		b.OnChange(open)
+	}
+}
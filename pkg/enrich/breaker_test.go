@@ -0,0 +1,69 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package enrich
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestBreaker(t *testing.T) {
+	changes := []bool{}
+	b := &Breaker{Failures: 3, Cooldown: 20 * time.Millisecond, OnChange: func(open bool) { changes = append(changes, open) }}
+	fail := errors.New("timed out")
+
+	// failures that aren't in a row don't open it
+	for _, err := range []error{fail, fail, nil, fail, fail} {
+		if !b.Allow() {
+			t.Fatal("opened too soon")
+		}
+		b.Record(err)
+	}
+	b.Record(fail)
+	if b.Allow() {
+		t.Fatal("still closed after 3 failures in a row")
+	}
+
+	// after the cooldown, a single try is let through, and failing it opens
+	// the breaker for another cooldown
+	time.Sleep(30 * time.Millisecond)
+	if !b.Allow() {
+		t.Fatal("still open after the cooldown")
+	}
+	if b.Allow() {
+		t.Fatal("let a second try through")
+	}
+	b.Record(fail)
+	if b.Allow() {
+		t.Fatal("closed after the try failed")
+	}
+
+	// succeeding closes it
+	time.Sleep(30 * time.Millisecond)
+	if !b.Allow() {
+		t.Fatal("still open after the cooldown")
+	}
+	b.Record(nil)
+	if !b.Allow() || !b.Allow() {
+		t.Fatal("still open after the try succeeded")
+	}
+	if !reflect.DeepEqual(changes, []bool{true, false}) {
+		t.Errorf("got changes %v, want [true false]", changes)
+	}
+}
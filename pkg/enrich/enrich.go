@@ -0,0 +1,61 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package enrich adds context to alerts before they're sent, like whether a
+// matching domain resolves or who registered it, so that whoever gets the
+// alert can triage it without looking everything up themselves.
+package enrich
+
+import (
+	"context"
+	"time"
+
+	"github.com/heptiolabs/certstream-slack/pkg/notify"
+)
+
+// Enricher looks up context about an alert's certificate or domains.
+type Enricher interface {
+	// Name identifies the enricher, like "dns", in logs and alerts
+	Name() string
+
+	// Enrich returns what the enricher found about a, giving up when ctx
+	// is done. It mustn't modify a.
+	Enrich(ctx context.Context, a *notify.Alert) ([]notify.Enrichment, error)
+}
+
+// Apply runs each enricher on a in turn, giving each up to timeout (if
+// positive), and adds what they find to a.Enrichments. An enricher failing
+// doesn't stop the rest, and the errors are passed to failed, if set. It's
+// shorthand for a Pipeline without breakers.
+func Apply(ctx context.Context, enrichers []Enricher, timeout time.Duration, a *notify.Alert, failed func(e Enricher, err error)) {
+	p := &Pipeline{}
+	if failed != nil {
+		p.Failed = func(e Enricher, a *notify.Alert, err error) { failed(e, err) }
+	}
+	for _, e := range enrichers {
+		p.Stages = append(p.Stages, &Stage{Enricher: e, Timeout: timeout})
+	}
+	p.Run(ctx, a)
+}
+
+func enrich(ctx context.Context, e Enricher, timeout time.Duration, a *notify.Alert) ([]notify.Enrichment, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return e.Enrich(ctx, a)
+}
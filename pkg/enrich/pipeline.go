@@ -0,0 +1,80 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package enrich
+
+import (
+	"context"
+	"time"
+
+	"github.com/heptiolabs/certstream-slack/pkg/notify"
+)
+
+// Pipeline runs enrichers in order, so that later ones can build on what
+// earlier ones found, like looking up where the addresses a DNS enricher
+// found are. Each stage has its own timeout and, optionally, a circuit
+// breaker that skips it while it keeps failing.
+type Pipeline struct {
+	Stages []*Stage
+
+	// Failed, if set, is called with each error a stage returns or times
+	// out with
+	Failed func(e Enricher, a *notify.Alert, err error)
+
+	// Skipped, if set, is called for each stage skipped because its
+	// breaker is open
+	Skipped func(e Enricher, a *notify.Alert)
+}
+
+// Stage is a single enricher in a pipeline.
+type Stage struct {
+	Enricher Enricher
+
+	// Timeout limits the enricher for each alert, if positive
+	Timeout time.Duration
+
+	// Breaker, if set, skips the enricher after it fails too many times in
+	// a row
+	Breaker *Breaker
+}
+
+// Run runs each stage on a in turn and adds what they find to
+// a.Enrichments. A stage failing or being skipped doesn't stop the rest.
+func (p *Pipeline) Run(ctx context.Context, a *notify.Alert) {
+	for _, s := range p.Stages {
+		if s.Breaker != nil && !s.Breaker.Allow() {
+			if p.Skipped != nil {
+				p.Skipped(s.Enricher, a)
+			}
+			continue
+		}
+		found, err := enrich(ctx, s.Enricher, s.Timeout, a)
+		if s.Breaker != nil {
+			// the caller giving up isn't the enricher's fault
+			if err == nil || ctx.Err() == nil {
+				s.Breaker.Record(err)
+			}
+		}
+		if err != nil && p.Failed != nil {
+			p.Failed(s.Enricher, a, err)
+		}
+		for _, f := range found {
+			if f.Source == "" {
+				f.Source = s.Enricher.Name()
+			}
+			a.Enrichments = append(a.Enrichments, f)
+		}
+	}
+}
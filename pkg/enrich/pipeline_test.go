@@ -0,0 +1,165 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package enrich
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/heptiolabs/certstream-slack/pkg/notify"
+)
+
+// testEnricher finds what its function returns.
+type testEnricher struct {
+	name   string
+	enrich func(ctx context.Context, a *notify.Alert) ([]notify.Enrichment, error)
+}
+
+func (e *testEnricher) Name() string { return e.name }
+
+func (e *testEnricher) Enrich(ctx context.Context, a *notify.Alert) ([]notify.Enrichment, error) {
+	return e.enrich(ctx, a)
+}
+
+// found returns an enricher that always finds a single fact.
+func found(name, fact string) *testEnricher {
+	return &testEnricher{name: name, enrich: func(context.Context, *notify.Alert) ([]notify.Enrichment, error) {
+		return []notify.Enrichment{{Name: "fact", Value: fact}}, nil
+	}}
+}
+
+// failing returns an enricher that always fails.
+func failing(name string) *testEnricher {
+	return &testEnricher{name: name, enrich: func(context.Context, *notify.Alert) ([]notify.Enrichment, error) {
+		return nil, errors.New("service unavailable")
+	}}
+}
+
+func TestPipeline(t *testing.T) {
+	dns := &testEnricher{name: "dns", enrich: func(context.Context, *notify.Alert) ([]notify.Enrichment, error) {
+		return []notify.Enrichment{{Domain: "example.com", Name: "A", Value: "192.0.2.1"}}, nil
+	}}
+	// later stages see what earlier ones found
+	geo := &testEnricher{name: "geo", enrich: func(ctx context.Context, a *notify.Alert) ([]notify.Enrichment, error) {
+		found := []notify.Enrichment{}
+		for _, e := range a.Enrichments {
+			if e.Name == "A" {
+				found = append(found, notify.Enrichment{Source: "maxmind", Domain: e.Domain, Name: "country", Value: "US"})
+			}
+		}
+		return found, nil
+	}}
+	slow := &testEnricher{name: "slow", enrich: func(ctx context.Context, a *notify.Alert) ([]notify.Enrichment, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}}
+
+	failures := []string{}
+	p := &Pipeline{
+		Stages: []*Stage{
+			{Enricher: dns},
+			{Enricher: failing("whois")},
+			{Enricher: slow, Timeout: time.Millisecond},
+			{Enricher: geo, Timeout: time.Second},
+		},
+		Failed: func(e Enricher, a *notify.Alert, err error) {
+			failures = append(failures, e.Name()+": "+err.Error())
+		},
+	}
+	a := &notify.Alert{}
+	p.Run(context.Background(), a)
+
+	want := []notify.Enrichment{
+		{Source: "dns", Domain: "example.com", Name: "A", Value: "192.0.2.1"},
+		{Source: "maxmind", Domain: "example.com", Name: "country", Value: "US"},
+	}
+	if !reflect.DeepEqual(a.Enrichments, want) {
+		t.Errorf("got %+v, want %+v", a.Enrichments, want)
+	}
+	wantFailures := []string{"whois: service unavailable", "slow: " + context.DeadlineExceeded.Error()}
+	if !reflect.DeepEqual(failures, wantFailures) {
+		t.Errorf("got failures %q, want %q", failures, wantFailures)
+	}
+}
+
+func TestPipelineBreaker(t *testing.T) {
+	changes := []bool{}
+	breaker := &Breaker{Failures: 2, Cooldown: time.Hour, OnChange: func(open bool) { changes = append(changes, open) }}
+	calls := 0
+	whois := failing("whois")
+	enrich := whois.enrich
+	whois.enrich = func(ctx context.Context, a *notify.Alert) ([]notify.Enrichment, error) {
+		calls++
+		return enrich(ctx, a)
+	}
+	skipped := 0
+	p := &Pipeline{
+		Stages: []*Stage{{Enricher: whois, Breaker: breaker}, {Enricher: found("dns", "resolves")}},
+		Skipped: func(e Enricher, a *notify.Alert) {
+			if e != whois {
+				t.Errorf("skipped %s", e.Name())
+			}
+			skipped++
+		},
+	}
+	for i := 0; i < 4; i++ {
+		a := &notify.Alert{}
+		p.Run(context.Background(), a)
+		if len(a.Enrichments) != 1 {
+			t.Errorf("alert %d got %+v; an open breaker shouldn't skip later stages", i, a.Enrichments)
+		}
+	}
+	if calls != 2 || skipped != 2 {
+		t.Errorf("the enricher ran %d times and was skipped %d, want 2 and 2", calls, skipped)
+	}
+	if !reflect.DeepEqual(changes, []bool{true}) {
+		t.Errorf("got breaker changes %v", changes)
+	}
+
+	// the caller giving up doesn't count against the enricher
+	breaker = &Breaker{Failures: 1, Cooldown: time.Hour}
+	p = &Pipeline{Stages: []*Stage{{Enricher: &testEnricher{name: "slow", enrich: func(ctx context.Context, a *notify.Alert) ([]notify.Enrichment, error) {
+		return nil, ctx.Err()
+	}}, Breaker: breaker}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p.Run(ctx, &notify.Alert{})
+	if !breaker.Allow() {
+		t.Error("the breaker opened when the caller gave up")
+	}
+}
+
+func TestApply(t *testing.T) {
+	failed := []string{}
+	a := &notify.Alert{}
+	Apply(context.Background(), []Enricher{found("dns", "a"), failing("whois"), found("http", "b")}, time.Second, a, func(e Enricher, err error) {
+		failed = append(failed, e.Name())
+	})
+	want := []notify.Enrichment{{Source: "dns", Name: "fact", Value: "a"}, {Source: "http", Name: "fact", Value: "b"}}
+	if !reflect.DeepEqual(a.Enrichments, want) {
+		t.Errorf("got %+v, want %+v", a.Enrichments, want)
+	}
+	if !reflect.DeepEqual(failed, []string{"whois"}) {
+		t.Errorf("got failures %q", failed)
+	}
+
+	// without a callback, failures are ignored
+	Apply(context.Background(), []Enricher{failing("whois")}, 0, &notify.Alert{}, nil)
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package match
+
+// ahoCorasick finds every occurrence of a set of keywords in a string in a
+// single pass, however many keywords there are.
+type ahoCorasick struct {
+	nodes []acNode
+}
+
+type acNode struct {
+	next map[byte]int
+	fail int   // the node for the longest proper suffix that's in the trie
+	out  []int // keywords ending here, including those reached by fail
+}
+
+func newAhoCorasick(keywords []string) *ahoCorasick {
+	a := &ahoCorasick{nodes: []acNode{{next: map[byte]int{}}}}
+
+	// build a trie of the keywords
+	for i, keyword := range keywords {
+		n := 0
+		for j := 0; j < len(keyword); j++ {
+			child, ok := a.nodes[n].next[keyword[j]]
+			if !ok {
+				child = len(a.nodes)
+				a.nodes = append(a.nodes, acNode{next: map[byte]int{}})
+				a.nodes[n].next[keyword[j]] = child
+			}
+			n = child
+		}
+		a.nodes[n].out = append(a.nodes[n].out, i)
+	}
+
+	// link each node to its longest suffix, breadth first so that shorter
+	// suffixes are linked before they're needed
+	queue := []int{}
+	for _, child := range a.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for c, child := range a.nodes[n].next {
+			fail := a.nodes[n].fail
+			for {
+				if next, ok := a.nodes[fail].next[c]; ok {
+					fail = next
+					break
+				}
+				if fail == 0 {
+					break
+				}
+				fail = a.nodes[fail].fail
+			}
+			a.nodes[child].fail = fail
+			a.nodes[child].out = append(a.nodes[child].out, a.nodes[fail].out...)
+			queue = append(queue, child)
+		}
+	}
+	return a
+}
+
+// each calls found with the index of each keyword occurring in s, possibly
+// more than once, until found returns false.
+func (a *ahoCorasick) each(s string, found func(keyword int) bool) {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		for {
+			if next, ok := a.nodes[n].next[s[i]]; ok {
+				n = next
+				break
+			}
+			if n == 0 {
+				break
+			}
+			n = a.nodes[n].fail
+		}
+		for _, keyword := range a.nodes[n].out {
+			if !found(keyword) {
+				return
+			}
+		}
+	}
+}
+
+// contains reports whether any keyword occurs in s.
+func (a *ahoCorasick) contains(s string) bool {
+	found := false
+	a.each(s, func(int) bool {
+		found = true
+		return false
+	})
+	return found
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package match
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// The confusables table is generated into confusables_table.go from the
+// Unicode confusables data (UTS #39), for the version in
+// gen_confusables.go.
+//
+//go:generate go run gen_confusables.go
+
+// Skeleton returns the skeleton of s per UTS #39: two strings that look
+// alike, like "paypal.com" and "раураl.com" (with Cyrillic letters), have
+// the same skeleton. Ahead of mapping confusables, s is lowercased and
+// fullwidth forms are narrowed, as IDNA would.
+func Skeleton(s string) string {
+	s = norm.NFD.String(strings.ToLower(s))
+	var b strings.Builder
+	for _, r := range s {
+		if r >= 0xff01 && r <= 0xff5e {
+			r = unicode.ToLower(r - (0xff01 - '!'))
+		}
+		if prototype, ok := confusables[r]; ok {
+			b.WriteString(prototype)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return norm.NFD.String(b.String())
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package match
+
+import (
+	"testing"
+)
+
+func TestSkeleton(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"paypal.com", "раураl.com", true}, // Cyrillic а, р, and у
+		{"paypal.com", "PAYPAL.com", true},
+		{"paypal.com", "ｐａｙｐａｌ.com", true}, // fullwidth
+		{"microsoft.com", "rnicrosoft.com", true},
+		{"example.com", "examp1e.com", true},
+		{"google.com", "g00gle.com", true},
+		{"apple.com", "аррlе.com", true}, // Cyrillic а, р, and е
+		{"example.com", "exämple.com", false},
+		{"paypal.com", "paypal.net", false},
+		{"example.com", "exanple.com", false},
+	}
+	for _, test := range tests {
+		a, b := Skeleton(test.a), Skeleton(test.b)
+		if (a == b) != test.same {
+			t.Errorf("Skeleton(%q) = %q and Skeleton(%q) = %q, want same = %v", test.a, a, test.b, b, test.same)
+		}
+	}
+}
+
+func TestConfusables(t *testing.T) {
+	// the prototypes are lowercase ASCII, so skeletons of ASCII domains stay
+	// comparable, and characters don't map to themselves
+	for r, prototype := range confusables {
+		if prototype == "" || prototype == string(r) {
+			t.Errorf("%U maps to %q", r, prototype)
+		}
+		for _, p := range prototype {
+			if !(p >= 'a' && p <= 'z') && !(p >= '0' && p <= '9') {
+				t.Errorf("%U maps to %q, which isn't lowercase ASCII", r, prototype)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,194 @@
+//go:build ignore
+
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// gen_confusables generates confusables_table.go from the Unicode
+// confusables data (UTS #39), confusables.txt. It downloads the data for
+// -version, or reads a copy of it from -file:
+//
+//	go run gen_confusables.go -version 15.0.0
+//
+// Only the mappings Skeleton can use are kept: from characters that are
+// already lowercase and in NFD (as Skeleton lowercases and decomposes
+// before mapping), to prototypes that are lowercase ASCII letters and
+// digits, since domains are compared ignoring case and what's spoofed is
+// almost always an ASCII name.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// unicodeVersion is the version of the data go generate uses.
+const unicodeVersion = "15.0.0"
+
+const header = `/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+`
+
+func main() {
+	version := flag.String("version", unicodeVersion, "the Unicode version of the data to download")
+	file := flag.String("file", "", "read confusables.txt from `path` instead of downloading it")
+	output := flag.String("output", "confusables_table.go", "write the table to `path`")
+	flag.Parse()
+
+	var data io.Reader
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		data = f
+	} else {
+		url := fmt.Sprintf("https://www.unicode.org/Public/security/%s/confusables.txt", *version)
+		resp, err := http.Get(url)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("could not download %s: %s", url, resp.Status)
+		}
+		data = resp.Body
+	}
+
+	confusables, err := parse(data)
+	if err != nil {
+		log.Fatal(err)
+	}
+	src, err := table(confusables, *version)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(*output, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// parse reads lines of confusables.txt like "0430 ;	0061 ;	MA	# ...",
+// keeping the ones Skeleton can use.
+func parse(r io.Reader) (map[rune]string, error) {
+	confusables := map[rune]string{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimPrefix(scanner.Text(), "\ufeff")
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Split(line, ";")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected a source and a prototype", n)
+		}
+		source, err := codePoints(fields[0])
+		if err != nil || len(source) != 1 {
+			return nil, fmt.Errorf("line %d: invalid source %q", n, fields[0])
+		}
+		prototype, err := codePoints(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid prototype %q", n, fields[1])
+		}
+
+		r := source[0]
+		p := strings.ToLower(string(prototype))
+		if unicode.ToLower(r) != r || norm.NFD.String(string(r)) != string(r) || p == string(r) || !asciiAlphanumeric(p) {
+			continue
+		}
+		confusables[r] = p
+	}
+	return confusables, scanner.Err()
+}
+
+// codePoints parses space-separated hex code points.
+func codePoints(s string) ([]rune, error) {
+	runes := []rune{}
+	for _, field := range strings.Fields(s) {
+		cp, err := strconv.ParseUint(field, 16, 32)
+		if err != nil {
+			return nil, err
+		}
+		runes = append(runes, rune(cp))
+	}
+	return runes, nil
+}
+
+func asciiAlphanumeric(s string) bool {
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// table formats the generated Go source.
+func table(confusables map[rune]string, version string) ([]byte, error) {
+	runes := []rune{}
+	for r := range confusables {
+		runes = append(runes, r)
+	}
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+
+	var b bytes.Buffer
+	b.WriteString(header)
+	fmt.Fprintf(&b, "// Code generated by gen_confusables.go from the Unicode %s confusables data; DO NOT EDIT.\n\n", version)
+	b.WriteString("package match\n\n")
+	b.WriteString("// confusables maps characters to the prototype they're visually confusable\n")
+	b.WriteString("// with (see gen_confusables.go for which are kept).\n")
+	b.WriteString("var confusables = map[rune]string{\n")
+	for _, r := range runes {
+		if unicode.IsPrint(r) {
+			fmt.Fprintf(&b, "\t%q: %q, // U+%04X\n", r, confusables[r], r)
+		} else {
+			fmt.Fprintf(&b, "\t0x%04X: %q,\n", r, confusables[r])
+		}
+	}
+	b.WriteString("}\n")
+	return format.Source(b.Bytes())
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package match
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/publicsuffix"
+)
+
+// KeywordMatcher matches domains against a list of keywords, as a simpler
+// alternative to writing one giant regular expression.
+type KeywordMatcher struct {
+	// mode is "substring" to match keywords anywhere in the domain,
+	// "registrable" to match them anywhere in the registrable label (the
+	// part of the eTLD+1 before the public suffix, like "example" in
+	// "www.example.co.uk"), or "label" to match the registrable label
+	mode string
+
+	// keywords are lowercased, and only kept for substring and registrable
+	// modes
+	keywords   []string
+	substrings *ahoCorasick
+	labels     map[string]bool
+}
+
+// NewKeywordMatcher returns a matcher for keywords in mode, which is
+// "substring", "registrable", or "label".
+func NewKeywordMatcher(keywords []string, mode string) (*KeywordMatcher, error) {
+	m := &KeywordMatcher{mode: mode}
+	switch mode {
+	case "substring", "registrable":
+		// the automaton finds keywords in a single pass over the domain, so
+		// this stays fast however long the list is
+		for _, keyword := range keywords {
+			m.keywords = append(m.keywords, strings.ToLower(keyword))
+		}
+		m.substrings = newAhoCorasick(m.keywords)
+	case "label":
+		m.labels = map[string]bool{}
+		for _, keyword := range keywords {
+			m.labels[strings.ToLower(keyword)] = true
+		}
+	default:
+		return nil, errors.Errorf("must be \"substring\", \"registrable\", or \"label\", not %q", mode)
+	}
+	return m, nil
+}
+
+// Match reports whether domain contains (or, in registrable mode, is
+// registered with a label containing, or in label mode, is registered as)
+// one of the keywords, ignoring case.
+func (m *KeywordMatcher) Match(domain string) bool {
+	domain = strings.ToLower(domain)
+	switch m.mode {
+	case "substring":
+		return m.substrings.contains(domain)
+	case "registrable":
+		return m.substrings.contains(registrableLabel(domain))
+	}
+	return m.labels[registrableLabel(domain)]
+}
+
+// registrableLabel returns the label of domain's eTLD+1 that its owner
+// chose, like "example" for "www.example.co.uk".
+func registrableLabel(domain string) string {
+	etldPlusOne := RegistrableDomain(domain)
+	if i := strings.Index(etldPlusOne, "."); i >= 0 {
+		return etldPlusOne[:i]
+	}
+	return etldPlusOne
+}
+
+// RegistrableDomain returns domain's eTLD+1, the name its owner registered
+// with the public suffix it's under, like "example.co.uk" for
+// "www.example.co.uk", or "" if it has none.
+func RegistrableDomain(domain string) string {
+	etldPlusOne, err := publicsuffix.EffectiveTLDPlusOne(strings.TrimPrefix(domain, "*."))
+	if err != nil {
+		return ""
+	}
+	return etldPlusOne
+}
+
+// ReadKeywordsFile reads a list of keywords from path, one per line,
+// skipping blank lines and comments starting with "#".
+func ReadKeywordsFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	keywords := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keywords = append(keywords, line)
+	}
+	return keywords, scanner.Err()
+}
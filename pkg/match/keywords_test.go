@@ -0,0 +1,130 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package match
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestAhoCorasick(t *testing.T) {
+	a := newAhoCorasick([]string{"he", "she", "his", "hers"})
+	tests := []struct {
+		s    string
+		want []int
+	}{
+		{"ushers", []int{0, 1, 3}},
+		{"ahishers", []int{0, 1, 2, 3}},
+		{"hhhhe", []int{0}},
+		{"xyz", nil},
+		{"", nil},
+	}
+	for _, test := range tests {
+		var found []int
+		a.each(test.s, func(keyword int) bool {
+			found = append(found, keyword)
+			return true
+		})
+		sort.Ints(found)
+		if !reflect.DeepEqual(found, test.want) {
+			t.Errorf("each(%q) found %v, want %v", test.s, found, test.want)
+		}
+		if got := a.contains(test.s); got != (test.want != nil) {
+			t.Errorf("contains(%q) = %v", test.s, got)
+		}
+	}
+
+	// returning false stops the search
+	n := 0
+	a.each("hehehe", func(int) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Errorf("each kept going after found returned false, calling it %d times", n)
+	}
+}
+
+func TestKeywordMatcher(t *testing.T) {
+	tests := []struct {
+		mode   string
+		domain string
+		want   bool
+	}{
+		{"substring", "paypal-login.example.com", true},
+		{"substring", "SECURE.Example.com", true},
+		{"substring", "www.example.com", false},
+		{"registrable", "secure-paypal.co.uk", true},
+		{"registrable", "www.mypaypal.com", true},
+		{"registrable", "paypal.example.com", false},
+		{"registrable", "secure.example.com", false},
+		{"label", "www.paypal.co.uk", true},
+		{"label", "*.PayPal.com", true},
+		{"label", "paypal-login.com", false},
+		{"label", "paypal.example.com", false},
+		{"label", "com", false},
+	}
+	for _, test := range tests {
+		m, err := NewKeywordMatcher([]string{"PayPal", "secure"}, test.mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := m.Match(test.domain); got != test.want {
+			t.Errorf("%s mode: Match(%q) = %v, want %v", test.mode, test.domain, got, test.want)
+		}
+	}
+
+	if _, err := NewKeywordMatcher([]string{"paypal"}, "prefix"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
+
+func TestRegistrableDomain(t *testing.T) {
+	tests := map[string]string{
+		"www.example.co.uk": "example.co.uk",
+		"*.example.com":     "example.com",
+		"example.com":       "example.com",
+		"co.uk":             "",
+		"localhost":         "",
+	}
+	for domain, want := range tests {
+		if got := RegistrableDomain(domain); got != want {
+			t.Errorf("RegistrableDomain(%q) = %q, want %q", domain, got, want)
+		}
+	}
+}
+
+func TestReadKeywordsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keywords.txt")
+	if err := ioutil.WriteFile(path, []byte("# brands\npaypal\n\n  apple  \n#login\nsecure\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	keywords, err := ReadKeywordsFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"paypal", "apple", "secure"}; !reflect.DeepEqual(keywords, want) {
+		t.Errorf("got %q, want %q", keywords, want)
+	}
+
+	if _, err := ReadKeywordsFile(filepath.Join(t.TempDir(), "missing.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+}
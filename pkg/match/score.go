@@ -0,0 +1,155 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package match
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// Scorer scores how likely domains are to be phishing, in the style of
+// phishing_catcher. Keywords in a domain add their weights, as do a
+// suspicious TLD, a free CA issuing its certificate, and a word within one
+// edit (or a confusable) of a protected name, while the domain's entropy
+// and nesting add in proportion to them.
+type Scorer struct {
+	// Keywords are weighted substrings, like {"login": 25}
+	Keywords map[string]int
+
+	// SuspiciousTLDs are public suffixes, like "xyz", popular with phishing
+	SuspiciousTLDs []string
+
+	// FreeCAs are the organizations of free CAs, like "Let's Encrypt",
+	// compared to certificates' issuers ignoring case
+	FreeCAs []string
+
+	// Protected are domains, like "example.com", whose registrable labels
+	// shouldn't be imitated
+	Protected []string
+
+	Weights ScoreWeights
+}
+
+// ScoreWeights weigh the signals other than keywords.
+type ScoreWeights struct {
+	Entropy       int // per bit of Shannon entropy per character
+	SuspiciousTLD int
+	Nesting       int // per dot, in domains with at least three
+	FreeCA        int
+	Lookalike     int
+}
+
+// Score returns the score of domain in a certificate from issuerOrg, and
+// what contributed to it, like "login +25" and "entropy +31", heaviest
+// first.
+func (s *Scorer) Score(domain, issuerOrg string) (int, []string) {
+	domain = strings.TrimPrefix(strings.ToLower(domain), "*.")
+	if decoded, err := idna.ToUnicode(domain); err == nil {
+		domain = decoded
+	}
+	type signal struct {
+		name   string
+		weight int
+	}
+	signals := []signal{}
+	add := func(name string, weight int) {
+		if weight != 0 {
+			signals = append(signals, signal{name, weight})
+		}
+	}
+
+	add("entropy", int(math.Round(entropy(domain)*float64(s.Weights.Entropy))))
+	for keyword, weight := range s.Keywords {
+		if strings.Contains(domain, keyword) {
+			add(keyword, weight)
+		}
+	}
+	suffix, _ := publicsuffix.PublicSuffix(domain)
+	for _, tld := range s.SuspiciousTLDs {
+		if suffix == tld {
+			add("."+suffix, s.Weights.SuspiciousTLD)
+			break
+		}
+	}
+	if dots := strings.Count(domain, "."); dots >= 3 {
+		add(fmt.Sprintf("%d levels", dots+1), dots*s.Weights.Nesting)
+	}
+	for _, ca := range s.FreeCAs {
+		if issuerOrg != "" && strings.EqualFold(issuerOrg, ca) {
+			add("free CA "+issuerOrg, s.Weights.FreeCA)
+			break
+		}
+	}
+	if protected := s.imitates(strings.TrimSuffix(domain, "."+suffix)); protected != "" {
+		add("lookalike of "+protected, s.Weights.Lookalike)
+	}
+
+	sort.Slice(signals, func(i, j int) bool {
+		if signals[i].weight != signals[j].weight {
+			return signals[i].weight > signals[j].weight
+		}
+		return signals[i].name < signals[j].name
+	})
+	score, contributions := 0, []string{}
+	for _, sig := range signals {
+		score += sig.weight
+		contributions = append(contributions, fmt.Sprintf("%s %+d", sig.name, sig.weight))
+	}
+	return score, contributions
+}
+
+// imitates returns the protected domain that a word of name (split at dots
+// and hyphens) is one edit from or confusable with, if any.
+func (s *Scorer) imitates(name string) string {
+	if len(s.Protected) == 0 {
+		return ""
+	}
+	words := strings.FieldsFunc(name, func(r rune) bool { return r == '.' || r == '-' })
+	for _, protected := range s.Protected {
+		suffix, _ := publicsuffix.PublicSuffix(protected)
+		label := strings.TrimSuffix(protected, "."+suffix)
+		for _, word := range words {
+			if word == label {
+				continue
+			}
+			if levenshtein(word, label, 1) == 1 || Skeleton(word) == Skeleton(label) {
+				return protected
+			}
+		}
+	}
+	return ""
+}
+
+// entropy is the Shannon entropy of s in bits per character.
+func entropy(s string) float64 {
+	counts := map[rune]int{}
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	e := 0.0
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		e -= p * math.Log2(p)
+	}
+	return e
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package match
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestScore(t *testing.T) {
+	s := &Scorer{
+		Keywords:       map[string]int{"login": 25, "paypal": 40},
+		SuspiciousTLDs: []string{"xyz", "tk"},
+		FreeCAs:        []string{"Let's Encrypt"},
+		Protected:      []string{"example.com"},
+		Weights: ScoreWeights{
+			SuspiciousTLD: 20,
+			Nesting:       3,
+			FreeCA:        10,
+			Lookalike:     70,
+		},
+	}
+	tests := []struct {
+		domain, issuerOrg string
+		score             int
+		contributions     []string
+	}{
+		{"www.example.com", "DigiCert Inc", 0, []string{}},
+		{"*.paypal-login.xyz", "", 85, []string{"paypal +40", "login +25", ".xyz +20"}},
+		{"login.paypal.com.secure.tk", "let's encrypt", 107, []string{"paypal +40", "login +25", ".tk +20", "5 levels +12", "free CA let's encrypt +10"}},
+		{"examp1e-login.com", "", 95, []string{"lookalike of example.com +70", "login +25"}},
+		{"exampel.com", "", 0, []string{}},
+		{"exampl.com", "", 70, []string{"lookalike of example.com +70"}},
+		{"ехаmрlе.com", "", 70, []string{"lookalike of example.com +70"}}, // Cyrillic
+		{"xn--ml-6kctd8d6a.net", "", 70, []string{"lookalike of example.com +70"}},
+	}
+	for _, test := range tests {
+		score, contributions := s.Score(test.domain, test.issuerOrg)
+		if score != test.score || !reflect.DeepEqual(contributions, test.contributions) {
+			t.Errorf("Score(%q, %q) = %d, %q, want %d, %q", test.domain, test.issuerOrg, score, contributions, test.score, test.contributions)
+		}
+	}
+}
+
+func TestScoreEntropy(t *testing.T) {
+	s := &Scorer{Weights: ScoreWeights{Entropy: 10}}
+	score, contributions := s.Score("aaaa.aa", "")
+	if want := int(math.Round(entropy("aaaa.aa") * 10)); score != want {
+		t.Errorf("got score %d, want %d", score, want)
+	}
+	if !reflect.DeepEqual(contributions, []string{"entropy +6"}) {
+		t.Errorf("got %q", contributions)
+	}
+
+	tests := map[string]float64{
+		"":     0,
+		"aaaa": 0,
+		"ab":   1,
+		"abcd": 2,
+	}
+	for s, want := range tests {
+		if got := entropy(s); math.Abs(got-want) > 1e-9 {
+			t.Errorf("entropy(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
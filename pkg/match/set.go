@@ -0,0 +1,145 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package match finds the domains of interest in certificates, by regular
+// expression, keyword, or resemblance to protected domains, using a Set of
+// Rules to check each domain against all of them at once.
+package match
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Rule matches domains by its Pattern, its Keywords, or its Lookalikes,
+// whichever are set, unless Exclude matches too. If PatternRegistrable is
+// set, Pattern is matched against domains' registrable domains (see
+// RegistrableDomain) instead of the whole domain.
+type Rule struct {
+	Pattern            *regexp.Regexp
+	PatternRegistrable bool
+	Keywords           *KeywordMatcher
+	Lookalikes         *LookalikeMatcher
+	Exclude            *regexp.Regexp
+}
+
+// Set matches domains against every rule at once. Most domains match
+// nothing, so rather than trying each rule's pattern and keywords in turn,
+// it looks for every rule's keywords in a single Aho-Corasick pass and rules
+// out the patterns with a single regular expression combining them all.
+type Set struct {
+	rules []*Rule
+
+	// keywords finds the substring keywords of every rule, and
+	// keywordRules lists the rules each keyword belongs to
+	keywords     *ahoCorasick
+	keywordRules [][]int
+
+	// patterns is an alternation of every rule's pattern, which only
+	// matches if at least one of them does
+	patterns *regexp.Regexp
+}
+
+// Hit is a rule matching a domain, with the reason if there is one (like
+// "homoglyph of example.com").
+type Hit struct {
+	Rule   int // index into the rules passed to NewSet
+	Reason string
+}
+
+// NewSet combines rules.
+func NewSet(rules []*Rule) *Set {
+	s := &Set{rules: rules}
+
+	keywords := []string{}
+	index := map[string]int{}
+	patterns := []string{}
+	for i, r := range rules {
+		if r.Keywords != nil {
+			for _, keyword := range r.Keywords.keywords {
+				k, ok := index[keyword]
+				if !ok {
+					k = len(keywords)
+					index[keyword] = k
+					keywords = append(keywords, keyword)
+					s.keywordRules = append(s.keywordRules, nil)
+				}
+				s.keywordRules[k] = append(s.keywordRules[k], i)
+			}
+		}
+		if r.Pattern != nil && !r.PatternRegistrable {
+			patterns = append(patterns, "(?:"+r.Pattern.String()+")")
+		}
+	}
+	if len(keywords) > 0 {
+		s.keywords = newAhoCorasick(keywords)
+	}
+	if len(patterns) > 0 {
+		// each pattern compiled on its own, so this can only fail if the
+		// combination is too big, in which case every pattern is tried
+		s.patterns, _ = regexp.Compile(strings.Join(patterns, "|"))
+	}
+	return s
+}
+
+// Match returns the rules matching domain, in the order they were passed to
+// NewSet.
+func (s *Set) Match(domain string) []Hit {
+	var keywordHits map[int]bool
+	if s.keywords != nil {
+		s.keywords.each(strings.ToLower(domain), func(k int) bool {
+			if keywordHits == nil {
+				keywordHits = map[int]bool{}
+			}
+			for _, i := range s.keywordRules[k] {
+				keywordHits[i] = true
+			}
+			return true
+		})
+	}
+	patternHit := s.patterns == nil || s.patterns.MatchString(domain)
+	registrable, haveRegistrable := "", false
+
+	hits := []Hit{}
+	for i, r := range s.rules {
+		reason, ok := "", false
+		switch {
+		case r.Pattern != nil && r.PatternRegistrable:
+			if !haveRegistrable {
+				registrable, haveRegistrable = RegistrableDomain(strings.ToLower(domain)), true
+			}
+			ok = registrable != "" && r.Pattern.MatchString(registrable)
+		case patternHit && r.Pattern != nil && r.Pattern.MatchString(domain):
+			ok = true
+		}
+		switch {
+		case ok:
+		case keywordHits[i]:
+			// in registrable mode, a keyword in the domain might not be in
+			// the registrable label
+			ok = r.Keywords.mode == "substring" || r.Keywords.Match(domain)
+		case r.Keywords != nil && r.Keywords.mode == "label":
+			ok = r.Keywords.Match(domain)
+		}
+		if !ok && r.Lookalikes != nil {
+			reason, ok = r.Lookalikes.Match(domain)
+		}
+		if ok && (r.Exclude == nil || !r.Exclude.MatchString(domain)) {
+			hits = append(hits, Hit{Rule: i, Reason: reason})
+		}
+	}
+	return hits
+}
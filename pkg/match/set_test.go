@@ -0,0 +1,96 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package match
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSet(t *testing.T) {
+	keywords := func(mode string, keywords ...string) *KeywordMatcher {
+		m, err := NewKeywordMatcher(keywords, mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	lookalikes, err := NewLookalikeMatcher([]string{"example.com"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := []*Rule{
+		{Pattern: regexp.MustCompile(`^mail\.`)},
+		{Keywords: keywords("substring", "login", "secure")},
+		{Keywords: keywords("substring", "login"), Exclude: regexp.MustCompile(`\.acme\.org$`)},
+		{Keywords: keywords("label", "paypal")},
+		{Lookalikes: lookalikes},
+		{Pattern: regexp.MustCompile(`shop`), Keywords: keywords("substring", "store")},
+		{Keywords: keywords("registrable", "bank")},
+		{Pattern: regexp.MustCompile(`^payments\.`), PatternRegistrable: true},
+	}
+	set := NewSet(rules)
+
+	tests := []struct {
+		domain string
+		want   []Hit
+	}{
+		{"www.example.com", []Hit{}},
+		{"mail.acme.net", []Hit{{Rule: 0}}},
+		{"LOGIN.acme.net", []Hit{{Rule: 1}, {Rule: 2}}},
+		{"login.acme.org", []Hit{{Rule: 1}}},
+		{"www.paypal.com", []Hit{{Rule: 3}}},
+		{"secure.examp1e.com", []Hit{{Rule: 1}, {Rule: 4, Reason: "homoglyph of example.com"}}},
+		{"shop.example.com", []Hit{{Rule: 5}}},
+		{"store.example.com", []Hit{{Rule: 5}}},
+		{"bank.acme.net", []Hit{}},
+		{"www.mybank.net", []Hit{{Rule: 6}}},
+		{"payments.acme.net", []Hit{}},
+		{"www.payments.acme.co.uk", []Hit{}},
+		{"www.Payments.co.uk", []Hit{{Rule: 7}}},
+	}
+	for _, test := range tests {
+		hits := set.Match(test.domain)
+		if !reflect.DeepEqual(hits, test.want) {
+			t.Errorf("Match(%q) = %+v, want %+v", test.domain, hits, test.want)
+		}
+
+		// the set agrees with trying each rule in turn
+		for _, hit := range hits {
+			r := rules[hit.Rule]
+			pattern := test.domain
+			if r.PatternRegistrable {
+				pattern = RegistrableDomain(strings.ToLower(test.domain))
+			}
+			ok := (r.Pattern != nil && r.Pattern.MatchString(pattern)) ||
+				(r.Keywords != nil && r.Keywords.Match(test.domain))
+			if r.Lookalikes != nil {
+				_, ok = r.Lookalikes.Match(test.domain)
+			}
+			if !ok {
+				t.Errorf("Match(%q) hit rule %d, which doesn't match on its own", test.domain, hit.Rule)
+			}
+		}
+	}
+}
+
+func TestSetEmpty(t *testing.T) {
+	if hits := NewSet(nil).Match("example.com"); len(hits) != 0 {
+		t.Errorf("got %+v from an empty set", hits)
+	}
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package match
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// LookalikeMatcher flags domains registered as a permutation of a protected
+// domain, in the style of dnstwist.
+type LookalikeMatcher struct {
+	// permutations maps each registrable permutation (like "examp1e.com", in
+	// both Unicode and punycode form) to how it was derived
+	permutations map[string]string
+
+	// maxDistance, if positive, also matches registrable labels within this
+	// Levenshtein distance of a protected label
+	maxDistance int
+	protected   []protectedDomain
+
+	// skeletons maps the skeleton (see Skeleton) of each protected domain
+	// to the domain, catching confusables no single homoglyph produces
+	skeletons map[string]string
+}
+
+// protectedDomain is a protected domain and its registrable label.
+type protectedDomain struct {
+	domain string
+	label  string
+}
+
+// homoglyphs are characters that look like each ASCII letter or digit,
+// either in some fonts or as Unicode confusables.
+var homoglyphs = map[rune][]string{
+	'a': {"à", "á", "â", "ã", "ä", "å", "ɑ", "а", "ạ"},
+	'b': {"d", "lb", "ib", "ß", "ь"},
+	'c': {"e", "ç", "ć", "с", "ϲ"},
+	'd': {"b", "cl", "dl", "ď", "ԁ"},
+	'e': {"c", "é", "ê", "ë", "ē", "е", "ė"},
+	'f': {"ƒ"},
+	'g': {"q", "ɢ", "ɡ", "ġ"},
+	'h': {"lh", "ih", "һ"},
+	'i': {"1", "l", "í", "ï", "ı", "і"},
+	'j': {"ј", "ʝ"},
+	'k': {"lk", "ik", "lc", "κ"},
+	'l': {"1", "i", "ɫ", "ł", "ӏ"},
+	'm': {"n", "nn", "rn", "rr", "ṃ"},
+	'n': {"m", "r", "ń", "ñ", "ո"},
+	'o': {"0", "ο", "о", "ö", "ó", "ò", "ø"},
+	'p': {"ρ", "р", "þ"},
+	'q': {"g", "զ"},
+	'r': {"ʀ", "г", "ŕ"},
+	's': {"ʂ", "ѕ", "ś", "š"},
+	't': {"τ", "ţ"},
+	'u': {"μ", "υ", "ü", "ú", "ù"},
+	'v': {"ѵ", "ν"},
+	'w': {"vv", "ѡ", "ԝ"},
+	'x': {"х", "ҳ"},
+	'y': {"ʏ", "γ", "у", "ý"},
+	'z': {"ʐ", "ż", "ź"},
+	'0': {"o"},
+	'1': {"l", "i"},
+	'5': {"s"},
+}
+
+// swapTLDs are the suffixes tried for TLD swaps.
+var swapTLDs = []string{
+	"com", "net", "org", "info", "biz", "co", "io", "app", "dev", "xyz",
+	"online", "site", "top", "club", "shop", "store", "tech", "cloud",
+	"us", "uk", "co.uk", "de", "fr", "ru", "cn", "in", "eu", "cc", "me",
+}
+
+// NewLookalikeMatcher returns a matcher for permutations of the protected
+// domains, like "example.com", and, if maxDistance is positive, for
+// registrable labels within that edit distance of theirs.
+func NewLookalikeMatcher(domains []string, maxDistance int) (*LookalikeMatcher, error) {
+	m := &LookalikeMatcher{permutations: map[string]string{}, maxDistance: maxDistance, skeletons: map[string]string{}}
+	for i, domain := range domains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		suffix, _ := publicsuffix.PublicSuffix(domain)
+		label := strings.TrimSuffix(domain, "."+suffix)
+		if label == domain || label == "" || strings.Contains(label, ".") {
+			return nil, errors.Errorf("[%d]: %q is not a registrable domain like \"example.com\"", i, domain)
+		}
+		m.protected = append(m.protected, protectedDomain{domain: domain, label: label})
+		m.skeletons[Skeleton(domain)] = domain
+		for permutation, kind := range permutations(label, suffix) {
+			if permutation == domain {
+				continue
+			}
+			m.add(permutation, fmt.Sprintf("%s of %s", kind, domain))
+		}
+	}
+	return m, nil
+}
+
+// add records a permutation in both Unicode and punycode form, so that it
+// matches whether or not domains are normalized.
+func (m *LookalikeMatcher) add(permutation, reason string) {
+	if _, ok := m.permutations[permutation]; !ok {
+		m.permutations[permutation] = reason
+	}
+	if ascii, err := idna.ToASCII(permutation); err == nil {
+		if _, ok := m.permutations[ascii]; !ok {
+			m.permutations[ascii] = reason
+		}
+	}
+}
+
+// Match returns how domain's registrable domain was derived from a
+// protected domain, if it was.
+func (m *LookalikeMatcher) Match(domain string) (string, bool) {
+	domain = strings.TrimPrefix(strings.ToLower(domain), "*.")
+	registrable, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil {
+		return "", false
+	}
+	if reason, ok := m.permutations[registrable]; ok {
+		return reason, true
+	}
+	unicode := registrable
+	if decoded, err := idna.ToUnicode(registrable); err == nil {
+		unicode = decoded
+	}
+	if protected, ok := m.skeletons[Skeleton(unicode)]; ok && unicode != protected {
+		return "confusable with " + protected, true
+	}
+	if m.maxDistance <= 0 {
+		return "", false
+	}
+
+	label := unicode[:strings.Index(unicode, ".")]
+	for _, p := range m.protected {
+		if registrable == p.domain {
+			continue
+		}
+		if d := levenshtein(label, p.label, m.maxDistance); d > 0 && d <= m.maxDistance {
+			return fmt.Sprintf("edit distance %d from %s", d, p.domain), true
+		}
+	}
+	return "", false
+}
+
+// levenshtein returns the edit distance between a and b, or a value greater
+// than max once it's clear the distance exceeds max.
+func levenshtein(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	if diff := len(ra) - len(rb); diff > max || -diff > max {
+		return max + 1
+	}
+
+	// dynamic programming over two rows of the edit matrix
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if cur[j] < rowMin {
+				rowMin = cur[j]
+			}
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func minInt(values ...int) int {
+	min := values[0]
+	for _, v := range values[1:] {
+		if v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// permutations generates lookalikes of label under suffix, keyed by the
+// permuted domain with the kind of permutation as the value.
+func permutations(label, suffix string) map[string]string {
+	found := map[string]string{}
+	add := func(kind, l, s string) {
+		if l == "" || strings.HasPrefix(l, "-") || strings.HasSuffix(l, "-") {
+			return
+		}
+		d := l + "." + s
+		if _, ok := found[d]; !ok {
+			found[d] = kind
+		}
+	}
+
+	runes := []rune(label)
+	for i, r := range runes {
+		before, after := string(runes[:i]), string(runes[i+1:])
+
+		for _, glyph := range homoglyphs[r] {
+			add("homoglyph", before+glyph+after, suffix)
+		}
+
+		// a single flipped bit in memory or on the wire
+		if r < 128 {
+			for bit := uint(0); bit < 7; bit++ {
+				flipped := rune(byte(r) ^ (1 << bit))
+				if (flipped >= 'a' && flipped <= 'z') || (flipped >= '0' && flipped <= '9') || flipped == '-' {
+					add("bitsquat", before+string(flipped)+after, suffix)
+				}
+			}
+		}
+
+		if i+1 < len(runes) && runes[i+1] != r {
+			swapped := append([]rune{}, runes...)
+			swapped[i], swapped[i+1] = swapped[i+1], swapped[i]
+			add("transposition", string(swapped), suffix)
+		}
+		if i > 0 {
+			add("hyphenation", before+"-"+string(runes[i:]), suffix)
+		}
+		add("omission", before+after, suffix)
+		add("repetition", before+string(r)+string(r)+after, suffix)
+	}
+
+	for _, tld := range swapTLDs {
+		if tld != suffix {
+			add("TLD swap", label, tld)
+		}
+	}
+	return found
+}
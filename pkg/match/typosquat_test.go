@@ -0,0 +1,98 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package match
+
+import (
+	"testing"
+)
+
+func TestLookalikeMatcher(t *testing.T) {
+	m, err := NewLookalikeMatcher([]string{"example.com", " PayPal.co.uk ", "microsoft.com"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		domain string
+		want   string
+	}{
+		{"examp1e.com", "homoglyph of example.com"},
+		{"www.exämple.com", "homoglyph of example.com"},
+		{"xn--exmple-cua.com", "homoglyph of example.com"},
+		{"*.exampme.com", "bitsquat of example.com"},
+		{"exmaple.com", "transposition of example.com"},
+		{"exa-mple.com", "hyphenation of example.com"},
+		{"exampe.com", "omission of example.com"},
+		{"EXAMPPLE.com", "repetition of example.com"},
+		{"example.net", "TLD swap of example.com"},
+		{"paypa1.co.uk", "homoglyph of paypal.co.uk"},
+		{"paypal.com", "TLD swap of paypal.co.uk"},
+		{"exzmplz.com", "edit distance 2 from example.com"},
+		{"раураl.co.uk", "confusable with paypal.co.uk"},
+		{"xn--l-7sba6dbr.co.uk", "confusable with paypal.co.uk"},
+		{"www.rnicr0soft.com", "confusable with microsoft.com"},
+
+		// the protected domains themselves, and domains too far from them
+		{"example.com", ""},
+		{"www.example.com", ""},
+		{"paypal.co.uk", ""},
+		{"examplesite.com", ""},
+		{"com", ""},
+	}
+	for _, test := range tests {
+		reason, ok := m.Match(test.domain)
+		if reason != test.want || ok != (test.want != "") {
+			t.Errorf("Match(%q) = %q, %v, want %q", test.domain, reason, ok, test.want)
+		}
+	}
+
+	// without a distance, only permutations match
+	m, err = NewLookalikeMatcher([]string{"example.com"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason, ok := m.Match("exzmplz.com"); ok {
+		t.Errorf("matched %q without a distance", reason)
+	}
+}
+
+func TestLookalikeMatcherErrors(t *testing.T) {
+	for _, domain := range []string{"com", "www.example.com", ""} {
+		if _, err := NewLookalikeMatcher([]string{domain}, 0); err == nil {
+			t.Errorf("expected an error for %q", domain)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		max  int
+		want int
+	}{
+		{"example", "example", 2, 0},
+		{"example", "exmaple", 2, 2},
+		{"example", "examples", 2, 1},
+		{"kitten", "sitting", 3, 3},
+		{"kitten", "sitting", 2, 3},
+		{"exämple", "example", 1, 1},
+		{"a", "abcd", 2, 3},
+	}
+	for _, test := range tests {
+		if got := levenshtein(test.a, test.b, test.max); got != test.want {
+			t.Errorf("levenshtein(%q, %q, %d) = %d, want %d", test.a, test.b, test.max, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package notify describes certificates matching a rule as Alerts, and the
+// Notifiers that send them to people or other systems.
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize/english"
+)
+
+// Alert describes a certificate matching a rule, ready to be sent to a sink.
+type Alert struct {
+	// Rule is the name of the matching rule and Pattern is its pattern
+	Rule    string
+	Pattern string
+
+	// Severity is the rule's severity
+	Severity Severity
+
+	// Domains are the matching domains, in sorted order
+	Domains []string
+
+	// OtherDomains is the number of domains in the certificate that didn't
+	// match the rule
+	OtherDomains int
+
+	// AllDomains are all the domains named in the certificate
+	AllDomains []string
+
+	// MaxDomains limits how many matching domains are listed in messages
+	// (zero lists them all)
+	MaxDomains int
+
+	// Original maps domains that were normalized before matching to how
+	// they were written in the certificate, if different
+	Original map[string]string
+
+	// Reasons explains why domains matched, where that isn't obvious from
+	// the rule (like "homoglyph of example.com"), keyed by domain
+	Reasons map[string]string
+
+	// Score is the highest phishing score of the matching domains, if the
+	// rule scores them
+	Score int
+
+	// Fingerprint is the certificate's SHA-1 fingerprint as colon-separated
+	// hex, and SHA256 is its SHA-256 fingerprint the same way if the source
+	// provides it
+	Fingerprint string
+	SHA256      string
+	CertURL     string
+
+	// Issuer is the certificate issuer's distinguished name, and IssuerCN
+	// and IssuerOrg are its common name and organization
+	Issuer    string
+	IssuerCN  string
+	IssuerOrg string
+
+	// Serial is the certificate's serial number in hex, and
+	// SignatureAlgorithm is how the issuer signed it (like "sha256, rsa")
+	Serial             string
+	SignatureAlgorithm string
+
+	// KeyAlgorithm and KeySize describe the certificate's public key (like
+	// "RSA" and 2048), ExtKeyUsages are what it may be used for (like
+	// "server auth"), and SCTs are the signed certificate timestamps
+	// embedded in it. These are only known if the source provides the
+	// certificate's DER encoding.
+	KeyAlgorithm string
+	KeySize      int
+	ExtKeyUsages []string
+	SCTs         []SCT
+
+	// Chain names the CAs in the certificate's chain by their
+	// distinguished names, from its issuer up to RootCA, the root CA, if
+	// the source provides the chain
+	Chain  []string
+	RootCA string
+
+	// NotBefore and NotAfter bound the certificate's validity period
+	NotBefore time.Time
+	NotAfter  time.Time
+
+	// Seen is when certstream saw the certificate in a CT log
+	Seen time.Time
+
+	// SourceName and SourceURL identify the CT log, and CertIndex is the
+	// certificate's index in it (or -1 if unknown)
+	SourceName string
+	SourceURL  string
+	CertIndex  int
+
+	// Data is the "data" object of the certstream message, which encodes
+	// as JSON as it was received
+	Data interface{}
+
+	// Message is the alert's message from a template, if the rule or sink
+	// has one, which sinks send instead of their own
+	Message string
+
+	// Enrichments are what enrichers found out about the certificate or its
+	// domains
+	Enrichments []Enrichment
+}
+
+// SCT is a signed certificate timestamp, a CT log's promise to log a
+// certificate.
+type SCT struct {
+	// LogID identifies the log, as base64 of the SHA-256 hash of its key
+	LogID string `json:"log_id"`
+
+	// Timestamp is when the log saw the certificate
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Enrichment is a fact about an alert's certificate or one of its domains,
+// like that "login.example.com" has the A record "192.0.2.1".
+type Enrichment struct {
+	// Source is the enricher that found it, like "dns"
+	Source string `json:"source"`
+
+	// Domain is the domain it's about, or empty if it's about the
+	// certificate
+	Domain string `json:"domain,omitempty"`
+
+	Name  string `json:"name"`  // like "A"
+	Value string `json:"value"` // like "192.0.2.1"
+
+	// Data is a file that goes with the fact, like a screenshot as PNG,
+	// for sinks that can share files
+	Data []byte `json:"-"`
+}
+
+// EnrichmentLines summarizes the enrichments, one line for the certificate
+// and one for each domain, in the order they were found, like
+// "login.example.com: A 192.0.2.1, 192.0.2.2; NS ns1.example.net".
+func (a *Alert) EnrichmentLines() []string {
+	order := []string{}
+	byDomain := map[string][]Enrichment{}
+	for _, e := range a.Enrichments {
+		if _, ok := byDomain[e.Domain]; !ok {
+			order = append(order, e.Domain)
+		}
+		byDomain[e.Domain] = append(byDomain[e.Domain], e)
+	}
+	lines := []string{}
+	for _, domain := range order {
+		names := []string{}
+		values := map[string][]string{}
+		for _, e := range byDomain[domain] {
+			if _, ok := values[e.Name]; !ok {
+				names = append(names, e.Name)
+			}
+			values[e.Name] = append(values[e.Name], e.Value)
+		}
+		facts := []string{}
+		for _, name := range names {
+			facts = append(facts, name+" "+strings.Join(values[name], ", "))
+		}
+		line := strings.Join(facts, "; ")
+		if domain != "" {
+			line = domain + ": " + line
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// DomainList describes the matching domains in English, with each domain
+// formatted by FormatDomain, like "`a.com`, `b.com`, and 3 others".
+func (a *Alert) DomainList() string {
+	return a.DomainListWith(a.FormatDomain)
+}
+
+// DomainListWith is DomainList with a custom format for each domain. At
+// most MaxDomains matches are listed, followed by a count of the rest.
+func (a *Alert) DomainListWith(format func(domain string) string) string {
+	shown := a.Domains
+	if a.MaxDomains > 0 && len(shown) > a.MaxDomains {
+		shown = shown[:a.MaxDomains]
+	}
+	matches := []string{}
+	for _, domain := range shown {
+		matches = append(matches, format(domain))
+	}
+	if hidden := len(a.Domains) - len(shown); hidden > 0 {
+		matches = append(matches, english.Plural(hidden, "more match", "more matches"))
+	}
+	if a.OtherDomains > 0 {
+		matches = append(matches, english.Plural(a.OtherDomains, "other", "others"))
+	}
+	return english.OxfordWordSeries(matches, "and")
+}
+
+// Truncated reports whether the certificate has more domains than messages
+// list, so that the full list is worth sharing separately.
+func (a *Alert) Truncated() bool {
+	return a.MaxDomains > 0 && len(a.AllDomains) > a.MaxDomains
+}
+
+// FormatDomain wraps a domain in backticks, followed by its original form if
+// it was normalized and why it matched if known, like
+// "`exämple.com` (`xn--exmple-cua.com`, homoglyph of example.com)".
+func (a *Alert) FormatDomain(domain string) string {
+	return a.AnnotateDomain(domain, "`"+domain+"`")
+}
+
+// AnnotateDomain follows the display form of a domain with its original form
+// and why it matched, if known.
+func (a *Alert) AnnotateDomain(domain, display string) string {
+	notes := []string{}
+	if original, ok := a.Original[domain]; ok {
+		notes = append(notes, "`"+original+"`")
+	}
+	if reason, ok := a.Reasons[domain]; ok {
+		notes = append(notes, reason)
+	}
+	if len(notes) == 0 {
+		return display
+	}
+	return fmt.Sprintf("%s (%s)", display, strings.Join(notes, ", "))
+}
+
+// IssuerName is a short name for the issuer, like "Let's Encrypt (R3)",
+// falling back to the distinguished name.
+func (a *Alert) IssuerName() string {
+	switch {
+	case a.IssuerOrg != "" && a.IssuerCN != "" && a.IssuerOrg != a.IssuerCN:
+		return fmt.Sprintf("%s (%s)", a.IssuerOrg, a.IssuerCN)
+	case a.IssuerOrg != "":
+		return a.IssuerOrg
+	case a.IssuerCN != "":
+		return a.IssuerCN
+	}
+	return valueOr(a.Issuer, "unknown")
+}
+
+// Details is a one line summary of the certificate's metadata.
+func (a *Alert) Details() string {
+	details := fmt.Sprintf("Issued by %s, valid %s to %s, serial %s, signed with %s",
+		a.IssuerName(), formatTime(a.NotBefore), formatTime(a.NotAfter),
+		valueOr(a.Serial, "unknown"), valueOr(a.SignatureAlgorithm, "unknown"))
+	if a.KeyAlgorithm != "" {
+		key := a.KeyAlgorithm
+		if a.KeySize > 0 {
+			key = fmt.Sprintf("%d-bit %s", a.KeySize, a.KeyAlgorithm)
+		}
+		details += ", " + key + " key"
+		if len(a.ExtKeyUsages) > 0 {
+			details += " for " + english.OxfordWordSeries(a.ExtKeyUsages, "and")
+		}
+		details += ", " + english.Plural(len(a.SCTs), "embedded SCT", "")
+	}
+	if a.RootCA != "" && a.RootCA != a.Issuer {
+		details += ", chaining to " + a.RootCA
+	}
+	if source := a.Source(); source != "" {
+		details += ", " + source
+	}
+	return details
+}
+
+// Source describes where the certificate was logged, like "entry 1234 in
+// Google 'Pilot' log".
+func (a *Alert) Source() string {
+	name := valueOr(a.SourceName, a.SourceURL)
+	switch {
+	case name == "":
+		return ""
+	case a.CertIndex < 0:
+		return "logged in " + name
+	}
+	return fmt.Sprintf("entry %d in %s", a.CertIndex, name)
+}
+
+// EntryURL links to the certificate's entry using the log's RFC 6962
+// get-entries API, if the log and index are known.
+func (a *Alert) EntryURL() string {
+	if a.SourceURL == "" || a.CertIndex < 0 {
+		return ""
+	}
+	base := a.SourceURL
+	if !strings.Contains(base, "://") {
+		base = "https://" + base
+	}
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	return fmt.Sprintf("%sct/v1/get-entries?start=%d&end=%d", base, a.CertIndex, a.CertIndex)
+}
+
+// MessageOr returns the alert's Message from a template, if any, or else
+// the sink's built-in message.
+func (a *Alert) MessageOr(builtin string) string {
+	if a.Message != "" {
+		return a.Message
+	}
+	return builtin
+}
+
+// Text is a one line plain text description of the alert.
+func (a *Alert) Text() string {
+	return fmt.Sprintf("Found matching certificate for %s: %s", a.DomainList(), a.CertURL)
+}
+
+// Summary is a plain text, one line description of the alert, for titles
+// and subjects where markup isn't rendered.
+func (a *Alert) Summary() string {
+	return fmt.Sprintf("Certificate matching %s for %s", a.Rule, a.DomainListWith(func(domain string) string {
+		return domain
+	}))
+}
+
+// Notifier sends alerts to a single destination.
+type Notifier interface {
+	Notify(a *Alert) error
+}
+
+// Flusher is implemented by Notifiers that hold alerts back, such as for a
+// digest, so that they can be sent before exiting.
+type Flusher interface {
+	Flush() error
+}
+
+// Closer is implemented by Notifiers that hold connections, files, or
+// background goroutines, so that they can be let go when a reload removes
+// their sink. It's called after Flush.
+type Closer interface {
+	Close() error
+}
+
+// Threader is implemented by Notifiers that can send alerts before they're
+// enriched, then follow up with what the enrichers found, like in a Slack
+// thread, if Threaded. NotifyEarly returns the thread to follow up in, or ""
+// if there's none, and FollowUp is called with it once the alert has been
+// enriched, noting whether that escalated its severity.
+type Threader interface {
+	Threaded() bool
+	NotifyEarly(a *Alert) (thread string, err error)
+	FollowUp(a *Alert, thread string, escalated bool) error
+}
+
+// formatTime formats a time for messages, in UTC.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+	return t.UTC().Format("2006-01-02 15:04 MST")
+}
+
+// valueOr returns s, or def if s is empty.
+func valueOr(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package notify
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDomainList(t *testing.T) {
+	tests := []struct {
+		alert Alert
+		want  string
+	}{
+		{Alert{Domains: []string{"a.com"}}, "`a.com`"},
+		{Alert{Domains: []string{"a.com", "b.com"}}, "`a.com` and `b.com`"},
+		{Alert{Domains: []string{"a.com", "b.com"}, OtherDomains: 1}, "`a.com`, `b.com`, and 1 other"},
+		{Alert{Domains: []string{"a.com", "b.com", "c.com"}, MaxDomains: 1, OtherDomains: 3}, "`a.com`, 2 more matches, and 3 others"},
+		{Alert{Domains: []string{"a.com", "b.com"}, MaxDomains: 2}, "`a.com` and `b.com`"},
+		{
+			Alert{
+				Domains:  []string{"exämple.com"},
+				Original: map[string]string{"exämple.com": "xn--exmple-cua.com"},
+				Reasons:  map[string]string{"exämple.com": "homoglyph of example.com"},
+			},
+			"`exämple.com` (`xn--exmple-cua.com`, homoglyph of example.com)",
+		},
+	}
+	for _, test := range tests {
+		if got := test.alert.DomainList(); got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+		}
+	}
+
+	a := &Alert{Rule: "login", Domains: []string{"a.com", "b.com"}, Reasons: map[string]string{"b.com": "score 80"}}
+	if got, want := a.Summary(), "Certificate matching login for a.com and b.com"; got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+	if got, want := a.AnnotateDomain("b.com", "<b.com>"), "<b.com> (score 80)"; got != want {
+		t.Errorf("AnnotateDomain() = %q, want %q", got, want)
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	a := &Alert{AllDomains: []string{"a.com", "b.com", "c.com"}}
+	if a.Truncated() {
+		t.Error("truncated without MaxDomains")
+	}
+	a.MaxDomains = 3
+	if a.Truncated() {
+		t.Error("truncated with every domain listed")
+	}
+	a.MaxDomains = 2
+	if !a.Truncated() {
+		t.Error("not truncated with a domain left out")
+	}
+}
+
+func TestIssuerName(t *testing.T) {
+	tests := []struct {
+		alert Alert
+		want  string
+	}{
+		{Alert{IssuerOrg: "Let's Encrypt", IssuerCN: "R3"}, "Let's Encrypt (R3)"},
+		{Alert{IssuerOrg: "Example CA", IssuerCN: "Example CA"}, "Example CA"},
+		{Alert{IssuerCN: "R3"}, "R3"},
+		{Alert{Issuer: "CN=R3"}, "CN=R3"},
+		{Alert{}, "unknown"},
+	}
+	for _, test := range tests {
+		if got := test.alert.IssuerName(); got != test.want {
+			t.Errorf("IssuerName() = %q, want %q", got, test.want)
+		}
+	}
+}
+
+func TestDetails(t *testing.T) {
+	a := &Alert{
+		IssuerOrg:          "Let's Encrypt",
+		IssuerCN:           "R3",
+		Issuer:             "CN=R3,O=Let's Encrypt,C=US",
+		Serial:             "0a1b",
+		SignatureAlgorithm: "sha256, rsa",
+		NotBefore:          time.Date(2024, 1, 2, 3, 4, 0, 0, time.UTC),
+		NotAfter:           time.Date(2024, 4, 1, 3, 4, 0, 0, time.FixedZone("EST", -5*60*60)),
+		KeyAlgorithm:       "ECDSA",
+		KeySize:            256,
+		ExtKeyUsages:       []string{"server auth", "client auth"},
+		SCTs:               []SCT{{LogID: "a"}, {LogID: "b"}},
+		RootCA:             "CN=ISRG Root X1",
+		SourceName:         "Google 'Argon2024'",
+		CertIndex:          1234,
+	}
+	want := "Issued by Let's Encrypt (R3), valid 2024-01-02 03:04 UTC to 2024-04-01 08:04 UTC, " +
+		"serial 0a1b, signed with sha256, rsa, 256-bit ECDSA key for server auth and client auth, " +
+		"2 embedded SCTs, chaining to CN=ISRG Root X1, entry 1234 in Google 'Argon2024'"
+	if got := a.Details(); got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+
+	a = &Alert{CertIndex: -1}
+	if got, want := a.Details(), "Issued by unknown, valid unknown to unknown, serial unknown, signed with unknown"; got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		alert  Alert
+		source string
+		url    string
+	}{
+		{Alert{SourceName: "Argon", SourceURL: "ct.googleapis.com/logs/argon2024/", CertIndex: 7},
+			"entry 7 in Argon", "https://ct.googleapis.com/logs/argon2024/ct/v1/get-entries?start=7&end=7"},
+		{Alert{SourceURL: "https://ct.example.com/log", CertIndex: 0},
+			"entry 0 in https://ct.example.com/log", "https://ct.example.com/log/ct/v1/get-entries?start=0&end=0"},
+		{Alert{SourceName: "Argon", SourceURL: "ct.googleapis.com/logs/argon2024/", CertIndex: -1},
+			"logged in Argon", ""},
+		{Alert{CertIndex: 7}, "", ""},
+	}
+	for _, test := range tests {
+		if got := test.alert.Source(); got != test.source {
+			t.Errorf("Source() = %q, want %q", got, test.source)
+		}
+		if got := test.alert.EntryURL(); got != test.url {
+			t.Errorf("EntryURL() = %q, want %q", got, test.url)
+		}
+	}
+}
+
+func TestEnrichmentLines(t *testing.T) {
+	a := &Alert{Enrichments: []Enrichment{
+		{Source: "dns", Domain: "login.example.com", Name: "A", Value: "192.0.2.1"},
+		{Source: "whois", Name: "registrar", Value: "Example Registrar"},
+		{Source: "dns", Domain: "login.example.com", Name: "NS", Value: "ns1.example.net"},
+		{Source: "dns", Domain: "login.example.com", Name: "A", Value: "192.0.2.2"},
+		{Source: "dns", Domain: "www.example.com", Name: "A", Value: "192.0.2.3"},
+	}}
+	want := []string{
+		"login.example.com: A 192.0.2.1, 192.0.2.2; NS ns1.example.net",
+		"registrar Example Registrar",
+		"www.example.com: A 192.0.2.3",
+	}
+	if got := a.EnrichmentLines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestMessageOr(t *testing.T) {
+	a := &Alert{}
+	if got := a.MessageOr("built in"); got != "built in" {
+		t.Errorf("got %q without a message", got)
+	}
+	a.Message = "from a template"
+	if got := a.MessageOr("built in"); got != "from a template" {
+		t.Errorf("got %q with a message", got)
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package notify
+
+import "github.com/pkg/errors"
+
+// Severity is how urgent a rule's matches are. It sets how alerts look and,
+// with a sink's min_severity, which sinks they're sent to.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityCritical
+)
+
+// DefaultSeverity is the severity of rules that don't set one.
+const DefaultSeverity = SeverityWarning
+
+var severityNames = map[Severity]string{
+	SeverityInfo:     "info",
+	SeverityWarning:  "warning",
+	SeverityCritical: "critical",
+}
+
+// ParseSeverity parses "info", "warning", or "critical".
+func ParseSeverity(s string) (Severity, error) {
+	for sev, name := range severityNames {
+		if s == name {
+			return sev, nil
+		}
+	}
+	return 0, errors.Errorf("must be \"info\", \"warning\", or \"critical\", not %q", s)
+}
+
+func (s Severity) String() string {
+	return severityNames[s]
+}
+
+// Color is the hex RGB color of alerts with this severity.
+func (s Severity) Color() int {
+	switch s {
+	case SeverityInfo:
+		return 0x36c5f0
+	case SeverityCritical:
+		return 0xe01e5a
+	}
+	return 0xecb22e
+}
+
+// Emoji is the Slack emoji code for alerts with this severity.
+func (s Severity) Emoji() string {
+	switch s {
+	case SeverityInfo:
+		return ":information_source:"
+	case SeverityCritical:
+		return ":rotating_light:"
+	}
+	return ":warning:"
+}
+
+// Symbol is the Unicode emoji for alerts with this severity, for services
+// that don't understand Slack's emoji codes.
+func (s Severity) Symbol() string {
+	switch s {
+	case SeverityInfo:
+		return "ℹ️"
+	case SeverityCritical:
+		return "\U0001f6a8"
+	}
+	return "⚠️"
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package notify
+
+import (
+	"testing"
+)
+
+func TestParseSeverity(t *testing.T) {
+	for _, sev := range []Severity{SeverityInfo, SeverityWarning, SeverityCritical} {
+		parsed, err := ParseSeverity(sev.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed != sev {
+			t.Errorf("ParseSeverity(%q) = %v", sev.String(), parsed)
+		}
+	}
+	if _, err := ParseSeverity("Critical"); err == nil {
+		t.Error("expected an error for \"Critical\"")
+	}
+	if DefaultSeverity.String() != "warning" {
+		t.Errorf("the default severity is %v", DefaultSeverity)
+	}
+}
+
+func TestSeverityOrder(t *testing.T) {
+	// sinks' min_severity compares severities
+	if !(SeverityInfo < SeverityWarning && SeverityWarning < SeverityCritical) {
+		t.Error("severities are out of order")
+	}
+
+	// each severity looks different
+	colors, emoji, symbols := map[int]bool{}, map[string]bool{}, map[string]bool{}
+	for _, sev := range []Severity{SeverityInfo, SeverityWarning, SeverityCritical} {
+		colors[sev.Color()] = true
+		emoji[sev.Emoji()] = true
+		symbols[sev.Symbol()] = true
+	}
+	if len(colors) != 3 || len(emoji) != 3 || len(symbols) != 3 {
+		t.Errorf("severities share colors %v, emoji %v, or symbols %v", colors, emoji, symbols)
+	}
+}
@@ -0,0 +1,294 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package stream is a client for certstream's websocket feed of certificates
+// being added to Certificate Transparency logs.
+package stream
+
+import (
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Client is a certstream websocket client that reconnects with jittered
+// exponential backoff whenever the connection fails.
+type Client struct {
+	URL    string
+	Header http.Header // sent with the websocket handshake
+
+	// Dialer connects to the server (websocket.DefaultDialer, using the
+	// proxy from the environment, if nil)
+	Dialer *websocket.Dialer
+
+	// MaxAttempts is the number of consecutive failed connection attempts,
+	// counting connections dropped before they delivered a message, before
+	// giving up (zero means retry forever)
+	MaxAttempts int
+
+	// MinBackoff and MaxBackoff bound the delay between connection
+	// attempts, which is random up to a limit that doubles with each one
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// PingInterval is how often to ping the server (zero disables pings),
+	// and ReadTimeout how long to wait for a message or a pong before
+	// giving up on the connection and reconnecting (zero waits forever).
+	// Without them, a connection dropped without a close, such as by a NAT
+	// timing out, looks just like a quiet stream.
+	PingInterval time.Duration
+	ReadTimeout  time.Duration
+
+	// Log is where the client logs connection problems (or the standard
+	// logrus logger, if nil)
+	Log logrus.FieldLogger
+
+	// OnReconnect is called, if set, whenever the connection is
+	// re-established after failing, and OnMalformed whenever a message
+	// can't be decoded and is skipped, such as to count them
+	OnReconnect func()
+	OnMalformed func()
+
+	mu          sync.Mutex
+	connected   bool
+	lastMessage time.Time
+	conn        *websocket.Conn
+	stopping    bool
+	stopped     chan struct{} // closed by stop
+}
+
+// Status reports whether the websocket is currently connected and when the
+// last message was received (the zero time if none has been).
+func (s *Client) Status() (connected bool, lastMessage time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connected, s.lastMessage
+}
+
+// Stop closes the websocket cleanly and makes Run return once the message
+// being handled (if any) is done.
+func (s *Client) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopping {
+		return
+	}
+	s.stopping = true
+	if s.stopped == nil {
+		s.stopped = make(chan struct{})
+	}
+	close(s.stopped)
+	if s.conn != nil {
+		// the server is expected to echo the close frame, at which point the
+		// blocked read returns and run closes the connection
+		msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+		if err := s.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second)); err != nil {
+			s.conn.Close()
+			return
+		}
+		// don't wait forever for a server that never answers
+		s.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	}
+}
+
+func (s *Client) isStopping() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopping
+}
+
+// Run connects to the stream and calls handle for every message received,
+// reconnecting as needed. It returns nil after Stop is called, or an error
+// if MaxAttempts is exceeded.
+func (s *Client) Run(handle func(msg *Message)) error {
+	s.mu.Lock()
+	if s.stopped == nil {
+		s.stopped = make(chan struct{})
+	}
+	s.mu.Unlock()
+
+	log := s.Log
+	if log == nil {
+		log = logrus.StandardLogger()
+	}
+	attempts := 0
+	reconnecting := false
+	for !s.isStopping() {
+		dialer := s.Dialer
+		if dialer == nil {
+			dialer = websocket.DefaultDialer
+		}
+		conn, _, err := dialer.Dial(s.URL, s.Header)
+		if err != nil {
+			attempts++
+			if s.MaxAttempts > 0 && attempts >= s.MaxAttempts {
+				return errors.Wrapf(err, "could not connect to certstream after %d attempts", attempts)
+			}
+			delay := s.backoff(attempts)
+			log.WithError(err).WithField("attempt", attempts).Warnf("could not connect to certstream, retrying in %s", delay)
+			s.wait(delay)
+			continue
+		}
+
+		s.mu.Lock()
+		if s.stopping {
+			s.mu.Unlock()
+			conn.Close()
+			break
+		}
+		s.conn = conn
+		s.connected = true
+		s.mu.Unlock()
+
+		if reconnecting {
+			log.WithField("attempts", attempts+1).Info("reconnected to certstream")
+			if s.OnReconnect != nil {
+				s.OnReconnect()
+			}
+		}
+		reconnecting = true
+
+		connected := time.Now()
+		delivered, err := s.read(conn, log, handle)
+		s.mu.Lock()
+		s.conn = nil
+		s.connected = false
+		s.mu.Unlock()
+		conn.Close()
+		if s.isStopping() {
+			break
+		}
+		if delivered || time.Since(connected) >= stableConnection {
+			log.WithError(err).Warn("lost connection to certstream")
+			attempts = 0
+			continue
+		}
+
+		// a server that accepts connections only to drop them would
+		// otherwise be redialed as fast as it can answer
+		attempts++
+		if s.MaxAttempts > 0 && attempts >= s.MaxAttempts {
+			return errors.Wrapf(err, "certstream kept dropping the connection after %d attempts", attempts)
+		}
+		delay := s.backoff(attempts)
+		log.WithError(err).WithField("attempt", attempts).Warnf("lost connection to certstream right away, retrying in %s", delay)
+		s.wait(delay)
+	}
+	log.Info("disconnected from certstream")
+	return nil
+}
+
+// stableConnection is how long a connection must stay up, if it doesn't
+// deliver a message first, for the backoff to start over when it fails.
+const stableConnection = 30 * time.Second
+
+// wait waits for delay, or until the client is stopped.
+func (s *Client) wait(delay time.Duration) {
+	select {
+	case <-time.After(delay):
+	case <-s.stopped:
+	}
+}
+
+// read calls handle for each message on conn until the connection fails,
+// reporting whether any message was delivered. Messages that can't be
+// decoded are logged and skipped.
+func (s *Client) read(conn *websocket.Conn, log logrus.FieldLogger, handle func(msg *Message)) (bool, error) {
+	s.extendDeadline(conn)
+	conn.SetPongHandler(func(string) error {
+		s.extendDeadline(conn)
+		return nil
+	})
+	if s.PingInterval > 0 {
+		done := make(chan struct{})
+		defer close(done)
+		go s.ping(conn, done)
+	}
+	delivered := false
+	for {
+		_, frame, err := conn.ReadMessage()
+		if err != nil {
+			if err, ok := err.(net.Error); ok && err.Timeout() && !s.isStopping() {
+				return delivered, errors.Errorf("no messages or pongs for %s", s.ReadTimeout)
+			}
+			return delivered, err
+		}
+		s.extendDeadline(conn)
+		msg, err := Decode(frame)
+		if err != nil {
+			log.WithError(err).Warn("skipping malformed message from certstream")
+			log.WithField("frame", string(frame)).Debug("malformed message")
+			if s.OnMalformed != nil {
+				s.OnMalformed()
+			}
+			continue
+		}
+		s.mu.Lock()
+		s.lastMessage = msg.Received
+		s.mu.Unlock()
+		delivered = true
+		handle(msg)
+	}
+}
+
+// extendDeadline gives the server another ReadTimeout to send something,
+// unless Stop has set a deadline for it to answer the close.
+func (s *Client) extendDeadline(conn *websocket.Conn) {
+	if s.ReadTimeout > 0 && !s.isStopping() {
+		conn.SetReadDeadline(time.Now().Add(s.ReadTimeout))
+	}
+}
+
+// ping pings the server every PingInterval until done is closed. If a ping
+// can't be sent, the read deadline notices the connection has failed.
+func (s *Client) ping(conn *websocket.Conn, done chan struct{}) {
+	ticker := time.NewTicker(s.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(s.PingInterval)); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// backoff returns the delay before the given connection attempt: a random
+// delay from MinBackoff up to a ceiling that starts at MinBackoff and
+// doubles with each attempt until it reaches MaxBackoff, so that many
+// clients don't reconnect in lockstep after an outage.
+func (s *Client) backoff(attempt int) time.Duration {
+	ceiling := s.MinBackoff
+	for i := 1; i < attempt && ceiling < s.MaxBackoff; i++ {
+		ceiling *= 2
+	}
+	if ceiling > s.MaxBackoff {
+		ceiling = s.MaxBackoff
+	}
+	if ceiling <= s.MinBackoff {
+		return s.MinBackoff
+	}
+	return s.MinBackoff + time.Duration(rand.Int63n(int64(ceiling-s.MinBackoff)+1))
+}
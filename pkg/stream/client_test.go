@@ -0,0 +1,211 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package stream
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+// testServer serves websocket connections, calling serve with each one and
+// how many came before it, and closing it after.
+func testServer(t *testing.T, serve func(n int, conn *websocket.Conn)) *httptest.Server {
+	var mu sync.Mutex
+	n := 0
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		mu.Lock()
+		i := n
+		n++
+		mu.Unlock()
+		serve(i, conn)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func testClient(server *httptest.Server) *Client {
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	return &Client{
+		URL:        "ws" + strings.TrimPrefix(server.URL, "http"),
+		MinBackoff: time.Millisecond,
+		MaxBackoff: time.Millisecond,
+		Log:        log,
+	}
+}
+
+// update is a certificate update message for domain.
+func update(domain string) []byte {
+	return []byte(`{"message_type": "certificate_update", "data": {"leaf_cert": {"all_domains": ["` + domain + `"]}}}`)
+}
+
+// run runs c until it returns or the test times out.
+func run(t *testing.T, c *Client, handle func(msg *Message)) error {
+	done := make(chan error, 1)
+	go func() { done <- c.Run(handle) }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(10 * time.Second):
+		c.Stop()
+		t.Fatal("Run didn't return")
+		return nil
+	}
+}
+
+func TestRunReconnects(t *testing.T) {
+	server := testServer(t, func(n int, conn *websocket.Conn) {
+		switch n {
+		case 0:
+			conn.WriteMessage(websocket.TextMessage, update("one.example.com"))
+		case 1:
+			conn.WriteMessage(websocket.TextMessage, []byte("not JSON"))
+			conn.WriteMessage(websocket.TextMessage, update("two.example.com"))
+			// wait for the client to close the connection
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}
+	})
+	c := testClient(server)
+	reconnects, malformed := 0, 0
+	c.OnReconnect = func() { reconnects++ }
+	c.OnMalformed = func() { malformed++ }
+	var domains []string
+	err := run(t, c, func(msg *Message) {
+		domains = append(domains, msg.Data.LeafCert.AllDomains...)
+		if len(domains) == 2 {
+			c.Stop()
+		}
+	})
+	if err != nil {
+		t.Errorf("Run returned %v", err)
+	}
+	if strings.Join(domains, " ") != "one.example.com two.example.com" {
+		t.Errorf("handled %v, want one.example.com and two.example.com", domains)
+	}
+	if reconnects != 1 || malformed != 1 {
+		t.Errorf("%d reconnects and %d malformed messages, want 1 of each", reconnects, malformed)
+	}
+	if connected, last := c.Status(); connected || last.IsZero() {
+		t.Errorf("Status() = %v, %s after stopping, want false and the last message's time", connected, last)
+	}
+}
+
+func TestRunGivesUp(t *testing.T) {
+	// a server dropping every connection, or not sending anything
+	dropping := testServer(t, func(n int, conn *websocket.Conn) {})
+	quiet := testServer(t, func(n int, conn *websocket.Conn) {
+		time.Sleep(time.Second)
+	})
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	tests := []struct {
+		name   string
+		server *httptest.Server
+		setup  func(c *Client)
+		err    string
+	}{
+		{"dropped", dropping, nil, "certstream kept dropping the connection after 3 attempts"},
+		{"read timeout", quiet, func(c *Client) { c.ReadTimeout = 50 * time.Millisecond }, "certstream kept dropping the connection after 3 attempts: no messages or pongs for 50ms"},
+		{"unreachable", unreachable, nil, "could not connect to certstream after 3 attempts"},
+	}
+	for _, test := range tests {
+		c := testClient(test.server)
+		c.MaxAttempts = 3
+		if test.setup != nil {
+			test.setup(c)
+		}
+		err := run(t, c, func(*Message) { t.Errorf("%s: handled a message", test.name) })
+		if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+			t.Errorf("%s: Run returned %v, want an error starting %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestRunPingsKeepConnectionAlive(t *testing.T) {
+	server := testServer(t, func(n int, conn *websocket.Conn) {
+		if n > 0 {
+			return
+		}
+		// reading answers the client's pings
+		go func() {
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+		time.Sleep(300 * time.Millisecond)
+		conn.WriteMessage(websocket.TextMessage, update("late.example.com"))
+		time.Sleep(time.Second)
+	})
+	c := testClient(server)
+	c.PingInterval = 20 * time.Millisecond
+	c.ReadTimeout = 100 * time.Millisecond
+	reconnects := 0
+	c.OnReconnect = func() { reconnects++ }
+	err := run(t, c, func(msg *Message) { c.Stop() })
+	if err != nil {
+		t.Errorf("Run returned %v", err)
+	}
+	if reconnects != 0 {
+		t.Errorf("reconnected %d times, want none", reconnects)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		min, max time.Duration
+		attempt  int
+		from, to time.Duration
+	}{
+		{time.Second, 2 * time.Minute, 1, time.Second, time.Second},
+		{time.Second, 2 * time.Minute, 2, time.Second, 2 * time.Second},
+		{time.Second, 2 * time.Minute, 3, time.Second, 4 * time.Second},
+		{time.Second, 2 * time.Minute, 7, time.Second, 64 * time.Second},
+		{time.Second, 2 * time.Minute, 8, time.Second, 2 * time.Minute},
+		{time.Second, 2 * time.Minute, 1000, time.Second, 2 * time.Minute},
+		{0, 0, 5, 0, 0},
+		{5 * time.Second, time.Second, 3, 5 * time.Second, 5 * time.Second},
+	}
+	for _, test := range tests {
+		c := &Client{MinBackoff: test.min, MaxBackoff: test.max}
+		for i := 0; i < 100; i++ {
+			if d := c.backoff(test.attempt); d < test.from || d > test.to {
+				t.Errorf("backoff %s to %s, attempt %d: %s, want %s to %s", test.min, test.max, test.attempt, d, test.from, test.to)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package stream
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Message is a message from certstream. Only certificate updates, and the
+// domains-only stream's "dns_entries" messages, are decoded; other messages,
+// like heartbeats, just have their type.
+type Message struct {
+	MessageType string `json:"message_type"`
+
+	// Data is the certificate update, for "certificate_update" and
+	// "dns_entries" messages
+	Data *CertificateUpdate `json:"data,omitempty"`
+
+	// Received is when the message was received
+	Received time.Time `json:"-"`
+
+	// raw is the message as it was received, if it was
+	raw []byte
+}
+
+// CertificateUpdate is a certificate that was added to a CT log.
+type CertificateUpdate struct {
+	UpdateType string        `json:"update_type"` // "X509LogEntry" or "PrecertLogEntry"
+	LeafCert   Certificate   `json:"leaf_cert"`
+	Chain      []Certificate `json:"chain,omitempty"`
+	CertIndex  int64         `json:"cert_index"` // -1 if unknown
+	CertLink   string        `json:"cert_link,omitempty"`
+	Seen       float64       `json:"seen"` // Unix time
+	Source     Source        `json:"source"`
+
+	// DomainsOnly is whether the update came from the domains-only stream,
+	// so all it has are the leaf certificate's domains
+	DomainsOnly bool `json:"-"`
+
+	// raw is the update as it was received, if it was, which is passed on
+	// as it is, with any fields not decoded above
+	raw json.RawMessage
+
+	fieldsOnce sync.Once
+	fields     map[string]interface{}
+}
+
+// Certificate describes a certificate the way certstream does.
+type Certificate struct {
+	Subject            Name       `json:"subject"`
+	Issuer             Name       `json:"issuer"`
+	Extensions         Extensions `json:"extensions,omitempty"`
+	NotBefore          float64    `json:"not_before"` // Unix time
+	NotAfter           float64    `json:"not_after"`  // Unix time
+	SerialNumber       string     `json:"serial_number"`
+	Fingerprint        string     `json:"fingerprint"` // SHA-1, like "AA:BB:..."
+	SHA256             string     `json:"sha256,omitempty"`
+	SignatureAlgorithm string     `json:"signature_algorithm"`
+	AllDomains         []string   `json:"all_domains"`
+
+	// AsDER is the certificate, base64 encoded, in the full stream
+	AsDER string `json:"as_der,omitempty"`
+}
+
+// Name is a distinguished name, with an "aggregated" form like
+// "/C=US/O=Let's Encrypt/CN=R3".
+type Name struct {
+	Aggregated   string `json:"aggregated"`
+	C            string `json:"C,omitempty"`
+	ST           string `json:"ST,omitempty"`
+	L            string `json:"L,omitempty"`
+	O            string `json:"O,omitempty"`
+	OU           string `json:"OU,omitempty"`
+	CN           string `json:"CN,omitempty"`
+	EmailAddress string `json:"emailAddress,omitempty"`
+}
+
+// Extensions are a certificate's extensions by name, like
+// "subjectAltName", described as text.
+type Extensions map[string]string
+
+// UnmarshalJSON implements json.Unmarshaler, keeping any values that aren't
+// strings as their JSON rather than failing to decode the certificate.
+func (e *Extensions) UnmarshalJSON(data []byte) error {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	*e = Extensions{}
+	for name, value := range values {
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil {
+			s = string(value)
+		}
+		(*e)[name] = s
+	}
+	return nil
+}
+
+// Source is the CT log a certificate was added to.
+type Source struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// Decode decodes a message from certstream, which keeps frame to encode
+// the message as it was received.
+func Decode(frame []byte) (*Message, error) {
+	var envelope struct {
+		MessageType string          `json:"message_type"`
+		Data        json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(frame, &envelope); err != nil {
+		return nil, err
+	}
+	m := &Message{MessageType: envelope.MessageType, Received: time.Now(), raw: frame}
+	if envelope.Data == nil {
+		return m, nil
+	}
+	switch m.MessageType {
+	case "certificate_update":
+		u := &CertificateUpdate{CertIndex: -1}
+		if err := json.Unmarshal(envelope.Data, u); err != nil {
+			return nil, err
+		}
+		u.raw = envelope.Data
+		m.Data = u
+	case "dns_entries":
+		// The domains-only stream sends just the domains, which we
+		// describe as an update with nothing else known. It isn't kept
+		// raw, so it encodes with the same shape as any other update.
+		u := &CertificateUpdate{CertIndex: -1, DomainsOnly: true}
+		if err := json.Unmarshal(envelope.Data, &u.LeafCert.AllDomains); err != nil {
+			return nil, err
+		}
+		m.Data = u
+	}
+	return m, nil
+}
+
+// MarshalJSON implements json.Marshaler, encoding the message as it was
+// received, if it was.
+func (m *Message) MarshalJSON() ([]byte, error) {
+	if m.raw != nil {
+		return m.raw, nil
+	}
+	type plain Message
+	return json.Marshal((*plain)(m))
+}
+
+// MarshalJSON implements json.Marshaler, encoding the update as it was
+// received, if it was.
+func (u *CertificateUpdate) MarshalJSON() ([]byte, error) {
+	if u.raw != nil {
+		return u.raw, nil
+	}
+	type plain CertificateUpdate
+	return json.Marshal((*plain)(u))
+}
+
+// Fields returns the update as generic JSON values, for rules that look
+// at arbitrary fields. It's decoded the first time it's needed.
+func (u *CertificateUpdate) Fields() map[string]interface{} {
+	u.fieldsOnce.Do(func() {
+		data, err := u.MarshalJSON()
+		if err == nil {
+			err = json.Unmarshal(data, &u.fields)
+		}
+		if err != nil || u.fields == nil {
+			u.fields = map[string]interface{}{}
+		}
+	})
+	return u.fields
+}
+
+// Time converts a Unix time from certstream, returning the zero time for
+// zero.
+func Time(unix float64) time.Time {
+	if unix == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(unix*1e9)).UTC()
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// pluginProcess runs a plugin: a command that reads one JSON request per line
+// on standard input and writes one JSON response per line on standard
+// output, so that custom matchers and sinks can be written in any language.
+// A response with an "error" string fails the request. The command is started
+// when it's first needed, with its standard error passed through to ours, and
+// restarted if it exits or doesn't respond in time.
+type pluginProcess struct {
+	command []string
+	timeout time.Duration
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+func newPluginProcess(command []string, timeout time.Duration) *pluginProcess {
+	return &pluginProcess{command: command, timeout: timeout}
+}
+
+// call sends request to the plugin and decodes its response into response.
+func (p *pluginProcess) call(request, response interface{}) error {
+	line, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cmd == nil {
+		if err := p.start(); err != nil {
+			return errors.Wrapf(err, "could not start plugin %s", p.command[0])
+		}
+	}
+	if _, err := p.stdin.Write(append(line, '\n')); err != nil {
+		p.stop()
+		return errors.Wrapf(err, "could not write to plugin %s", p.command[0])
+	}
+
+	// if the plugin hangs, stopping it ends the read
+	type result struct {
+		line []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func(stdout *bufio.Reader) {
+		line, err := stdout.ReadBytes('\n')
+		done <- result{line, err}
+	}(p.stdout)
+	var r result
+	select {
+	case r = <-done:
+	case <-time.After(p.timeout):
+		p.stop()
+		return errors.Errorf("plugin %s didn't respond within %s", p.command[0], p.timeout)
+	}
+	if r.err != nil {
+		p.stop()
+		return errors.Wrapf(r.err, "could not read from plugin %s", p.command[0])
+	}
+
+	var failure struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(r.line, &failure); err != nil {
+		return errors.Wrapf(err, "invalid response from plugin %s", p.command[0])
+	}
+	if failure.Error != "" {
+		return errors.Errorf("plugin %s: %s", p.command[0], failure.Error)
+	}
+	return errors.Wrapf(json.Unmarshal(r.line, response), "invalid response from plugin %s", p.command[0])
+}
+
+func (p *pluginProcess) start() error {
+	cmd := exec.Command(p.command[0], p.command[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	log.WithField("plugin", strings.Join(p.command, " ")).WithField("pid", cmd.Process.Pid).Debug("started plugin")
+	p.cmd, p.stdin, p.stdout = cmd, stdin, bufio.NewReader(stdout)
+	return nil
+}
+
+// stop closes the plugin's standard input, which should make it exit, and
+// kills it if it hasn't within a few seconds.
+func (p *pluginProcess) stop() {
+	if p.cmd == nil {
+		return
+	}
+	cmd := p.cmd
+	p.stdin.Close()
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.After(3 * time.Second):
+		cmd.Process.Kill()
+		<-exited
+	}
+	p.cmd, p.stdin, p.stdout = nil, nil, nil
+}
+
+// close stops the plugin, if it's running.
+func (p *pluginProcess) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stop()
+	return nil
+}
+
+// checkPluginCommand returns an error unless command names an executable.
+func checkPluginCommand(command []string) error {
+	if len(command) == 0 {
+		return errors.New("must be set")
+	}
+	_, err := exec.LookPath(command[0])
+	return err
+}
@@ -0,0 +1,309 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+)
+
+// proxySettings is the proxy setting, used for outbound HTTP and websocket
+// connections except to the hosts in no_proxy. Without it, HTTPS_PROXY,
+// HTTP_PROXY, and NO_PROXY choose the proxy, as for any Go program.
+var proxySettings struct {
+	mu      sync.RWMutex
+	url     *url.URL
+	noProxy []string
+}
+
+func init() {
+	// every HTTP client uses the default transport or a clone of it, which
+	// shares this function, so the proxy can be set once the config loads
+	http.DefaultTransport.(*http.Transport).Proxy = proxyForRequest
+}
+
+// setProxy sets the proxy, or with nil, goes back to the environment's.
+func setProxy(u *url.URL, noProxy []string) {
+	proxySettings.mu.Lock()
+	defer proxySettings.mu.Unlock()
+	proxySettings.url = u
+	proxySettings.noProxy = noProxy
+}
+
+func proxyForRequest(req *http.Request) (*url.URL, error) {
+	return proxyFor(req.URL)
+}
+
+// proxyFor returns the proxy to connect to u through, or nil to connect
+// directly.
+func proxyFor(u *url.URL) (*url.URL, error) {
+	proxySettings.mu.RLock()
+	proxy, noProxy := proxySettings.url, proxySettings.noProxy
+	proxySettings.mu.RUnlock()
+	if proxy == nil {
+		// the environment's proxies are chosen by the scheme
+		target := *u
+		switch target.Scheme {
+		case "ws":
+			target.Scheme = "http"
+		case "wss":
+			target.Scheme = "https"
+		}
+		return http.ProxyFromEnvironment(&http.Request{URL: &target})
+	}
+	if bypassProxy(u.Hostname(), noProxy) {
+		return nil, nil
+	}
+	return proxy, nil
+}
+
+// bypassProxy reports whether host is exempt from the proxy: localhost and
+// loopback addresses, which the proxy can't reach, and hosts matching
+// noProxy, which lists domains (matching their subdomains too), IP
+// addresses, CIDR ranges, or "*" for everything.
+func bypassProxy(host string, noProxy []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	ip := net.ParseIP(host)
+	if host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return true
+	}
+	for _, entry := range noProxy {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "*" {
+			return true
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		entry = strings.TrimPrefix(entry, ".")
+		if entry != "" && (host == entry || strings.HasSuffix(host, "."+entry)) {
+			return true
+		}
+	}
+	return false
+}
+
+// directTransport returns a transport that never uses a proxy, for the
+// link-local services that only answer the machine itself, like a cloud
+// provider's metadata service.
+func directTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	return transport
+}
+
+// proxyDialTimeout bounds connecting to a websocket server or its proxy.
+const proxyDialTimeout = 30 * time.Second
+
+// newWebsocketDialer returns a websocket dialer connecting to the server at
+// rawURL through its proxy, if it has one, with tlsConfig for wss:// URLs.
+// The websocket library only knows HTTP proxies, so this speaks to HTTPS
+// and SOCKS5 proxies too.
+func newWebsocketDialer(rawURL string, tlsConfig *tls.Config) *websocket.Dialer {
+	d := *websocket.DefaultDialer
+	d.Proxy = nil
+	d.TLSClientConfig = tlsConfig
+	d.NetDial = func(network, addr string) (net.Conn, error) {
+		target, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		target.Host = addr
+		proxy, err := proxyFor(target)
+		if err != nil {
+			return nil, err
+		}
+		if proxy == nil {
+			return net.DialTimeout(network, addr, proxyDialTimeout)
+		}
+		conn, err := dialProxy(proxy, addr)
+		return conn, errors.Wrapf(err, "proxy %s", proxy.Host)
+	}
+	return &d
+}
+
+// dialProxy connects to addr through an HTTP, HTTPS, or SOCKS5 proxy.
+func dialProxy(proxy *url.URL, addr string) (net.Conn, error) {
+	ports := map[string]string{"http": "80", "https": "443", "socks5": "1080", "socks5h": "1080"}
+	port, ok := ports[proxy.Scheme]
+	if !ok {
+		return nil, errors.Errorf("unsupported proxy scheme %q", proxy.Scheme)
+	}
+	proxyAddr := proxy.Host
+	if proxy.Port() == "" {
+		proxyAddr = net.JoinHostPort(proxy.Hostname(), port)
+	}
+
+	dialer := &net.Dialer{Timeout: proxyDialTimeout}
+	var conn net.Conn
+	var err error
+	if proxy.Scheme == "https" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", proxyAddr, &tls.Config{ServerName: proxy.Hostname()})
+	} else {
+		conn, err = dialer.Dial("tcp", proxyAddr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(proxyDialTimeout))
+	if proxy.Scheme == "socks5" || proxy.Scheme == "socks5h" {
+		err = socks5Connect(conn, proxy.User, addr)
+	} else {
+		err = httpConnect(conn, proxy.User, addr)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// httpConnect asks an HTTP proxy to open a tunnel to addr.
+func httpConnect(conn net.Conn, user *url.Userinfo, addr string) error {
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if user != nil {
+		password, _ := user.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user.Username()+":"+password)))
+	}
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+	// the server doesn't speak until the TLS or websocket handshake, so
+	// nothing buffered past the response is lost
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("CONNECT returned %s", resp.Status)
+	}
+	return nil
+}
+
+// socks5Replies describe the SOCKS5 reply codes (RFC 1928) for errors.
+var socks5Replies = map[byte]string{
+	1: "general failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// socks5Connect asks a SOCKS5 proxy to connect to addr, authenticating
+// with a user name and password (RFC 1929) if user is set. The proxy
+// resolves the host name.
+func socks5Connect(conn net.Conn, user *url.Userinfo, addr string) error {
+	host, portText, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil || len(host) > 255 {
+		return errors.Errorf("invalid address %q", addr)
+	}
+
+	methods := []byte{0} // no authentication
+	if user != nil {
+		methods = []byte{2} // user name and password
+	}
+	if _, err := conn.Write(append([]byte{5, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 5 || reply[1] != methods[0] {
+		return errors.New("SOCKS5 proxy refused the authentication method")
+	}
+	if user != nil {
+		password, _ := user.Password()
+		if len(user.Username()) > 255 || len(password) > 255 {
+			return errors.New("SOCKS5 user name and password must be at most 255 bytes")
+		}
+		auth := append([]byte{1, byte(len(user.Username()))}, user.Username()...)
+		auth = append(append(auth, byte(len(password))), password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0 {
+			return errors.New("SOCKS5 proxy rejected the user name and password")
+		}
+	}
+
+	req := append([]byte{5, 1, 0, 3, byte(len(host))}, host...)
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[1] != 0 {
+		reason, ok := socks5Replies[header[1]]
+		if !ok {
+			reason = "error " + strconv.Itoa(int(header[1]))
+		}
+		return errors.Errorf("SOCKS5 proxy couldn't connect to %s: %s", addr, reason)
+	}
+	// skip the address the proxy bound, and its port
+	var skip int
+	switch header[3] {
+	case 1:
+		skip = net.IPv4len
+	case 4:
+		skip = net.IPv6len
+	case 3:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return err
+		}
+		skip = int(length[0])
+	default:
+		return errors.Errorf("SOCKS5 proxy replied with address type %d", header[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip+2))
+	return err
+}
@@ -0,0 +1,276 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestBypassProxy(t *testing.T) {
+	noProxy := []string{"internal", ".corp.example.com", "192.0.2.0/24", "198.51.100.7", " Example.NET "}
+	tests := map[string]bool{
+		"localhost":              true,
+		"127.0.0.1":              true,
+		"::1":                    true,
+		"internal":               true,
+		"api.internal":           true,
+		"corp.example.com":       true,
+		"www.corp.example.com.":  true,
+		"192.0.2.10":             true,
+		"198.51.100.7":           true,
+		"www.example.net":        true,
+		"example.com":            false,
+		"notinternal":            false,
+		"198.51.100.8":           false,
+		"certstream.calidog.io":  false,
+		"192.0.2.10.example.org": false,
+	}
+	for host, want := range tests {
+		if got := bypassProxy(host, noProxy); got != want {
+			t.Errorf("bypassProxy(%q) = %v, want %v", host, got, want)
+		}
+	}
+	if !bypassProxy("example.com", []string{"*"}) {
+		t.Error("\"*\" doesn't bypass the proxy for everything")
+	}
+}
+
+func TestProxyFor(t *testing.T) {
+	proxy, _ := url.Parse("http://proxy.example.com:3128")
+	setProxy(proxy, []string{"internal"})
+	t.Cleanup(func() { setProxy(nil, nil) })
+
+	tests := map[string]*url.URL{
+		"wss://certstream.calidog.io/": proxy,
+		"https://hooks.slack.com/x":    proxy,
+		"http://api.internal/":         nil,
+		"http://localhost:8080/":       nil,
+	}
+	for rawURL, want := range tests {
+		u, _ := url.Parse(rawURL)
+		got, err := proxyFor(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("proxyFor(%q) = %v, want %v", rawURL, got, want)
+		}
+	}
+
+	// HTTP clients pick it up, except for the metadata service
+	req := httptest.NewRequest("GET", "https://hooks.slack.com/x", nil)
+	if got, _ := http.DefaultTransport.(*http.Transport).Proxy(req); got != proxy {
+		t.Errorf("the default transport's proxy is %v", got)
+	}
+	if directTransport().Proxy != nil {
+		t.Error("the direct transport has a proxy")
+	}
+}
+
+// testWebsocketServer echoes websocket messages.
+func testWebsocketServer(t *testing.T) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			typ, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(typ, message)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// testProxy accepts connections, calling handshake on each to read the
+// proxy request and reply to it, then connects them to target, whatever
+// host they asked for. The names of the hosts asked for are sent to
+// requested.
+func testProxy(t *testing.T, target string, handshake func(conn net.Conn, r *bufio.Reader) (host string, ok bool)) (addr string, requested chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	requested = make(chan string, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				host, ok := handshake(conn, r)
+				requested <- host
+				if !ok {
+					return
+				}
+				upstream, err := net.Dial("tcp", target)
+				if err != nil {
+					return
+				}
+				defer upstream.Close()
+				go io.Copy(upstream, r)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+	return l.Addr().String(), requested
+}
+
+// httpProxyHandshake answers a CONNECT request, requiring the credentials
+// "user:secret".
+func httpProxyHandshake(conn net.Conn, r *bufio.Reader) (string, bool) {
+	req, err := http.ReadRequest(r)
+	if err != nil {
+		return "", false
+	}
+	want := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:secret"))
+	if req.Method != "CONNECT" || req.Header.Get("Proxy-Authorization") != want {
+		io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\nContent-Length: 0\r\n\r\n")
+		return req.Host, false
+	}
+	io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+	return req.Host, true
+}
+
+// socks5ProxyHandshake answers a SOCKS5 connect request by host name,
+// requiring the user name "user" and password "secret".
+func socks5ProxyHandshake(conn net.Conn, r *bufio.Reader) (string, bool) {
+	greeting := make([]byte, 2)
+	if _, err := io.ReadFull(r, greeting); err != nil {
+		return "", false
+	}
+	methods := make([]byte, greeting[1])
+	if _, err := io.ReadFull(r, methods); err != nil || !strings.Contains(string(methods), "\x02") {
+		conn.Write([]byte{5, 0xff})
+		return "", false
+	}
+	conn.Write([]byte{5, 2})
+
+	version, _ := r.ReadByte()
+	userLen, _ := r.ReadByte()
+	user := make([]byte, userLen)
+	io.ReadFull(r, user)
+	passwordLen, _ := r.ReadByte()
+	password := make([]byte, passwordLen)
+	io.ReadFull(r, password)
+	if version != 1 || string(user) != "user" || string(password) != "secret" {
+		conn.Write([]byte{1, 1})
+		return "", false
+	}
+	conn.Write([]byte{1, 0})
+
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil || header[3] != 3 {
+		return "", false
+	}
+	host := make([]byte, int(header[4])+2)
+	if _, err := io.ReadFull(r, host); err != nil {
+		return "", false
+	}
+	port := int(host[len(host)-2])<<8 | int(host[len(host)-1])
+	addr := net.JoinHostPort(string(host[:len(host)-2]), strconv.Itoa(port))
+	if strings.HasPrefix(addr, "refused.") {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return addr, false
+	}
+	conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0})
+	return addr, true
+}
+
+func TestWebsocketDialerProxy(t *testing.T) {
+	server := testWebsocketServer(t)
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	tests := []struct {
+		scheme    string
+		handshake func(conn net.Conn, r *bufio.Reader) (string, bool)
+	}{
+		{"http", httpProxyHandshake},
+		{"socks5", socks5ProxyHandshake},
+	}
+	for _, test := range tests {
+		addr, requested := testProxy(t, server.Listener.Addr().String(), test.handshake)
+		proxy := &url.URL{Scheme: test.scheme, Host: addr, User: url.UserPassword("user", "secret")}
+		setProxy(proxy, nil)
+		t.Cleanup(func() { setProxy(nil, nil) })
+
+		// the proxy resolves the host name
+		rawURL := "ws://certstream.test:" + port + "/"
+		conn, _, err := newWebsocketDialer(rawURL, nil).Dial(rawURL, nil)
+		if err != nil {
+			t.Fatalf("%s proxy: %v", test.scheme, err)
+		}
+		if err := conn.WriteMessage(websocket.TextMessage, []byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		if _, message, err := conn.ReadMessage(); err != nil || string(message) != "hello" {
+			t.Errorf("%s proxy: read %q, %v", test.scheme, message, err)
+		}
+		conn.Close()
+		if host := <-requested; host != "certstream.test:"+port {
+			t.Errorf("%s proxy: asked to connect to %q", test.scheme, host)
+		}
+
+		// the proxy turns away the wrong credentials
+		proxy.User = url.UserPassword("user", "wrong")
+		if _, _, err := newWebsocketDialer(rawURL, nil).Dial(rawURL, nil); err == nil || !strings.Contains(err.Error(), "proxy "+addr) {
+			t.Errorf("%s proxy: expected an error for the wrong credentials, got %v", test.scheme, err)
+		}
+		<-requested
+		proxy.User = url.UserPassword("user", "secret")
+	}
+}
+
+func TestDialProxyErrors(t *testing.T) {
+	server := testWebsocketServer(t)
+	addr, _ := testProxy(t, server.Listener.Addr().String(), socks5ProxyHandshake)
+	proxy := &url.URL{Scheme: "socks5", Host: addr, User: url.UserPassword("user", "secret")}
+	_, err := dialProxy(proxy, "refused.test:443")
+	if err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("expected the SOCKS5 reply in the error, got %v", err)
+	}
+
+	addr, _ = testProxy(t, server.Listener.Addr().String(), httpProxyHandshake)
+	_, err = dialProxy(&url.URL{Scheme: "http", Host: addr}, "certstream.test:443")
+	if err == nil || !strings.Contains(err.Error(), "407") {
+		t.Errorf("expected the CONNECT status in the error, got %v", err)
+	}
+
+	if _, err := dialProxy(&url.URL{Scheme: "ftp", Host: addr}, "certstream.test:443"); err == nil {
+		t.Error("expected an error for an unsupported scheme")
+	}
+}
@@ -0,0 +1,301 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize/english"
+	"github.com/pkg/errors"
+)
+
+// quietHours keep a rule's less severe alerts from paging anyone during a
+// daily period, like overnight, by holding them for a digest when the
+// period ends or by sending them to other sinks, like a low-noise channel.
+type quietHours struct {
+	// From and To are the times of day, like "22:00" and "07:00", quiet
+	// hours start and end, which can span midnight. If they're the same,
+	// quiet hours last all day.
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+
+	// Timezone is the time zone, like "America/New_York", From and To are
+	// in, the local time zone by default
+	Timezone string `yaml:"timezone"`
+
+	// Days, if set, limits quiet hours to those starting on these days of
+	// the week, like [sat, sun]
+	Days []string `yaml:"days"`
+
+	// Below is the severity alerts must be less severe than to be quieted,
+	// "critical" by default, so critical alerts still go out right away
+	Below string `yaml:"below"`
+
+	// Sinks, if set, are the names of the sinks quieted alerts go to
+	// instead. Otherwise they're held and sent to the rule's sinks, as a
+	// digest where the sink supports it, when quiet hours end.
+	Sinks []string `yaml:"sinks"`
+
+	from, to int // minutes after midnight
+	location *time.Location
+	days     map[time.Weekday]bool // nil for every day
+	below    severity
+	sinks    []*sink
+}
+
+// weekdays are the names days can be given by.
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// compile validates the quiet hours and resolves their sinks.
+func (q *quietHours) compile(sinksByName map[string]*sink, ruleSeverity severity) error {
+	var err error
+	if q.from, err = parseTimeOfDay(q.From); err != nil {
+		return errors.Wrap(err, "from")
+	}
+	if q.to, err = parseTimeOfDay(q.To); err != nil {
+		return errors.Wrap(err, "to")
+	}
+
+	q.location = time.Local
+	if q.Timezone != "" {
+		if q.location, err = time.LoadLocation(q.Timezone); err != nil {
+			return errors.Errorf("timezone: unknown time zone %q", q.Timezone)
+		}
+	}
+
+	q.days = nil
+	for i, name := range q.Days {
+		day, ok := weekdays[strings.ToLower(name)]
+		if !ok && len(name) > 3 {
+			// allow full names, like "Monday"
+			day, ok = weekdays[strings.ToLower(name[:3])]
+			ok = ok && strings.EqualFold(name, day.String())
+		}
+		if !ok {
+			return errors.Errorf("days[%d]: unknown day %q (must be sun, mon, tue, wed, thu, fri, or sat)", i, name)
+		}
+		if q.days == nil {
+			q.days = map[time.Weekday]bool{}
+		}
+		q.days[day] = true
+	}
+
+	q.below = severityCritical
+	if q.Below != "" {
+		if q.below, err = parseSeverity(q.Below); err != nil {
+			return errors.Wrap(err, "below")
+		}
+		if q.below == severityInfo {
+			return errors.New("below: no alerts are less severe than info")
+		}
+	}
+
+	q.sinks = nil
+	for i, name := range q.Sinks {
+		s := sinksByName[name]
+		if s == nil {
+			return errors.Errorf("sinks[%d]: unknown sink %q", i, name)
+		}
+		if ruleSeverity < s.minSeverity {
+			return errors.Errorf("sinks[%d]: sink %q only takes %s alerts and up, but the rule's severity is %s", i, name, s.minSeverity, ruleSeverity)
+		}
+		q.sinks = append(q.sinks, s)
+	}
+	return nil
+}
+
+// parseTimeOfDay parses a time of day, like "22:00", as minutes after
+// midnight.
+func parseTimeOfDay(s string) (int, error) {
+	if s == "" {
+		return 0, errors.New("must be set (e.g., \"22:00\")")
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, errors.Errorf("%q isn't a time of day like \"22:00\"", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// until reports whether t is during quiet hours and, if it is, when they
+// end, taking in any quiet hours that start as soon as they do.
+func (q *quietHours) until(t time.Time) (time.Time, bool) {
+	local := t.In(q.location)
+	for _, daysAgo := range []int{0, 1} {
+		start := time.Date(local.Year(), local.Month(), local.Day()-daysAgo, q.from/60, q.from%60, 0, 0, q.location)
+		if t.Before(start) || !q.on(start.Weekday()) {
+			continue
+		}
+		end := q.end(start)
+		if !t.Before(end) {
+			continue
+		}
+		// all-day quiet hours on consecutive days run together
+		for i := 0; q.from == q.to && i < 7 && q.on(end.Weekday()); i++ {
+			end = q.end(end)
+		}
+		return end, true
+	}
+	return time.Time{}, false
+}
+
+// end returns when quiet hours starting at start end.
+func (q *quietHours) end(start time.Time) time.Time {
+	days := 0
+	if q.to <= q.from {
+		days = 1
+	}
+	return time.Date(start.Year(), start.Month(), start.Day()+days, q.to/60, q.to%60, 0, 0, q.location)
+}
+
+// on reports whether quiet hours start on a day of the week.
+func (q *quietHours) on(day time.Weekday) bool {
+	return q.days == nil || q.days[day]
+}
+
+// String describes the quiet hours, like "22:00-07:00 America/New_York".
+func (q *quietHours) String() string {
+	s := fmt.Sprintf("%s-%s %s", q.From, q.To, q.location)
+	if len(q.Days) > 0 {
+		s += " on " + strings.Join(q.Days, ", ")
+	}
+	return s
+}
+
+// summarySender is implemented by sinks, like Slack, that can send a batch
+// of alerts as a single message headed by a summary.
+type summarySender interface {
+	sendSummary(alerts []*alert, summary string) error
+}
+
+// quietHold holds alerts during their rules' quiet hours until the quiet
+// hours end.
+type quietHold struct {
+	// send sends a batch of held alerts to a sink
+	send func(s *sink, alerts []*alert)
+
+	mu      sync.Mutex
+	batches map[heldKey]*heldBatch
+}
+
+// heldKey identifies the alerts held for a rule until the same time.
+type heldKey struct {
+	rule  string
+	until int64 // Unix time
+}
+
+// heldBatch is the alerts held for a rule, in the order they were held,
+// with the sinks to send each to.
+type heldBatch struct {
+	sinks  []*sink
+	alerts []*alert
+	timer  *time.Timer
+}
+
+func newQuietHold(send func(s *sink, alerts []*alert)) *quietHold {
+	return &quietHold{send: send, batches: map[heldKey]*heldBatch{}}
+}
+
+// add holds an alert for a sink until the end of its rule's quiet hours.
+func (h *quietHold) add(s *sink, a *alert, until time.Time) {
+	key := heldKey{rule: a.Rule, until: until.Unix()}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	b := h.batches[key]
+	if b == nil {
+		b = &heldBatch{}
+		b.timer = time.AfterFunc(time.Until(until), func() { h.release(key) })
+		h.batches[key] = b
+	}
+	b.sinks = append(b.sinks, s)
+	b.alerts = append(b.alerts, a)
+}
+
+// release sends a batch of held alerts.
+func (h *quietHold) release(key heldKey) {
+	h.mu.Lock()
+	b := h.batches[key]
+	delete(h.batches, key)
+	h.mu.Unlock()
+	if b != nil {
+		h.sendBatch(b)
+	}
+}
+
+// sendBatch sends the alerts held in a batch, grouped by sink.
+func (h *quietHold) sendBatch(b *heldBatch) {
+	bySink := map[*sink][]*alert{}
+	order := []*sink{}
+	for i, s := range b.sinks {
+		if bySink[s] == nil {
+			order = append(order, s)
+		}
+		bySink[s] = append(bySink[s], b.alerts[i])
+	}
+	for _, s := range order {
+		h.send(s, bySink[s])
+	}
+}
+
+// close sends every held alert now, rather than losing them on exit.
+func (h *quietHold) close() {
+	h.mu.Lock()
+	keys := []heldKey{}
+	for key, b := range h.batches {
+		b.timer.Stop()
+		keys = append(keys, key)
+	}
+	batches := h.batches
+	h.batches = map[heldKey]*heldBatch{}
+	h.mu.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].until < keys[j].until })
+	for _, key := range keys {
+		log.WithField("rule", key.rule).WithField("alerts", len(batches[key].alerts)).Info("sending alerts held for quiet hours early to exit")
+		h.sendBatch(batches[key])
+	}
+}
+
+// sendHeld sends alerts held during quiet hours to a sink, as one summary
+// if the sink can send one and there's more than one alert.
+func (w *watcher) sendHeld(s *sink, alerts []*alert) {
+	log.WithField("sink", s.name).WithField("alerts", len(alerts)).Info("sending alerts held for quiet hours")
+	ss, ok := s.notifier.(summarySender)
+	if !ok || len(alerts) == 1 {
+		for _, a := range alerts {
+			w.notify(s, a)
+		}
+		return
+	}
+	summary := english.Plural(len(alerts), "matching certificate", "") + " during quiet hours"
+	if err := ss.sendSummary(alerts, summary); err != nil {
+		log.WithError(err).WithField("sink", s.name).Error("error sending alerts held for quiet hours")
+		for _, a := range alerts {
+			notificationsFailed.inc(a.Rule, s.name)
+		}
+		return
+	}
+	for _, a := range alerts {
+		notificationsSent.inc(a.Rule, s.name)
+	}
+}
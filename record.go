@@ -0,0 +1,132 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/heptiolabs/certstream-slack/pkg/stream"
+)
+
+// recorder writes every message from the source to gzipped files of JSON
+// lines, starting a new file every rotate interval, so that traffic can be
+// investigated and replayed later. Files are named after path and the time
+// they were started, like "capture-2024-01-02T15-04-05.jsonl.gz".
+type recorder struct {
+	path   string
+	rotate time.Duration
+	keep   int // how many files to keep (zero keeps them all)
+
+	mu      sync.Mutex
+	file    *os.File
+	gz      *gzip.Writer
+	started time.Time
+}
+
+const recordTimeFormat = "2006-01-02T15-04-05"
+
+func newRecorder(path string, rotate time.Duration, keep int) *recorder {
+	return &recorder{path: path, rotate: rotate, keep: keep}
+}
+
+// wrap returns a handler that records each message and then passes it on
+// to handle.
+func (r *recorder) wrap(handle func(msg *stream.Message)) func(msg *stream.Message) {
+	return func(msg *stream.Message) {
+		if err := r.record(msg); err != nil {
+			log.WithError(err).Error("could not record message")
+		}
+		handle(msg)
+	}
+}
+
+func (r *recorder) record(msg *stream.Message) error {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.gz == nil || time.Since(r.started) >= r.rotate {
+		if err := r.open(); err != nil {
+			return err
+		}
+	}
+	_, err = r.gz.Write(append(line, '\n'))
+	return err
+}
+
+// open closes the current file, if any, and starts a new one.
+func (r *recorder) open() error {
+	if err := r.closeFile(); err != nil {
+		log.WithError(err).Error("could not close recording")
+	}
+	r.started = time.Now()
+	name := r.path + "-" + r.started.UTC().Format(recordTimeFormat) + ".jsonl.gz"
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	r.file = f
+	r.gz = gzip.NewWriter(f)
+	log.WithField("path", name).Debug("started recording")
+	r.prune()
+	return nil
+}
+
+// prune removes the oldest recordings beyond the number to keep.
+func (r *recorder) prune() {
+	if r.keep <= 0 {
+		return
+	}
+	names, err := filepath.Glob(r.path + "-*.jsonl.gz")
+	if err != nil {
+		return
+	}
+	// the timestamps in the names sort chronologically
+	sort.Strings(names)
+	for len(names) > r.keep {
+		if err := os.Remove(names[0]); err != nil {
+			log.WithError(err).WithField("path", names[0]).Error("could not remove old recording")
+		}
+		names = names[1:]
+	}
+}
+
+func (r *recorder) closeFile() error {
+	if r.gz == nil {
+		return nil
+	}
+	err := r.gz.Close()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	r.gz, r.file = nil, nil
+	return err
+}
+
+// close finishes the current recording.
+func (r *recorder) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closeFile()
+}
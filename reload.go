@@ -0,0 +1,196 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// sinkRetireDelay is how long sinks removed by a reload are kept, so that
+// alerts already being sent to them can finish, before they're flushed and
+// closed.
+const sinkRetireDelay = time.Minute
+
+// reloader reloads the config on demand, swapping the new rules into the
+// watcher without interrupting the certificate source.
+type reloader struct {
+	watcher  *watcher
+	override func(c *config) // applied to every load, for command line flags
+
+	mu      sync.Mutex
+	current *config
+	stamps  string // of the config's files as of the last load
+}
+
+func newReloader(w *watcher, override func(c *config), cfg *config) *reloader {
+	return &reloader{watcher: w, override: override, current: cfg, stamps: fileStamps(cfg.files())}
+}
+
+// config returns the config in use.
+func (r *reloader) config() *config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// refresh swaps the current config's rules into the watcher again, along
+// with any watches added from Slack since.
+func (r *reloader) refresh() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.watcher.update(r.current)
+}
+
+// reload loads the config again and starts using it. If it's invalid, the
+// error is returned and the current config stays in use.
+func (r *reloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := r.current
+	// a change made while loading is noticed by the next check
+	r.stamps = fileStamps(old.files())
+	cfg, err := loadConfig(old.path, r.override, old)
+	if err != nil {
+		configReloads.inc("failure")
+		return err
+	}
+	cfg.previous = nil
+	r.stamps = fileStamps(cfg.files())
+	if cfg.restartSettings() != old.restartSettings() {
+		log.Warn("some changed settings only take effect after a restart")
+	}
+
+	log.SetLevel(cfg.logLevel)
+	r.watcher.update(cfg)
+	r.current = cfg
+	configReloads.inc("success")
+	log.WithField("rules", len(cfg.Rules)).WithField("sinks", len(cfg.sinks)).Info("reloaded configuration")
+
+	// let go of the sinks that are no longer used, and the old rules'
+	// plugins and scripts, once any alerts on their way to them are sent
+	inUse := cfg.allSinks()
+	retired := []*sink{}
+	for s := range old.allSinks() {
+		if !inUse[s] {
+			retired = append(retired, s)
+		}
+	}
+	stops := []func() error{}
+	for _, rl := range old.Rules {
+		if rl.plugin != nil {
+			stops = append(stops, rl.plugin.close)
+		}
+		if rl.script != nil {
+			stops = append(stops, rl.script.close)
+		}
+	}
+	if len(retired) > 0 || len(stops) > 0 {
+		time.AfterFunc(sinkRetireDelay, func() {
+			for _, s := range retired {
+				retireSink(s)
+			}
+			for _, stop := range stops {
+				stop()
+			}
+		})
+	}
+	return nil
+}
+
+// retireSink flushes and closes a sink that's no longer used.
+func retireSink(s *sink) {
+	if f, ok := s.notifier.(flusher); ok {
+		if err := f.Flush(); err != nil {
+			log.WithError(err).WithField("sink", s.name).Error("error flushing alerts")
+		}
+	}
+	if c, ok := s.notifier.(closer); ok {
+		if err := c.Close(); err != nil {
+			log.WithError(err).WithField("sink", s.name).Error("error closing sink")
+		}
+	}
+}
+
+// watch reloads the config whenever one of its files changes, checking
+// every interval.
+func (r *reloader) watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		if !r.changed() {
+			continue
+		}
+		log.Info("config changed, reloading")
+		if err := r.reload(); err != nil {
+			log.WithError(err).Error("could not reload configuration, keeping the current one")
+		}
+	}
+}
+
+// changed reports whether any of the config's files changed since the last
+// load.
+func (r *reloader) changed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return fileStamps(r.current.files()) != r.stamps
+}
+
+// fileStamps describes the size and modification time of each file, to
+// notice when any of them change.
+func fileStamps(files []string) string {
+	stamps := ""
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			stamps += file + " missing\n"
+			continue
+		}
+		stamps += fmt.Sprintf("%s %s %d\n", file, info.ModTime(), info.Size())
+	}
+	return stamps
+}
+
+// allSinks returns every sink the config's rules send to.
+func (c *config) allSinks() map[*sink]bool {
+	sinks := map[*sink]bool{}
+	for _, s := range c.sinks {
+		sinks[s] = true
+	}
+	for _, r := range c.Rules {
+		for _, s := range r.sinks {
+			sinks[s] = true
+		}
+	}
+	return sinks
+}
+
+// restartSettings describes the settings that a reload doesn't apply, to
+// warn when they change.
+func (c *config) restartSettings() string {
+	settings := *c
+	settings.LogLevel = ""
+	settings.Sinks = nil
+	settings.SlackWebhookURL = ""
+	settings.Rules = nil
+	settings.NormalizeDomains = false
+	settings.MaxDomainsInAlert = 0
+	settings.ExcludePattern = ""
+	data, _ := yaml.Marshal(&settings)
+	return string(data)
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/heptiolabs/certstream-slack/pkg/stream"
+)
+
+// replaySource reads certstream messages from a file of JSON lines, such as
+// a recording, for trying out rules offline. The file may be gzipped, and a
+// path of "-" reads standard input.
+type replaySource struct {
+	path string
+
+	mu          sync.Mutex
+	reading     bool
+	lastMessage time.Time
+
+	stopOnce sync.Once
+	stopped  chan struct{}
+}
+
+func newReplaySource(path string) *replaySource {
+	return &replaySource{path: path, stopped: make(chan struct{})}
+}
+
+func (s *replaySource) stop() {
+	s.stopOnce.Do(func() { close(s.stopped) })
+}
+
+// status reports the source as connected while the file is being read.
+func (s *replaySource) status() (bool, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reading, s.lastMessage
+}
+
+// run calls handle for each message in the file, returning at the end of it
+// or when stopped. Lines that aren't valid JSON are logged and skipped.
+func (s *replaySource) run(handle func(msg *stream.Message)) error {
+	var r io.Reader = os.Stdin
+	if s.path != "-" {
+		f, err := os.Open(s.path)
+		if err != nil {
+			return errors.Wrap(err, "could not open replay file")
+		}
+		defer f.Close()
+		r = f
+	}
+	// gzipped files start with a magic number
+	buffered := bufio.NewReader(r)
+	r = buffered
+	if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return errors.Wrap(err, "could not read replay file")
+		}
+		defer gz.Close()
+		r = gz
+	}
+	log.WithField("path", s.path).Info("replaying certstream messages")
+
+	s.setReading(true)
+	defer s.setReading(false)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	messages := 0
+	for line := 1; scanner.Scan(); line++ {
+		select {
+		case <-s.stopped:
+			return nil
+		default:
+		}
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		// the scanner reuses its buffer, and messages keep what they decode
+		frame := append([]byte(nil), scanner.Bytes()...)
+		msg, err := stream.Decode(frame)
+		if err != nil {
+			log.WithError(err).WithField("line", line).Warn("skipping malformed message in replay file")
+			malformedMessages.inc()
+			continue
+		}
+		s.mu.Lock()
+		s.lastMessage = msg.Received
+		s.mu.Unlock()
+		lastMessageTime.set(float64(msg.Received.UnixNano()) / 1e9)
+		handle(msg)
+		messages++
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err, "could not read replay file")
+	}
+	log.WithField("messages", messages).Info("finished replaying certstream messages")
+	return nil
+}
+
+func (s *replaySource) setReading(reading bool) {
+	s.mu.Lock()
+	s.reading = reading
+	s.mu.Unlock()
+}
@@ -0,0 +1,343 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize/english"
+	"github.com/pkg/errors"
+)
+
+// statsReport is a summary of what the watcher did, posted on a schedule,
+// like every morning, which shows it's alive and how matches are trending.
+type statsReport struct {
+	// Schedule is when to post the report, as a cron expression like
+	// "0 9 * * mon" or a shorthand like "@daily", in Timezone (the local
+	// time zone by default)
+	Schedule string `yaml:"schedule"`
+	Timezone string `yaml:"timezone"`
+
+	// Sinks are the names of the Slack sinks to post the report to, every
+	// Slack sink by default
+	Sinks []string `yaml:"sinks"`
+
+	// TopDomains is how many of the most matched registrable domains to
+	// list (10 by default)
+	TopDomains int `yaml:"top_domains"`
+
+	schedule *cronSchedule
+	location *time.Location
+	sinks    []string
+}
+
+// defaultReportTopDomains is how many registrable domains reports list by
+// default.
+const defaultReportTopDomains = 10
+
+// reportSender is implemented by sinks that can post reports.
+type reportSender interface {
+	sendReport(title string, lines []string) error
+}
+
+// compile validates the report and resolves its sinks. In a dry run,
+// reports are logged instead.
+func (r *statsReport) compile(sinks []*sink, dryRun bool) error {
+	var err error
+	if r.schedule, err = parseCron(r.Schedule); err != nil {
+		return errors.Wrap(err, "schedule")
+	}
+	r.location = time.Local
+	if r.Timezone != "" {
+		if r.location, err = time.LoadLocation(r.Timezone); err != nil {
+			return errors.Errorf("timezone: unknown time zone %q", r.Timezone)
+		}
+	}
+	if r.TopDomains < 0 {
+		return errors.New("top_domains: must not be negative")
+	}
+	if r.TopDomains == 0 {
+		r.TopDomains = defaultReportTopDomains
+	}
+
+	r.sinks = nil
+	if dryRun {
+		return nil
+	}
+	sinksByName := map[string]*sink{}
+	for _, s := range sinks {
+		sinksByName[s.name] = s
+	}
+	for i, name := range r.Sinks {
+		s := sinksByName[name]
+		if s == nil {
+			return errors.Errorf("sinks[%d]: unknown sink %q", i, name)
+		}
+		if _, ok := s.notifier.(reportSender); !ok {
+			return errors.Errorf("sinks[%d]: sink %q can't post reports, only slack sinks can", i, name)
+		}
+		r.sinks = append(r.sinks, name)
+	}
+	if r.Sinks == nil {
+		for _, s := range sinks {
+			if _, ok := s.notifier.(reportSender); ok {
+				r.sinks = append(r.sinks, s.name)
+			}
+		}
+		if len(r.sinks) == 0 {
+			return errors.New("sinks: there are no slack sinks to post the report to")
+		}
+	}
+	return nil
+}
+
+// maxReportDomains limits how many registrable domains a report period
+// counts matches for, so that a broad rule can't use up the memory.
+const maxReportDomains = 10000
+
+// reportPeriod is what happened since the last report.
+type reportPeriod struct {
+	start        time.Time
+	certificates int64
+	matches      map[string]int // by rule
+	domains      map[string]int // by registrable domain
+	minutes      map[int64]bool // in which certificates were received
+
+	// reconnects and dropped are the counters' values at the start
+	reconnects, dropped float64
+}
+
+func newReportPeriod(start time.Time) *reportPeriod {
+	return &reportPeriod{
+		start:      start,
+		matches:    map[string]int{},
+		domains:    map[string]int{},
+		minutes:    map[int64]bool{},
+		reconnects: streamReconnects.get(),
+		dropped:    messagesDropped.get(),
+	}
+}
+
+// reporter keeps the statistics for each report and posts them on their
+// schedules.
+type reporter struct {
+	started time.Time
+
+	// config returns the config in use, whose sinks the reports are posted
+	// to, as they may have been reloaded
+	config func() *config
+
+	mu      sync.Mutex
+	reports []*statsReport
+	periods []*reportPeriod
+	timers  []*time.Timer
+}
+
+// newReporter starts posting reports on their schedules.
+func newReporter(reports []*statsReport, config func() *config) *reporter {
+	now := time.Now()
+	r := &reporter{started: now, config: config, reports: reports}
+	for i := range reports {
+		r.periods = append(r.periods, newReportPeriod(now))
+		r.timers = append(r.timers, nil)
+		r.schedule(i)
+	}
+	return r
+}
+
+// schedule sets the timer for the next time report i is posted.
+func (r *reporter) schedule(i int) {
+	report := r.reports[i]
+	next := report.schedule.next(time.Now().In(report.location))
+	if next.IsZero() {
+		log.WithField("schedule", report.Schedule).Warn("report schedule never comes")
+		return
+	}
+	r.timers[i] = time.AfterFunc(time.Until(next), func() {
+		r.post(i)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.timers[i] != nil {
+			r.schedule(i)
+		}
+	})
+}
+
+// certificate counts a certificate received for every report.
+func (r *reporter) certificate() {
+	if r == nil {
+		return
+	}
+	minute := time.Now().Unix() / 60
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, p := range r.periods {
+		p.certificates++
+		p.minutes[minute] = true
+	}
+}
+
+// match counts a rule's match on domains for every report.
+func (r *reporter) match(rule string, domains []string) {
+	if r == nil {
+		return
+	}
+	registrables := registrableDomains(domains)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, p := range r.periods {
+		p.matches[rule]++
+		for _, registrable := range registrables {
+			if _, ok := p.domains[registrable]; ok || len(p.domains) < maxReportDomains {
+				p.domains[registrable]++
+			}
+		}
+	}
+}
+
+// post posts report i about the period since the last one, and starts the
+// next period.
+func (r *reporter) post(i int) {
+	now := time.Now()
+	r.mu.Lock()
+	report, p := r.reports[i], r.periods[i]
+	r.periods[i] = newReportPeriod(now)
+	title, lines := p.summary(now, r.started, report)
+	r.mu.Unlock()
+
+	if report.sinks == nil {
+		log.WithField("report", title).Info(strings.Join(lines, "\n"))
+		return
+	}
+	cfg := r.config()
+	for _, name := range report.sinks {
+		var sender reportSender
+		for _, s := range cfg.sinks {
+			if s.name == name {
+				sender, _ = s.notifier.(reportSender)
+			}
+		}
+		if sender == nil {
+			log.WithField("sink", name).Warn("can't post report to a sink that's been removed")
+			continue
+		}
+		if err := sender.sendReport(title, lines); err != nil {
+			log.WithError(err).WithField("sink", name).Error("error posting report")
+		}
+	}
+}
+
+// close stops posting reports.
+func (r *reporter) close() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, t := range r.timers {
+		if t != nil {
+			t.Stop()
+			r.timers[i] = nil
+		}
+	}
+}
+
+// summary describes the period until end, for report, with a title and a
+// line for each statistic in Slack's markdown.
+func (p *reportPeriod) summary(end, started time.Time, report *statsReport) (string, []string) {
+	total := 0
+	rules := []string{}
+	for rule, n := range p.matches {
+		total += n
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if p.matches[rules[i]] != p.matches[rules[j]] {
+			return p.matches[rules[i]] > p.matches[rules[j]]
+		}
+		return rules[i] < rules[j]
+	})
+	title := fmt.Sprintf("Certstream report: %s, %s",
+		english.Plural(int(p.certificates), "certificate", ""), english.Plural(total, "match", "matches"))
+
+	when := func(t time.Time) string { return t.In(report.location).Format("Jan 2 15:04 MST") }
+	lines := []string{
+		fmt.Sprintf("*Period*: %s to %s", when(p.start), when(end)),
+		fmt.Sprintf("*Certificates processed*: %d", p.certificates),
+	}
+
+	if total == 0 {
+		lines = append(lines, "*Matches*: none")
+	} else {
+		counts := []string{}
+		for _, rule := range rules {
+			counts = append(counts, fmt.Sprintf("%s %d", rule, p.matches[rule]))
+		}
+		lines = append(lines, fmt.Sprintf("*Matches*: %d (%s)", total, strings.Join(counts, ", ")))
+	}
+
+	if len(p.domains) > 0 {
+		domains := make([]string, 0, len(p.domains))
+		for domain := range p.domains {
+			domains = append(domains, domain)
+		}
+		sort.Slice(domains, func(i, j int) bool {
+			if p.domains[domains[i]] != p.domains[domains[j]] {
+				return p.domains[domains[i]] > p.domains[domains[j]]
+			}
+			return domains[i] < domains[j]
+		})
+		top := []string{}
+		for _, domain := range domains {
+			if len(top) == report.TopDomains {
+				break
+			}
+			top = append(top, fmt.Sprintf("%s (%d)", domain, p.domains[domain]))
+		}
+		lines = append(lines, "*Top domains*: "+strings.Join(top, ", "))
+	}
+
+	// the share of minutes certificates came in shows how much of the time
+	// the stream was up, since certstream sends many every minute
+	minutes := int64(end.Sub(p.start)/time.Minute) + 1
+	live := float64(len(p.minutes)) / float64(minutes) * 100
+	if live > 100 {
+		live = 100
+	}
+	stream := fmt.Sprintf("*Stream*: certificates received in %.1f%% of minutes, %s",
+		live, english.Plural(int(streamReconnects.get()-p.reconnects), "reconnect", ""))
+	if dropped := int(messagesDropped.get() - p.dropped); dropped > 0 {
+		stream += fmt.Sprintf(", %s dropped", english.Plural(dropped, "message", ""))
+	}
+	lines = append(lines, stream)
+	lines = append(lines, fmt.Sprintf("*Uptime*: running since %s (%s)", when(started), formatUptime(end.Sub(started))))
+	return title, lines
+}
+
+// formatUptime describes a duration roughly, like "3 days" or "5 hours".
+func formatUptime(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return english.Plural(int(d/(24*time.Hour)), "day", "")
+	case d >= 2*time.Hour:
+		return english.Plural(int(d/time.Hour), "hour", "")
+	}
+	return english.Plural(int(d/time.Minute), "minute", "")
+}
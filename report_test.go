@@ -0,0 +1,121 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReportPeriodSummary(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	end := start.Add(59 * time.Minute)
+
+	// minutes are the first n minutes of the period
+	minutes := func(n int) map[int64]bool {
+		m := map[int64]bool{}
+		for i := 0; i < n; i++ {
+			m[start.Add(time.Duration(i)*time.Minute).Unix()/60] = true
+		}
+		return m
+	}
+
+	tests := []struct {
+		name                string
+		period              reportPeriod
+		reconnects, dropped float64 // since the start
+		started             time.Time
+		report              statsReport
+		title               string
+		lines               []string
+	}{
+		{
+			name:    "nothing happened",
+			period:  reportPeriod{matches: map[string]int{}, domains: map[string]int{}, minutes: map[int64]bool{}},
+			started: start.Add(-10 * time.Minute),
+			report:  statsReport{TopDomains: 10, location: time.UTC},
+			title:   "Certstream report: 0 certificates, 0 matches",
+			lines: []string{
+				"*Period*: Jan 1 09:00 UTC to Jan 1 09:59 UTC",
+				"*Certificates processed*: 0",
+				"*Matches*: none",
+				"*Stream*: certificates received in 0.0% of minutes, 0 reconnects",
+				"*Uptime*: running since Jan 1 08:50 UTC (69 minutes)",
+			},
+		},
+		{
+			name: "ordered by count, then name",
+			period: reportPeriod{
+				certificates: 1,
+				matches:      map[string]int{"beta": 2, "alpha": 2, "gamma": 5},
+				domains:      map[string]int{"b.com": 4, "a.com": 4, "c.com": 1, "d.com": 1},
+				minutes:      minutes(30),
+			},
+			reconnects: 1,
+			dropped:    3,
+			started:    start.Add(-50 * time.Hour),
+			report:     statsReport{TopDomains: 3, location: tokyo},
+			title:      "Certstream report: 1 certificate, 9 matches",
+			lines: []string{
+				"*Period*: Jan 1 18:00 JST to Jan 1 18:59 JST",
+				"*Certificates processed*: 1",
+				"*Matches*: 9 (gamma 5, alpha 2, beta 2)",
+				"*Top domains*: a.com (4), b.com (4), c.com (1)",
+				"*Stream*: certificates received in 50.0% of minutes, 1 reconnect, 3 messages dropped",
+				"*Uptime*: running since Dec 30 16:00 JST (2 days)",
+			},
+		},
+		{
+			name: "one match, the stream always up",
+			period: reportPeriod{
+				certificates: 2500,
+				matches:      map[string]int{"phishing": 1},
+				domains:      map[string]int{"example.com": 1},
+				minutes:      minutes(61),
+			},
+			reconnects: 2,
+			started:    start.Add(-5 * time.Hour),
+			report:     statsReport{TopDomains: 10, location: time.UTC},
+			title:      "Certstream report: 2500 certificates, 1 match",
+			lines: []string{
+				"*Period*: Jan 1 09:00 UTC to Jan 1 09:59 UTC",
+				"*Certificates processed*: 2500",
+				"*Matches*: 1 (phishing 1)",
+				"*Top domains*: example.com (1)",
+				"*Stream*: certificates received in 100.0% of minutes, 2 reconnects",
+				"*Uptime*: running since Jan 1 04:00 UTC (5 hours)",
+			},
+		},
+	}
+	for _, test := range tests {
+		p := test.period
+		p.start = start
+		p.reconnects = streamReconnects.get() - test.reconnects
+		p.dropped = messagesDropped.get() - test.dropped
+		title, lines := p.summary(end, test.started, &test.report)
+		if title != test.title {
+			t.Errorf("%s: title = %q, want %q", test.name, title, test.title)
+		}
+		if !reflect.DeepEqual(lines, test.lines) {
+			t.Errorf("%s: lines =\n%q\nwant\n%q", test.name, lines, test.lines)
+		}
+	}
+}
@@ -0,0 +1,641 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/heptiolabs/certstream-slack/pkg/cel"
+	"github.com/heptiolabs/certstream-slack/pkg/match"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// rule routes certificates naming domains that match a pattern or keyword
+// list to sinks.
+type rule struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
+
+	// PatternMode is "domain" (the default) to match Pattern against whole
+	// domains, or "registrable" to match it against their registrable
+	// domains (eTLD+1), like "example.co.uk" for "www.example.co.uk"
+	PatternMode string `yaml:"pattern_mode"`
+
+	// Keywords are matched against domains as an alternative to Pattern,
+	// along with any listed in KeywordsFile (one per line). KeywordMode is
+	// "substring" (the default), "registrable", or "label".
+	Keywords     []string `yaml:"keywords"`
+	KeywordsFile string   `yaml:"keywords_file"`
+	KeywordMode  string   `yaml:"keyword_mode"`
+
+	// Lookalikes are protected domains, like "example.com". Certificates
+	// for permutations of them (homoglyphs, bitsquats, swapped characters,
+	// added hyphens, swapped TLDs, and so on) match.
+	Lookalikes []string `yaml:"lookalikes"`
+
+	// LookalikeDistance, if positive, also matches domains whose registrable
+	// label is within this edit distance of a protected domain's label
+	LookalikeDistance int `yaml:"lookalike_distance"`
+
+	// Plugin is a command deciding which of a certificate's domains match
+	// and, optionally, the severity and sinks of the alert (see
+	// pluginMatch), as an alternative to Pattern, and PluginTimeout is how
+	// long it has to answer for each certificate
+	Plugin        []string      `yaml:"plugin"`
+	PluginTimeout time.Duration `yaml:"plugin_timeout"`
+
+	// Script is a Lua script deciding the same, run in the watcher (see
+	// luaScript), and ScriptTimeout is how long it has to decide for each
+	// certificate
+	Script        string        `yaml:"script"`
+	ScriptTimeout time.Duration `yaml:"script_timeout"`
+
+	// OPABundle is an Open Policy Agent bundle, a directory or a .tar.gz,
+	// with a decision, OPAQuery (by default "data.certstream.match"), that
+	// decides which of a certificate's domains match (see opaMatch), as an
+	// alternative to Pattern. OPATimeout is how long it has to decide for
+	// each certificate.
+	OPABundle  string        `yaml:"opa_bundle"`
+	OPAQuery   string        `yaml:"opa_query"`
+	OPATimeout time.Duration `yaml:"opa_timeout"`
+
+	// Zones are domains you own. Certificates naming them or their
+	// subdomains in ways Expect doesn't describe match (see zoneMatch), or,
+	// without Expect, every certificate for them does.
+	Zones  []string          `yaml:"zones"`
+	Expect *zoneExpectations `yaml:"expect"`
+
+	// CAADomains are domains you own. Certificates for them or their
+	// subdomains from CAs their CAA records don't authorize match (see
+	// caaMatch). CAAIssuers add to the CAA identifiers of CAs, keyed by the
+	// organization in the issuer names of their certificates, and
+	// CAAResolver is the DNS server to look up CAA records with.
+	CAADomains  []string            `yaml:"caa_domains"`
+	CAAIssuers  map[string][]string `yaml:"caa_issuers"`
+	CAAResolver string              `yaml:"caa_resolver"`
+
+	// Issuers limit the rule to certificates from the matching CAs, and
+	// ExcludeIssuers skip certificates from them, such as the CAs approved
+	// to issue certificates for your domains. On their own, they match every
+	// domain of the certificates they allow.
+	Issuers        []issuerSpec `yaml:"issuers"`
+	ExcludeIssuers []issuerSpec `yaml:"exclude_issuers"`
+
+	// ChainsTo limits the rule to certificates with a matching CA anywhere
+	// in their chain, from the issuer up to the root, and ExcludeChainsTo
+	// skips them, such as certificates from your own private CA. On their
+	// own, they match every domain of the certificates they allow.
+	ChainsTo        []issuerSpec `yaml:"chains_to"`
+	ExcludeChainsTo []issuerSpec `yaml:"exclude_chains_to"`
+
+	// ValidityOver and ValidityUnder limit the rule to certificates valid
+	// (from not_before to not_after) for longer or shorter than them, such
+	// as over 9552h (398 days, the longest browsers accept) or under 24h.
+	// On their own, they match every domain of those certificates.
+	ValidityOver  time.Duration `yaml:"validity_over"`
+	ValidityUnder time.Duration `yaml:"validity_under"`
+
+	// Filter is a CEL expression (see filterVariables) that a certificate
+	// must satisfy for the rule to match it. On its own, it matches every
+	// domain of the certificates that satisfy it.
+	Filter string `yaml:"filter"`
+
+	// Score, if set, scores how likely each matching domain is to be
+	// phishing, and only domains scoring at least its threshold alert. On
+	// its own, it scores every domain of every certificate.
+	Score *scoring `yaml:"score"`
+
+	// Severity is "info", "warning" (the default), or "critical". It sets
+	// how alerts look and, with a sink's min_severity, where they're sent.
+	// WildcardSeverity, if set, is the severity of alerts for certificates
+	// with a matching wildcard domain, like "*.example.com".
+	Severity         string `yaml:"severity"`
+	WildcardSeverity string `yaml:"wildcard_severity"`
+
+	// NewDomainSeverity, if set, is the severity of alerts for domains
+	// that the rdap enricher found were registered less than NewDomainAge
+	// ago
+	NewDomainAge      time.Duration `yaml:"new_domain_age"`
+	NewDomainSeverity string        `yaml:"new_domain_severity"`
+
+	// Cooldown, if set, overrides the config's cooldown: how long after
+	// alerting on a registrable domain to suppress the rule's alerts for it
+	Cooldown time.Duration `yaml:"cooldown"`
+
+	// QuietHours, if set, holds or reroutes the rule's less severe alerts
+	// during a daily period, like overnight
+	QuietHours *quietHours `yaml:"quiet_hours"`
+
+	// Exclude is a pattern for domains to ignore even if they match Pattern,
+	// such as your own domains
+	Exclude string `yaml:"exclude"`
+
+	// Sinks are the names of the sinks to alert. If neither Sinks nor
+	// WebhookURL is set, every sink is alerted.
+	Sinks []string `yaml:"sinks"`
+
+	// WebhookURL is a Slack webhook to alert for this rule only
+	WebhookURL string `yaml:"webhook_url"`
+
+	// Template customizes the rule's messages (see messageData), overriding
+	// the sinks' message_template, and Templates does so for specific sinks,
+	// keyed by sink name
+	Template  string            `yaml:"template"`
+	Templates map[string]string `yaml:"templates"`
+
+	matcher  match.Rule
+	plugin   *pluginProcess
+	script   *luaScript
+	opa      *opaPolicy
+	caa      *caaChecker
+	zones    zoneList
+	filter   *cel.Program
+	scorer   *match.Scorer
+	severity severity
+	sinks    []*sink
+	// wildcardSeverity and wildcardSinks are for alerts with a matching
+	// wildcard domain, if WildcardSeverity is set
+	wildcardSeverity severity
+	wildcardSinks    []*sink
+	// newDomainSeverity and newDomainSinks are for alerts about newly
+	// registered domains, if NewDomainSeverity is set
+	newDomainSeverity severity
+	newDomainSinks    []*sink
+	template          *template.Template
+	templates         map[string]*template.Template
+
+	// cooldown is the rule's cooldown, or the config's if it doesn't set
+	// one
+	cooldown time.Duration
+
+	// sinksByName and allSinks are all the configured sinks, for plugins
+	// and policies to route alerts to
+	sinksByName map[string]*sink
+	allSinks    []*sink
+
+	// key is where the rule was configured (e.g., "rules[2]" in the config
+	// file) and is used to point validation errors at the offending setting
+	key string
+	// envKeys names the environment variables that set fields, keyed by
+	// field, to use in place of key
+	envKeys map[string]string
+}
+
+// compile validates the rule, compiles its pattern, and resolves its sinks.
+func (r *rule) compile(sinksByName map[string]*sink, allSinks []*sink) error {
+	// whether anything but keywords can match
+	others := r.Pattern != "" || len(r.Lookalikes) > 0 || len(r.Plugin) > 0 || r.Script != "" || r.OPABundle != "" || len(r.Zones) > 0 || len(r.CAADomains) > 0 || r.hasConditions()
+	if !others && len(r.Keywords) == 0 && r.KeywordsFile == "" {
+		return errors.Errorf("%s: pattern, keywords, lookalikes, plugin, script, opa_bundle, zones, caa_domains, filter, issuers, chains_to, validity_over, or score must be set", r.settingKey("pattern"))
+	}
+	if r.ValidityOver < 0 || r.ValidityUnder < 0 {
+		return errors.Errorf("%s: validity_over and validity_under must be positive", r.key)
+	}
+	r.matcher = match.Rule{}
+	if r.Pattern != "" {
+		regex, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return errors.Wrap(err, r.settingKey("pattern"))
+		}
+		r.matcher.Pattern = regex
+	}
+	switch r.PatternMode {
+	case "", "domain":
+	case "registrable":
+		r.matcher.PatternRegistrable = true
+	default:
+		return errors.Errorf("%s: must be \"domain\" or \"registrable\", not %q", r.settingKey("pattern_mode"), r.PatternMode)
+	}
+
+	keywords := r.Keywords
+	if r.KeywordsFile != "" {
+		more, err := match.ReadKeywordsFile(r.KeywordsFile)
+		if err != nil {
+			return errors.Wrap(err, r.settingKey("keywords_file"))
+		}
+		keywords = append(append([]string{}, keywords...), more...)
+	}
+	if len(keywords) > 0 {
+		mode := r.KeywordMode
+		if mode == "" {
+			mode = "substring"
+		}
+		m, err := match.NewKeywordMatcher(keywords, mode)
+		if err != nil {
+			return errors.Wrap(err, r.settingKey("keyword_mode"))
+		}
+		r.matcher.Keywords = m
+	} else if r.KeywordsFile != "" && !others {
+		return errors.Errorf("%s: contains no keywords", r.settingKey("keywords_file"))
+	}
+
+	if len(r.Lookalikes) > 0 {
+		if r.LookalikeDistance < 0 {
+			return errors.Errorf("%s: must not be negative", r.settingKey("lookalike_distance"))
+		}
+		m, err := match.NewLookalikeMatcher(r.Lookalikes, r.LookalikeDistance)
+		if err != nil {
+			return errors.Wrap(err, r.settingKey("lookalikes"))
+		}
+		r.matcher.Lookalikes = m
+	}
+
+	r.plugin = nil
+	if len(r.Plugin) > 0 {
+		timeout := r.PluginTimeout
+		if timeout == 0 {
+			timeout = 5 * time.Second
+		}
+		if timeout < 0 {
+			return errors.Errorf("%s.plugin_timeout: must be positive", r.key)
+		}
+		r.plugin = newPluginProcess(r.Plugin, timeout)
+	}
+
+	r.script = nil
+	if r.Script != "" {
+		if len(r.Plugin) > 0 {
+			return errors.Errorf("%s.script: can't be set with plugin", r.key)
+		}
+		timeout := r.ScriptTimeout
+		if timeout == 0 {
+			timeout = 5 * time.Second
+		}
+		if timeout < 0 {
+			return errors.Errorf("%s.script_timeout: must be positive", r.key)
+		}
+		s, err := newLuaScript(r.Script, timeout)
+		if err != nil {
+			return errors.Wrap(err, r.settingKey("script"))
+		}
+		r.script = s
+	}
+
+	r.opa = nil
+	if r.OPABundle != "" {
+		if len(r.Plugin) > 0 || r.Script != "" {
+			return errors.Errorf("%s.opa_bundle: can't be set with plugin or script", r.key)
+		}
+		timeout := r.OPATimeout
+		if timeout == 0 {
+			timeout = time.Second
+		}
+		if timeout < 0 {
+			return errors.Errorf("%s.opa_timeout: must be positive", r.key)
+		}
+		query := r.OPAQuery
+		if query == "" {
+			query = "data.certstream.match"
+		}
+		p, err := newOPAPolicy(r.OPABundle, query, timeout)
+		if err != nil {
+			return errors.Wrap(err, r.settingKey("opa_bundle"))
+		}
+		r.opa = p
+	} else if r.OPAQuery != "" {
+		return errors.Errorf("%s.opa_query: requires opa_bundle", r.key)
+	}
+
+	r.zones = nil
+	if len(r.Zones) > 0 {
+		if len(r.Plugin) > 0 || r.Script != "" || r.OPABundle != "" {
+			return errors.Errorf("%s.zones: can't be set with plugin, script, or opa_bundle", r.key)
+		}
+		zones, err := parseZones(r.Zones)
+		if err != nil {
+			return errors.Wrap(err, r.settingKey("zones"))
+		}
+		r.zones = zones
+	}
+	if r.Expect != nil {
+		if len(r.Zones) == 0 {
+			return errors.Errorf("%s.expect: zones must be set", r.key)
+		}
+		if err := r.Expect.compile(); err != nil {
+			return errors.Wrap(err, r.key+".expect")
+		}
+	}
+
+	r.caa = nil
+	if len(r.CAADomains) > 0 {
+		if len(r.Plugin) > 0 || r.Script != "" || r.OPABundle != "" || len(r.Zones) > 0 {
+			return errors.Errorf("%s.caa_domains: can't be set with plugin, script, opa_bundle, or zones", r.key)
+		}
+		c, err := newCAAChecker(r.CAADomains, r.CAAIssuers, r.CAAResolver)
+		if err != nil {
+			return errors.Wrap(err, r.settingKey("caa_domains"))
+		}
+		r.caa = c
+	}
+
+	for field, specs := range map[string][]issuerSpec{"issuers": r.Issuers, "exclude_issuers": r.ExcludeIssuers, "chains_to": r.ChainsTo, "exclude_chains_to": r.ExcludeChainsTo} {
+		for i, spec := range specs {
+			if spec == (issuerSpec{}) {
+				return errors.Errorf("%s.%s[%d]: common_name, organization, or country must be set", r.key, field, i)
+			}
+		}
+	}
+
+	r.filter = nil
+	if r.Filter != "" {
+		p, err := cel.Compile(r.Filter, filterVariables...)
+		if err != nil {
+			return errors.Wrap(err, r.settingKey("filter"))
+		}
+		r.filter = p
+	}
+
+	r.scorer = nil
+	if r.Score != nil {
+		scorer, err := r.Score.compile(r.Lookalikes)
+		if err != nil {
+			return errors.Wrap(err, r.settingKey("score"))
+		}
+		r.scorer = scorer
+	}
+
+	r.severity = defaultSeverity
+	if r.Severity != "" {
+		sev, err := parseSeverity(r.Severity)
+		if err != nil {
+			return errors.Wrap(err, r.settingKey("severity"))
+		}
+		r.severity = sev
+	}
+
+	if r.Exclude != "" {
+		exclude, err := regexp.Compile(r.Exclude)
+		if err != nil {
+			return errors.Wrap(err, r.key+".exclude")
+		}
+		r.matcher.Exclude = exclude
+	}
+
+	r.sinksByName, r.allSinks = sinksByName, allSinks
+	r.sinks = nil
+	for i, name := range r.Sinks {
+		s := sinksByName[name]
+		if s == nil {
+			return errors.Errorf("%s.sinks[%d]: unknown sink %q", r.key, i, name)
+		}
+		if r.severity < s.minSeverity {
+			return errors.Errorf("%s.sinks[%d]: sink %q only takes %s alerts and up, but the rule's severity is %s", r.key, i, name, s.minSeverity, r.severity)
+		}
+		r.sinks = append(r.sinks, s)
+	}
+	if r.WebhookURL != "" {
+		s, err := newSink(&sinkConfig{
+			Name:    "rule:" + r.Name,
+			Type:    "slack",
+			options: map[string]interface{}{"url": r.WebhookURL},
+			key:     r.settingKey("webhook_url"),
+		})
+		if err != nil {
+			return err
+		}
+		r.sinks = append(r.sinks, s)
+	}
+	if len(r.Sinks) == 0 && r.WebhookURL == "" {
+		// every sink that takes alerts this severe
+		for _, s := range allSinks {
+			if r.severity >= s.minSeverity {
+				r.sinks = append(r.sinks, s)
+			}
+		}
+	}
+	if len(r.sinks) == 0 {
+		return errors.Errorf("%s: rule %q has no sinks (set SLACK_WEBHOOK_URL or configure sinks)", r.key, r.Name)
+	}
+
+	r.wildcardSinks = nil
+	if r.WildcardSeverity != "" {
+		sev, sinks, err := r.escalation("wildcard_severity", r.WildcardSeverity)
+		if err != nil {
+			return err
+		}
+		r.wildcardSeverity, r.wildcardSinks = sev, sinks
+	}
+
+	r.newDomainSinks = nil
+	if r.NewDomainAge < 0 {
+		return errors.Errorf("%s: must not be negative", r.settingKey("new_domain_age"))
+	}
+	if (r.NewDomainAge > 0) != (r.NewDomainSeverity != "") {
+		return errors.Errorf("%s: new_domain_age and new_domain_severity must be set together", r.key)
+	}
+	if r.NewDomainSeverity != "" {
+		sev, sinks, err := r.escalation("new_domain_severity", r.NewDomainSeverity)
+		if err != nil {
+			return err
+		}
+		r.newDomainSeverity, r.newDomainSinks = sev, sinks
+	}
+
+	if r.Cooldown < 0 {
+		return errors.Errorf("%s: must not be negative", r.settingKey("cooldown"))
+	}
+	r.cooldown = r.Cooldown
+
+	if r.QuietHours != nil {
+		if err := r.QuietHours.compile(sinksByName, r.severity); err != nil {
+			return errors.Wrap(err, r.settingKey("quiet_hours"))
+		}
+	}
+
+	r.template = nil
+	if r.Template != "" {
+		t, err := newMessageTemplate(r.Name, r.Template)
+		if err != nil {
+			return errors.Wrap(err, r.settingKey("template"))
+		}
+		r.template = t
+	}
+	r.templates = map[string]*template.Template{}
+	for name, text := range r.Templates {
+		found := false
+		for _, s := range r.sinks {
+			found = found || s.name == name
+		}
+		if !found {
+			return errors.Errorf("%s.templates.%s: sink %q isn't one of the rule's sinks", r.key, name, name)
+		}
+		t, err := newMessageTemplate(r.Name+"/"+name, text)
+		if err != nil {
+			return errors.Wrapf(err, "%s.templates.%s", r.key, name)
+		}
+		r.templates[name] = t
+	}
+	return nil
+}
+
+// escalation parses the severity set by the named field and returns the
+// sinks for alerts escalated to it.
+func (r *rule) escalation(field, value string) (severity, []*sink, error) {
+	sev, err := parseSeverity(value)
+	if err != nil {
+		return sev, nil, errors.Wrap(err, r.settingKey(field))
+	}
+	sinks := r.sinksFor(sev, nil)
+	if len(sinks) == 0 {
+		return sev, nil, errors.Errorf("%s: no sinks take %s alerts", r.settingKey(field), sev)
+	}
+	return sev, sinks, nil
+}
+
+// sinksFor returns the sinks that take alerts as severe as sev, out of the
+// candidates, or if there are none, the rule's sinks, or if it doesn't name
+// any, every sink.
+func (r *rule) sinksFor(sev severity, candidates []*sink) []*sink {
+	if candidates == nil {
+		candidates = r.sinks
+		if len(r.Sinks) == 0 && r.WebhookURL == "" {
+			candidates = r.allSinks
+		}
+	}
+	sinks := []*sink{}
+	for _, s := range candidates {
+		if sev >= s.minSeverity {
+			sinks = append(sinks, s)
+		}
+	}
+	return sinks
+}
+
+// hasConditions reports whether the rule only matches certificates meeting
+// some conditions, besides naming matching domains.
+func (r *rule) hasConditions() bool {
+	return r.Filter != "" || len(r.Issuers) > 0 || len(r.ExcludeIssuers) > 0 || len(r.ChainsTo) > 0 || len(r.ExcludeChainsTo) > 0 || r.ValidityOver > 0 || r.ValidityUnder > 0 || r.Score != nil
+}
+
+// messageTemplate returns the template for the rule's messages to a sink,
+// or nil to use the sink's built-in message.
+func (r *rule) messageTemplate(s *sink) *template.Template {
+	if t := r.templates[s.name]; t != nil {
+		return t
+	}
+	if r.template != nil {
+		return r.template
+	}
+	return s.template
+}
+
+// description summarizes what the rule matches, for logs and alerts.
+func (r *rule) description() string {
+	parts := []string{}
+	if r.Pattern != "" {
+		parts = append(parts, r.Pattern)
+	}
+	if len(r.Keywords) > 0 {
+		parts = append(parts, "keywords "+strings.Join(r.Keywords, ", "))
+	}
+	if r.KeywordsFile != "" {
+		parts = append(parts, "keywords in "+r.KeywordsFile)
+	}
+	if len(r.Lookalikes) > 0 {
+		parts = append(parts, "lookalikes of "+strings.Join(r.Lookalikes, ", "))
+	}
+	if len(r.Plugin) > 0 {
+		parts = append(parts, "plugin "+strings.Join(r.Plugin, " "))
+	}
+	if r.Script != "" {
+		parts = append(parts, "script "+r.Script)
+	}
+	if r.OPABundle != "" {
+		parts = append(parts, "policy "+r.OPABundle)
+	}
+	if len(r.Zones) > 0 {
+		parts = append(parts, "unexpected certificates for "+strings.Join(r.Zones, ", "))
+	}
+	if len(r.CAADomains) > 0 {
+		parts = append(parts, "CAA violations for "+strings.Join(r.CAADomains, ", "))
+	}
+	description := strings.Join(parts, " or ")
+	conditions := []string{}
+	if len(r.Issuers) > 0 {
+		conditions = append(conditions, "issued by "+issuerNames(r.Issuers))
+	}
+	if len(r.ExcludeIssuers) > 0 {
+		conditions = append(conditions, "not issued by "+issuerNames(r.ExcludeIssuers))
+	}
+	if len(r.ChainsTo) > 0 {
+		conditions = append(conditions, "chaining to "+issuerNames(r.ChainsTo))
+	}
+	if len(r.ExcludeChainsTo) > 0 {
+		conditions = append(conditions, "not chaining to "+issuerNames(r.ExcludeChainsTo))
+	}
+	validity := []string{}
+	if r.ValidityOver > 0 {
+		validity = append(validity, "over "+formatValidity(r.ValidityOver))
+	}
+	if r.ValidityUnder > 0 {
+		validity = append(validity, "under "+formatValidity(r.ValidityUnder))
+	}
+	if len(validity) > 0 {
+		conditions = append(conditions, "valid for "+strings.Join(validity, " or "))
+	}
+	if r.Filter != "" {
+		conditions = append(conditions, r.Filter)
+	}
+	if r.Score != nil {
+		conditions = append(conditions, fmt.Sprintf("scoring at least %d", r.Score.Threshold))
+	}
+	if len(conditions) > 0 {
+		if description == "" {
+			description = "any domain"
+		}
+		description += " where " + strings.Join(conditions, " and ")
+	}
+	return description
+}
+
+// settingKey returns the environment variable that set the named field, or
+// else the field's key in the config.
+func (r *rule) settingKey(field string) string {
+	if env, ok := r.envKeys[field]; ok {
+		return env
+	}
+	return r.key + "." + field
+}
+
+// setFromEnv records that an environment variable set the named field.
+func (r *rule) setFromEnv(field, env string) {
+	if r.envKeys == nil {
+		r.envKeys = map[string]string{}
+	}
+	r.envKeys[field] = env
+}
+
+// readRulesFile parses a YAML list of rules from path.
+func readRulesFile(path string) ([]*rule, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read RULES_FILE")
+	}
+	rules := []*rule{}
+	if err := yaml.UnmarshalStrict(data, &rules); err != nil {
+		return nil, errors.Wrapf(err, "could not parse %s", path)
+	}
+	for i, r := range rules {
+		r.key = fmt.Sprintf("%s: [%d]", path, i)
+	}
+	return rules, nil
+}
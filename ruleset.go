@@ -0,0 +1,336 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/heptiolabs/certstream-slack/pkg/match"
+	"github.com/heptiolabs/certstream-slack/pkg/stream"
+)
+
+// ruleSet matches domains against every rule at once.
+type ruleSet struct {
+	rules []*rule
+	set   *match.Set
+}
+
+// newRuleSet combines compiled rules.
+func newRuleSet(rules []*rule) *ruleSet {
+	matchers := []*match.Rule{}
+	for _, r := range rules {
+		matchers = append(matchers, &r.matcher)
+	}
+	return &ruleSet{rules: rules, set: match.NewSet(matchers)}
+}
+
+// match returns the rules matching domain, in the order they're configured.
+// A rule matches if its pattern, one of its keywords, or one of its
+// lookalikes matches, unless its exclude pattern does too.
+func (s *ruleSet) match(domain string) []match.Hit {
+	return s.set.Match(domain)
+}
+
+// ruleMatch is the set of domains in a certificate matching a single rule,
+// with the severity and sinks to alert, which are the rule's unless its
+// plugin routes them elsewhere.
+type ruleMatch struct {
+	rule     *rule
+	domains  []string
+	reasons  map[string]string // why domains matched, if known
+	score    int               // the highest score, if the rule scores domains
+	severity severity
+	sinks    []*sink
+}
+
+// matchCertificate returns the domains matching each rule, for the rules
+// that match any, asking rules with plugins, scripts, policies, zones, or CAA checks
+// about the certificate's data and dropping the matches of rules whose
+// conditions (issuers, validity, filters, and scores) it doesn't satisfy.
+func (s *ruleSet) matchCertificate(domains []string, u *stream.CertificateUpdate) []ruleMatch {
+	byRule := make([]ruleMatch, len(s.rules))
+	add := func(i int, domain, reason string) {
+		m := &byRule[i]
+		m.domains = append(m.domains, domain)
+		if reason != "" {
+			if m.reasons == nil {
+				m.reasons = map[string]string{}
+			}
+			m.reasons[domain] = reason
+		}
+	}
+	for _, domain := range domains {
+		for _, hit := range s.match(domain) {
+			add(hit.Rule, domain, hit.Reason)
+		}
+	}
+
+	for i, r := range s.rules {
+		decide := pluginMatch
+		switch {
+		case r.script != nil:
+			decide = scriptMatch
+		case r.opa != nil:
+			decide = opaMatch
+		case r.zones != nil:
+			decide = zoneMatch
+		case r.caa != nil:
+			decide = caaMatch
+		case r.plugin == nil:
+			continue
+		}
+		if len(domains) == 0 {
+			continue
+		}
+		found, route, err := decide(r, domains, u)
+		if err != nil {
+			log.WithError(err).WithField("rule", r.Name).Error("could not match certificate")
+			continue
+		}
+		if len(found) > 0 && route.sinks != nil {
+			// the decision's own route, in place of the rule's or its
+			// wildcard escalation
+			byRule[i].severity, byRule[i].sinks = route.severity, route.sinks
+		}
+		for _, f := range found {
+			already := false
+			for _, domain := range byRule[i].domains {
+				already = already || domain == f.Domain
+			}
+			if !already {
+				add(i, f.Domain, f.Reason)
+			}
+		}
+	}
+
+	// without an update, as for the sample domains validate checks, the
+	// conditions see an empty certificate
+	update := u
+	if update == nil {
+		update = &stream.CertificateUpdate{}
+	}
+	leaf := &update.LeafCert
+	var vars map[string]interface{}
+	var cas []stream.Name
+	for i, r := range s.rules {
+		conditionsOnly := r.matcher.Pattern == nil && r.matcher.Keywords == nil && r.matcher.Lookalikes == nil && r.plugin == nil && r.script == nil && r.opa == nil && r.zones == nil && r.caa == nil
+		if !r.hasConditions() || (len(byRule[i].domains) == 0 && !conditionsOnly) {
+			continue
+		}
+		if !r.issuerAllowed(leaf.Issuer) {
+			byRule[i] = ruleMatch{}
+			continue
+		}
+		if len(r.ChainsTo) > 0 || len(r.ExcludeChainsTo) > 0 {
+			if cas == nil {
+				cas = chainCAs(update)
+			}
+			if !r.chainAllowed(cas) {
+				byRule[i] = ruleMatch{}
+				continue
+			}
+		}
+		validity, ok := r.validityAllowed(leaf)
+		if !ok {
+			byRule[i] = ruleMatch{}
+			continue
+		}
+		if r.filter != nil {
+			if vars == nil {
+				vars = filterVars(domains, u)
+			}
+			ok, err := r.filter.EvalBool(vars)
+			if err != nil {
+				log.WithError(err).WithField("rule", r.Name).Warn("could not evaluate filter")
+			}
+			if !ok {
+				byRule[i] = ruleMatch{}
+				continue
+			}
+		}
+		if conditionsOnly {
+			for _, domain := range domains {
+				if r.matcher.Exclude == nil || !r.matcher.Exclude.MatchString(domain) {
+					add(i, domain, "")
+				}
+			}
+		}
+		if validity != "" {
+			for _, domain := range byRule[i].domains {
+				addReason(&byRule[i], domain, validity)
+			}
+		}
+		if r.scorer != nil {
+			scoreDomains(r, &byRule[i], leaf.Issuer.O)
+		}
+	}
+
+	matches := []ruleMatch{}
+	for i, m := range byRule {
+		if len(m.domains) > 0 {
+			m.rule = s.rules[i]
+			if m.sinks == nil {
+				m.severity, m.sinks = m.rule.severity, m.rule.sinks
+				if m.rule.wildcardSinks != nil && flagWildcards(&m) {
+					m.severity, m.sinks = m.rule.wildcardSeverity, m.rule.wildcardSinks
+				}
+			}
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+// pluginMatch asks a rule's plugin which of a certificate's domains match,
+// sending a request like {"type": "match", "rule": "phishing", "domains":
+// [...], "data": {...}}, where data is the certstream message's data. The
+// plugin responds with a decision, like {"matches": [{"domain":
+// "login.example.com", "reason": "on our blocklist"}]}.
+func pluginMatch(r *rule, domains []string, u *stream.CertificateUpdate) ([]foundDomain, alertRoute, error) {
+	request := map[string]interface{}{"type": "match", "rule": r.Name, "domains": domains, "data": u}
+	var response matchDecision
+	if err := r.plugin.call(request, &response); err != nil {
+		return nil, alertRoute{}, err
+	}
+	found, route, err := response.apply(r, domains)
+	return found, route, errors.Wrap(err, "plugin responded with an invalid decision")
+}
+
+// matchDecision is a plugin or policy's decision on which of a certificate's
+// domains match a rule and, optionally, why. It can also set the severity
+// of the alert and the sinks to send it to, by name, in place of the rule's.
+type matchDecision struct {
+	Matches  []foundDomain `json:"matches"`
+	Severity string        `json:"severity"`
+	Sinks    []string      `json:"sinks"`
+}
+
+// foundDomain is a domain a decision says matches its rule.
+type foundDomain struct {
+	Domain string `json:"domain"`
+	Reason string `json:"reason"`
+}
+
+// UnmarshalJSON also accepts a domain on its own, without a reason.
+func (f *foundDomain) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &f.Domain); err == nil {
+		return nil
+	}
+	type plain foundDomain
+	return json.Unmarshal(data, (*plain)(f))
+}
+
+// alertRoute is where a decision says to send an alert, or if its sinks are
+// nil, that the alert goes where the rule sends it.
+type alertRoute struct {
+	severity severity
+	sinks    []*sink
+}
+
+// apply returns the matching domains and where to send the alert. Domains
+// that weren't asked about, or that the rule's exclude pattern matches, are
+// ignored, and only the sinks taking alerts as severe as the alert's are
+// alerted: those the decision names, or the rule's, or if it doesn't name
+// any, every sink, like an escalation.
+func (d *matchDecision) apply(r *rule, domains []string) ([]foundDomain, alertRoute, error) {
+	route := alertRoute{severity: r.severity}
+	asked := map[string]bool{}
+	for _, domain := range domains {
+		asked[domain] = true
+	}
+	found := []foundDomain{}
+	for _, f := range d.Matches {
+		f.Domain = strings.TrimSpace(f.Domain)
+		if asked[f.Domain] && (r.matcher.Exclude == nil || !r.matcher.Exclude.MatchString(f.Domain)) {
+			found = append(found, f)
+		}
+	}
+	if d.Severity == "" && d.Sinks == nil {
+		return found, alertRoute{}, nil
+	}
+
+	if d.Severity != "" {
+		sev, err := parseSeverity(d.Severity)
+		if err != nil {
+			return nil, route, errors.Wrap(err, "invalid severity")
+		}
+		route.severity = sev
+	}
+	var candidates []*sink
+	for _, name := range d.Sinks {
+		s := r.sinksByName[name]
+		if s == nil {
+			return nil, route, errors.Errorf("unknown sink %q", name)
+		}
+		candidates = append(candidates, s)
+	}
+	if d.Sinks != nil && candidates == nil {
+		// an empty list of sinks alerts none of them
+		candidates = []*sink{}
+	}
+	route.sinks = r.sinksFor(route.severity, candidates)
+	return found, route, nil
+}
+
+// flagWildcards notes that the wildcard domains in a match are wildcards,
+// returning whether there are any.
+func flagWildcards(m *ruleMatch) bool {
+	found := false
+	for _, domain := range m.domains {
+		if !strings.HasPrefix(domain, "*.") {
+			continue
+		}
+		found = true
+		addReason(m, domain, "wildcard")
+	}
+	return found
+}
+
+// addReason adds to why a domain matched.
+func addReason(m *ruleMatch, domain, reason string) {
+	if m.reasons == nil {
+		m.reasons = map[string]string{}
+	}
+	if m.reasons[domain] != "" {
+		reason = m.reasons[domain] + ", " + reason
+	}
+	m.reasons[domain] = reason
+}
+
+// filterVariables are the variables rules' filters can refer to: cert, the
+// certificate as certstream describes it (with its subject, issuer,
+// extensions, not_before, not_after, serial_number, fingerprint, and
+// all_domains), data, the rest of the certstream message (like
+// update_type, chain, seen, and source), and domains, the certificate's
+// domains as they're matched.
+var filterVariables = []string{"cert", "data", "domains"}
+
+// filterVars sets the filterVariables for a certificate, decoding its
+// update into generic values the first time a filter needs them.
+func filterVars(domains []string, u *stream.CertificateUpdate) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if u != nil {
+		fields = u.Fields()
+	}
+	cert, _ := fields["leaf_cert"].(map[string]interface{})
+	if cert == nil {
+		cert = map[string]interface{}{}
+	}
+	return map[string]interface{}{"cert": cert, "data": fields, "domains": domains}
+}
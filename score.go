@@ -0,0 +1,166 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/heptiolabs/certstream-slack/pkg/match"
+)
+
+// scoring configures a rule to score how likely the domains it matches are
+// to be phishing (see match.Scorer), alerting on those scoring at least
+// Threshold.
+type scoring struct {
+	// Threshold is the lowest score that alerts, 65 by default
+	Threshold int `yaml:"threshold"`
+
+	// Keywords are weighted substrings, like {login: 25}, in place of
+	// defaultScoreKeywords
+	Keywords map[string]int `yaml:"keywords"`
+
+	// SuspiciousTLDs replace defaultSuspiciousTLDs, and FreeCAs replace
+	// defaultFreeCAs
+	SuspiciousTLDs []string `yaml:"suspicious_tlds"`
+	FreeCAs        []string `yaml:"free_cas"`
+
+	// Protected are domains, like "example.com", whose names shouldn't be
+	// imitated. The rule's lookalikes are protected too.
+	Protected []string `yaml:"protected"`
+
+	// Weights override defaultScoreWeights for "entropy", "suspicious_tld",
+	// "nesting", "free_ca", and "lookalike"
+	Weights map[string]int `yaml:"weights"`
+}
+
+// defaultScoreKeywords are the words phishing domains commonly use to look
+// legitimate.
+var defaultScoreKeywords = map[string]int{
+	"login": 25, "log-in": 25, "signin": 25, "sign-in": 25, "logon": 25,
+	"account": 25, "verify": 25, "verification": 25, "authenticate": 25,
+	"password": 25, "wallet": 25, "recover": 20, "unlock": 20,
+	"secure": 10, "security": 10, "support": 10, "update": 10,
+	"confirm": 10, "billing": 10, "invoice": 10, "webscr": 20,
+	"appleid": 40, "icloud": 40, "paypal": 40, "office365": 40,
+	"outlook": 30, "microsoft": 30, "amazon": 30, "netflix": 30,
+}
+
+// defaultSuspiciousTLDs are public suffixes that are cheap or free to
+// register and popular with phishing.
+var defaultSuspiciousTLDs = []string{
+	"tk", "ml", "ga", "cf", "gq", "xyz", "top", "pw", "cc", "club", "work",
+	"support", "online", "site", "icu", "live", "click", "link", "info",
+	"buzz", "rest", "fit", "cyou", "monster", "loan", "win", "stream",
+}
+
+// defaultFreeCAs are the CAs issuing certificates for free and
+// automatically.
+var defaultFreeCAs = []string{"Let's Encrypt", "ZeroSSL", "Buypass AS-983163327"}
+
+var defaultScoreWeights = match.ScoreWeights{
+	Entropy:       10,
+	SuspiciousTLD: 20,
+	Nesting:       3,
+	FreeCA:        10,
+	Lookalike:     70,
+}
+
+// compile builds the scorer, protecting lookalikes as well as Protected.
+func (s *scoring) compile(lookalikes []string) (*match.Scorer, error) {
+	if s.Threshold < 0 {
+		return nil, errors.New("threshold: must not be negative")
+	}
+	if s.Threshold == 0 {
+		s.Threshold = 65
+	}
+	scorer := &match.Scorer{
+		Keywords:       defaultScoreKeywords,
+		SuspiciousTLDs: defaultSuspiciousTLDs,
+		FreeCAs:        defaultFreeCAs,
+		Weights:        defaultScoreWeights,
+	}
+	if s.Keywords != nil {
+		scorer.Keywords = map[string]int{}
+		for keyword, weight := range s.Keywords {
+			keyword = strings.ToLower(strings.TrimSpace(keyword))
+			if keyword == "" {
+				return nil, errors.New("keywords: must not be empty")
+			}
+			scorer.Keywords[keyword] = weight
+		}
+	}
+	if s.SuspiciousTLDs != nil {
+		scorer.SuspiciousTLDs = nil
+		for _, tld := range s.SuspiciousTLDs {
+			scorer.SuspiciousTLDs = append(scorer.SuspiciousTLDs, strings.TrimPrefix(strings.ToLower(tld), "."))
+		}
+	}
+	if s.FreeCAs != nil {
+		scorer.FreeCAs = s.FreeCAs
+	}
+	for i, domain := range s.Protected {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if !strings.Contains(domain, ".") {
+			return nil, errors.Errorf("protected[%d]: %q is not a domain like \"example.com\"", i, s.Protected[i])
+		}
+		scorer.Protected = append(scorer.Protected, domain)
+	}
+	for _, domain := range lookalikes {
+		scorer.Protected = append(scorer.Protected, strings.ToLower(strings.TrimSpace(domain)))
+	}
+	for name, weight := range s.Weights {
+		switch name {
+		case "entropy":
+			scorer.Weights.Entropy = weight
+		case "suspicious_tld":
+			scorer.Weights.SuspiciousTLD = weight
+		case "nesting":
+			scorer.Weights.Nesting = weight
+		case "free_ca":
+			scorer.Weights.FreeCA = weight
+		case "lookalike":
+			scorer.Weights.Lookalike = weight
+		default:
+			return nil, errors.Errorf("weights: unknown signal %q", name)
+		}
+	}
+	return scorer, nil
+}
+
+// scoreDomains scores the domains matching a rule in a certificate from
+// issuerOrg, keeping those at or above the rule's threshold with their
+// scores noted, and recording the highest score.
+func scoreDomains(r *rule, m *ruleMatch, issuerOrg string) {
+	kept := []string{}
+	for _, domain := range m.domains {
+		score, contributions := r.scorer.Score(domain, issuerOrg)
+		if score < r.Score.Threshold {
+			if m.reasons != nil {
+				delete(m.reasons, domain)
+			}
+			continue
+		}
+		kept = append(kept, domain)
+		addReason(m, domain, fmt.Sprintf("score %d: %s", score, strings.Join(contributions, ", ")))
+		if score > m.score {
+			m.score = score
+		}
+	}
+	m.domains = kept
+}
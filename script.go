@@ -0,0 +1,313 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+
+	"github.com/heptiolabs/certstream-slack/pkg/stream"
+)
+
+// luaScript runs a rule's Lua script in the watcher, so bespoke matching
+// logic doesn't need a plugin process. The script defines a match function,
+// which is called with a request like a plugin's (see pluginMatch) as a
+// table and returns a decision like a plugin's response, or nil if nothing
+// matches. Calls share one interpreter, so a script's globals last between
+// them, until it fails to finish in time and the interpreter is replaced.
+//
+// Scripts run sandboxed, with Lua's base, string, table, and math libraries
+// but nothing that reads files, loads code, or starts processes. What they
+// can do besides is log with print, convert JSON with json.encode and
+// json.decode, and request URLs with http.get.
+type luaScript struct {
+	path    string
+	proto   *lua.FunctionProto
+	timeout time.Duration
+
+	mu    sync.Mutex
+	state *lua.LState
+}
+
+// newLuaScript compiles the script at path, so syntax errors are found
+// when the config loads.
+func newLuaScript(path string, timeout time.Duration) (*luaScript, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	chunk, err := parse.Parse(f, path)
+	if err != nil {
+		return nil, err
+	}
+	proto, err := lua.Compile(chunk, path)
+	if err != nil {
+		return nil, err
+	}
+	return &luaScript{path: path, proto: proto, timeout: timeout}, nil
+}
+
+// scriptMatch asks a rule's script which of a certificate's domains match,
+// with the same request and decision as a plugin's.
+func scriptMatch(r *rule, domains []string, u *stream.CertificateUpdate) ([]foundDomain, alertRoute, error) {
+	request := map[string]interface{}{"type": "match", "rule": r.Name, "domains": domains, "data": u}
+	var response matchDecision
+	if err := r.script.call(request, &response); err != nil {
+		return nil, alertRoute{}, err
+	}
+	found, route, err := response.apply(r, domains)
+	return found, route, errors.Wrap(err, "script returned an invalid decision")
+}
+
+// call passes request to the script's match function and decodes what it
+// returns into response.
+func (s *luaScript) call(request, response interface{}) error {
+	arg, err := plainJSON(request)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	if s.state == nil {
+		if err := s.start(ctx); err != nil {
+			return errors.Wrapf(err, "could not run script %s", s.path)
+		}
+	}
+	L := s.state
+	match, ok := L.GetGlobal("match").(*lua.LFunction)
+	if !ok {
+		return errors.Errorf("script %s doesn't define a match function", s.path)
+	}
+	L.SetContext(ctx)
+	err = L.CallByParam(lua.P{Fn: match, NRet: 1, Protect: true}, toLua(L, arg))
+	L.RemoveContext()
+	if ctx.Err() != nil {
+		s.stop()
+		return errors.Errorf("script %s didn't finish within %s", s.path, s.timeout)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "script %s", s.path)
+	}
+	result := L.Get(-1)
+	L.Pop(1)
+	if result == lua.LNil {
+		result = L.NewTable()
+	}
+	data, err := json.Marshal(fromLua(result))
+	if err != nil {
+		return errors.Wrapf(err, "invalid result from script %s", s.path)
+	}
+	return errors.Wrapf(json.Unmarshal(data, response), "invalid result from script %s", s.path)
+}
+
+// start creates the sandboxed interpreter and runs the script, which
+// defines its functions.
+func (s *luaScript) start(ctx context.Context) error {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true, CallStackSize: 200, RegistrySize: 1024, RegistryMaxSize: 1024 * 1024})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring", "require", "module", "getfenv", "setfenv", "newproxy", "_printregs"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+	L.SetGlobal("print", L.NewFunction(s.print))
+	L.SetGlobal("json", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{"encode": luaJSONEncode, "decode": luaJSONDecode}))
+	L.SetGlobal("http", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{"get": luaHTTPGet}))
+
+	L.SetContext(ctx)
+	err := L.CallByParam(lua.P{Fn: L.NewFunctionFromProto(s.proto), Protect: true})
+	L.RemoveContext()
+	if err != nil {
+		L.Close()
+		return err
+	}
+	s.state = L
+	return nil
+}
+
+func (s *luaScript) stop() {
+	if s.state != nil {
+		s.state.Close()
+		s.state = nil
+	}
+}
+
+// close lets go of the script's interpreter.
+func (s *luaScript) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stop()
+	return nil
+}
+
+// print logs its arguments, separated by spaces.
+func (s *luaScript) print(L *lua.LState) int {
+	parts := []string{}
+	for i := 1; i <= L.GetTop(); i++ {
+		parts = append(parts, L.ToStringMeta(L.Get(i)).String())
+	}
+	log.WithField("script", s.path).Info(strings.Join(parts, " "))
+	return 0
+}
+
+// luaJSONEncode is json.encode(value), which returns value as JSON.
+func luaJSONEncode(L *lua.LState) int {
+	data, err := json.Marshal(fromLua(L.CheckAny(1)))
+	if err != nil {
+		L.RaiseError("%s", err)
+	}
+	L.Push(lua.LString(data))
+	return 1
+}
+
+// luaJSONDecode is json.decode(text), which returns the value text
+// encodes.
+func luaJSONDecode(L *lua.LState) int {
+	var v interface{}
+	if err := json.Unmarshal([]byte(L.CheckString(1)), &v); err != nil {
+		L.RaiseError("%s", err)
+	}
+	L.Push(toLua(L, v))
+	return 1
+}
+
+// luaHTTPGet is http.get(url, [headers]), which requests url with the
+// headers in the table, if any. It returns the response's body (up to 1
+// MiB) and status code, or nil and why the request failed. Requests are
+// cut short when the script runs out of time.
+func luaHTTPGet(L *lua.LState) int {
+	req, err := http.NewRequest("GET", L.CheckString(1), nil)
+	if err != nil {
+		L.ArgError(1, err.Error())
+	}
+	if headers := L.OptTable(2, nil); headers != nil {
+		headers.ForEach(func(k, v lua.LValue) {
+			req.Header.Set(k.String(), v.String())
+		})
+	}
+	if ctx := L.Context(); ctx != nil {
+		req = req.WithContext(ctx)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(lua.LString(body))
+	L.Push(lua.LNumber(resp.StatusCode))
+	return 2
+}
+
+// plainJSON converts v to the plain values, maps, and slices that encoding
+// it as JSON and decoding it again would give.
+func plainJSON(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var plain interface{}
+	return plain, json.Unmarshal(data, &plain)
+}
+
+// toLua converts a value decoded from JSON to Lua: objects to tables,
+// arrays to sequences, and null to nil.
+func toLua(L *lua.LState, v interface{}) lua.LValue {
+	switch v := v.(type) {
+	case bool:
+		return lua.LBool(v)
+	case float64:
+		return lua.LNumber(v)
+	case string:
+		return lua.LString(v)
+	case []interface{}:
+		t := L.CreateTable(len(v), 0)
+		for _, item := range v {
+			t.Append(toLua(L, item))
+		}
+		return t
+	case map[string]interface{}:
+		t := L.CreateTable(0, len(v))
+		for key, item := range v {
+			t.RawSetString(key, toLua(L, item))
+		}
+		return t
+	}
+	return lua.LNil
+}
+
+// fromLua converts a Lua value for encoding as JSON: sequences (including
+// empty tables) to arrays, other tables to objects, and anything that
+// can't be encoded, like a function, to null.
+func fromLua(v lua.LValue) interface{} {
+	switch v := v.(type) {
+	case lua.LBool:
+		return bool(v)
+	case lua.LNumber:
+		return float64(v)
+	case lua.LString:
+		return string(v)
+	case *lua.LTable:
+		n := v.MaxN()
+		keys := 0
+		v.ForEach(func(lua.LValue, lua.LValue) { keys++ })
+		if keys == n {
+			items := make([]interface{}, 0, n)
+			for i := 1; i <= n; i++ {
+				items = append(items, fromLua(v.RawGetInt(i)))
+			}
+			return items
+		}
+		fields := map[string]interface{}{}
+		v.ForEach(func(key, value lua.LValue) {
+			fields[key.String()] = fromLua(value)
+		})
+		return fields
+	}
+	return nil
+}
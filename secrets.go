@@ -0,0 +1,421 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// secretEnvs are the environment variables holding secrets, which can be
+// read instead from the file named by the variable with _FILE added, like
+// SLACK_WEBHOOK_URL_FILE for a mounted Kubernetes secret. So can
+// SLACK_WEBHOOK_URL_<NAME>.
+var secretEnvs = []string{
+	"CERTSTREAM_URL", "CERTSTREAM_HEADERS", "CERTSPOTTER_TOKEN",
+	"DASHBOARD_PASSWORD", "OTEL_EXPORTER_OTLP_HEADERS", "SLACK_SIGNING_SECRET",
+	"SLACK_WEBHOOK_URL", "SLACK_TOKEN", "DISCORD_WEBHOOK_URL", "TEAMS_WEBHOOK_URL",
+	"GENERIC_WEBHOOK_URL", "GENERIC_WEBHOOK_HEADERS",
+	"PAGERDUTY_ROUTING_KEY", "OPSGENIE_API_KEY", "TELEGRAM_BOT_TOKEN",
+	"VAULT_TOKEN",
+}
+
+// secretFilesLoaded are the variables set from _FILE variables, which are
+// read again on reload so that a rotated secret is picked up.
+var secretFilesLoaded = map[string]bool{}
+
+// loadSecretFiles sets each secret variable with a _FILE variable to the
+// file's contents, unless the variable was set some other way.
+func loadSecretFiles() error {
+	names := append([]string{}, secretEnvs...)
+	for _, kv := range os.Environ() {
+		name := strings.SplitN(kv, "=", 2)[0]
+		if strings.HasPrefix(name, "SLACK_WEBHOOK_URL_") && strings.HasSuffix(name, "_FILE") && name != "SLACK_WEBHOOK_URL_FILE" {
+			names = append(names, strings.TrimSuffix(name, "_FILE"))
+		}
+	}
+	for _, name := range names {
+		path := os.Getenv(name + "_FILE")
+		if path == "" || (os.Getenv(name) != "" && !secretFilesLoaded[name]) {
+			continue
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrap(err, name+"_FILE")
+		}
+		os.Setenv(name, strings.TrimRight(string(data), "\r\n"))
+		secretFilesLoaded[name] = true
+	}
+	return nil
+}
+
+// secretResolver replaces references to secrets held elsewhere with the
+// secrets, looking each up once:
+//
+//   - "file:PATH" is the contents of a file, without a trailing newline.
+//   - "vault:PATH#FIELD" is a field of a HashiCorp Vault secret, like
+//     "vault:secret/data/certstream-slack#slack_webhook_url", read from
+//     VAULT_ADDR with VAULT_TOKEN, or logging in with the pod's service
+//     account as VAULT_KUBERNETES_ROLE.
+//   - "aws-sm:ID" is an AWS Secrets Manager secret, by name or ARN, and
+//     "aws-sm:ID#FIELD" a field of one holding JSON.
+//   - "aws-ssm:NAME" is an AWS Systems Manager parameter, decrypted if it's
+//     a SecureString.
+type secretResolver struct {
+	secrets    map[string]string
+	vaultToken string
+}
+
+// secretPrefixes are the prefixes of references to secrets.
+var secretPrefixes = []string{"file:", "vault:", "aws-sm:", "aws-ssm:"}
+
+// resolveSecrets replaces references to secrets in the top-level settings,
+// rules' webhook URLs, and sinks' and enrichers' options.
+func (c *config) resolveSecrets() error {
+	r := &secretResolver{secrets: map[string]string{}}
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		key := strings.Split(v.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		if key == "" {
+			continue
+		}
+		if err := r.resolveField(key, v.Field(i)); err != nil {
+			return err
+		}
+	}
+	for _, rl := range c.Rules {
+		resolved, err := r.resolve(rl.WebhookURL)
+		if err != nil {
+			return errors.Wrapf(err, "%s.webhook_url", rl.key)
+		}
+		rl.WebhookURL = resolved
+	}
+	for _, s := range c.Sinks {
+		if err := r.resolveOptions(s.key, s.options); err != nil {
+			return err
+		}
+	}
+	for _, e := range c.Enrichers {
+		if err := r.resolveOptions(e.key, e.options); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveField resolves a string, list of strings, or map of strings.
+func (r *secretResolver) resolveField(key string, v reflect.Value) error {
+	switch {
+	case v.Kind() == reflect.String:
+		resolved, err := r.resolve(v.String())
+		if err != nil {
+			return errors.Wrap(err, key)
+		}
+		v.SetString(resolved)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		for i := 0; i < v.Len(); i++ {
+			if err := r.resolveField(fmt.Sprintf("%s[%d]", key, i), v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case v.Kind() == reflect.Map && v.Type().Elem().Kind() == reflect.String:
+		for _, k := range v.MapKeys() {
+			resolved, err := r.resolve(v.MapIndex(k).String())
+			if err != nil {
+				return errors.Wrapf(err, "%s.%v", key, k)
+			}
+			v.SetMapIndex(k, reflect.ValueOf(resolved).Convert(v.Type().Elem()))
+		}
+	}
+	return nil
+}
+
+// resolveOptions resolves the strings in a sink's or enricher's options,
+// including within lists and nested maps.
+func (r *secretResolver) resolveOptions(key string, options map[string]interface{}) error {
+	for name, value := range options {
+		resolved, err := r.resolveOption(key+"."+name, value)
+		if err != nil {
+			return err
+		}
+		options[name] = resolved
+	}
+	return nil
+}
+
+func (r *secretResolver) resolveOption(key string, value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case string:
+		resolved, err := r.resolve(value)
+		return resolved, errors.Wrap(err, key)
+	case []interface{}:
+		for i, item := range value {
+			resolved, err := r.resolveOption(fmt.Sprintf("%s[%d]", key, i), item)
+			if err != nil {
+				return nil, err
+			}
+			value[i] = resolved
+		}
+	case map[interface{}]interface{}:
+		for k, item := range value {
+			resolved, err := r.resolveOption(fmt.Sprintf("%s.%v", key, k), item)
+			if err != nil {
+				return nil, err
+			}
+			value[k] = resolved
+		}
+	}
+	return value, nil
+}
+
+// resolve returns the secret value refers to, or value itself if it isn't
+// a reference.
+func (r *secretResolver) resolve(value string) (string, error) {
+	prefix := ""
+	for _, p := range secretPrefixes {
+		if strings.HasPrefix(value, p) {
+			prefix = p
+		}
+	}
+	if prefix == "" {
+		return value, nil
+	}
+	if secret, ok := r.secrets[value]; ok {
+		return secret, nil
+	}
+	ref := strings.TrimPrefix(value, prefix)
+	var secret string
+	var err error
+	switch prefix {
+	case "file:":
+		var data []byte
+		data, err = ioutil.ReadFile(ref)
+		secret = strings.TrimRight(string(data), "\r\n")
+	case "vault:":
+		secret, err = r.vault(ref)
+	case "aws-sm:":
+		secret, err = awsSecretsManagerSecret(ref)
+	case "aws-ssm:":
+		secret, err = awsSSMParameter(ref)
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "could not read secret %s", value)
+	}
+	r.secrets[value] = secret
+	return secret, nil
+}
+
+// splitSecretField splits a reference like "path#field".
+func splitSecretField(ref string) (string, string) {
+	if i := strings.LastIndex(ref, "#"); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
+
+// secretField returns a field of a secret holding several, which needn't
+// be named if there's only one.
+func secretField(fields map[string]interface{}, field string) (string, error) {
+	if field == "" {
+		if len(fields) != 1 {
+			return "", errors.Errorf("the secret has %d fields, so name one with #FIELD", len(fields))
+		}
+		for name := range fields {
+			field = name
+		}
+	}
+	value, ok := fields[field].(string)
+	if !ok {
+		return "", errors.Errorf("the secret has no string field %q", field)
+	}
+	return value, nil
+}
+
+// vault reads a field of a Vault secret, unwrapping a KV version 2
+// secret's data.
+func (r *secretResolver) vault(ref string) (string, error) {
+	path, field := splitSecretField(ref)
+	addr := strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/")
+	if addr == "" {
+		return "", errors.New("VAULT_ADDR must be set")
+	}
+	if err := r.vaultLogin(addr); err != nil {
+		return "", err
+	}
+	var result struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := vaultRequest("GET", addr+"/v1/"+strings.TrimPrefix(path, "/"), r.vaultToken, nil, &result); err != nil {
+		return "", err
+	}
+	fields := result.Data
+	if data, ok := fields["data"].(map[string]interface{}); ok && fields["metadata"] != nil {
+		fields = data
+	}
+	return secretField(fields, field)
+}
+
+// vaultKubernetesToken is where Kubernetes mounts the pod's service account
+// token.
+const vaultKubernetesToken = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// vaultLogin finds a Vault token, logging in with the Kubernetes auth
+// method if there's a role but no token.
+func (r *secretResolver) vaultLogin(addr string) error {
+	if r.vaultToken != "" {
+		return nil
+	}
+	if r.vaultToken = os.Getenv("VAULT_TOKEN"); r.vaultToken != "" {
+		return nil
+	}
+	role := os.Getenv("VAULT_KUBERNETES_ROLE")
+	if role == "" {
+		return errors.New("VAULT_TOKEN or VAULT_KUBERNETES_ROLE must be set")
+	}
+	jwt, err := ioutil.ReadFile(vaultKubernetesToken)
+	if err != nil {
+		return errors.Wrap(err, "could not read the service account token")
+	}
+	body, _ := json.Marshal(map[string]string{"role": role, "jwt": strings.TrimSpace(string(jwt))})
+	var result struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if err := vaultRequest("POST", addr+"/v1/auth/kubernetes/login", "", body, &result); err != nil {
+		return errors.Wrap(err, "could not log in to Vault")
+	}
+	if result.Auth.ClientToken == "" {
+		return errors.New("logging in to Vault returned no token")
+	}
+	r.vaultToken = result.Auth.ClientToken
+	return nil
+}
+
+// vaultRequest makes a Vault API request, in VAULT_NAMESPACE if it's set,
+// decoding the response into result.
+func vaultRequest(method, url, token string, body []byte, result interface{}) error {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := readResponse(resp)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, result)
+}
+
+// awsSecretsManagerSecret reads a Secrets Manager secret, or a field of a
+// secret holding JSON.
+func awsSecretsManagerSecret(ref string) (string, error) {
+	id, field := splitSecretField(ref)
+	region, err := awsSecretRegion(id)
+	if err != nil {
+		return "", err
+	}
+	body, _ := json.Marshal(map[string]string{"SecretId": id})
+	data, err := awsRequest("secretsmanager", region, awsSecretEndpoint("secretsmanager", "SECRETS_MANAGER", region), map[string]string{
+		"Content-Type": "application/x-amz-json-1.1",
+		"X-Amz-Target": "secretsmanager.GetSecretValue",
+	}, body)
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		SecretString string
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return "", err
+	}
+	if field == "" {
+		return result.SecretString, nil
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(result.SecretString), &fields); err != nil {
+		return "", errors.Wrap(err, "the secret isn't JSON")
+	}
+	return secretField(fields, field)
+}
+
+// awsSSMParameter reads a Systems Manager parameter.
+func awsSSMParameter(name string) (string, error) {
+	region, err := awsSecretRegion(name)
+	if err != nil {
+		return "", err
+	}
+	body, _ := json.Marshal(map[string]interface{}{"Name": name, "WithDecryption": true})
+	data, err := awsRequest("ssm", region, awsSecretEndpoint("ssm", "SSM", region), map[string]string{
+		"Content-Type": "application/x-amz-json-1.1",
+		"X-Amz-Target": "AmazonSSM.GetParameter",
+	}, body)
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		Parameter struct {
+			Value string
+		}
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return "", err
+	}
+	return result.Parameter.Value, nil
+}
+
+// awsSecretRegion returns the region in an ARN, or else the region from
+// the environment.
+func awsSecretRegion(id string) (string, error) {
+	if parts := strings.Split(id, ":"); len(parts) > 3 && parts[0] == "arn" && parts[3] != "" {
+		return parts[3], nil
+	}
+	if region := awsRegionFromEnv(); region != "" {
+		return region, nil
+	}
+	return "", errors.New("AWS_REGION must be set unless the secret is named by its ARN")
+}
+
+// awsSecretEndpoint returns a service's regional endpoint, or the endpoint
+// that AWS_ENDPOINT_URL_<SERVICE> or AWS_ENDPOINT_URL sets, as for the AWS
+// SDKs.
+func awsSecretEndpoint(service, envName, region string) string {
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL_" + envName); endpoint != "" {
+		return endpoint
+	}
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL"); endpoint != "" {
+		return endpoint
+	}
+	return fmt.Sprintf("https://%s.%s.amazonaws.com/", service, region)
+}
@@ -0,0 +1,278 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/heptiolabs/certstream-slack/pkg/stream"
+)
+
+// serve runs the source and serves what it delivers the way certstream-server
+// does, so that one process can tail the CT logs for any number of watchers
+// and other certstream clients.
+func serve(cfg *config) {
+	s := newSource(cfg)
+	server := newCertstreamServer()
+
+	if cfg.ListenAddr != "" {
+		go serveHTTP(cfg.ListenAddr, s, cfg.HealthTimeout, nil, newMatchFeed(), nil)
+	}
+	go func() {
+		log.WithField("addr", cfg.ServeAddr).Info("serving certstream")
+		err := http.ListenAndServe(cfg.ServeAddr, server)
+		log.WithError(err).Fatal("certstream server failed")
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.WithField("signal", sig.String()).Info("shutting down")
+		s.stop()
+	}()
+
+	err := s.run(server.broadcast)
+	server.close()
+	if err != nil {
+		log.WithError(err).Fatal("giving up on certificate source")
+	}
+	log.Info("shut down")
+}
+
+// certstreamServer serves certificate updates on certstream's three
+// streams: "/" (the lite stream), "/full-stream", and "/domains-only".
+type certstreamServer struct {
+	mu      sync.Mutex
+	clients map[*certstreamClient]bool
+	closed  bool
+
+	// connections counts the clients still being served, so that close
+	// can wait for them to be told the server is going away
+	connections sync.WaitGroup
+}
+
+// certstreamClient is a websocket connected to one of the streams.
+type certstreamClient struct {
+	mode string // as for stream_mode
+	send chan []byte
+}
+
+// certstreamClientBuffer is how many messages can wait for a slow client
+// before more are dropped, as certstream-server does.
+const certstreamClientBuffer = 1000
+
+// certstreamHeartbeat is how often clients are sent a heartbeat message,
+// which certstream clients expect when there's nothing else to send.
+const certstreamHeartbeat = 30 * time.Second
+
+func newCertstreamServer() *certstreamServer {
+	return &certstreamServer{clients: map[*certstreamClient]bool{}}
+}
+
+var certstreamUpgrader = websocket.Upgrader{
+	// the streams are read-only, so any page may connect to them
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+func (s *certstreamServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	mode := ""
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	for m, p := range streamPaths {
+		if path == p {
+			mode = m
+		}
+	}
+	if mode == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if !websocket.IsWebSocketUpgrade(r) {
+		http.Error(w, "this is a certstream websocket; connect to it with a certstream client", http.StatusBadRequest)
+		return
+	}
+	conn, err := certstreamUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already replied with an error
+		return
+	}
+	defer conn.Close()
+
+	c := &certstreamClient{mode: mode, send: make(chan []byte, certstreamClientBuffer)}
+	if !s.subscribe(c) {
+		return
+	}
+	defer s.connections.Done()
+	defer s.unsubscribe(c)
+	log.WithField("remote", r.RemoteAddr).WithField("stream", mode).Debug("certstream client connected")
+
+	// read (and ignore) messages so that a close from the client is noticed
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(certstreamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		var frame []byte
+		select {
+		case f, ok := <-c.send:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(time.Second))
+				return
+			}
+			frame = f
+		case now := <-heartbeat.C:
+			frame, _ = json.Marshal(map[string]interface{}{
+				"message_type": "heartbeat",
+				"timestamp":    float64(now.UnixNano()) / 1e9,
+			})
+		case <-closed:
+			log.WithField("remote", r.RemoteAddr).Debug("certstream client disconnected")
+			return
+		}
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if err := conn.WriteMessage(websocket.TextMessage, frame); err != nil {
+			return
+		}
+	}
+}
+
+// subscribe adds a client, unless the server is closed.
+func (s *certstreamServer) subscribe(c *certstreamClient) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.clients[c] = true
+	s.connections.Add(1)
+	serveClients.set(float64(len(s.clients)))
+	return true
+}
+
+func (s *certstreamServer) unsubscribe(c *certstreamClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.clients[c] {
+		delete(s.clients, c)
+		close(c.send)
+	}
+	serveClients.set(float64(len(s.clients)))
+}
+
+// broadcast sends a message to every client, in the form of its stream,
+// dropping it for clients that have fallen too far behind.
+func (s *certstreamServer) broadcast(msg *stream.Message) {
+	if msg.Data == nil {
+		return
+	}
+	certificatesSeen.inc()
+	frames := map[string][]byte{}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		frame, ok := frames[c.mode]
+		if !ok {
+			frame = encodeForStream(msg, c.mode)
+			frames[c.mode] = frame
+		}
+		if frame == nil {
+			continue
+		}
+		select {
+		case c.send <- frame:
+		default:
+			serveMessagesDropped.inc(c.mode)
+		}
+	}
+}
+
+// close disconnects every client, waiting briefly for them to be told.
+func (s *certstreamServer) close() {
+	s.mu.Lock()
+	s.closed = true
+	for c := range s.clients {
+		delete(s.clients, c)
+		close(c.send)
+	}
+	serveClients.set(0)
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.connections.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+	}
+}
+
+// encodeForStream encodes a message for the stream mode's stream, or returns
+// nil if it can't be: updates from the domains-only stream only have their
+// domains. The full stream has the update as it is, the lite stream drops
+// the certificates' DER and the chain, and the domains-only stream has just
+// the domains.
+func encodeForStream(msg *stream.Message, mode string) []byte {
+	u := msg.Data
+	var v interface{}
+	switch {
+	case mode == "domains-only":
+		v = map[string]interface{}{"message_type": "dns_entries", "data": u.LeafCert.AllDomains}
+	case u.DomainsOnly:
+		return nil
+	case mode == "full":
+		v = msg
+	default:
+		data := map[string]interface{}{}
+		for name, value := range u.Fields() {
+			data[name] = value
+		}
+		delete(data, "chain")
+		if leaf, ok := data["leaf_cert"].(map[string]interface{}); ok {
+			lite := map[string]interface{}{}
+			for name, value := range leaf {
+				lite[name] = value
+			}
+			delete(lite, "as_der")
+			data["leaf_cert"] = lite
+		}
+		v = map[string]interface{}{"message_type": "certificate_update", "data": data}
+	}
+	frame, err := json.Marshal(v)
+	if err != nil {
+		log.WithError(err).Warn("could not encode certificate update for certstream clients")
+		return nil
+	}
+	return frame
+}
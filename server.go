@@ -0,0 +1,140 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// serveHTTP serves the metrics and health endpoints and the feed of matches
+// on addr, along with the match history API if store isn't nil and the
+// Slack app's endpoints if app isn't. It never returns.
+func serveHTTP(addr string, s source, healthTimeout time.Duration, store *matchStore, feed *matchFeed, app *slackApp) {
+	started := time.Now()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", metricsHandler)
+
+	// /healthz fails once no message has arrived for healthTimeout, so that a
+	// liveness probe restarts a watcher whose connection has silently wedged
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		connected, lastMessage := s.status()
+		since := lastMessage
+		if since.IsZero() {
+			since = started
+		}
+		writeStatus(w, time.Since(since) <= healthTimeout, connected, lastMessage)
+	})
+
+	// /readyz fails whenever the source is disconnected
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		connected, lastMessage := s.status()
+		writeStatus(w, connected, connected, lastMessage)
+	})
+
+	if store != nil {
+		mux.HandleFunc("/matches", matchesHandler(store))
+	}
+	mux.Handle("/stream", feed)
+	if app != nil {
+		mux.HandleFunc("/slack/interactions", app.handleInteraction)
+		mux.HandleFunc("/slack/commands", app.handleCommand)
+	}
+
+	log.WithField("addr", addr).Info("serving HTTP")
+	err := http.ListenAndServe(addr, mux)
+	log.WithError(err).Fatal("HTTP server failed")
+}
+
+// writeStatus writes a JSON description of the stream state, with a 503
+// status code unless ok is true.
+func writeStatus(w http.ResponseWriter, ok, connected bool, lastMessage time.Time) {
+	status := struct {
+		OK          bool       `json:"ok"`
+		Connected   bool       `json:"connected"`
+		LastMessage *time.Time `json:"last_message,omitempty"`
+	}{OK: ok, Connected: connected}
+	if !lastMessage.IsZero() {
+		status.LastMessage = &lastMessage
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// matchesHandler serves recorded matches as JSON, newest first. The optional
+// query parameters are "since" (an RFC 3339 time, or a duration like "24h"
+// meaning that long ago), "rule", and "limit" (100 by default, and 0 for no
+// limit).
+func matchesHandler(store *matchStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "only GET is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+
+		var since time.Time
+		if v := q.Get("since"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				d, derr := time.ParseDuration(v)
+				if derr != nil {
+					http.Error(w, "since: must be an RFC 3339 time or a duration", http.StatusBadRequest)
+					return
+				}
+				t = time.Now().Add(-d)
+			}
+			since = t
+		}
+
+		limit := 100
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "limit: must be a non-negative integer", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		// stream the matches as they're read, rather than collecting them
+		// all first
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"matches":[`)
+		sep := ""
+		err := store.each(since, q.Get("rule"), limit, func(m *matchRecord) error {
+			data, err := json.Marshal(m)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(w, sep+string(data))
+			sep = ","
+			return err
+		})
+		if err != nil {
+			log.WithError(err).Error("could not list matches")
+		}
+		io.WriteString(w, "]}\n")
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// discordSink posts alerts to a Discord webhook as embeds.
+type discordSink struct {
+	URL string `yaml:"url"`
+}
+
+func init() {
+	registerSinkType("discord", func(decode func(interface{}) error) (notifier, error) {
+		s := &discordSink{}
+		if err := decode(s); err != nil {
+			return nil, err
+		}
+		if s.URL == "" {
+			return nil, errors.New("url: must be set")
+		}
+		return s, nil
+	})
+}
+
+// discordWebhookPath matches the path of a Discord webhook's URL.
+var discordWebhookPath = regexp.MustCompile(`^/api/webhooks/[0-9]+/[A-Za-z0-9_-]+$`)
+
+func (s *discordSink) check() error {
+	if err := checkURL(s.URL); err != nil {
+		return errors.Wrap(err, "url")
+	}
+	if u, _ := url.Parse(s.URL); (u.Host == "discord.com" || u.Host == "discordapp.com") && !discordWebhookPath.MatchString(u.Path) {
+		return errors.New("url: doesn't look like a webhook URL (https://discord.com/api/webhooks/<id>/<token>)")
+	}
+	return nil
+}
+
+func (s *discordSink) Notify(a *alert) error {
+	type field struct {
+		Name   string `json:"name"`
+		Value  string `json:"value"`
+		Inline bool   `json:"inline,omitempty"`
+	}
+	type embed struct {
+		Title       string  `json:"title"`
+		URL         string  `json:"url,omitempty"`
+		Description string  `json:"description"`
+		Color       int     `json:"color"`
+		Fields      []field `json:"fields"`
+	}
+
+	domains := []string{}
+	for _, domain := range a.Domains {
+		domains = append(domains, a.FormatDomain(domain))
+	}
+	description := strings.Join(domains, "\n")
+	if a.OtherDomains > 0 {
+		description += fmt.Sprintf("\nand %d others", a.OtherDomains)
+	}
+	payload := struct {
+		Content string  `json:"content"`
+		Embeds  []embed `json:"embeds"`
+	}{
+		Content: a.Severity.Symbol() + " Found matching certificate",
+		Embeds: []embed{{
+			Title:       "View on crt.sh",
+			URL:         a.CertURL,
+			Description: description,
+			Color:       a.Severity.Color(),
+			Fields: []field{
+				{Name: "Rule", Value: a.Rule, Inline: true},
+				{Name: "Severity", Value: a.Severity.String(), Inline: true},
+				{Name: "Issuer", Value: a.IssuerName(), Inline: true},
+				{Name: "Valid", Value: formatTime(a.NotBefore) + " to " + formatTime(a.NotAfter), Inline: true},
+				{Name: "Fingerprint", Value: "`" + a.Fingerprint + "`", Inline: true},
+			},
+		}},
+	}
+	if a.Message != "" {
+		// a templated message replaces the embed
+		payload.Content = truncate(a.Message, 2000)
+		payload.Embeds = nil
+	}
+	return errors.Wrap(postJSON(s.URL, nil, payload), "error sending Discord webhook")
+}
@@ -0,0 +1,343 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize/english"
+	"github.com/pkg/errors"
+)
+
+// elasticsearchMapping is the mapping of indexes created by the
+// elasticsearch sink. Domains and other identifiers are keywords, for exact
+// matches and aggregations, and the per-domain maps are stored but not
+// indexed so that they don't add a field for every domain.
+const elasticsearchMapping = `{
+  "mappings": {
+    "properties": {
+      "@timestamp":       {"type": "date"},
+      "matched_at":       {"type": "date"},
+      "rule":             {"type": "keyword"},
+      "pattern":          {"type": "keyword"},
+      "severity":         {"type": "keyword"},
+      "domains":          {"type": "keyword"},
+      "all_domains":      {"type": "keyword"},
+      "original_domains": {"type": "object", "enabled": false},
+      "reasons":          {"type": "object", "enabled": false},
+      "fingerprint":      {"type": "keyword"},
+      "cert_url":         {"type": "keyword", "index": false},
+      "issuer":           {"type": "keyword"},
+      "issuer_cn":        {"type": "keyword"},
+      "issuer_org":       {"type": "keyword"},
+      "serial":           {"type": "keyword"},
+      "not_before":       {"type": "date"},
+      "not_after":        {"type": "date"},
+      "log_name":         {"type": "keyword"},
+      "log_url":          {"type": "keyword"},
+      "cert_index":       {"type": "long"}
+    }
+  }
+}`
+
+// elasticsearchSink indexes alerts into an Elasticsearch or OpenSearch index
+// with the bulk API. Alerts are batched, and a batch that can't be indexed
+// is retried with backoff. While a batch is being sent, notify blocks once
+// the next batch fills, which slows the workers so that the message queue
+// absorbs the backlog.
+type elasticsearchSink struct {
+	// URL is the cluster's base URL, like "https://localhost:9200"
+	URL   string `yaml:"url"`
+	Index string `yaml:"index"`
+
+	// Username and Password use basic auth, or APIKey an API key
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	APIKey   string `yaml:"api_key"`
+
+	// BatchSize is the most alerts to send in one bulk request, and
+	// FlushInterval is the longest to hold an alert before sending it
+	BatchSize     int           `yaml:"batch_size"`
+	FlushInterval time.Duration `yaml:"flush_interval"`
+	MaxRetries    int           `yaml:"max_retries"`
+
+	mu      sync.Mutex
+	pending []map[string]interface{}
+
+	sendMu  sync.Mutex // held while sending, so batches go in order
+	created bool       // whether the index was checked or created
+
+	stop chan struct{} // closed by close
+}
+
+// elasticsearchMinBackoff and elasticsearchMaxBackoff bound the delay
+// between attempts to send a batch.
+const (
+	elasticsearchMinBackoff = time.Second
+	elasticsearchMaxBackoff = 30 * time.Second
+)
+
+func init() {
+	registerSinkType("elasticsearch", func(decode func(interface{}) error) (notifier, error) {
+		s := &elasticsearchSink{
+			Index:         "certstream-matches",
+			BatchSize:     100,
+			FlushInterval: 5 * time.Second,
+			MaxRetries:    5,
+		}
+		if err := decode(s); err != nil {
+			return nil, err
+		}
+		if s.URL == "" {
+			return nil, errors.New("url: must be set")
+		}
+		s.URL = strings.TrimSuffix(s.URL, "/")
+		if s.Index == "" || strings.ContainsAny(s.Index, "/\\*?\"<>| ,#") {
+			return nil, errors.Errorf("index: %q is not a valid index name", s.Index)
+		}
+		if s.BatchSize < 1 {
+			return nil, errors.New("batch_size: must be at least 1")
+		}
+		if s.FlushInterval <= 0 {
+			return nil, errors.New("flush_interval: must be positive")
+		}
+		if s.MaxRetries < 0 {
+			return nil, errors.New("max_retries: must not be negative")
+		}
+		s.stop = make(chan struct{})
+		go func() {
+			ticker := time.NewTicker(s.FlushInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+				case <-s.stop:
+					return
+				}
+				if err := s.Flush(); err != nil {
+					log.WithError(err).Error("error indexing matches in Elasticsearch")
+				}
+			}
+		}()
+		return s, nil
+	})
+}
+
+func (s *elasticsearchSink) check() error {
+	return errors.Wrap(checkURL(s.URL), "url")
+}
+
+func (s *elasticsearchSink) Notify(a *alert) error {
+	doc := map[string]interface{}{
+		"@timestamp":  a.Seen.UTC(),
+		"matched_at":  time.Now().UTC(),
+		"rule":        a.Rule,
+		"pattern":     a.Pattern,
+		"severity":    a.Severity.String(),
+		"domains":     a.Domains,
+		"all_domains": a.AllDomains,
+		"fingerprint": a.Fingerprint,
+		"cert_url":    a.CertURL,
+		"issuer":      a.Issuer,
+		"issuer_cn":   a.IssuerCN,
+		"issuer_org":  a.IssuerOrg,
+		"serial":      a.Serial,
+		"not_before":  a.NotBefore.UTC(),
+		"not_after":   a.NotAfter.UTC(),
+		"log_name":    a.SourceName,
+		"log_url":     a.SourceURL,
+		"cert_index":  a.CertIndex,
+	}
+	if len(a.Original) > 0 {
+		doc["original_domains"] = a.Original
+	}
+	if len(a.Reasons) > 0 {
+		doc["reasons"] = a.Reasons
+	}
+
+	s.mu.Lock()
+	s.pending = append(s.pending, doc)
+	full := len(s.pending) >= s.BatchSize
+	s.mu.Unlock()
+	if full {
+		return s.Flush()
+	}
+	return nil
+}
+
+// flush sends the pending alerts, in as many batches as it takes.
+func (s *elasticsearchSink) Flush() error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	for {
+		s.mu.Lock()
+		batch := s.pending
+		if len(batch) > s.BatchSize {
+			batch = batch[:s.BatchSize]
+		}
+		s.pending = s.pending[len(batch):]
+		s.mu.Unlock()
+
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := s.send(batch); err != nil {
+			return err
+		}
+	}
+}
+
+// send indexes a batch of documents, retrying those that fail with backoff.
+func (s *elasticsearchSink) send(batch []map[string]interface{}) error {
+	if !s.created {
+		if err := s.createIndex(); err != nil {
+			// the index might still be created automatically, or exist
+			// already under a role that can't see it
+			log.WithError(err).WithField("index", s.Index).Warn("could not create Elasticsearch index")
+		}
+		s.created = true
+	}
+
+	delay := elasticsearchMinBackoff
+	for attempt := 0; ; attempt++ {
+		failed, err := s.bulk(batch)
+		if err == nil && len(failed) == 0 {
+			return nil
+		}
+		if err == nil {
+			batch = failed
+			err = errors.Errorf("%s rejected by Elasticsearch", english.Plural(len(failed), "document was", "documents were"))
+		}
+		if attempt == s.MaxRetries {
+			return errors.Wrapf(err, "gave up indexing %s", english.Plural(len(batch), "match", "matches"))
+		}
+		if e, ok := errors.Cause(err).(*httpError); ok && e.RetryAfter > delay {
+			delay = e.RetryAfter
+		}
+		log.WithError(err).WithField("attempt", attempt+1).Warnf("could not index matches in Elasticsearch, retrying in %s", delay)
+		time.Sleep(delay)
+		if delay *= 2; delay > elasticsearchMaxBackoff {
+			delay = elasticsearchMaxBackoff
+		}
+	}
+}
+
+// bulk sends one bulk request, returning the documents that should be
+// retried because the cluster was too busy for them. Documents rejected for
+// other reasons, like failing the mapping, are logged and dropped.
+func (s *elasticsearchSink) bulk(batch []map[string]interface{}) ([]map[string]interface{}, error) {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, doc := range batch {
+		// index, rather than create, so that a retried request doesn't
+		// fail for documents that made it the first time
+		action := map[string]interface{}{"index": map[string]string{
+			"_index": s.Index,
+			"_id":    fmt.Sprintf("%s %s", doc["fingerprint"], doc["rule"]),
+		}}
+		if err := enc.Encode(action); err != nil {
+			return nil, err
+		}
+		if err := enc.Encode(doc); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := s.do("POST", "/_bulk", "application/x-ndjson", &body)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int `json:"status"`
+			Error  struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return nil, errors.Wrap(err, "could not parse bulk response")
+	}
+	if !result.Errors {
+		return nil, nil
+	}
+	retry := []map[string]interface{}{}
+	for i, item := range result.Items {
+		if i >= len(batch) {
+			break
+		}
+		for _, r := range item {
+			switch {
+			case r.Status == http.StatusTooManyRequests || r.Status >= 500:
+				retry = append(retry, batch[i])
+			case r.Status >= 300:
+				log.WithFields(map[string]interface{}{
+					"fingerprint": batch[i]["fingerprint"],
+					"rule":        batch[i]["rule"],
+					"status":      r.Status,
+				}).Errorf("Elasticsearch rejected match: %s: %s", r.Error.Type, r.Error.Reason)
+			}
+		}
+	}
+	return retry, nil
+}
+
+// createIndex creates the index with elasticsearchMapping unless it exists.
+func (s *elasticsearchSink) createIndex() error {
+	_, err := s.do("PUT", "/"+s.Index, "application/json", strings.NewReader(elasticsearchMapping))
+	if e, ok := err.(*httpError); ok && e.StatusCode == http.StatusBadRequest &&
+		strings.Contains(e.Body, "already_exists") {
+		return nil
+	}
+	return err
+}
+
+// do makes a request to the cluster and returns the response body, or an
+// *httpError for a response other than 2xx.
+func (s *elasticsearchSink) do(method, path, contentType string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, s.URL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	switch {
+	case s.APIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+s.APIKey)
+	case s.Username != "":
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return readResponse(resp)
+}
+
+// close stops flushing batches in the background.
+func (s *elasticsearchSink) Close() error {
+	close(s.stop)
+	return nil
+}
@@ -0,0 +1,347 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// emailSink sends each alert as an email over SMTP, with a plain text part
+// and an HTML part rendered from a template.
+type emailSink struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+
+	// Username and Password authenticate with PLAIN auth, if set
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+
+	// TLS is "starttls" (the default), "tls" to connect with TLS from the
+	// start (usually on port 465), or "none"
+	TLS string `yaml:"tls"`
+
+	From string   `yaml:"from"`
+	To   []string `yaml:"to"`
+
+	// SubjectPrefix comes before the alert summary in the subject
+	SubjectPrefix string `yaml:"subject_prefix"`
+
+	// Template is a file with an html/template for the HTML part, in place
+	// of emailTemplate
+	Template string `yaml:"template"`
+
+	template *template.Template
+	from     string   // the bare address of From
+	to       []string // and of To
+}
+
+// emailTemplate is the default HTML body. It's executed with an emailData.
+const emailTemplate = `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif">
+<h2 style="border-left: 4px solid {{.Color}}; padding-left: 8px">{{.Summary}}</h2>
+<p>These domains in a new certificate match the rule <b>{{.Rule}}</b> ({{.Severity}}):</p>
+<ul>
+{{- range .Matches}}
+<li><code>{{.Domain}}</code>{{with .Note}} ({{.}}){{end}}</li>
+{{- end}}
+</ul>
+{{- if .OtherDomains}}
+<p>The certificate also names:</p>
+<ul>
+{{- range .OtherDomains}}
+<li><code>{{.}}</code></li>
+{{- end}}
+</ul>
+{{- end}}
+<table>
+<tr><th align="left">Issuer</th><td>{{.Issuer}}</td></tr>
+<tr><th align="left">Valid</th><td>{{.NotBefore}} to {{.NotAfter}}</td></tr>
+<tr><th align="left">Serial</th><td>{{.Serial}}</td></tr>
+<tr><th align="left">Fingerprint</th><td>{{.Fingerprint}}</td></tr>
+{{- with .Source}}
+<tr><th align="left">Logged</th><td>{{.}}</td></tr>
+{{- end}}
+</table>
+<p><a href="{{.CertURL}}">View on crt.sh</a>{{with .EntryURL}} | <a href="{{.}}">CT log entry</a>{{end}}</p>
+</body>
+</html>
+`
+
+// emailData is what email templates are executed with.
+type emailData struct {
+	Summary  string
+	Rule     string
+	Pattern  string
+	Severity string
+	Color    string // for the severity, like "#e01e5a"
+	Matches  []emailMatch
+	// OtherDomains are the domains in the certificate that didn't match
+	OtherDomains []string
+	Issuer       string
+	Serial       string
+	Fingerprint  string
+	NotBefore    string
+	NotAfter     string
+	Source       string
+	CertURL      string
+	EntryURL     string
+}
+
+// emailMatch is a matching domain and any note on it, like its original
+// form or why it matched.
+type emailMatch struct {
+	Domain string
+	Note   string
+}
+
+func init() {
+	registerSinkType("email", func(decode func(interface{}) error) (notifier, error) {
+		s := &emailSink{TLS: "starttls", SubjectPrefix: "[certstream-slack] "}
+		if err := decode(s); err != nil {
+			return nil, err
+		}
+		if s.Host == "" {
+			return nil, errors.New("host: must be set")
+		}
+		switch s.TLS {
+		case "starttls", "none":
+			if s.Port == 0 {
+				s.Port = 587
+			}
+		case "tls":
+			if s.Port == 0 {
+				s.Port = 465
+			}
+		default:
+			return nil, errors.Errorf("tls: must be \"starttls\", \"tls\", or \"none\", not %q", s.TLS)
+		}
+		from, err := mail.ParseAddress(s.From)
+		if err != nil {
+			return nil, errors.Wrap(err, "from")
+		}
+		s.from = from.Address
+		if len(s.To) == 0 {
+			return nil, errors.New("to: must list at least one address")
+		}
+		for i, to := range s.To {
+			addr, err := mail.ParseAddress(to)
+			if err != nil {
+				return nil, errors.Wrapf(err, "to[%d]", i)
+			}
+			s.to = append(s.to, addr.Address)
+		}
+		text := emailTemplate
+		if s.Template != "" {
+			data, err := ioutil.ReadFile(s.Template)
+			if err != nil {
+				return nil, errors.Wrap(err, "template")
+			}
+			text = string(data)
+		}
+		t, err := template.New("email").Parse(text)
+		if err != nil {
+			return nil, errors.Wrap(err, "template")
+		}
+		s.template = t
+		return s, nil
+	})
+}
+
+func (s *emailSink) Notify(a *alert) error {
+	msg, err := s.message(a)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(s.send(msg), "error sending email")
+}
+
+// data returns the template data for an alert.
+func (s *emailSink) data(a *alert) *emailData {
+	d := &emailData{
+		Summary:     a.Summary(),
+		Rule:        a.Rule,
+		Pattern:     a.Pattern,
+		Severity:    a.Severity.String(),
+		Color:       fmt.Sprintf("#%06x", a.Severity.Color()),
+		Issuer:      a.IssuerName(),
+		Serial:      valueOr(a.Serial, "unknown"),
+		Fingerprint: a.Fingerprint,
+		NotBefore:   formatTime(a.NotBefore),
+		NotAfter:    formatTime(a.NotAfter),
+		Source:      a.Source(),
+		CertURL:     a.CertURL,
+		EntryURL:    a.EntryURL(),
+	}
+	matched := map[string]bool{}
+	for _, domain := range a.Domains {
+		matched[domain] = true
+		notes := []string{}
+		if original, ok := a.Original[domain]; ok {
+			notes = append(notes, original)
+		}
+		if reason, ok := a.Reasons[domain]; ok {
+			notes = append(notes, reason)
+		}
+		d.Matches = append(d.Matches, emailMatch{Domain: domain, Note: strings.Join(notes, ", ")})
+	}
+	for _, domain := range a.AllDomains {
+		if !matched[domain] {
+			d.OtherDomains = append(d.OtherDomains, domain)
+		}
+	}
+	return d
+}
+
+// message builds the email for an alert as a multipart/alternative message
+// with plain text and HTML parts.
+func (s *emailSink) message(a *alert) ([]byte, error) {
+	var html bytes.Buffer
+	var text string
+	if a.Message != "" {
+		// a templated message replaces both parts
+		text = a.Message + "\n"
+		fmt.Fprintf(&html, "<div style=\"white-space: pre-wrap\">%s</div>\n", template.HTMLEscapeString(a.Message))
+	} else {
+		if err := s.template.Execute(&html, s.data(a)); err != nil {
+			return nil, errors.Wrap(err, "error executing email template")
+		}
+		text = fmt.Sprintf("%s\n\n%s\n\n%s\n", a.Summary(), a.Details(), a.CertURL)
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, part := range []struct{ typ, content string }{
+		{"text/plain", text},
+		{"text/html", html.String()},
+	} {
+		pw, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.typ + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"8bit"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		pw.Write([]byte(part.content))
+	}
+	w.Close()
+
+	var msg bytes.Buffer
+	headers := [][2]string{
+		{"From", s.From},
+		{"To", strings.Join(s.To, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", headerValue(s.SubjectPrefix+a.Summary()))},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", s.messageID()},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + w.Boundary()},
+	}
+	for _, h := range headers {
+		fmt.Fprintf(&msg, "%s: %s\r\n", h[0], headerValue(h[1]))
+	}
+	msg.WriteString("\r\n")
+	// SMTP wants CRLF line endings throughout
+	msg.WriteString(strings.Replace(strings.Replace(body.String(), "\r\n", "\n", -1), "\n", "\r\n", -1))
+	return msg.Bytes(), nil
+}
+
+// headerValue makes a header value safe to write, replacing line breaks
+// and other control characters with spaces, since certificates can put
+// anything in their domains and a line break would start a new header (or
+// the body).
+func headerValue(v string) string {
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, v)
+}
+
+// messageID returns a unique Message-ID header for a new email.
+func (s *emailSink) messageID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	domain := s.Host
+	if at := strings.LastIndex(s.from, "@"); at >= 0 {
+		domain = s.from[at+1:]
+	}
+	return fmt.Sprintf("<%x@%s>", b, domain)
+}
+
+// send delivers msg to the SMTP server.
+func (s *emailSink) send(msg []byte) error {
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	conn, err := net.DialTimeout("tcp", addr, 30*time.Second)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(time.Minute))
+	if s.TLS == "tls" {
+		conn = tls.Client(conn, &tls.Config{ServerName: s.Host})
+	}
+	c, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if s.TLS == "starttls" {
+		if err := c.StartTLS(&tls.Config{ServerName: s.Host}); err != nil {
+			return errors.Wrap(err, "STARTTLS failed")
+		}
+	}
+	if s.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.from); err != nil {
+		return err
+	}
+	for _, to := range s.to {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
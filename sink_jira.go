@@ -0,0 +1,296 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// jiraSink opens a JIRA issue for each matching certificate. Issues are
+// labelled with the certificate's fingerprint and its issuer and serial, and
+// no new issue is opened for a certificate that already has one, including
+// the certificate for a precertificate that was already ticketed.
+type jiraSink struct {
+	// URL is the JIRA site, like "https://example.atlassian.net"
+	URL string `yaml:"url"`
+
+	// Username and APIToken authenticate to JIRA Cloud, and Token is a
+	// personal access token for JIRA Server or Data Center
+	Username string `yaml:"username"`
+	APIToken string `yaml:"api_token"`
+	Token    string `yaml:"token"`
+
+	// Project is the key of the project to open issues in, and IssueType
+	// is the type of issue to open (default "Task")
+	Project   string `yaml:"project"`
+	IssueType string `yaml:"issue_type"`
+
+	// Labels are added to every issue
+	Labels []string `yaml:"labels"`
+
+	// Priorities maps rule severities to JIRA priority names, like
+	// {critical: Highest}
+	Priorities map[string]string `yaml:"priorities"`
+
+	// Fields sets more issue fields by ID, like components or custom fields.
+	// "{rule}", "{severity}", "{domain}", "{domains}", "{fingerprint}",
+	// "{serial}", "{issuer}", and "{cert_url}" in strings are replaced with
+	// the alert's.
+	Fields map[string]interface{} `yaml:"fields"`
+
+	// CAFile verifies the site against it, instead of the system roots
+	CAFile string `yaml:"ca_file"`
+
+	priorities map[severity]string
+	fields     map[string]interface{} // Fields, converted for JSON
+	client     *http.Client
+
+	mu        sync.Mutex
+	searchAPI string // the issue search endpoint, which differs by version
+}
+
+func init() {
+	registerSinkType("jira", func(decode func(interface{}) error) (notifier, error) {
+		s := &jiraSink{IssueType: "Task", searchAPI: "/rest/api/2/search/jql"}
+		if err := decode(s); err != nil {
+			return nil, err
+		}
+		if s.URL == "" {
+			return nil, errors.New("url: must be set")
+		}
+		s.URL = strings.TrimSuffix(s.URL, "/")
+		if s.Project == "" {
+			return nil, errors.New("project: must be set")
+		}
+		if (s.Username == "") != (s.APIToken == "") {
+			return nil, errors.New("api_token: username and api_token must be set together")
+		}
+		if s.Token == "" && s.APIToken == "" {
+			return nil, errors.New("api_token: username and api_token, or token, must be set")
+		}
+		if s.Token != "" && s.APIToken != "" {
+			return nil, errors.New("token: only one of token and api_token can be set")
+		}
+		s.priorities = map[severity]string{}
+		for name, priority := range s.Priorities {
+			sev, err := parseSeverity(name)
+			if err != nil {
+				return nil, errors.Wrap(err, "priorities")
+			}
+			s.priorities[sev] = priority
+		}
+		s.fields = map[string]interface{}{}
+		for id, value := range s.Fields {
+			s.fields[id] = jsonValue(value)
+		}
+		var err error
+		if s.client, err = newHTTPClient(s.CAFile); err != nil {
+			return nil, errors.Wrap(err, "ca_file")
+		}
+		return s, nil
+	})
+}
+
+// jsonValue converts the maps in a value decoded from YAML to ones that can
+// be encoded as JSON.
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for key, value := range v {
+			m[fmt.Sprint(key)] = jsonValue(value)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, value := range v {
+			l[i] = jsonValue(value)
+		}
+		return l
+	}
+	return value
+}
+
+// expand replaces placeholders in the strings of a field value.
+func (s *jiraSink) expand(value interface{}, placeholders *strings.Replacer) interface{} {
+	switch v := value.(type) {
+	case string:
+		return placeholders.Replace(v)
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for key, value := range v {
+			m[key] = s.expand(value, placeholders)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, value := range v {
+			l[i] = s.expand(value, placeholders)
+		}
+		return l
+	}
+	return value
+}
+
+// labels returns the labels identifying an alert's certificate: one with its
+// fingerprint, and one with a hash of its issuer and serial, which it shares
+// with its precertificate.
+func (s *jiraSink) labels(a *alert) []string {
+	labels := []string{"certstream-" + strings.ToLower(strings.Replace(a.Fingerprint, ":", "", -1))}
+	if a.Serial != "" {
+		sum := sha1.Sum([]byte(a.Issuer + "/" + a.Serial))
+		labels = append(labels, "certstream-cert-"+hex.EncodeToString(sum[:10]))
+	}
+	return labels
+}
+
+func (s *jiraSink) check() error {
+	return errors.Wrap(checkURL(s.URL), "url")
+}
+
+func (s *jiraSink) Notify(a *alert) error {
+	labels := s.labels(a)
+
+	// hold the lock from searching to creating so that concurrent alerts for
+	// a certificate (from different rules) don't both open an issue
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, err := s.search(labels)
+	if err != nil {
+		return errors.Wrap(err, "error searching JIRA issues")
+	}
+	if existing != "" {
+		log.WithFields(map[string]interface{}{
+			"rule":        a.Rule,
+			"fingerprint": a.Fingerprint,
+			"issue":       existing,
+		}).Debug("JIRA issue already open for certificate")
+		return nil
+	}
+
+	domains := []string{}
+	for _, domain := range a.AllDomains {
+		domains = append(domains, "* {{"+domain+"}}")
+	}
+	description := fmt.Sprintf("%s\n\n%s\n\n[View the certificate on crt.sh|%s]\n\nDomains in the certificate:\n%s",
+		a.Summary(), a.Details(), a.CertURL, strings.Join(domains, "\n"))
+
+	placeholders := strings.NewReplacer(
+		"{rule}", a.Rule,
+		"{severity}", a.Severity.String(),
+		"{domain}", a.Domains[0],
+		"{domains}", strings.Join(a.Domains, ", "),
+		"{fingerprint}", a.Fingerprint,
+		"{serial}", a.Serial,
+		"{issuer}", a.IssuerName(),
+		"{cert_url}", a.CertURL,
+	)
+	fields := map[string]interface{}{
+		"project":     map[string]string{"key": s.Project},
+		"issuetype":   map[string]string{"name": s.IssueType},
+		"summary":     truncate(a.Summary(), 255),
+		"description": truncate(a.MessageOr(description), 32767),
+		"labels":      append(append(labels, "certstream-slack"), s.Labels...),
+	}
+	if priority := s.priorities[a.Severity]; priority != "" {
+		fields["priority"] = map[string]string{"name": priority}
+	}
+	for id, value := range s.fields {
+		fields[id] = s.expand(value, placeholders)
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"fields": fields})
+	if err != nil {
+		return err
+	}
+	var created struct {
+		Key string `json:"key"`
+	}
+	if err := s.do("POST", "/rest/api/2/issue", bytes.NewReader(body), &created); err != nil {
+		return errors.Wrap(err, "error creating JIRA issue")
+	}
+	log.WithField("rule", a.Rule).WithField("issue", created.Key).Info("opened JIRA issue")
+	return nil
+}
+
+// search returns the key of an issue in the project with any of the labels,
+// or "" if there are none.
+func (s *jiraSink) search(labels []string) (string, error) {
+	quoted := []string{}
+	for _, label := range labels {
+		quoted = append(quoted, fmt.Sprintf("%q", label))
+	}
+	query := url.Values{
+		"jql":        {fmt.Sprintf("project = %q AND labels in (%s)", s.Project, strings.Join(quoted, ", "))},
+		"fields":     {"key"},
+		"maxResults": {"1"},
+	}
+	var result struct {
+		Issues []struct {
+			Key string `json:"key"`
+		} `json:"issues"`
+	}
+	err := s.do("GET", s.searchAPI+"?"+query.Encode(), nil, &result)
+	if e, ok := err.(*httpError); ok && e.StatusCode == http.StatusNotFound && s.searchAPI != "/rest/api/2/search" {
+		// JIRA Server and Data Center don't have JIRA Cloud's newer endpoint
+		s.searchAPI = "/rest/api/2/search"
+		err = s.do("GET", s.searchAPI+"?"+query.Encode(), nil, &result)
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(result.Issues) == 0 {
+		return "", nil
+	}
+	return result.Issues[0].Key, nil
+}
+
+// do makes a request to the JIRA REST API and decodes the response into
+// result.
+func (s *jiraSink) do(method, path string, body io.Reader, result interface{}) error {
+	req, err := http.NewRequest(method, s.URL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	} else {
+		req.SetBasicAuth(s.Username, s.APIToken)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := readResponse(resp)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(json.Unmarshal(respBody, result), "could not parse JIRA response")
+}
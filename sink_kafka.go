@@ -0,0 +1,130 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+// kafkaSink publishes each alert to a Kafka topic as JSON, keyed by the
+// certificate fingerprint so that alerts for a certificate land in the same
+// partition, using franz-go.
+type kafkaSink struct {
+	// Brokers are bootstrap brokers, as "host:port"
+	Brokers  []string `yaml:"brokers"`
+	Topic    string   `yaml:"topic"`
+	ClientID string   `yaml:"client_id"`
+
+	// TLS connects with TLS, verifying brokers against CAFile if set or
+	// else the system roots
+	TLS    bool   `yaml:"tls"`
+	CAFile string `yaml:"ca_file"`
+
+	// SASLMechanism is "PLAIN", "SCRAM-SHA-256", or "SCRAM-SHA-512" to
+	// authenticate with Username and Password
+	SASLMechanism string `yaml:"sasl_mechanism"`
+	Username      string `yaml:"username"`
+	Password      string `yaml:"password"`
+
+	client *kgo.Client
+}
+
+// kafkaTimeout is how long to wait for the brokers to acknowledge an alert.
+const kafkaTimeout = 30 * time.Second
+
+func init() {
+	registerSinkType("kafka", func(decode func(interface{}) error) (notifier, error) {
+		s := &kafkaSink{ClientID: "certstream-slack"}
+		if err := decode(s); err != nil {
+			return nil, err
+		}
+		if len(s.Brokers) == 0 {
+			return nil, errors.New("brokers: must list at least one broker")
+		}
+		if s.Topic == "" {
+			return nil, errors.New("topic: must be set")
+		}
+
+		opts := []kgo.Opt{
+			kgo.SeedBrokers(s.Brokers...),
+			kgo.ClientID(s.ClientID),
+			kgo.DefaultProduceTopic(s.Topic),
+			// partition by the key the way the Java client does, and wait
+			// for every in-sync replica, without needing the idempotent
+			// write permission older clusters require
+			kgo.RecordPartitioner(kgo.StickyKeyPartitioner(nil)),
+			kgo.RequiredAcks(kgo.AllISRAcks()),
+			kgo.DisableIdempotentWrite(),
+		}
+		if s.TLS {
+			tlsConfig, err := newTLSConfig(s.CAFile)
+			if err != nil {
+				return nil, errors.Wrap(err, "ca_file")
+			}
+			opts = append(opts, kgo.DialTLSConfig(tlsConfig))
+		} else if s.CAFile != "" {
+			return nil, errors.New("ca_file: tls must be enabled")
+		}
+
+		switch s.SASLMechanism {
+		case "":
+			if s.Username != "" {
+				return nil, errors.New("sasl_mechanism: must be set with username")
+			}
+		case "PLAIN":
+			opts = append(opts, kgo.SASL(plain.Auth{User: s.Username, Pass: s.Password}.AsMechanism()))
+		case "SCRAM-SHA-256":
+			opts = append(opts, kgo.SASL(scram.Auth{User: s.Username, Pass: s.Password}.AsSha256Mechanism()))
+		case "SCRAM-SHA-512":
+			opts = append(opts, kgo.SASL(scram.Auth{User: s.Username, Pass: s.Password}.AsSha512Mechanism()))
+		default:
+			return nil, errors.Errorf("sasl_mechanism: must be PLAIN, SCRAM-SHA-256, or SCRAM-SHA-512, not %q", s.SASLMechanism)
+		}
+
+		if s.SASLMechanism != "" && s.Username == "" {
+			return nil, errors.New("username: must be set with sasl_mechanism")
+		}
+
+		var err error
+		if s.client, err = kgo.NewClient(opts...); err != nil {
+			return nil, errors.Wrap(err, "could not create Kafka client")
+		}
+		return s, nil
+	})
+}
+
+func (s *kafkaSink) Notify(a *alert) error {
+	value, err := json.Marshal(alertPayload(a))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kafkaTimeout)
+	defer cancel()
+	record := &kgo.Record{Key: []byte(a.Fingerprint), Value: value}
+	return errors.Wrap(s.client.ProduceSync(ctx, record).FirstErr(), "error publishing to Kafka")
+}
+
+func (s *kafkaSink) Close() error {
+	s.client.Close()
+	return nil
+}
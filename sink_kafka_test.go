@@ -0,0 +1,100 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"gopkg.in/yaml.v2"
+)
+
+// testSink builds a sink of the given type from its YAML options, closing
+// it when the test is done.
+func testSink(t *testing.T, typ, options string) (notifier, error) {
+	n, err := sinkTypes[typ](func(v interface{}) error { return yaml.Unmarshal([]byte(options), v) })
+	if c, ok := n.(closer); ok && err == nil {
+		t.Cleanup(func() { c.Close() })
+	}
+	return n, err
+}
+
+func TestKafkaSink(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.SeedTopics(3, "alerts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Close()
+
+	n, err := testSink(t, "kafka", fmt.Sprintf("brokers: [%s]\ntopic: alerts\n", strings.Join(cluster.ListenAddrs(), ", ")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify(&alert{Rule: "phishing", Domains: []string{"login.example.com"}, Fingerprint: "0A:1B"}); err != nil {
+		t.Fatal(err)
+	}
+
+	consumer, err := kgo.NewClient(kgo.SeedBrokers(cluster.ListenAddrs()...), kgo.ConsumeTopics("alerts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer consumer.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	fetches := consumer.PollRecords(ctx, 1)
+	if err := fetches.Err(); err != nil {
+		t.Fatal(err)
+	}
+	records := fetches.Records()
+	if len(records) != 1 {
+		t.Fatalf("consumed %d records, want 1", len(records))
+	}
+	var payload struct {
+		Rule    string   `json:"rule"`
+		Domains []string `json:"domains"`
+	}
+	if err := json.Unmarshal(records[0].Value, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if string(records[0].Key) != "0A:1B" || payload.Rule != "phishing" {
+		t.Errorf("consumed key %q for rule %q, want 0A:1B for phishing", records[0].Key, payload.Rule)
+	}
+}
+
+func TestKafkaSinkOptions(t *testing.T) {
+	tests := []struct {
+		options, err string
+	}{
+		{options: "topic: alerts", err: "brokers: must list at least one broker"},
+		{options: "brokers: [localhost:9092]", err: "topic: must be set"},
+		{options: "brokers: [localhost:9092]\ntopic: alerts\nca_file: ca.pem", err: "ca_file: tls must be enabled"},
+		{options: "brokers: [localhost:9092]\ntopic: alerts\nusername: alice", err: "sasl_mechanism: must be set with username"},
+		{options: "brokers: [localhost:9092]\ntopic: alerts\nsasl_mechanism: SCRAM-SHA-256", err: "username: must be set with sasl_mechanism"},
+		{options: "brokers: [localhost:9092]\ntopic: alerts\nsasl_mechanism: GSSAPI\nusername: alice", err: `sasl_mechanism: must be PLAIN, SCRAM-SHA-256, or SCRAM-SHA-512, not "GSSAPI"`},
+	}
+	for _, test := range tests {
+		_, err := testSink(t, "kafka", test.options)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%q: error %v, want %q", test.options, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// mispSink records matches as MISP events, with the matching domains and
+// the certificate's fingerprints as attributes and tags naming the rule and
+// severity. Each alert is its own event, or with Event set to "rule", each
+// rule has one event that new matches are added to.
+type mispSink struct {
+	// URL is the MISP instance, like "https://misp.example.com"
+	URL    string `yaml:"url"`
+	APIKey string `yaml:"api_key"`
+
+	// CAFile verifies the instance against it, instead of the system roots
+	CAFile string `yaml:"ca_file"`
+
+	// Event is "alert" (the default) to create an event per alert, or
+	// "rule" to keep one event per rule up to date
+	Event string `yaml:"event"`
+
+	// Distribution is the events' distribution level, from 0 (your
+	// organisation only, the default) to 3 (all communities)
+	Distribution int `yaml:"distribution"`
+
+	// Tags are added to every event, along with the rule and severity tags
+	Tags []string `yaml:"tags"`
+
+	// ToIDS sets the IDS flag on domain attributes, so they're exported to
+	// network detection rules
+	ToIDS bool `yaml:"to_ids"`
+
+	// Publish publishes events after creating or updating them
+	Publish bool `yaml:"publish"`
+
+	client *http.Client
+
+	mu       sync.Mutex
+	eventIDs map[string]string // event IDs in "rule" mode, by rule
+}
+
+func init() {
+	registerSinkType("misp", func(decode func(interface{}) error) (notifier, error) {
+		s := &mispSink{Event: "alert", eventIDs: map[string]string{}}
+		if err := decode(s); err != nil {
+			return nil, err
+		}
+		if s.URL == "" {
+			return nil, errors.New("url: must be set")
+		}
+		s.URL = strings.TrimSuffix(s.URL, "/")
+		if s.APIKey == "" {
+			return nil, errors.New("api_key: must be set")
+		}
+		if s.Event != "alert" && s.Event != "rule" {
+			return nil, errors.Errorf("event: must be \"alert\" or \"rule\", not %q", s.Event)
+		}
+		if s.Distribution < 0 || s.Distribution > 3 {
+			return nil, errors.Errorf("distribution: must be from 0 to 3, not %d", s.Distribution)
+		}
+		var err error
+		if s.client, err = newHTTPClient(s.CAFile); err != nil {
+			return nil, errors.Wrap(err, "ca_file")
+		}
+		return s, nil
+	})
+}
+
+// mispThreatLevels maps rule severities to MISP threat levels.
+var mispThreatLevels = map[severity]int{
+	severityInfo:     3, // low
+	severityWarning:  2, // medium
+	severityCritical: 1, // high
+}
+
+type mispAttribute struct {
+	Type     string `json:"type"`
+	Category string `json:"category"`
+	Value    string `json:"value"`
+	ToIDS    bool   `json:"to_ids"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type mispTag struct {
+	Name string `json:"name"`
+}
+
+var mispHex = regexp.MustCompile(`^[0-9a-f]*$`)
+
+// attributes returns the MISP attributes describing an alert.
+func (s *mispSink) attributes(a *alert) []mispAttribute {
+	cert := fmt.Sprintf("certificate %s issued by %s", a.Fingerprint, a.IssuerName())
+	attributes := []mispAttribute{}
+	for _, domain := range a.Domains {
+		comment := "in " + cert
+		if reason := a.Reasons[domain]; reason != "" {
+			comment = reason + ", " + comment
+		}
+		attributes = append(attributes, mispAttribute{
+			Type: "domain", Category: "Network activity", Value: domain, ToIDS: s.ToIDS, Comment: comment,
+		})
+	}
+	fingerprints := []struct {
+		kind, value string
+		length      int
+	}{
+		{"x509-fingerprint-sha1", a.Fingerprint, 40},
+		{"x509-fingerprint-sha256", a.SHA256, 64},
+	}
+	for _, f := range fingerprints {
+		value := strings.ToLower(strings.Replace(f.value, ":", "", -1))
+		if len(value) != f.length || !mispHex.MatchString(value) {
+			// MISP would reject it
+			continue
+		}
+		attributes = append(attributes, mispAttribute{
+			Type: f.kind, Category: "Network activity", Value: value, Comment: "certificate issued by " + a.IssuerName(),
+		})
+	}
+	attributes = append(attributes, mispAttribute{
+		Type: "link", Category: "External analysis", Value: a.CertURL, Comment: "crt.sh entry for " + cert,
+	})
+	return attributes
+}
+
+// tags returns the tags for events about an alert's rule.
+func (s *mispSink) tags(a *alert) []mispTag {
+	tags := []mispTag{
+		{fmt.Sprintf("certstream-slack:rule=%q", a.Rule)},
+		{fmt.Sprintf("certstream-slack:severity=%q", a.Severity)},
+	}
+	for _, tag := range s.Tags {
+		tags = append(tags, mispTag{tag})
+	}
+	return tags
+}
+
+func (s *mispSink) check() error {
+	if err := checkURL(s.URL); err != nil {
+		return errors.Wrap(err, "url")
+	}
+	if len(s.APIKey) != 40 {
+		return errors.New("api_key: must be a 40-character authentication key")
+	}
+	return nil
+}
+
+func (s *mispSink) Notify(a *alert) error {
+	if s.Event == "alert" {
+		id, err := s.createEvent(a, a.Summary())
+		if err != nil {
+			return errors.Wrap(err, "error creating MISP event")
+		}
+		return s.publish(id)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := "Certificates matching " + a.Rule
+	id := s.eventIDs[a.Rule]
+	if id == "" {
+		var err error
+		if id, err = s.findEvent(info); err != nil {
+			return errors.Wrap(err, "error searching MISP events")
+		}
+	}
+	if id != "" {
+		err := s.addAttributes(id, s.attributes(a))
+		if e, ok := err.(*httpError); ok && e.StatusCode == http.StatusNotFound {
+			// the event was deleted, so start a new one
+			id = ""
+		} else if err != nil {
+			return errors.Wrap(err, "error updating MISP event")
+		}
+	}
+	if id == "" {
+		var err error
+		if id, err = s.createEvent(a, info); err != nil {
+			return errors.Wrap(err, "error creating MISP event")
+		}
+	}
+	s.eventIDs[a.Rule] = id
+	return s.publish(id)
+}
+
+// createEvent creates an event for an alert and returns its ID.
+func (s *mispSink) createEvent(a *alert, info string) (string, error) {
+	var resp struct {
+		Event struct {
+			ID string `json:"id"`
+		}
+	}
+	err := s.post("/events/add", map[string]interface{}{
+		"Event": map[string]interface{}{
+			"info":            info,
+			"date":            a.Seen.UTC().Format("2006-01-02"),
+			"distribution":    s.Distribution,
+			"threat_level_id": mispThreatLevels[a.Severity],
+			"analysis":        0, // initial
+			"Attribute":       s.attributes(a),
+			"Tag":             s.tags(a),
+		},
+	}, &resp)
+	if err != nil {
+		return "", err
+	}
+	if resp.Event.ID == "" {
+		return "", errors.New("MISP returned no event ID")
+	}
+	return resp.Event.ID, nil
+}
+
+// findEvent returns the ID of the latest event with the given info, or ""
+// if there isn't one.
+func (s *mispSink) findEvent(info string) (string, error) {
+	var resp struct {
+		Response []struct {
+			Event struct {
+				ID   string `json:"id"`
+				Info string `json:"info"`
+			}
+		} `json:"response"`
+	}
+	err := s.post("/events/restSearch", map[string]interface{}{
+		"returnFormat": "json",
+		"eventinfo":    info,
+		"metadata":     true,
+		"order":        "Event.id desc",
+	}, &resp)
+	if e, ok := err.(*httpError); ok && e.StatusCode == http.StatusNotFound {
+		// older versions of MISP return 404 when nothing matches
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	// eventinfo is a substring match, so look for this exact event
+	for _, r := range resp.Response {
+		if r.Event.Info == info {
+			return r.Event.ID, nil
+		}
+	}
+	return "", nil
+}
+
+// addAttributes adds attributes to an event. Attributes the event already
+// has are skipped by MISP.
+func (s *mispSink) addAttributes(id string, attributes []mispAttribute) error {
+	err := s.post("/attributes/add/"+id, attributes, nil)
+	if e, ok := err.(*httpError); ok && e.StatusCode == http.StatusForbidden &&
+		strings.Contains(e.Body, "already exists") {
+		// every attribute was a duplicate
+		return nil
+	}
+	return err
+}
+
+// publish publishes an event if Publish is set.
+func (s *mispSink) publish(id string) error {
+	if !s.Publish {
+		return nil
+	}
+	if err := s.post("/events/publish/"+id, map[string]interface{}{}, nil); err != nil {
+		return errors.Wrap(err, "error publishing MISP event")
+	}
+	return nil
+}
+
+// post POSTs a JSON request to the MISP API and decodes the response into
+// result, unless it's nil.
+func (s *mispSink) post(path string, payload, result interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", s.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", s.APIKey)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := readResponse(resp)
+	if err != nil || result == nil {
+		return err
+	}
+	return errors.Wrap(json.Unmarshal(respBody, result), "could not parse MISP response")
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/pkg/errors"
+)
+
+// mqttSink publishes each alert to an MQTT broker as JSON, using the Eclipse
+// Paho client, such as for home automation.
+type mqttSink struct {
+	// Broker is like "mqtt://localhost:1883" or "mqtts://host:8883"
+	Broker string `yaml:"broker"`
+
+	// Topic is where to publish, where "{rule}" and "{severity}" are
+	// replaced with the alert's (with "/", "+", and "#" in them replaced by
+	// underscores)
+	Topic string `yaml:"topic"`
+
+	// QoS is 0, 1 (the default), or 2, and Retain asks the broker to keep
+	// the last alert on each topic for new subscribers
+	QoS    *int `yaml:"qos"`
+	Retain bool `yaml:"retain"`
+
+	// ClientID defaults to "certstream-slack-" and a random suffix
+	ClientID string `yaml:"client_id"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+
+	// CAFile verifies mqtts brokers, instead of the system roots
+	CAFile string `yaml:"ca_file"`
+
+	qos    byte
+	client mqtt.Client
+	mu     sync.Mutex // held while connecting
+}
+
+// mqttTimeout is how long to wait to connect, and for the broker to
+// acknowledge an alert.
+const mqttTimeout = 10 * time.Second
+
+// mqttTopicLevel replaces characters that can't be in an MQTT topic level.
+var mqttTopicLevel = strings.NewReplacer("/", "_", "+", "_", "#", "_")
+
+func init() {
+	registerSinkType("mqtt", func(decode func(interface{}) error) (notifier, error) {
+		s := &mqttSink{Topic: "certstream/{rule}"}
+		if err := decode(s); err != nil {
+			return nil, err
+		}
+		if s.Broker == "" {
+			return nil, errors.New("broker: must be set")
+		}
+		broker, err := mqttBrokerURL(s.Broker)
+		if err != nil {
+			return nil, errors.Wrap(err, "broker")
+		}
+		if s.Topic == "" || strings.ContainsAny(s.Topic, "+#") {
+			return nil, errors.Errorf("topic: %q is not a valid topic to publish to", s.Topic)
+		}
+		s.qos = 1
+		if s.QoS != nil {
+			if *s.QoS < 0 || *s.QoS > 2 {
+				return nil, errors.New("qos: must be 0, 1, or 2")
+			}
+			s.qos = byte(*s.QoS)
+		}
+		if s.ClientID == "" {
+			suffix := make([]byte, 4)
+			rand.Read(suffix)
+			s.ClientID = "certstream-slack-" + hex.EncodeToString(suffix)
+		}
+
+		// the broker's credentials can also come from its URL
+		opts := mqtt.NewClientOptions().
+			AddBroker(broker).
+			SetClientID(s.ClientID).
+			SetUsername(s.Username).
+			SetPassword(s.Password).
+			SetConnectTimeout(mqttTimeout).
+			SetWriteTimeout(mqttTimeout).
+			SetConnectRetry(false).
+			SetAutoReconnect(true)
+		if s.CAFile != "" {
+			tlsConfig, err := newTLSConfig(s.CAFile)
+			if err != nil {
+				return nil, errors.Wrap(err, "ca_file")
+			}
+			opts.SetTLSConfig(tlsConfig)
+		}
+		s.client = mqtt.NewClient(opts)
+		return s, nil
+	})
+}
+
+func (s *mqttSink) Notify(a *alert) error {
+	payload, err := json.Marshal(alertPayload(a))
+	if err != nil {
+		return err
+	}
+	topic := strings.NewReplacer(
+		"{rule}", mqttTopicLevel.Replace(a.Rule),
+		"{severity}", a.Severity.String(),
+	).Replace(s.Topic)
+
+	// connect the first time, and again if the client gave up reconnecting
+	s.mu.Lock()
+	if !s.client.IsConnected() {
+		err = mqttWait(s.client.Connect())
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return errors.Wrap(err, "could not connect to MQTT broker")
+	}
+	return errors.Wrap(mqttWait(s.client.Publish(topic, s.qos, s.Retain, payload)), "error publishing to MQTT")
+}
+
+// mqttWait waits for the broker to acknowledge an operation.
+func mqttWait(t mqtt.Token) error {
+	if !t.WaitTimeout(mqttTimeout) {
+		return errors.New("timed out waiting for the broker")
+	}
+	return t.Error()
+}
+
+// mqttBrokerURL checks a broker URL, like "mqtt://localhost:1883" or
+// "mqtts://broker.example.com", adding the default port if it's missing.
+func mqttBrokerURL(rawurl string) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+	port := "1883"
+	switch u.Scheme {
+	case "mqtt", "tcp":
+	case "mqtts", "ssl", "tls":
+		port = "8883"
+	default:
+		return "", errors.Errorf("unsupported scheme %q (must be mqtt or mqtts)", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return "", errors.Errorf("%q has no host", rawurl)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+	return u.String(), nil
+}
+
+func (s *mqttSink) Close() error {
+	if s.client.IsConnected() {
+		s.client.Disconnect(uint(time.Second / time.Millisecond))
+	}
+	return nil
+}
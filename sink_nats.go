@@ -0,0 +1,164 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/pkg/errors"
+)
+
+// natsSink publishes each alert to a NATS subject as JSON, using nats.go,
+// optionally waiting for JetStream to acknowledge storing it.
+type natsSink struct {
+	// Servers are tried in order, like "nats://localhost:4222"
+	Servers []string `yaml:"servers"`
+
+	// Subject is where to publish, where "{rule}" and "{severity}" are
+	// replaced with the alert's (with characters NATS reserves in subjects
+	// replaced by underscores)
+	Subject string `yaml:"subject"`
+
+	// JetStream waits for a stream capturing Subject to acknowledge each
+	// alert, so that alerts are only considered sent once persisted
+	JetStream bool `yaml:"jetstream"`
+
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Token    string `yaml:"token"`
+
+	// TLS requires TLS, verifying servers against CAFile if set or else
+	// the system roots
+	TLS    bool   `yaml:"tls"`
+	CAFile string `yaml:"ca_file"`
+
+	opts []nats.Option
+
+	mu   sync.Mutex
+	conn *nats.Conn
+	js   jetstream.JetStream
+}
+
+// natsTimeout is how long to wait to connect, and for the server or
+// JetStream to acknowledge an alert.
+const natsTimeout = 10 * time.Second
+
+// natsSubjectToken replaces characters that can't be in a NATS subject
+// token.
+var natsSubjectToken = strings.NewReplacer(" ", "_", "\t", "_", ".", "_", "*", "_", ">", "_")
+
+func init() {
+	registerSinkType("nats", func(decode func(interface{}) error) (notifier, error) {
+		s := &natsSink{Subject: "certstream.{rule}"}
+		if err := decode(s); err != nil {
+			return nil, err
+		}
+		if len(s.Servers) == 0 {
+			return nil, errors.New("servers: must list at least one server")
+		}
+		if s.Subject == "" || strings.ContainsAny(s.Subject, " \t*>") {
+			return nil, errors.Errorf("subject: %q is not a valid subject to publish to", s.Subject)
+		}
+		// try the servers in order, as they're listed
+		s.opts = []nats.Option{nats.Name("certstream-slack"), nats.DontRandomize(), nats.Timeout(natsTimeout)}
+		if s.Username != "" {
+			s.opts = append(s.opts, nats.UserInfo(s.Username, s.Password))
+		}
+		if s.Token != "" {
+			s.opts = append(s.opts, nats.Token(s.Token))
+		}
+		if s.TLS {
+			tlsConfig, err := newTLSConfig(s.CAFile)
+			if err != nil {
+				return nil, errors.Wrap(err, "ca_file")
+			}
+			s.opts = append(s.opts, nats.Secure(tlsConfig))
+		} else if s.CAFile != "" {
+			return nil, errors.New("ca_file: tls must be enabled")
+		}
+		return s, nil
+	})
+}
+
+func (s *natsSink) Notify(a *alert) error {
+	data, err := json.Marshal(alertPayload(a))
+	if err != nil {
+		return err
+	}
+	subject := strings.NewReplacer(
+		"{rule}", natsSubjectToken.Replace(a.Rule),
+		"{severity}", a.Severity.String(),
+	).Replace(s.Subject)
+
+	conn, js, err := s.connect()
+	if err != nil {
+		return errors.Wrap(err, "could not connect to NATS")
+	}
+	if !s.JetStream {
+		// flush, so that the server has the alert before it's considered
+		// sent
+		if err = conn.Publish(subject, data); err == nil {
+			err = conn.FlushTimeout(natsTimeout)
+		}
+		return errors.Wrap(err, "error publishing to NATS")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+	_, err = js.Publish(ctx, subject, data)
+	if err == jetstream.ErrNoStreamResponse {
+		return errors.Errorf("error publishing to NATS: no JetStream stream captures subject %s", subject)
+	}
+	return errors.Wrap(err, "error publishing to NATS")
+}
+
+// connect returns the open connection, or connects to the first server that
+// accepts a connection. Once connected, nats.go reconnects as needed, until
+// it gives up and closes the connection.
+func (s *natsSink) connect() (*nats.Conn, jetstream.JetStream, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil && !s.conn.IsClosed() {
+		return s.conn, s.js, nil
+	}
+	conn, err := nats.Connect(strings.Join(s.Servers, ","), s.opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	s.conn, s.js = conn, js
+	return conn, js, nil
+}
+
+func (s *natsSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// natsMessage is a message published to fakeNATS.
+type natsMessage struct {
+	subject, data string
+}
+
+// fakeNATS is a NATS server that speaks just enough of the protocol for
+// the nats sink, recording what's published and answering requests with
+// reply, where a nil answer means there are no responders.
+type fakeNATS struct {
+	net.Listener
+	messages chan natsMessage
+	reply    func(subject string) []byte
+}
+
+func newFakeNATS(t *testing.T, reply func(subject string) []byte) *fakeNATS {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	s := &fakeNATS{Listener: l, messages: make(chan natsMessage, 10), reply: reply}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeNATS) url() string {
+	return "nats://" + s.Addr().String()
+}
+
+func (s *fakeNATS) serve(conn net.Conn) {
+	defer conn.Close()
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"fake\",\"version\":\"2.10.0\",\"proto\":1,\"headers\":true,\"max_payload\":1048576}\r\n")
+	r := bufio.NewReader(conn)
+	inboxes := map[string]string{} // subscription IDs, by subject prefix
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "PING":
+			io.WriteString(conn, "PONG\r\n")
+		case "SUB":
+			inboxes[strings.TrimSuffix(fields[1], "*")] = fields[len(fields)-1]
+		case "PUB", "HPUB":
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			data := string(payload[:size])
+			if fields[0] == "HPUB" {
+				headers, _ := strconv.Atoi(fields[len(fields)-2])
+				data = data[headers:]
+			}
+			s.messages <- natsMessage{subject: fields[1], data: data}
+			if len(fields) < 4 || fields[0] == "HPUB" && len(fields) < 5 {
+				continue
+			}
+			reply := fields[2]
+			for prefix, sid := range inboxes {
+				if !strings.HasPrefix(reply, prefix) {
+					continue
+				}
+				if answer := s.reply(fields[1]); answer != nil {
+					fmt.Fprintf(conn, "MSG %s %s %d\r\n%s\r\n", reply, sid, len(answer), answer)
+				} else {
+					status := "NATS/1.0 503\r\n\r\n"
+					fmt.Fprintf(conn, "HMSG %s %s %d %d\r\n%s\r\n", reply, sid, len(status), len(status), status)
+				}
+			}
+		}
+	}
+}
+
+func TestNATSSink(t *testing.T) {
+	server := newFakeNATS(t, nil)
+	n, err := testSink(t, "nats", fmt.Sprintf("servers: [%s]\nsubject: certstream.{severity}.{rule}\n", server.url()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify(&alert{Rule: "login pages", Severity: severityCritical, Domains: []string{"login.example.com"}}); err != nil {
+		t.Fatal(err)
+	}
+	msg := <-server.messages
+	if msg.subject != "certstream.critical.login_pages" || !strings.Contains(msg.data, `"rule":"login pages"`) {
+		t.Errorf("published %s to %s, want the alert on certstream.critical.login_pages", msg.data, msg.subject)
+	}
+}
+
+func TestNATSSinkJetStream(t *testing.T) {
+	server := newFakeNATS(t, func(subject string) []byte {
+		switch subject {
+		case "certstream.stored":
+			return []byte(`{"stream":"CERTSTREAM","seq":1}`)
+		case "certstream.refused":
+			return []byte(`{"error":{"code":503,"err_code":10077,"description":"maximum messages exceeded"}}`)
+		}
+		return nil
+	})
+	tests := []struct {
+		rule, err string
+	}{
+		{rule: "stored"},
+		{rule: "refused", err: "description=maximum messages exceeded"},
+		{rule: "lost", err: "error publishing to NATS: no JetStream stream captures subject certstream.lost"},
+	}
+	n, err := testSink(t, "nats", fmt.Sprintf("servers: [%s]\njetstream: true\n", server.url()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		err := n.Notify(&alert{Rule: test.rule})
+		if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: error %v, want %q", test.rule, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// opsgenieURLs are the Opsgenie alert API endpoints for each region.
+var opsgenieURLs = map[string]string{
+	"us": "https://api.opsgenie.com/v2/alerts",
+	"eu": "https://api.eu.opsgenie.com/v2/alerts",
+}
+
+// opsgenieSink creates Opsgenie alerts, tagged with the matching domains
+// and aliased by the certificate fingerprint so that repeat alerts for a
+// certificate are deduplicated.
+type opsgenieSink struct {
+	APIKey string `yaml:"api_key"`
+
+	// Region is "us" (the default) or "eu"
+	Region string `yaml:"region"`
+
+	// URL overrides the region's API endpoint
+	URL string `yaml:"url"`
+
+	// Priorities maps rule severities to Opsgenie priorities (P1 to P5),
+	// overriding the defaults of P5, P3, and P1
+	Priorities map[string]string `yaml:"priorities"`
+
+	url        string // URL or the region's endpoint
+	priorities map[severity]string
+}
+
+func init() {
+	registerSinkType("opsgenie", func(decode func(interface{}) error) (notifier, error) {
+		s := &opsgenieSink{Region: "us"}
+		if err := decode(s); err != nil {
+			return nil, err
+		}
+		if s.APIKey == "" {
+			return nil, errors.New("api_key: must be set")
+		}
+		s.url = s.URL
+		if s.url == "" {
+			s.url = opsgenieURLs[s.Region]
+		}
+		if s.url == "" {
+			return nil, errors.Errorf("region: must be \"us\" or \"eu\", not %q", s.Region)
+		}
+		s.priorities = map[severity]string{
+			severityInfo:     "P5",
+			severityWarning:  "P3",
+			severityCritical: "P1",
+		}
+		for name, priority := range s.Priorities {
+			sev, err := parseSeverity(name)
+			if err != nil {
+				return nil, errors.Wrap(err, "priorities")
+			}
+			switch priority {
+			case "P1", "P2", "P3", "P4", "P5":
+			default:
+				return nil, errors.Errorf("priorities.%s: must be P1, P2, P3, P4, or P5, not %q", name, priority)
+			}
+			s.priorities[sev] = priority
+		}
+		return s, nil
+	})
+}
+
+func (s *opsgenieSink) check() error {
+	if !uuidPattern.MatchString(s.APIKey) {
+		return errors.New("api_key: must be an API key like 01234567-89ab-cdef-0123-456789abcdef")
+	}
+	return errors.Wrap(checkURL(s.url), "url")
+}
+
+func (s *opsgenieSink) Notify(a *alert) error {
+	// Opsgenie limits tags to 50 characters and an alert to 20 of them
+	tags := []string{"certstream-slack", a.Rule}
+	for _, domain := range a.Domains {
+		if len(tags) == 20 {
+			break
+		}
+		tags = append(tags, truncate(domain, 50))
+	}
+
+	description := fmt.Sprintf("%s\n\n%s\n\n%s", a.Summary(), a.Details(), a.CertURL)
+	if len(a.AllDomains) > len(a.Domains) {
+		description += "\n\nAll domains in the certificate:\n" + strings.Join(a.AllDomains, "\n")
+	}
+
+	payload := map[string]interface{}{
+		"message":     truncate(a.Summary(), 130),
+		"alias":       a.Fingerprint,
+		"description": truncate(a.MessageOr(description), 15000),
+		"tags":        tags,
+		"entity":      truncate(a.Domains[0], 512),
+		"source":      "certstream-slack",
+		"priority":    s.priorities[a.Severity],
+		"details": map[string]string{
+			"rule":        a.Rule,
+			"fingerprint": a.Fingerprint,
+			"issuer":      a.IssuerName(),
+			"serial":      a.Serial,
+			"crt.sh":      a.CertURL,
+		},
+	}
+	headers := map[string]string{"Authorization": "GenieKey " + s.APIKey}
+	return errors.Wrap(postJSON(s.url, headers, payload), "error creating Opsgenie alert")
+}
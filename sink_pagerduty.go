@@ -0,0 +1,118 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// pagerdutyEventsURL is the PagerDuty Events API v2 endpoint.
+const pagerdutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// pagerdutySink triggers PagerDuty incidents using the Events API v2, with
+// the certificate fingerprint as the dedup key so that repeat alerts for a
+// certificate don't open more incidents.
+type pagerdutySink struct {
+	// RoutingKey is the integration key of an Events API v2 integration
+	RoutingKey string `yaml:"routing_key"`
+
+	// URL overrides the Events API endpoint, such as for EU accounts
+	URL string `yaml:"url"`
+}
+
+func init() {
+	registerSinkType("pagerduty", func(decode func(interface{}) error) (notifier, error) {
+		s := &pagerdutySink{URL: pagerdutyEventsURL}
+		if err := decode(s); err != nil {
+			return nil, err
+		}
+		if s.RoutingKey == "" {
+			return nil, errors.New("routing_key: must be set")
+		}
+		return s, nil
+	})
+}
+
+// pagerdutySeverity maps a rule's severity to one of PagerDuty's.
+func pagerdutySeverity(s severity) string {
+	switch s {
+	case severityInfo:
+		return "info"
+	case severityCritical:
+		return "critical"
+	}
+	return "warning"
+}
+
+// pagerdutyRoutingKey matches an Events API v2 integration key.
+var pagerdutyRoutingKey = regexp.MustCompile(`^[A-Za-z0-9]{32}$`)
+
+func (s *pagerdutySink) check() error {
+	if !pagerdutyRoutingKey.MatchString(s.RoutingKey) {
+		return errors.New("routing_key: must be a 32-character integration key")
+	}
+	return errors.Wrap(checkURL(s.URL), "url")
+}
+
+func (s *pagerdutySink) Notify(a *alert) error {
+	type link struct {
+		Href string `json:"href"`
+		Text string `json:"text"`
+	}
+	details := map[string]interface{}{
+		"rule":        a.Rule,
+		"pattern":     a.Pattern,
+		"domains":     a.Domains,
+		"all_domains": a.AllDomains,
+		"fingerprint": a.Fingerprint,
+		"issuer":      a.IssuerName(),
+		"serial":      a.Serial,
+		"not_before":  formatTime(a.NotBefore),
+		"not_after":   formatTime(a.NotAfter),
+	}
+	if source := a.Source(); source != "" {
+		details["source"] = source
+	}
+	if len(a.Reasons) > 0 {
+		details["reasons"] = a.Reasons
+	}
+	links := []link{{Href: a.CertURL, Text: "View on crt.sh"}}
+	if url := a.EntryURL(); url != "" {
+		links = append(links, link{Href: url, Text: "CT log entry"})
+	}
+
+	payload := map[string]interface{}{
+		"routing_key":  s.RoutingKey,
+		"event_action": "trigger",
+		"dedup_key":    a.Fingerprint,
+		"payload": map[string]interface{}{
+			// PagerDuty truncates summaries longer than this
+			"summary":        truncate(a.Summary(), 1024),
+			"source":         "certstream-slack",
+			"severity":       pagerdutySeverity(a.Severity),
+			"timestamp":      a.Seen.UTC().Format(time.RFC3339),
+			"component":      a.Domains[0],
+			"group":          a.Rule,
+			"class":          "certificate",
+			"custom_details": details,
+		},
+		"links": links,
+	}
+	return errors.Wrap(postJSON(s.URL, nil, payload), "error sending PagerDuty event")
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// pluginSink sends alerts to a plugin command (see pluginProcess), for
+// destinations there's no sink for. Each alert is sent as a request like
+// {"type": "alert", "alert": {...}}, with the alert as the webhook sink
+// sends it, and the plugin responds with {} once it's handled it.
+type pluginSink struct {
+	// Command is the plugin's path and arguments
+	Command []string `yaml:"command"`
+
+	// Timeout is how long the plugin has to respond to each alert
+	Timeout time.Duration `yaml:"timeout"`
+
+	plugin *pluginProcess
+}
+
+func init() {
+	registerSinkType("plugin", func(decode func(interface{}) error) (notifier, error) {
+		s := &pluginSink{Timeout: 30 * time.Second}
+		if err := decode(s); err != nil {
+			return nil, err
+		}
+		if len(s.Command) == 0 {
+			return nil, errors.New("command: must be set")
+		}
+		if s.Timeout <= 0 {
+			return nil, errors.New("timeout: must be positive")
+		}
+		s.plugin = newPluginProcess(s.Command, s.Timeout)
+		return s, nil
+	})
+}
+
+func (s *pluginSink) check() error {
+	return errors.Wrap(checkPluginCommand(s.Command), "command")
+}
+
+func (s *pluginSink) Notify(a *alert) error {
+	request := map[string]interface{}{"type": "alert", "alert": alertPayload(a)}
+	var response struct{}
+	return errors.Wrap(s.plugin.call(request, &response), "error sending alert to plugin")
+}
+
+func (s *pluginSink) Close() error {
+	return s.plugin.close()
+}
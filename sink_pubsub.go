@@ -0,0 +1,122 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// pubsubScope is the OAuth scope for publishing to Pub/Sub.
+const pubsubScope = "https://www.googleapis.com/auth/pubsub"
+
+// pubsubSink publishes each alert to a Google Cloud Pub/Sub topic as JSON,
+// with the rule, severity, and fingerprint as attributes for subscription
+// filters.
+type pubsubSink struct {
+	// Project defaults to the credentials' project, and Topic is the
+	// topic's ID or its full name, like "projects/my-project/topics/certs"
+	Project string `yaml:"project"`
+	Topic   string `yaml:"topic"`
+
+	// Endpoint overrides the Pub/Sub API, which is also overridden by
+	// PUBSUB_EMULATOR_HOST
+	Endpoint string `yaml:"endpoint"`
+
+	url    string
+	tokens *gcpTokenSource // nil when using the emulator
+}
+
+func init() {
+	registerSinkType("pubsub", func(decode func(interface{}) error) (notifier, error) {
+		s := &pubsubSink{Endpoint: "https://pubsub.googleapis.com"}
+		if err := decode(s); err != nil {
+			return nil, err
+		}
+		name := s.Topic
+		switch {
+		case s.Topic == "":
+			return nil, errors.New("topic: must be set")
+		case strings.HasPrefix(s.Topic, "projects/"):
+			if parts := strings.Split(s.Topic, "/"); len(parts) != 4 || parts[2] != "topics" {
+				return nil, errors.Errorf("topic: %q is not a topic name", s.Topic)
+			}
+		default:
+			if s.Project == "" {
+				s.Project = gcpProjectID()
+			}
+			if s.Project == "" {
+				return nil, errors.New("project: must be set, since there's no default project")
+			}
+			name = fmt.Sprintf("projects/%s/topics/%s", s.Project, s.Topic)
+		}
+
+		if host := os.Getenv("PUBSUB_EMULATOR_HOST"); host != "" {
+			s.Endpoint = "http://" + host
+		} else {
+			s.tokens = newGCPTokenSource(pubsubScope)
+		}
+		s.url = fmt.Sprintf("%s/v1/%s:publish", strings.TrimSuffix(s.Endpoint, "/"), name)
+		return s, nil
+	})
+}
+
+func (s *pubsubSink) Notify(a *alert) error {
+	data, err := json.Marshal(alertPayload(a))
+	if err != nil {
+		return err
+	}
+	attributes := map[string]string{}
+	for _, attr := range alertAttributes(a) {
+		attributes[attr[0]] = attr[1]
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"messages": []interface{}{map[string]interface{}{
+			"data":       base64.StdEncoding.EncodeToString(data),
+			"attributes": attributes,
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.tokens != nil {
+		token, err := s.tokens.get()
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "error publishing to Pub/Sub")
+	}
+	defer resp.Body.Close()
+	_, err = readResponse(resp)
+	return errors.Wrap(err, "error publishing to Pub/Sub")
+}
@@ -0,0 +1,582 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize/english"
+	"github.com/pkg/errors"
+)
+
+// slackSink posts alerts to a Slack incoming webhook, or to Channel using a
+// bot Token.
+type slackSink struct {
+	URL string `yaml:"url"`
+
+	// Blocks enables Block Kit formatting. Legacy webhooks that don't
+	// support blocks can disable it to post plain text.
+	Blocks *bool `yaml:"blocks"`
+
+	// Digest, if set, batches alerts into one summary message per window
+	Digest time.Duration `yaml:"digest"`
+
+	// RateLimit is the most messages to post per minute, on average, and
+	// RateBurst is how many can be posted at once. Alerts over the limit are
+	// dropped and counted in the next message. A RateLimit of 0 disables it.
+	RateLimit *float64 `yaml:"rate_limit"`
+	RateBurst int      `yaml:"rate_burst"`
+
+	// SANList shares the full list of a certificate's domains when the
+	// message can't list them all: "attachment" adds it as an attachment
+	// (which Slack collapses), and "file" uploads it as a text file to
+	// Channel using a bot Token with the files:write scope
+	SANList string `yaml:"san_list"`
+	Token   string `yaml:"token"`
+	Channel string `yaml:"channel"`
+
+	// UploadScreenshots uploads the screenshots enrichers take, and any
+	// other files they find, to Channel using Token after the alert
+	UploadScreenshots bool `yaml:"upload_screenshots"`
+
+	// Interactive adds buttons to alerts that acknowledge them and mute
+	// their registrable domains for MuteFor (30 days by default), handled
+	// by the Slack app's interactivity endpoint (see slackApp)
+	Interactive bool          `yaml:"interactive"`
+	MuteFor     time.Duration `yaml:"mute_for"`
+
+	// ThreadEnrichments posts alerts to Channel using Token as soon as they
+	// match, without waiting for the enrichers, and replies in the alert's
+	// thread with what they found
+	ThreadEnrichments bool `yaml:"thread_enrichments"`
+
+	digest  *digest
+	limiter *rateLimiter
+}
+
+// The default Slack rate limit, which stays under Slack's limit of about one
+// message per second per webhook.
+const (
+	defaultSlackRateLimit = 30
+	defaultSlackRateBurst = 10
+)
+
+// slackRetryAfter is how long to stop posting after Slack responds 429
+// without a Retry-After header.
+const slackRetryAfter = 30 * time.Second
+
+func init() {
+	registerSinkType("slack", func(decode func(interface{}) error) (notifier, error) {
+		s := &slackSink{}
+		if err := decode(s); err != nil {
+			return nil, err
+		}
+		if s.URL == "" && (s.Token == "" || s.Channel == "") {
+			return nil, errors.New("url: must be set, unless token and channel are")
+		}
+		if s.Digest < 0 {
+			return nil, errors.New("digest: must not be negative")
+		}
+		if s.RateLimit != nil && *s.RateLimit < 0 {
+			return nil, errors.New("rate_limit: must not be negative")
+		}
+		if s.RateBurst < 0 {
+			return nil, errors.New("rate_burst: must not be negative")
+		}
+		switch s.SANList {
+		case "", "attachment":
+		case "file":
+			if s.Token == "" || s.Channel == "" {
+				return nil, errors.New("san_list: \"file\" requires token and channel")
+			}
+		default:
+			return nil, errors.Errorf("san_list: must be \"attachment\" or \"file\", not %q", s.SANList)
+		}
+		if s.UploadScreenshots && (s.Token == "" || s.Channel == "") {
+			return nil, errors.New("upload_screenshots: requires token and channel")
+		}
+		if s.Interactive && s.Blocks != nil && !*s.Blocks {
+			return nil, errors.New("interactive: requires blocks")
+		}
+		if s.ThreadEnrichments && (s.Token == "" || s.Channel == "") {
+			return nil, errors.New("thread_enrichments: requires token and channel")
+		}
+		if s.ThreadEnrichments && s.Digest > 0 {
+			return nil, errors.New("thread_enrichments: can't be used with digest")
+		}
+		if s.MuteFor < 0 {
+			return nil, errors.New("mute_for: must not be negative")
+		}
+		if s.MuteFor == 0 {
+			s.MuteFor = 30 * 24 * time.Hour
+		}
+		if s.Digest > 0 {
+			s.digest = newDigest(s.Digest, s.sendDigest)
+		}
+		rate := float64(defaultSlackRateLimit)
+		if s.RateLimit != nil {
+			rate = *s.RateLimit
+		}
+		if s.RateBurst == 0 {
+			s.RateBurst = defaultSlackRateBurst
+		}
+		if rate > 0 {
+			s.limiter = newRateLimiter(rate, s.RateBurst)
+		}
+		return s, nil
+	})
+}
+
+// slackWebhookPath matches the path of an incoming webhook's URL.
+var slackWebhookPath = regexp.MustCompile(`^/services/T[A-Z0-9]+/B[A-Z0-9]+/[A-Za-z0-9]+$`)
+
+func (s *slackSink) check() error {
+	if s.URL == "" {
+		return nil
+	}
+	if err := checkURL(s.URL); err != nil {
+		return errors.Wrap(err, "url")
+	}
+	if u, _ := url.Parse(s.URL); u.Host == "hooks.slack.com" && strings.HasPrefix(u.Path, "/services/") && !slackWebhookPath.MatchString(u.Path) {
+		return errors.New("url: doesn't look like an incoming webhook URL (https://hooks.slack.com/services/T.../B.../...)")
+	}
+	if s.Token != "" && !strings.HasPrefix(s.Token, "xoxb-") && !strings.HasPrefix(s.Token, "xoxp-") {
+		return errors.New("token: must be a bot (xoxb-) or user (xoxp-) token")
+	}
+	return nil
+}
+
+func (s *slackSink) Notify(a *alert) error {
+	_, err := s.notify(a)
+	return err
+}
+
+// Threaded implements threader, if enrichments are threaded.
+func (s *slackSink) Threaded() bool {
+	return s.ThreadEnrichments
+}
+
+// NotifyEarly posts an alert before it's enriched, returning the message's
+// timestamp, which its thread is known by.
+func (s *slackSink) NotifyEarly(a *alert) (string, error) {
+	return s.notify(a)
+}
+
+// FollowUp replies in an alert's thread with what the enrichers found, and
+// uploads any files they found there. An escalation is noted first, and sent
+// to the channel too so it isn't missed.
+func (s *slackSink) FollowUp(a *alert, thread string, escalated bool) error {
+	lines := a.EnrichmentLines()
+	if len(lines) > 0 {
+		lines = append([]string{"*Enrichments*"}, lines...)
+	}
+	if escalated {
+		lines = append([]string{fmt.Sprintf("%s Escalated to *%s*", a.Severity.Emoji(), a.Severity)}, lines...)
+	}
+	if len(lines) > 0 {
+		payload := map[string]interface{}{
+			"text":      truncate(strings.Join(lines, "\n"), 3000),
+			"thread_ts": thread,
+		}
+		if escalated {
+			payload["reply_broadcast"] = "true"
+		}
+		if err := slackPostMessage(s.Token, s.Channel, payload, nil); err != nil {
+			return errors.Wrap(err, "error replying in Slack thread")
+		}
+	}
+	s.uploadFiles(a, thread)
+	return nil
+}
+
+// notify posts an alert, returning the message's timestamp if it was posted
+// with chat.postMessage.
+func (s *slackSink) notify(a *alert) (string, error) {
+	if s.digest != nil {
+		s.digest.add(a)
+		return "", nil
+	}
+
+	suppressed := ""
+	if s.limiter != nil {
+		if !s.limiter.allow() {
+			return "", errRateLimited
+		}
+		if n := s.limiter.takeSuppressed(); n > 0 {
+			suppressed = fmt.Sprintf("%s suppressed by the rate limit since the last message", english.Plural(n, "alert was", "alerts were"))
+		}
+	}
+
+	if (s.Blocks != nil && !*s.Blocks) || a.Message != "" {
+		// a templated message replaces the blocks
+		text := a.MessageOr(a.Severity.Emoji() + " " + a.Text() + "\n" + a.Details())
+		if lines := a.EnrichmentLines(); len(lines) > 0 && a.Message == "" {
+			text += "\n" + strings.Join(lines, "\n")
+		}
+		if suppressed != "" {
+			text += "\n_" + suppressed + "_"
+		}
+		payload := map[string]interface{}{"text": text}
+		if s.Interactive {
+			// the buttons need blocks to go in
+			payload["blocks"] = []interface{}{
+				map[string]interface{}{"type": "section", "text": map[string]interface{}{"type": "mrkdwn", "text": truncate(text, 3000)}},
+				map[string]interface{}{"type": "actions", "elements": slackAlertButtons(a, s.MuteFor)},
+			}
+		}
+		s.addSANAttachment(payload, a)
+		ts, err := s.post(payload)
+		if err != nil {
+			return "", errors.Wrap(err, "error sending Slack webhook")
+		}
+		s.uploadSANList(a)
+		s.uploadFiles(a, "")
+		return ts, nil
+	}
+
+	// the text is shown in notifications and by clients that can't render blocks
+	blocks := slackBlocks(a)
+	if s.Interactive {
+		for _, block := range blocks {
+			if b := block.(map[string]interface{}); b["type"] == "actions" {
+				b["elements"] = append(b["elements"].([]interface{}), slackAlertButtons(a, s.MuteFor)...)
+			}
+		}
+	}
+	if suppressed != "" {
+		blocks = append(blocks, map[string]interface{}{
+			"type":     "context",
+			"elements": []interface{}{map[string]interface{}{"type": "mrkdwn", "text": suppressed}},
+		})
+	}
+	payload := map[string]interface{}{
+		"text":   a.Severity.Emoji() + " " + a.Text(),
+		"blocks": blocks,
+	}
+	s.addSANAttachment(payload, a)
+	ts, err := s.post(payload)
+	if err != nil {
+		return "", errors.Wrap(err, "error sending Slack webhook")
+	}
+	s.uploadSANList(a)
+	s.uploadFiles(a, "")
+	return ts, nil
+}
+
+// addSANAttachment adds the certificate's full domain list to a message
+// payload as an attachment, if configured and needed.
+func (s *slackSink) addSANAttachment(payload map[string]interface{}, a *alert) {
+	if s.SANList != "attachment" || !a.Truncated() {
+		return
+	}
+	title := fmt.Sprintf("All %d domains", len(a.AllDomains))
+	payload["attachments"] = []interface{}{
+		map[string]interface{}{
+			"fallback": title,
+			"title":    title,
+			"text":     truncate(strings.Join(a.AllDomains, "\n"), 8000),
+		},
+	}
+}
+
+// uploadSANList uploads the certificate's full domain list as a text file,
+// if configured and needed. The alert has already been sent, so errors are
+// only logged.
+func (s *slackSink) uploadSANList(a *alert) {
+	if s.SANList != "file" || !a.Truncated() {
+		return
+	}
+	name := strings.ToLower(strings.Replace(a.Fingerprint, ":", "", -1)) + "-domains.txt"
+	comment := fmt.Sprintf("All %d domains in the certificate matching %s: %s", len(a.AllDomains), a.Rule, a.CertURL)
+	err := slackUploadFile(s.Token, s.Channel, "", name, "Certificate domains", comment, []byte(strings.Join(a.AllDomains, "\n")+"\n"))
+	if err != nil {
+		log.WithError(err).WithField("fingerprint", a.Fingerprint).Error("error uploading domain list to Slack")
+	}
+}
+
+// uploadFiles uploads the files enrichers found, like screenshots, if
+// configured, in thread if it's set. The alert has already been sent, so
+// errors are only logged.
+func (s *slackSink) uploadFiles(a *alert, thread string) {
+	if !s.UploadScreenshots {
+		return
+	}
+	for _, e := range a.Enrichments {
+		if len(e.Data) == 0 {
+			continue
+		}
+		subject := valueOr(e.Domain, "the certificate")
+		name := strings.ToLower(strings.Replace(e.Name, " ", "-", -1)) + "-" + valueOr(e.Domain, "certificate") + slackFileExtension(e.Data)
+		comment := fmt.Sprintf("%s of %s (%s)", e.Name, subject, a.Rule)
+		if err := slackUploadFile(s.Token, s.Channel, thread, name, e.Name+" of "+subject, comment, e.Data); err != nil {
+			log.WithError(err).WithField("fingerprint", a.Fingerprint).WithField("enricher", e.Source).Error("error uploading file to Slack")
+		}
+	}
+}
+
+// slackFileExtension guesses the extension of a file by its content.
+func slackFileExtension(data []byte) string {
+	switch http.DetectContentType(data) {
+	case "image/png":
+		return ".png"
+	case "image/jpeg":
+		return ".jpg"
+	}
+	return ""
+}
+
+// close stops the digest, if any.
+func (s *slackSink) Close() error {
+	if s.digest != nil {
+		s.digest.close()
+	}
+	return nil
+}
+
+// flush sends the pending digest, if any.
+func (s *slackSink) Flush() error {
+	if s.digest == nil {
+		return nil
+	}
+	return s.digest.flush()
+}
+
+// post sends a payload to the webhook, or without one (or when threading
+// enrichments), to the channel with chat.postMessage, returning the
+// message's timestamp. If Slack responds that we're being rate limited, the
+// limiter is paused for as long as Slack asks.
+func (s *slackSink) post(payload map[string]interface{}) (string, error) {
+	if s.URL == "" || s.ThreadEnrichments {
+		var posted struct {
+			TS string `json:"ts"`
+		}
+		err := slackPostMessage(s.Token, s.Channel, payload, &posted)
+		return posted.TS, err
+	}
+	err := postJSON(s.URL, nil, payload)
+	if e, ok := err.(*httpError); ok && e.StatusCode == http.StatusTooManyRequests && s.limiter != nil {
+		delay := e.RetryAfter
+		if delay == 0 {
+			delay = slackRetryAfter
+		}
+		log.WithField("retry_after", delay).Warn("rate limited by Slack, pausing alerts")
+		s.limiter.pause(delay)
+	}
+	return "", err
+}
+
+// slackBlocks formats an alert as Slack Block Kit blocks.
+func slackBlocks(a *alert) []interface{} {
+	text := func(typ, s string) map[string]interface{} {
+		return map[string]interface{}{"type": typ, "text": s}
+	}
+	button := func(label, url string) map[string]interface{} {
+		return map[string]interface{}{"type": "button", "text": text("plain_text", label), "url": url}
+	}
+
+	fields := []interface{}{
+		text("mrkdwn", "*Issuer*\n"+a.IssuerName()),
+		text("mrkdwn", fmt.Sprintf("*SANs*\n%d", len(a.AllDomains))),
+		text("mrkdwn", "*Not Before*\n"+formatTime(a.NotBefore)),
+		text("mrkdwn", "*Not After*\n"+formatTime(a.NotAfter)),
+		text("mrkdwn", "*Serial*\n`"+valueOr(a.Serial, "unknown")+"`"),
+		text("mrkdwn", "*Signature*\n"+valueOr(a.SignatureAlgorithm, "unknown")),
+	}
+	blocks := []interface{}{
+		map[string]interface{}{
+			"type": "header",
+			"text": map[string]interface{}{
+				"type":  "plain_text",
+				"text":  truncate(a.Severity.Emoji()+" Certificate matching "+a.Rule, 150),
+				"emoji": true,
+			},
+		},
+		map[string]interface{}{
+			"type": "section",
+			"text": text("mrkdwn", truncate(a.DomainListWith(func(domain string) string {
+				return a.AnnotateDomain(domain, fmt.Sprintf("<%s|%s>", crtshSearchURL(domain), domain))
+			}), 3000)),
+		},
+		map[string]interface{}{
+			"type":   "section",
+			"fields": fields,
+		},
+	}
+	if lines := a.EnrichmentLines(); len(lines) > 0 {
+		blocks = append(blocks, map[string]interface{}{
+			"type": "section",
+			"text": text("mrkdwn", truncate("*Enrichments*\n"+strings.Join(lines, "\n"), 3000)),
+		})
+	}
+	return append(blocks,
+		map[string]interface{}{
+			"type": "actions",
+			"elements": []interface{}{
+				button("View on crt.sh", a.CertURL),
+				button("Search Censys", censysURL(a.Fingerprint)),
+			},
+		},
+		map[string]interface{}{
+			"type": "context",
+			"elements": []interface{}{
+				text("mrkdwn", slackContext(a)),
+			},
+		},
+	)
+}
+
+// slackContext is the small print under an alert: the pattern, fingerprint,
+// and CT log entry.
+func slackContext(a *alert) string {
+	context := fmt.Sprintf("Pattern `%s` · Fingerprint `%s`", a.Pattern, a.Fingerprint)
+	source := a.Source()
+	if source == "" {
+		return context
+	}
+	if url := a.EntryURL(); url != "" {
+		source = fmt.Sprintf("<%s|%s>", url, source)
+	}
+	return context + " · " + source
+}
+
+// maxDigestDomains limits the number of domains listed in a digest message.
+const maxDigestDomains = 200
+
+// sendDigest posts a single message summarizing a batch of alerts, with
+// counts per rule and the matching domains in an attachment, which Slack
+// collapses behind "Show more" when it's long.
+func (s *slackSink) sendDigest(alerts []*alert) error {
+	return s.sendSummary(alerts, fmt.Sprintf("%d matching certificates in the last %s", len(alerts), s.Digest))
+}
+
+// sendSummary posts a digest of alerts, like sendDigest, headed by summary.
+func (s *slackSink) sendSummary(alerts []*alert, summary string) error {
+	counts := map[string]int{}
+	rules := []string{}
+	lines := []string{}
+	worst := severityInfo
+	for _, a := range alerts {
+		if a.Severity > worst {
+			worst = a.Severity
+		}
+		if counts[a.Rule] == 0 {
+			rules = append(rules, a.Rule)
+		}
+		counts[a.Rule]++
+		for _, domain := range a.Domains {
+			lines = append(lines, fmt.Sprintf("%s (%s) <%s|crt.sh>", a.FormatDomain(domain), a.Rule, a.CertURL))
+		}
+	}
+	sort.Strings(rules)
+
+	ruleCounts := []string{}
+	for _, r := range rules {
+		ruleCounts = append(ruleCounts, fmt.Sprintf("*%s*: %d", r, counts[r]))
+	}
+	if len(lines) > maxDigestDomains {
+		lines = append(lines[:maxDigestDomains], fmt.Sprintf("and %d more", len(lines)-maxDigestDomains))
+	}
+
+	payload := map[string]interface{}{
+		"text": summary,
+		"attachments": []interface{}{
+			map[string]interface{}{
+				"fallback":  summary,
+				"color":     fmt.Sprintf("#%06x", worst.Color()),
+				"pretext":   strings.Join(ruleCounts, " · "),
+				"text":      strings.Join(lines, "\n"),
+				"mrkdwn_in": []string{"pretext", "text"},
+			},
+		},
+	}
+	if s.Blocks == nil || *s.Blocks {
+		payload["blocks"] = []interface{}{
+			map[string]interface{}{
+				"type": "header",
+				"text": map[string]interface{}{"type": "plain_text", "text": summary},
+			},
+			map[string]interface{}{
+				"type": "section",
+				"text": map[string]interface{}{"type": "mrkdwn", "text": strings.Join(ruleCounts, "\n")},
+			},
+		}
+	}
+	_, err := s.post(payload)
+	return errors.Wrap(err, "error sending Slack digest")
+}
+
+// sendReport posts a report, with a header for its title and a line for
+// each statistic.
+func (s *slackSink) sendReport(title string, lines []string) error {
+	text := strings.Join(lines, "\n")
+	payload := map[string]interface{}{"text": title + "\n" + text}
+	if s.Blocks == nil || *s.Blocks {
+		payload["blocks"] = []interface{}{
+			map[string]interface{}{
+				"type": "header",
+				"text": map[string]interface{}{"type": "plain_text", "text": truncate(title, 150)},
+			},
+			map[string]interface{}{
+				"type": "section",
+				"text": map[string]interface{}{"type": "mrkdwn", "text": truncate(text, 3000)},
+			},
+		}
+	}
+	_, err := s.post(payload)
+	return errors.Wrap(err, "error sending Slack report")
+}
+
+// crtshSearchURL links to crt.sh's list of certificates for a domain.
+func crtshSearchURL(domain string) string {
+	return "https://crt.sh/?q=" + url.QueryEscape(domain)
+}
+
+// censysURL links to a Censys search for the certificate's SHA-1 fingerprint.
+func censysURL(fingerprint string) string {
+	hex := strings.ToLower(strings.Replace(fingerprint, ":", "", -1))
+	return "https://search.censys.io/certificates?q=" + url.QueryEscape("fingerprint_sha1: "+hex)
+}
+
+// formatTime formats a certificate timestamp for display.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+	return t.UTC().Format("2006-01-02 15:04 MST")
+}
+
+// valueOr returns s, or def if s is empty.
+func valueOr(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// truncate shortens s to at most n characters.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// snsSink publishes each alert to an AWS SNS topic as JSON, with the rule
+// and severity as message attributes for subscription filter policies.
+type snsSink struct {
+	TopicARN string `yaml:"topic_arn"`
+
+	// Region defaults to the topic's, and Endpoint overrides the regional
+	// endpoint, such as for LocalStack
+	Region   string `yaml:"region"`
+	Endpoint string `yaml:"endpoint"`
+}
+
+func init() {
+	registerSinkType("sns", func(decode func(interface{}) error) (notifier, error) {
+		s := &snsSink{}
+		if err := decode(s); err != nil {
+			return nil, err
+		}
+		// like "arn:aws:sns:us-east-1:123456789012:certstream-matches"
+		arn := strings.Split(s.TopicARN, ":")
+		if len(arn) != 6 || arn[0] != "arn" || arn[2] != "sns" {
+			return nil, errors.Errorf("topic_arn: %q is not an SNS topic ARN", s.TopicARN)
+		}
+		if s.Region == "" {
+			s.Region = arn[3]
+		}
+		if s.Endpoint == "" {
+			s.Endpoint = fmt.Sprintf("https://sns.%s.amazonaws.com/", s.Region)
+		}
+		return s, nil
+	})
+}
+
+func (s *snsSink) Notify(a *alert) error {
+	message, err := json.Marshal(alertPayload(a))
+	if err != nil {
+		return err
+	}
+	form := url.Values{
+		"Action":   {"Publish"},
+		"Version":  {"2010-03-31"},
+		"TopicArn": {s.TopicARN},
+		"Message":  {string(message)},
+		// subjects are used by email subscriptions and limited to 100
+		// characters of printable ASCII
+		"Subject": {truncate(strings.Map(func(r rune) rune {
+			if r < ' ' || r > '~' {
+				return '?'
+			}
+			return r
+		}, a.Summary()), 100)},
+	}
+	for i, attr := range alertAttributes(a) {
+		prefix := fmt.Sprintf("MessageAttributes.entry.%d.", i+1)
+		form.Set(prefix+"Name", attr[0])
+		form.Set(prefix+"Value.DataType", "String")
+		form.Set(prefix+"Value.StringValue", attr[1])
+	}
+	if strings.HasSuffix(s.TopicARN, ".fifo") {
+		form.Set("MessageGroupId", a.Rule)
+		form.Set("MessageDeduplicationId", awsDeduplicationID(a))
+	}
+	headers := map[string]string{"Content-Type": "application/x-www-form-urlencoded; charset=utf-8"}
+	_, err = awsRequest("sns", s.Region, s.Endpoint, headers, []byte(form.Encode()))
+	return errors.Wrap(err, "error publishing to SNS")
+}
+
+// awsDeduplicationID identifies an alert for FIFO topics and queues, which
+// drop repeats of a message sent within five minutes.
+func awsDeduplicationID(a *alert) string {
+	return sha256Hex([]byte(a.Fingerprint + " " + a.Rule))
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/heptiolabs/certstream-slack/pkg/stream"
+)
+
+// splunkSink sends each alert as a structured event to a Splunk HTTP Event
+// Collector.
+type splunkSink struct {
+	// URL is the HEC's base URL, like "https://splunk.example.com:8088", or
+	// the full URL of its event endpoint
+	URL   string `yaml:"url"`
+	Token string `yaml:"token"`
+
+	// SourceType, Source, Index, and Host set the events' metadata, where
+	// an empty Index or Host uses the token's default
+	SourceType string `yaml:"sourcetype"`
+	Source     string `yaml:"source"`
+	Index      string `yaml:"index"`
+	Host       string `yaml:"host"`
+}
+
+func init() {
+	registerSinkType("splunk", func(decode func(interface{}) error) (notifier, error) {
+		s := &splunkSink{SourceType: "certstream:match", Source: "certstream-slack"}
+		if err := decode(s); err != nil {
+			return nil, err
+		}
+		if s.URL == "" {
+			return nil, errors.New("url: must be set")
+		}
+		if s.Token == "" {
+			return nil, errors.New("token: must be set")
+		}
+		if !strings.Contains(s.URL, "/services/collector") {
+			s.URL = strings.TrimSuffix(s.URL, "/") + "/services/collector/event"
+		}
+		return s, nil
+	})
+}
+
+func (s *splunkSink) check() error {
+	if err := checkURL(s.URL); err != nil {
+		return errors.Wrap(err, "url")
+	}
+	if !uuidPattern.MatchString(s.Token) {
+		return errors.New("token: must be a HEC token like 01234567-89ab-cdef-0123-456789abcdef")
+	}
+	return nil
+}
+
+func (s *splunkSink) Notify(a *alert) error {
+	event := map[string]interface{}{
+		"rule":        a.Rule,
+		"pattern":     a.Pattern,
+		"severity":    a.Severity.String(),
+		"domains":     a.Domains,
+		"all_domains": a.AllDomains,
+		"fingerprint": a.Fingerprint,
+		"cert_url":    a.CertURL,
+		"issuer":      a.Issuer,
+		"serial":      a.Serial,
+		"not_before":  a.NotBefore.UTC(),
+		"not_after":   a.NotAfter.UTC(),
+		"log_name":    a.SourceName,
+		"log_url":     a.SourceURL,
+		"cert_index":  a.CertIndex,
+	}
+	if len(a.Original) > 0 {
+		event["original_domains"] = a.Original
+	}
+	if len(a.Reasons) > 0 {
+		event["reasons"] = a.Reasons
+	}
+	if u, ok := a.Data.(*stream.CertificateUpdate); ok {
+		event["leaf_cert"] = u.Fields()["leaf_cert"]
+	}
+
+	payload := map[string]interface{}{
+		// HEC takes epoch seconds, with a fraction for subsecond precision
+		"time":       float64(a.Seen.UnixNano()) / 1e9,
+		"sourcetype": s.SourceType,
+		"source":     s.Source,
+		"event":      event,
+	}
+	if s.Index != "" {
+		payload["index"] = s.Index
+	}
+	if s.Host != "" {
+		payload["host"] = s.Host
+	}
+	headers := map[string]string{"Authorization": "Splunk " + s.Token}
+	return errors.Wrap(postJSON(s.URL, headers, payload), "error sending Splunk event")
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// sqsSink sends each alert to an AWS SQS queue as JSON, with the rule and
+// severity as message attributes.
+type sqsSink struct {
+	// QueueURL is like
+	// "https://sqs.us-east-1.amazonaws.com/123456789012/certstream-matches"
+	QueueURL string `yaml:"queue_url"`
+
+	// Region defaults to the queue's, and Endpoint overrides the regional
+	// endpoint, such as for LocalStack
+	Region   string `yaml:"region"`
+	Endpoint string `yaml:"endpoint"`
+}
+
+func init() {
+	registerSinkType("sqs", func(decode func(interface{}) error) (notifier, error) {
+		s := &sqsSink{}
+		if err := decode(s); err != nil {
+			return nil, err
+		}
+		u, err := url.Parse(s.QueueURL)
+		if err != nil || u.Host == "" || strings.Count(strings.Trim(u.Path, "/"), "/") != 1 {
+			return nil, errors.Errorf("queue_url: %q is not an SQS queue URL", s.QueueURL)
+		}
+		if s.Region == "" {
+			// like "sqs.us-east-1.amazonaws.com", or the legacy
+			// "us-east-1.queue.amazonaws.com"
+			labels := strings.Split(u.Hostname(), ".")
+			switch {
+			case len(labels) >= 4 && labels[0] == "sqs":
+				s.Region = labels[1]
+			case len(labels) >= 4 && labels[1] == "queue":
+				s.Region = labels[0]
+			default:
+				s.Region = awsRegionFromEnv()
+			}
+			if s.Region == "" {
+				return nil, errors.New("region: must be set for this queue URL")
+			}
+		}
+		if s.Endpoint == "" {
+			s.Endpoint = fmt.Sprintf("https://sqs.%s.amazonaws.com/", s.Region)
+		}
+		return s, nil
+	})
+}
+
+func (s *sqsSink) Notify(a *alert) error {
+	body, err := json.Marshal(alertPayload(a))
+	if err != nil {
+		return err
+	}
+	type attribute struct {
+		DataType    string `json:"DataType"`
+		StringValue string `json:"StringValue"`
+	}
+	attrs := map[string]attribute{}
+	for _, attr := range alertAttributes(a) {
+		attrs[attr[0]] = attribute{DataType: "String", StringValue: attr[1]}
+	}
+	request := map[string]interface{}{
+		"QueueUrl":          s.QueueURL,
+		"MessageBody":       string(body),
+		"MessageAttributes": attrs,
+	}
+	if strings.HasSuffix(s.QueueURL, ".fifo") {
+		request["MessageGroupId"] = a.Rule
+		request["MessageDeduplicationId"] = awsDeduplicationID(a)
+	}
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{
+		"Content-Type": "application/x-amz-json-1.0",
+		"X-Amz-Target": "AmazonSQS.SendMessage",
+	}
+	_, err = awsRequest("sqs", s.Region, s.Endpoint, headers, payload)
+	return errors.Wrap(err, "error sending to SQS")
+}
@@ -0,0 +1,38 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+)
+
+// stdoutSink prints alerts to standard output.
+type stdoutSink struct{}
+
+func init() {
+	registerSinkType("stdout", func(decode func(interface{}) error) (notifier, error) {
+		s := &stdoutSink{}
+		if err := decode(s); err != nil {
+			return nil, err
+		}
+		return s, nil
+	})
+}
+
+func (s *stdoutSink) Notify(a *alert) error {
+	_, err := fmt.Println(a.MessageOr(fmt.Sprintf("[%s] %s", a.Rule, a.Text())))
+	return err
+}
@@ -0,0 +1,317 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// stixSink writes each alert as a STIX 2.1 bundle, with domain-name and
+// x509-certificate objects for the certificate and an indicator matching
+// its domains, to a file (one bundle per line) or a TAXII 2.1 collection.
+type stixSink struct {
+	// Path is a file to append bundles to
+	Path string `yaml:"path"`
+
+	// TAXIIURL is a TAXII 2.1 collection to add objects to, like
+	// "https://taxii.example.com/api1/collections/9cfa669c-ee94-4ece-afd2-f8edac37d8fd/"
+	TAXIIURL string `yaml:"taxii_url"`
+
+	// Username and Password, or Token, authenticate to the TAXII server
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Token    string `yaml:"token"`
+
+	// CAFile verifies the TAXII server against it, instead of the system
+	// roots
+	CAFile string `yaml:"ca_file"`
+
+	// TLP marks the objects with a TLP level: "clear", "green", "amber",
+	// or "red"
+	TLP string `yaml:"tlp"`
+
+	marking string
+	client  *http.Client
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// stixTLPMarkings are the IDs of the TLP marking definitions in STIX 2.1.
+var stixTLPMarkings = map[string]string{
+	"clear": "marking-definition--613f2e26-407d-48c7-9eca-b8e91df99dc9",
+	"white": "marking-definition--613f2e26-407d-48c7-9eca-b8e91df99dc9",
+	"green": "marking-definition--34098fce-860f-48ae-8e50-ebd3cc5e41da",
+	"amber": "marking-definition--f88d31f6-486f-44da-b317-01333bde0b82",
+	"red":   "marking-definition--5e57c739-391a-4eb3-b6be-7d15ca92d5ed",
+}
+
+func init() {
+	registerSinkType("stix", func(decode func(interface{}) error) (notifier, error) {
+		s := &stixSink{}
+		if err := decode(s); err != nil {
+			return nil, err
+		}
+		if (s.Path == "") == (s.TAXIIURL == "") {
+			return nil, errors.New("path: exactly one of path and taxii_url must be set")
+		}
+		if s.TLP != "" {
+			if s.marking = stixTLPMarkings[s.TLP]; s.marking == "" {
+				return nil, errors.Errorf("tlp: must be \"clear\", \"green\", \"amber\", or \"red\", not %q", s.TLP)
+			}
+		}
+		if s.Path != "" {
+			file, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+			if err != nil {
+				return nil, errors.Wrap(err, "path")
+			}
+			s.file = file
+			return s, nil
+		}
+		if !strings.HasSuffix(s.TAXIIURL, "/") {
+			s.TAXIIURL += "/"
+		}
+		var err error
+		if s.client, err = newHTTPClient(s.CAFile); err != nil {
+			return nil, errors.Wrap(err, "ca_file")
+		}
+		return s, nil
+	})
+}
+
+// stixNamespace is the namespace for the deterministic IDs of STIX cyber
+// observables, from the STIX 2.1 specification.
+var stixNamespace = [16]byte{0x00, 0xab, 0xed, 0xb4, 0xaa, 0x42, 0x46, 0x6c, 0x9c, 0x01, 0xfe, 0xd2, 0x33, 0x15, 0xa9, 0xb7}
+
+// stixID returns an ID for an object of the given type. If contributing is
+// set, the ID is derived from its JSON (a UUIDv5), so objects describing the
+// same thing have the same ID. Otherwise it's random (a UUIDv4).
+func stixID(kind string, contributing interface{}) string {
+	var uuid [16]byte
+	if contributing != nil {
+		// encoding/json sorts keys, which is canonical enough for the plain
+		// strings in these objects
+		var name bytes.Buffer
+		enc := json.NewEncoder(&name)
+		enc.SetEscapeHTML(false)
+		enc.Encode(contributing)
+		sum := sha1.Sum(append(stixNamespace[:], bytes.TrimSpace(name.Bytes())...))
+		copy(uuid[:], sum[:])
+		uuid[6] = uuid[6]&0x0f | 0x50
+	} else {
+		rand.Read(uuid[:])
+		uuid[6] = uuid[6]&0x0f | 0x40
+	}
+	uuid[8] = uuid[8]&0x3f | 0x80
+	return fmt.Sprintf("%s--%x-%x-%x-%x-%x", kind, uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+}
+
+// stixTime formats a time as a STIX timestamp.
+func stixTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// stixIdentity identifies us as the creator of indicators.
+var stixIdentity = map[string]interface{}{
+	"type":           "identity",
+	"spec_version":   "2.1",
+	"id":             stixID("identity", map[string]string{"name": "certstream-slack"}),
+	"created":        "2017-11-01T00:00:00.000Z",
+	"modified":       "2017-11-01T00:00:00.000Z",
+	"name":           "certstream-slack",
+	"identity_class": "system",
+}
+
+// objects returns the STIX objects describing an alert.
+func (s *stixSink) objects(a *alert, now time.Time) []map[string]interface{} {
+	mark := func(object map[string]interface{}) map[string]interface{} {
+		if s.marking != "" {
+			object["object_marking_refs"] = []string{s.marking}
+		}
+		return object
+	}
+
+	// the certificate, identified by its hashes and serial
+	hashes := map[string]string{}
+	for algorithm, fingerprint := range map[string]string{"SHA-1": a.Fingerprint, "SHA-256": a.SHA256} {
+		if fingerprint != "" {
+			hashes[algorithm] = strings.ToLower(strings.Replace(fingerprint, ":", "", -1))
+		}
+	}
+	contributing := map[string]interface{}{"hashes": hashes}
+	if a.Serial != "" {
+		contributing["serial_number"] = a.Serial
+	}
+	cert := mark(map[string]interface{}{
+		"type":         "x509-certificate",
+		"spec_version": "2.1",
+		"id":           stixID("x509-certificate", contributing),
+		"hashes":       hashes,
+	})
+	if a.Serial != "" {
+		cert["serial_number"] = a.Serial
+	}
+	if a.Issuer != "" {
+		cert["issuer"] = a.Issuer
+	}
+	if !a.NotBefore.IsZero() {
+		cert["validity_not_before"] = stixTime(a.NotBefore)
+	}
+	if !a.NotAfter.IsZero() {
+		cert["validity_not_after"] = stixTime(a.NotAfter)
+	}
+	if a.SignatureAlgorithm != "" {
+		cert["signature_algorithm"] = a.SignatureAlgorithm
+	}
+	sans := []string{}
+	for _, domain := range a.AllDomains {
+		sans = append(sans, "DNS:"+domain)
+	}
+	if len(sans) > 0 {
+		cert["x509_v3_extensions"] = map[string]string{"subject_alternative_name": strings.Join(sans, ", ")}
+	}
+
+	objects := []map[string]interface{}{stixIdentity, cert}
+	refs := []string{cert["id"].(string)}
+	patterns := []string{}
+	escape := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	for _, domain := range a.Domains {
+		d := mark(map[string]interface{}{
+			"type":         "domain-name",
+			"spec_version": "2.1",
+			"id":           stixID("domain-name", map[string]string{"value": domain}),
+			"value":        domain,
+		})
+		objects = append(objects, d)
+		refs = append(refs, d["id"].(string))
+		patterns = append(patterns, fmt.Sprintf("[domain-name:value = '%s']", escape.Replace(domain)))
+	}
+
+	// the indicator and the observation it's based on, identified by the
+	// certificate and rule so repeats update the same objects
+	key := map[string]string{"fingerprint": a.Fingerprint, "rule": a.Rule}
+	observed := mark(map[string]interface{}{
+		"type":            "observed-data",
+		"spec_version":    "2.1",
+		"id":              stixID("observed-data", key),
+		"created":         stixTime(now),
+		"modified":        stixTime(now),
+		"created_by_ref":  stixIdentity["id"],
+		"first_observed":  stixTime(a.Seen),
+		"last_observed":   stixTime(a.Seen),
+		"number_observed": 1,
+		"object_refs":     refs,
+	})
+	indicator := mark(map[string]interface{}{
+		"type":            "indicator",
+		"spec_version":    "2.1",
+		"id":              stixID("indicator", key),
+		"created":         stixTime(now),
+		"modified":        stixTime(now),
+		"created_by_ref":  stixIdentity["id"],
+		"name":            a.Summary(),
+		"description":     a.MessageOr(a.Details()),
+		"indicator_types": []string{"anomalous-activity"},
+		"pattern":         strings.Join(patterns, " OR "),
+		"pattern_type":    "stix",
+		"valid_from":      stixTime(a.Seen),
+		"labels":          []string{a.Rule, a.Severity.String()},
+		"external_references": []map[string]string{
+			{"source_name": "crt.sh", "url": a.CertURL},
+		},
+	})
+	relationship := mark(map[string]interface{}{
+		"type":              "relationship",
+		"spec_version":      "2.1",
+		"id":                stixID("relationship", key),
+		"created":           stixTime(now),
+		"modified":          stixTime(now),
+		"created_by_ref":    stixIdentity["id"],
+		"relationship_type": "based-on",
+		"source_ref":        indicator["id"],
+		"target_ref":        observed["id"],
+	})
+	return append(objects, observed, indicator, relationship)
+}
+
+func (s *stixSink) check() error {
+	if s.TAXIIURL == "" {
+		return nil
+	}
+	return errors.Wrap(checkURL(s.TAXIIURL), "taxii_url")
+}
+
+func (s *stixSink) Notify(a *alert) error {
+	objects := s.objects(a, time.Now())
+	if s.file != nil {
+		line, err := json.Marshal(map[string]interface{}{
+			"type":    "bundle",
+			"id":      stixID("bundle", nil),
+			"objects": objects,
+		})
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		_, err = s.file.Write(append(line, '\n'))
+		return errors.Wrap(err, "error writing STIX bundle")
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"objects": objects})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", s.TAXIIURL+"objects/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/taxii+json;version=2.1")
+	req.Header.Set("Content-Type", "application/taxii+json;version=2.1")
+	switch {
+	case s.Token != "":
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	case s.Username != "":
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "error adding STIX objects to TAXII collection")
+	}
+	defer resp.Body.Close()
+	_, err = readResponse(resp)
+	return errors.Wrap(err, "error adding STIX objects to TAXII collection")
+}
+
+func (s *stixSink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// syslogFacilities are the RFC 5424 facility codes, by name.
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslogSDID is the ID of the structured data element with an alert's
+// details. 32473 is the private enterprise number reserved for examples
+// (RFC 5612), since we don't have our own.
+const syslogSDID = "certstream@32473"
+
+// syslogSink sends each alert as an RFC 5424 syslog message, with the
+// domains, fingerprint, and other certificate details as structured data.
+type syslogSink struct {
+	// Address is like "udp://siem.example.com:514",
+	// "tcp://siem.example.com:601", or "tls://siem.example.com:6514"
+	Address string `yaml:"address"`
+
+	// Facility is a facility name, like "local0" (the default) or "auth"
+	Facility string `yaml:"facility"`
+
+	// Framing separates messages over TCP and TLS, either "octet-counting"
+	// (the default, from RFC 6587) or "newline"
+	Framing string `yaml:"framing"`
+
+	// CAFile verifies a TLS server against it, instead of the system roots
+	CAFile string `yaml:"ca_file"`
+
+	network  string // "udp", "tcp", or "tls"
+	host     string
+	facility int
+	hostname string
+	tls      *tls.Config
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func init() {
+	registerSinkType("syslog", func(decode func(interface{}) error) (notifier, error) {
+		s := &syslogSink{Facility: "local0", Framing: "octet-counting"}
+		if err := decode(s); err != nil {
+			return nil, err
+		}
+		u, err := url.Parse(s.Address)
+		if err != nil || u.Host == "" {
+			return nil, errors.Errorf("address: %q must be like udp://host:514, tcp://host:601, or tls://host:6514", s.Address)
+		}
+		ports := map[string]string{"udp": "514", "tcp": "601", "tls": "6514"}
+		port, ok := ports[u.Scheme]
+		if !ok {
+			return nil, errors.Errorf("address: unsupported scheme %q (must be udp, tcp, or tls)", u.Scheme)
+		}
+		s.network, s.host = u.Scheme, u.Host
+		if u.Port() == "" {
+			s.host = net.JoinHostPort(u.Hostname(), port)
+		}
+		if s.facility, ok = syslogFacilities[s.Facility]; !ok {
+			return nil, errors.Errorf("facility: unknown facility %q", s.Facility)
+		}
+		if s.Framing != "octet-counting" && s.Framing != "newline" {
+			return nil, errors.Errorf("framing: must be \"octet-counting\" or \"newline\", not %q", s.Framing)
+		}
+		if s.network == "tls" {
+			if s.tls, err = newTLSConfig(s.CAFile); err != nil {
+				return nil, errors.Wrap(err, "ca_file")
+			}
+			s.tls.ServerName = u.Hostname()
+		} else if s.CAFile != "" {
+			return nil, errors.New("ca_file: address must use tls")
+		}
+		if s.hostname, err = os.Hostname(); err != nil || s.hostname == "" {
+			s.hostname = "-"
+		}
+		return s, nil
+	})
+}
+
+// syslogSeverity maps a rule's severity to a syslog severity.
+func syslogSeverity(s severity) int {
+	switch s {
+	case severityInfo:
+		return 6 // informational
+	case severityCritical:
+		return 2 // critical
+	}
+	return 4 // warning
+}
+
+func (s *syslogSink) Notify(a *alert) error {
+	msg := s.format(a, time.Now())
+	if s.network != "udp" {
+		if s.Framing == "octet-counting" {
+			msg = fmt.Sprintf("%d %s", len(msg), msg)
+		} else {
+			msg += "\n"
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		var conn net.Conn
+		var err error
+		switch s.network {
+		case "tls":
+			conn, err = tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", s.host, s.tls)
+		default:
+			conn, err = net.DialTimeout(s.network, s.host, 10*time.Second)
+		}
+		if err != nil {
+			return errors.Wrap(err, "could not connect to syslog server")
+		}
+		s.conn = conn
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := s.conn.Write([]byte(msg)); err != nil {
+		// reconnect next time
+		s.conn.Close()
+		s.conn = nil
+		return errors.Wrap(err, "error sending syslog message")
+	}
+	return nil
+}
+
+// format returns the RFC 5424 message for an alert.
+func (s *syslogSink) format(a *alert, now time.Time) string {
+	params := [][2]string{
+		{"rule", a.Rule},
+		{"severity", a.Severity.String()},
+		{"fingerprint", a.Fingerprint},
+	}
+	domains := a.Domains
+	if len(domains) > 50 {
+		domains = domains[:50]
+	}
+	for _, domain := range domains {
+		params = append(params, [2]string{"domain", domain})
+	}
+	params = append(params,
+		[2]string{"issuer", a.IssuerName()},
+		[2]string{"serial", a.Serial},
+		[2]string{"not_before", a.NotBefore.UTC().Format(time.RFC3339)},
+		[2]string{"not_after", a.NotAfter.UTC().Format(time.RFC3339)},
+		[2]string{"cert_url", a.CertURL},
+	)
+	if a.SourceURL != "" {
+		params = append(params, [2]string{"log_url", a.SourceURL})
+	}
+
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+	var sd strings.Builder
+	sd.WriteString("[" + syslogSDID)
+	for _, p := range params {
+		fmt.Fprintf(&sd, ` %s="%s"`, p[0], escape.Replace(p[1]))
+	}
+	sd.WriteString("]")
+
+	// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG
+	return fmt.Sprintf("<%d>1 %s %s certstream-slack %d match %s %s",
+		s.facility*8+syslogSeverity(a.Severity), now.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		s.hostname, os.Getpid(), sd.String(), strings.Replace(a.MessageOr(a.Summary()), "\n", " ", -1))
+}
+
+func (s *syslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// teamsSink posts alerts to a Microsoft Teams incoming webhook as
+// MessageCards.
+type teamsSink struct {
+	URL string `yaml:"url"`
+}
+
+func init() {
+	registerSinkType("teams", func(decode func(interface{}) error) (notifier, error) {
+		s := &teamsSink{}
+		if err := decode(s); err != nil {
+			return nil, err
+		}
+		if s.URL == "" {
+			return nil, errors.New("url: must be set")
+		}
+		return s, nil
+	})
+}
+
+func (s *teamsSink) check() error {
+	return errors.Wrap(checkURL(s.URL), "url")
+}
+
+func (s *teamsSink) Notify(a *alert) error {
+	type fact struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	type section struct {
+		Text  string `json:"text"`
+		Facts []fact `json:"facts"`
+	}
+	type target struct {
+		OS  string `json:"os"`
+		URI string `json:"uri"`
+	}
+	type action struct {
+		Type    string   `json:"@type"`
+		Name    string   `json:"name"`
+		Targets []target `json:"targets"`
+	}
+
+	payload := struct {
+		Type            string    `json:"@type"`
+		Context         string    `json:"@context"`
+		Summary         string    `json:"summary"`
+		ThemeColor      string    `json:"themeColor"`
+		Title           string    `json:"title"`
+		Sections        []section `json:"sections"`
+		PotentialAction []action  `json:"potentialAction"`
+	}{
+		Type:       "MessageCard",
+		Context:    "https://schema.org/extensions",
+		Summary:    a.Text(),
+		ThemeColor: fmt.Sprintf("%06X", a.Severity.Color()),
+		Title:      a.Severity.Symbol() + " Found matching certificate",
+		Sections: []section{{
+			Text: a.DomainList(),
+			Facts: []fact{
+				{Name: "Rule", Value: a.Rule},
+				{Name: "Severity", Value: a.Severity.String()},
+				{Name: "Issuer", Value: a.IssuerName()},
+				{Name: "Valid", Value: formatTime(a.NotBefore) + " to " + formatTime(a.NotAfter)},
+				{Name: "Serial", Value: valueOr(a.Serial, "unknown")},
+				{Name: "Fingerprint", Value: a.Fingerprint},
+			},
+		}},
+		PotentialAction: []action{{
+			Type:    "OpenUri",
+			Name:    "View on crt.sh",
+			Targets: []target{{OS: "default", URI: a.CertURL}},
+		}},
+	}
+	if a.Message != "" {
+		// a templated message replaces the title and facts
+		payload.Summary = truncate(a.Message, 200)
+		payload.Title = ""
+		payload.Sections = []section{{Text: a.Message}}
+	}
+	return errors.Wrap(postJSON(s.URL, nil, payload), "error sending Teams webhook")
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// telegramAPIURL is the base URL of the Telegram Bot API.
+const telegramAPIURL = "https://api.telegram.org"
+
+// telegramSink sends alerts as Telegram messages from a bot.
+type telegramSink struct {
+	// Token is the bot's token from @BotFather
+	Token string `yaml:"token"`
+
+	// ChatID is the chat to message, either a numeric ID or a public
+	// channel's username, like "@mychannel"
+	ChatID string `yaml:"chat_id"`
+
+	// URL overrides the Bot API's base URL, such as for a local Bot API
+	// server
+	URL string `yaml:"url"`
+}
+
+func init() {
+	registerSinkType("telegram", func(decode func(interface{}) error) (notifier, error) {
+		s := &telegramSink{URL: telegramAPIURL}
+		if err := decode(s); err != nil {
+			return nil, err
+		}
+		if s.Token == "" {
+			return nil, errors.New("token: must be set")
+		}
+		if s.ChatID == "" {
+			return nil, errors.New("chat_id: must be set")
+		}
+		return s, nil
+	})
+}
+
+// telegramToken matches a bot token, like "123456:ABC-DEF1234ghIkl".
+var telegramToken = regexp.MustCompile(`^[0-9]+:[A-Za-z0-9_-]+$`)
+
+func (s *telegramSink) check() error {
+	if !telegramToken.MatchString(s.Token) {
+		return errors.New("token: must be a bot token like 123456:ABC-DEF1234ghIkl")
+	}
+	return errors.Wrap(checkURL(s.URL), "url")
+}
+
+func (s *telegramSink) Notify(a *alert) error {
+	payload := map[string]interface{}{
+		"chat_id":                  s.ChatID,
+		"text":                     telegramMessage(a),
+		"parse_mode":               "MarkdownV2",
+		"disable_web_page_preview": true,
+	}
+	if a.Message != "" {
+		// templated messages are plain text
+		payload["text"] = truncate(a.Message, 4096)
+		delete(payload, "parse_mode")
+	}
+	endpoint := fmt.Sprintf("%s/bot%s/sendMessage", strings.TrimSuffix(s.URL, "/"), s.Token)
+	err := postJSON(endpoint, nil, payload)
+	if e, ok := err.(*url.Error); ok {
+		// the URL includes the token, which shouldn't be logged
+		e.URL = strings.Replace(e.URL, s.Token, "[token]", -1)
+	}
+	return errors.Wrap(err, "error sending Telegram message")
+}
+
+// telegramMessage formats an alert in Telegram's MarkdownV2.
+func telegramMessage(a *alert) string {
+	// the rest of the list, like "and 3 others", needs no escaping
+	domains := a.DomainListWith(func(domain string) string {
+		display := "`" + telegramEscapeCode(domain) + "`"
+		notes := []string{}
+		if original, ok := a.Original[domain]; ok {
+			notes = append(notes, "`"+telegramEscapeCode(original)+"`")
+		}
+		if reason, ok := a.Reasons[domain]; ok {
+			notes = append(notes, telegramEscape(reason))
+		}
+		if len(notes) == 0 {
+			return display
+		}
+		return fmt.Sprintf("%s \\(%s\\)", display, strings.Join(notes, ", "))
+	})
+	text := fmt.Sprintf("%s *Certificate matching %s*\n\n%s\n\n_%s_\n\n[View on crt\\.sh](%s)",
+		a.Severity.Symbol(), telegramEscape(a.Rule), domains, telegramEscape(a.Details()),
+		telegramEscapeURL(a.CertURL))
+	if url := a.EntryURL(); url != "" {
+		text += fmt.Sprintf(" \\| [CT log entry](%s)", telegramEscapeURL(url))
+	}
+	return text
+}
+
+// telegramEscaper escapes the characters MarkdownV2 reserves in text.
+var telegramEscaper = func() *strings.Replacer {
+	pairs := []string{}
+	for _, c := range "\\_*[]()~`>#+-=|{}.!" {
+		pairs = append(pairs, string(c), "\\"+string(c))
+	}
+	return strings.NewReplacer(pairs...)
+}()
+
+func telegramEscape(s string) string {
+	return telegramEscaper.Replace(s)
+}
+
+// telegramEscapeCode escapes text inside inline code, where only backticks
+// and backslashes are special.
+func telegramEscapeCode(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "`", "\\`").Replace(s)
+}
+
+// telegramEscapeURL escapes a link's URL, where only closing parentheses
+// and backslashes are special.
+func telegramEscapeURL(s string) string {
+	return strings.NewReplacer("\\", "\\\\", ")", "\\)").Replace(s)
+}
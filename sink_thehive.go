@@ -0,0 +1,236 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// thehiveSink raises TheHive alerts with the matching domains and the
+// certificate's fingerprints as observables, so analyzers can run on them
+// and the alert can become a case.
+type thehiveSink struct {
+	// URL is the TheHive instance, like "https://thehive.example.com"
+	URL    string `yaml:"url"`
+	APIKey string `yaml:"api_key"`
+
+	// Organisation creates alerts in this organisation instead of the API
+	// user's default one
+	Organisation string `yaml:"organisation"`
+
+	// Version is the major version of TheHive, 5 (the default) or 4
+	Version int `yaml:"version"`
+
+	// Type and Source identify alerts from us, defaulting to "certstream"
+	// and "certstream-slack"
+	Type   string `yaml:"type"`
+	Source string `yaml:"source"`
+
+	// TLP and PAP are the alerts' traffic light and permissible actions
+	// protocol levels, defaulting to 2 (amber)
+	TLP *int `yaml:"tlp"`
+	PAP *int `yaml:"pap"`
+
+	// Tags are added to every alert, along with the rule's name
+	Tags []string `yaml:"tags"`
+
+	// CaseTemplate is the template for cases created from alerts, and
+	// Promote creates a case from each alert right away
+	CaseTemplate string `yaml:"case_template"`
+	Promote      bool   `yaml:"promote"`
+
+	// CAFile verifies the instance against it, instead of the system roots
+	CAFile string `yaml:"ca_file"`
+
+	client *http.Client
+}
+
+func init() {
+	registerSinkType("thehive", func(decode func(interface{}) error) (notifier, error) {
+		s := &thehiveSink{Version: 5, Type: "certstream", Source: "certstream-slack"}
+		if err := decode(s); err != nil {
+			return nil, err
+		}
+		if s.URL == "" {
+			return nil, errors.New("url: must be set")
+		}
+		s.URL = strings.TrimSuffix(s.URL, "/")
+		if s.APIKey == "" {
+			return nil, errors.New("api_key: must be set")
+		}
+		if s.Version != 4 && s.Version != 5 {
+			return nil, errors.Errorf("version: must be 4 or 5, not %d", s.Version)
+		}
+		amber := 2
+		if s.TLP == nil {
+			s.TLP = &amber
+		}
+		if s.PAP == nil {
+			s.PAP = &amber
+		}
+		if *s.TLP < 0 || *s.TLP > 4 {
+			return nil, errors.Errorf("tlp: must be from 0 to 4, not %d", *s.TLP)
+		}
+		if *s.PAP < 0 || *s.PAP > 3 {
+			return nil, errors.Errorf("pap: must be from 0 to 3, not %d", *s.PAP)
+		}
+		var err error
+		if s.client, err = newHTTPClient(s.CAFile); err != nil {
+			return nil, errors.Wrap(err, "ca_file")
+		}
+		return s, nil
+	})
+}
+
+// thehiveSeverities maps rule severities to TheHive severities.
+var thehiveSeverities = map[severity]int{
+	severityInfo:     1, // low
+	severityWarning:  2, // medium
+	severityCritical: 4, // critical
+}
+
+type thehiveObservable struct {
+	DataType string   `json:"dataType"`
+	Data     string   `json:"data"`
+	Message  string   `json:"message,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	IOC      bool     `json:"ioc"`
+}
+
+func (s *thehiveSink) check() error {
+	return errors.Wrap(checkURL(s.URL), "url")
+}
+
+func (s *thehiveSink) Notify(a *alert) error {
+	observables := []thehiveObservable{}
+	for _, domain := range a.Domains {
+		observables = append(observables, thehiveObservable{
+			DataType: "domain",
+			Data:     domain,
+			Message:  a.Reasons[domain],
+			Tags:     []string{"certstream-slack:rule=" + a.Rule},
+			IOC:      true,
+		})
+	}
+	for _, f := range [][2]string{{"sha1", a.Fingerprint}, {"sha256", a.SHA256}} {
+		if f[1] == "" {
+			continue
+		}
+		observables = append(observables, thehiveObservable{
+			DataType: "hash",
+			Data:     strings.ToLower(strings.Replace(f[1], ":", "", -1)),
+			Message:  fmt.Sprintf("%s fingerprint of the certificate issued by %s", strings.ToUpper(f[0]), a.IssuerName()),
+			Tags:     []string{"certificate", f[0]},
+		})
+	}
+
+	description := fmt.Sprintf("%s\n\n%s\n\n[View the certificate on crt.sh](%s)", a.Summary(), a.Details(), a.CertURL)
+	if len(a.AllDomains) > len(a.Domains) {
+		description += "\n\nAll domains in the certificate:\n\n- " + strings.Join(a.AllDomains, "\n- ")
+	}
+
+	payload := map[string]interface{}{
+		"type":   s.Type,
+		"source": s.Source,
+		// one alert per certificate and rule; TheHive rejects repeats
+		"sourceRef":   truncate(strings.Replace(a.Fingerprint, ":", "", -1)+"-"+a.Rule, 128),
+		"title":       truncate(a.Summary(), 512),
+		"description": a.MessageOr(description),
+		"severity":    thehiveSeverities[a.Severity],
+		"date":        a.Seen.UnixNano() / 1e6,
+		"tags":        append([]string{"certstream-slack", "certstream-slack:rule=" + a.Rule}, s.Tags...),
+		"tlp":         *s.TLP,
+		"pap":         *s.PAP,
+	}
+	if s.CaseTemplate != "" {
+		payload["caseTemplate"] = s.CaseTemplate
+	}
+	path := "/api/alert"
+	if s.Version == 5 {
+		path = "/api/v1/alert"
+		payload["observables"] = observables
+		payload["externalLink"] = a.CertURL
+	} else {
+		payload["artifacts"] = observables
+	}
+
+	var created struct {
+		ID  string `json:"_id"`
+		ID4 string `json:"id"`
+	}
+	err := s.post(path, payload, &created)
+	if e, ok := err.(*httpError); ok && e.StatusCode == http.StatusBadRequest &&
+		strings.Contains(e.Body, "already exists") {
+		log.WithField("rule", a.Rule).WithField("fingerprint", a.Fingerprint).Debug("TheHive already has an alert for this certificate")
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "error creating TheHive alert")
+	}
+
+	if !s.Promote {
+		return nil
+	}
+	id := created.ID
+	if id == "" {
+		id = created.ID4
+	}
+	if id == "" {
+		return errors.New("error creating TheHive case: TheHive returned no alert ID")
+	}
+	path = "/api/v1/alert/" + id + "/case"
+	if s.Version == 4 {
+		path = "/api/alert/" + id + "/createCase"
+	}
+	promote := map[string]interface{}{}
+	if s.CaseTemplate != "" {
+		promote["caseTemplate"] = s.CaseTemplate
+	}
+	return errors.Wrap(s.post(path, promote, nil), "error creating TheHive case")
+}
+
+// post POSTs a JSON request to the TheHive API and decodes the response into
+// result, unless it's nil.
+func (s *thehiveSink) post(path string, payload, result interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", s.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+	if s.Organisation != "" {
+		req.Header.Set("X-Organisation", s.Organisation)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := readResponse(resp)
+	if err != nil || result == nil {
+		return err
+	}
+	return errors.Wrap(json.Unmarshal(respBody, result), "could not parse TheHive response")
+}
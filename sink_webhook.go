@@ -0,0 +1,112 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/heptiolabs/certstream-slack/pkg/notify"
+)
+
+// webhookSink POSTs the full alert as JSON to an arbitrary endpoint, with
+// extra request headers (e.g., for authentication).
+type webhookSink struct {
+	URL string `yaml:"url"`
+
+	// Headers are added to every request
+	Headers map[string]string `yaml:"headers"`
+}
+
+func init() {
+	registerSinkType("webhook", func(decode func(interface{}) error) (notifier, error) {
+		s := &webhookSink{}
+		if err := decode(s); err != nil {
+			return nil, err
+		}
+		if s.URL == "" {
+			return nil, errors.New("url: must be set")
+		}
+		return s, nil
+	})
+}
+
+func (s *webhookSink) check() error {
+	return errors.Wrap(checkURL(s.URL), "url")
+}
+
+func (s *webhookSink) Notify(a *alert) error {
+	return errors.Wrap(postJSON(s.URL, s.Headers, alertPayload(a)), "error sending webhook")
+}
+
+// alertPayload is the JSON representation of an alert sent by the webhook
+// sink, and by other sinks that publish alerts to be processed elsewhere.
+func alertPayload(a *alert) interface{} {
+	return struct {
+		Rule         string              `json:"rule"`
+		Severity     string              `json:"severity"`
+		Domains      []string            `json:"domains"`
+		AllDomains   []string            `json:"all_domains"`
+		Original     map[string]string   `json:"original_domains,omitempty"`
+		Reasons      map[string]string   `json:"reasons,omitempty"`
+		Score        int                 `json:"score,omitempty"`
+		Enrichments  []notify.Enrichment `json:"enrichments,omitempty"`
+		Fingerprint  string              `json:"fingerprint"`
+		CertURL      string              `json:"cert_url"`
+		Issuer       string              `json:"issuer"`
+		KeyAlgorithm string              `json:"key_algorithm,omitempty"`
+		KeySize      int                 `json:"key_size,omitempty"`
+		ExtKeyUsages []string            `json:"ext_key_usages,omitempty"`
+		SCTs         []notify.SCT        `json:"scts,omitempty"`
+		Chain        []string            `json:"chain,omitempty"`
+		RootCA       string              `json:"root_ca,omitempty"`
+		Seen         time.Time           `json:"seen"`
+		Data         interface{}         `json:"data"`
+		Message      string              `json:"message,omitempty"`
+	}{
+		Rule:         a.Rule,
+		Severity:     a.Severity.String(),
+		Domains:      a.Domains,
+		AllDomains:   a.AllDomains,
+		Original:     a.Original,
+		Reasons:      a.Reasons,
+		Score:        a.Score,
+		Enrichments:  a.Enrichments,
+		Fingerprint:  a.Fingerprint,
+		CertURL:      a.CertURL,
+		Issuer:       a.Issuer,
+		KeyAlgorithm: a.KeyAlgorithm,
+		KeySize:      a.KeySize,
+		ExtKeyUsages: a.ExtKeyUsages,
+		SCTs:         a.SCTs,
+		Chain:        a.Chain,
+		RootCA:       a.RootCA,
+		Seen:         a.Seen,
+		Data:         a.Data,
+		Message:      a.Message,
+	}
+}
+
+// alertAttributes are the names and values of the attributes sent with
+// alert payloads by sinks that support them, for filtering.
+func alertAttributes(a *alert) [][2]string {
+	return [][2]string{
+		{"rule", a.Rule},
+		{"severity", a.Severity.String()},
+		{"fingerprint", a.Fingerprint},
+	}
+}
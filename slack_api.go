@@ -0,0 +1,129 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// slackAPIURL is the base URL of the Slack Web API, which needs a bot token
+// for the features incoming webhooks don't support.
+const slackAPIURL = "https://slack.com/api/"
+
+// slackAPI calls a Slack Web API method with form parameters and decodes the
+// response into out (if not nil), checking the "ok" field.
+func slackAPI(token, method string, params url.Values, out interface{}) error {
+	req, err := http.NewRequest("POST", slackAPIURL+method, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("%s: unexpected status %s", method, resp.Status)
+	}
+
+	var body json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return errors.Wrap(err, method)
+	}
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return errors.Wrap(err, method)
+	}
+	if !result.OK {
+		return errors.Errorf("%s: %s", method, result.Error)
+	}
+	if out != nil {
+		return errors.Wrap(json.Unmarshal(body, out), method)
+	}
+	return nil
+}
+
+// slackUploadFile shares a file, like a text file or an image, in a
+// channel, or in a thread if threadTS is set, using Slack's external upload
+// flow: get an upload URL, upload the content, then complete the upload to
+// share it.
+func slackUploadFile(token, channel, threadTS, filename, title, comment string, content []byte) error {
+	var upload struct {
+		UploadURL string `json:"upload_url"`
+		FileID    string `json:"file_id"`
+	}
+	err := slackAPI(token, "files.getUploadURLExternal", url.Values{
+		"filename": {filename},
+		"length":   {strconv.Itoa(len(content))},
+	}, &upload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Post(upload.UploadURL, http.DetectContentType(content), bytes.NewReader(content))
+	if err != nil {
+		return errors.Wrap(err, "could not upload file")
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("could not upload file: unexpected status %s", resp.Status)
+	}
+
+	files, err := json.Marshal([]map[string]string{{"id": upload.FileID, "title": title}})
+	if err != nil {
+		return err
+	}
+	params := url.Values{
+		"files":           {string(files)},
+		"channel_id":      {channel},
+		"initial_comment": {comment},
+	}
+	if threadTS != "" {
+		params.Set("thread_ts", threadTS)
+	}
+	return slackAPI(token, "files.completeUploadExternal", params, nil)
+}
+
+// slackPostMessage posts a message, described like an incoming webhook's
+// payload, to a channel with chat.postMessage, decoding the response into
+// out (if not nil).
+func slackPostMessage(token, channel string, payload map[string]interface{}, out interface{}) error {
+	params := url.Values{"channel": {channel}}
+	for name, value := range payload {
+		if text, ok := value.(string); ok {
+			params.Set(name, text)
+			continue
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		params.Set(name, string(data))
+	}
+	return slackAPI(token, "chat.postMessage", params, out)
+}
@@ -0,0 +1,375 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// slackApp handles requests from a Slack app: the buttons in the alerts of
+// interactive Slack sinks, which acknowledge alerts and mute domains, and a
+// slash command that adds, lists, and removes watches.
+type slackApp struct {
+	signingSecret string
+	suppressions  *suppressionStore
+	watches       *watchStore
+
+	// reload has the config to compile watches' rules with, and swaps them
+	// into the watcher
+	reload *reloader
+}
+
+// The action IDs of the buttons in interactive alerts.
+const (
+	slackActionAck    = "certstream_ack"
+	slackActionMute   = "certstream_mute"
+	slackActionUnmute = "certstream_unmute"
+)
+
+// slackMaxMuteDomains limits how many registrable domains a mute button
+// mutes, to keep its value under Slack's limit of 2000 characters.
+const slackMaxMuteDomains = 20
+
+// slackActionValue is the value of the buttons in interactive alerts,
+// which Slack hands back when they're clicked.
+type slackActionValue struct {
+	Rule        string   `json:"rule"`
+	Fingerprint string   `json:"fingerprint,omitempty"`
+	Domains     []string `json:"domains,omitempty"` // registrable domains
+	MuteFor     string   `json:"mute_for,omitempty"`
+}
+
+// slackAlertButtons are the buttons interactive alerts add to their actions:
+// acknowledge, and mute the matching registrable domains for muteFor.
+func slackAlertButtons(a *alert, muteFor time.Duration) []interface{} {
+	return []interface{}{
+		slackActionButton(slackActionAck, "Acknowledge", "primary", slackActionValue{Rule: a.Rule, Fingerprint: a.Fingerprint}),
+		slackMuteButton(a.Rule, registrableDomains(a.Domains), muteFor.String()),
+	}
+}
+
+// slackMuteButton mutes registrable domains for muteFor, a duration.
+func slackMuteButton(rule string, registrables []string, muteFor string) map[string]interface{} {
+	if len(registrables) > slackMaxMuteDomains {
+		registrables = registrables[:slackMaxMuteDomains]
+	}
+	label := "Mute domain"
+	if len(registrables) > 1 {
+		label = "Mute domains"
+	}
+	d, _ := time.ParseDuration(muteFor)
+	label += " for " + formatDays(d)
+	return slackActionButton(slackActionMute, label, "danger", slackActionValue{Rule: rule, Domains: registrables, MuteFor: muteFor})
+}
+
+// slackActionButton is a button that sends an action to the Slack app.
+func slackActionButton(actionID, label, style string, value slackActionValue) map[string]interface{} {
+	data, _ := json.Marshal(value)
+	button := map[string]interface{}{
+		"type":      "button",
+		"action_id": actionID,
+		"text":      map[string]interface{}{"type": "plain_text", "text": label},
+		"value":     string(data),
+	}
+	if style != "" {
+		button["style"] = style
+	}
+	return button
+}
+
+// formatDays formats a duration in days, like "30d", if it's a whole
+// number of them.
+func formatDays(d time.Duration) string {
+	if d > 0 && d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return d.String()
+}
+
+// slackInteraction is the part of a Slack interaction payload we use.
+type slackInteraction struct {
+	Type string `json:"type"`
+	User struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	} `json:"user"`
+	ResponseURL string `json:"response_url"`
+	Actions     []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+	Message struct {
+		Text   string                   `json:"text"`
+		Blocks []map[string]interface{} `json:"blocks"`
+	} `json:"message"`
+}
+
+// handleInteraction handles the buttons clicked in interactive alerts,
+// updating the suppressions and then the message to say who did what.
+func (app *slackApp) handleInteraction(w http.ResponseWriter, r *http.Request) {
+	body, ok := app.verify(w, r)
+	if !ok {
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "could not parse the form", http.StatusBadRequest)
+		return
+	}
+	var in slackInteraction
+	if err := json.Unmarshal([]byte(form.Get("payload")), &in); err != nil {
+		http.Error(w, "could not parse the payload", http.StatusBadRequest)
+		return
+	}
+	if in.Type != "block_actions" {
+		return
+	}
+
+	by := in.User.Username
+	if by == "" {
+		by = in.User.ID
+	}
+	blocks := in.Message.Blocks
+	updated := false
+	for _, action := range in.Actions {
+		var value slackActionValue
+		if !strings.HasPrefix(action.ActionID, "certstream_") || json.Unmarshal([]byte(action.Value), &value) != nil {
+			continue
+		}
+		note, replacement, err := app.act(action.ActionID, value, by)
+		logger := log.WithField("action", action.ActionID).WithField("rule", value.Rule).WithField("user", by)
+		if err != nil {
+			logger.WithError(err).Error("could not handle Slack action")
+			note = ":warning: Couldn't " + note + ": " + err.Error()
+		} else {
+			logger.Info("handled Slack action")
+			note += fmt.Sprintf(" by <@%s>", in.User.ID)
+		}
+		blocks = slackReplaceButton(blocks, action.ActionID, replacement, note)
+		updated = true
+	}
+	if !updated || in.ResponseURL == "" {
+		return
+	}
+
+	// Slack expects an answer within three seconds, so the message is
+	// updated afterward
+	update := map[string]interface{}{"replace_original": true, "text": in.Message.Text, "blocks": blocks}
+	go func() {
+		if err := postJSON(in.ResponseURL, nil, update); err != nil {
+			log.WithError(err).Error("could not update Slack message")
+		}
+	}()
+}
+
+// act carries out a button's action, returning a note describing it (or,
+// if it failed, what couldn't be done) and the button to replace it with,
+// if any.
+func (app *slackApp) act(actionID string, value slackActionValue, by string) (string, map[string]interface{}, error) {
+	domains := "`" + strings.Join(value.Domains, "`, `") + "`"
+	switch actionID {
+	case slackActionAck:
+		if err := app.suppressions.acknowledge(value.Fingerprint, by, value.Rule); err != nil {
+			return "acknowledge the alert", nil, err
+		}
+		return ":white_check_mark: Acknowledged", nil, nil
+	case slackActionMute:
+		d, err := time.ParseDuration(value.MuteFor)
+		if err != nil || d <= 0 {
+			return "mute " + domains, nil, errors.Errorf("bad mute duration %q", value.MuteFor)
+		}
+		until := time.Now().Add(d)
+		if err := app.suppressions.mute(value.Domains, until, by, value.Rule); err != nil {
+			return "mute " + domains, nil, err
+		}
+		note := fmt.Sprintf(":mute: Muted %s until %s", domains, until.UTC().Format("Jan 2 15:04 MST"))
+		return note, slackActionButton(slackActionUnmute, "Unmute", "", value), nil
+	case slackActionUnmute:
+		if _, err := app.suppressions.unmute(value.Domains); err != nil {
+			return "unmute " + domains, nil, err
+		}
+		return ":loud_sound: Unmuted " + domains, slackMuteButton(value.Rule, value.Domains, value.MuteFor), nil
+	}
+	return "handle " + actionID, nil, errors.New("unknown action")
+}
+
+// slackReplaceButton returns a message's blocks with the button for an
+// action replaced (or, if replacement is nil, removed), followed by a note.
+func slackReplaceButton(blocks []map[string]interface{}, actionID string, replacement map[string]interface{}, note string) []map[string]interface{} {
+	updated := []map[string]interface{}{}
+	for _, block := range blocks {
+		elements, ok := block["elements"].([]interface{})
+		if block["type"] != "actions" || !ok {
+			updated = append(updated, block)
+			continue
+		}
+		kept := []interface{}{}
+		for _, element := range elements {
+			if e, ok := element.(map[string]interface{}); ok && e["action_id"] == actionID {
+				if replacement != nil {
+					kept = append(kept, replacement)
+				}
+				continue
+			}
+			kept = append(kept, element)
+		}
+		if len(kept) > 0 {
+			block["elements"] = kept
+			updated = append(updated, block)
+		}
+	}
+	return append(updated, map[string]interface{}{
+		"type":     "context",
+		"elements": []interface{}{map[string]interface{}{"type": "mrkdwn", "text": note}},
+	})
+}
+
+// slackEscapes undoes the escaping of "&", "<", and ">" in slash commands.
+var slackEscapes = strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">")
+
+// handleCommand handles the Slack app's slash command, like
+// "/certwatch add <pattern>", "/certwatch list", and
+// "/certwatch remove <id>", which change the watches: patterns watched for
+// like configured rules, without editing the config.
+func (app *slackApp) handleCommand(w http.ResponseWriter, r *http.Request) {
+	body, ok := app.verify(w, r)
+	if !ok {
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "could not parse the form", http.StatusBadRequest)
+		return
+	}
+	command, userID := form.Get("command"), form.Get("user_id")
+	by := form.Get("user_name")
+	if by == "" {
+		by = userID
+	}
+	text := strings.TrimSpace(slackEscapes.Replace(form.Get("text")))
+	sub, arg := text, ""
+	if i := strings.IndexAny(text, " \t"); i >= 0 {
+		sub, arg = text[:i], strings.Trim(strings.TrimSpace(text[i+1:]), "`")
+	}
+	logger := log.WithField("command", command+" "+text).WithField("user", by)
+
+	reply := func(inChannel bool, text string) {
+		responseType := "ephemeral"
+		if inChannel {
+			responseType = "in_channel"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"response_type": responseType, "text": text})
+	}
+	usage := fmt.Sprintf("Usage: `%s add <pattern>` to watch for certificates with domains matching a regular expression, `%s list`, or `%s remove <id>`", command, command, command)
+
+	switch strings.ToLower(sub) {
+	case "add":
+		if arg == "" {
+			reply(false, usage)
+			return
+		}
+		cfg := app.reload.config()
+		wt, err := app.watches.add(arg, by, userID, func(wt *slackWatch) error {
+			_, err := cfg.watchRule(wt)
+			return err
+		})
+		if err != nil {
+			logger.WithError(err).Warn("could not add watch from Slack")
+			reply(false, fmt.Sprintf(":warning: Couldn't add a watch for `%s`: %s", arg, err))
+			return
+		}
+		app.reload.refresh()
+		logger.WithField("rule", wt.ruleName()).Info("added watch from Slack")
+		reply(true, fmt.Sprintf(":eyes: <@%s> added watch #%d for `%s`", userID, wt.ID, wt.Pattern))
+	case "list":
+		watches := app.watches.list()
+		if len(watches) == 0 {
+			reply(false, fmt.Sprintf("No watches yet. Add one with `%s add <pattern>`.", command))
+			return
+		}
+		lines := []string{"*Watches*"}
+		for _, wt := range watches {
+			lines = append(lines, fmt.Sprintf("#%d `%s`, added by %s on %s", wt.ID, wt.Pattern, wt.By, wt.Time.UTC().Format("Jan 2, 2006")))
+		}
+		reply(false, strings.Join(lines, "\n"))
+	case "remove":
+		id, err := strconv.Atoi(strings.TrimPrefix(arg, "#"))
+		if err != nil {
+			reply(false, usage)
+			return
+		}
+		wt, err := app.watches.remove(id)
+		if err != nil {
+			logger.WithError(err).Error("could not remove watch from Slack")
+			reply(false, fmt.Sprintf(":warning: Couldn't remove watch #%d: %s", id, err))
+			return
+		}
+		if wt == nil {
+			reply(false, fmt.Sprintf("There's no watch #%d. See `%s list`.", id, command))
+			return
+		}
+		app.reload.refresh()
+		logger.WithField("rule", wt.ruleName()).Info("removed watch from Slack")
+		reply(true, fmt.Sprintf(":wastebasket: <@%s> removed watch #%d for `%s`", userID, wt.ID, wt.Pattern))
+	default:
+		reply(false, usage)
+	}
+}
+
+// verify reads a request's body and checks its Slack signature, the
+// HMAC-SHA256 of "v0:<timestamp>:<body>" keyed by the signing secret.
+// Requests more than five minutes old are rejected so they can't be
+// replayed.
+func (app *slackApp) verify(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "could not read the request", http.StatusBadRequest)
+		return nil, false
+	}
+	timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if age := time.Since(time.Unix(unix, 0)); err != nil || age > 5*time.Minute || age < -5*time.Minute {
+		http.Error(w, "missing or stale timestamp", http.StatusUnauthorized)
+		return nil, false
+	}
+	mac := hmac.New(sha256.New, []byte(app.signingSecret))
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Slack-Signature"))) {
+		http.Error(w, "bad signature", http.StatusUnauthorized)
+		return nil, false
+	}
+	return body, true
+}
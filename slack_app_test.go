@@ -0,0 +1,113 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSigningSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+// signedSlackRequest is a request from Slack with body, sent at a time
+// and signed with secret.
+func signedSlackRequest(secret string, sent time.Time, body string) *http.Request {
+	timestamp := strconv.FormatInt(sent.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":" + body))
+	r := httptest.NewRequest(http.MethodPost, "/slack/interactions", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	r.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return r
+}
+
+func TestSlackAppVerify(t *testing.T) {
+	const body = "command=%2Fcertwatch&text=list"
+	tampered := signedSlackRequest(testSigningSecret, time.Now(), body)
+	tampered.Body = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body+"x")).Body
+	unsigned := signedSlackRequest(testSigningSecret, time.Now(), body)
+	unsigned.Header.Del("X-Slack-Signature")
+	get := signedSlackRequest(testSigningSecret, time.Now(), "")
+	get.Method = http.MethodGet
+
+	tests := []struct {
+		name   string
+		r      *http.Request
+		status int
+	}{
+		{"signed", signedSlackRequest(testSigningSecret, time.Now(), body), http.StatusOK},
+		{"a minute ago", signedSlackRequest(testSigningSecret, time.Now().Add(-time.Minute), body), http.StatusOK},
+		{"stale", signedSlackRequest(testSigningSecret, time.Now().Add(-6*time.Minute), body), http.StatusUnauthorized},
+		{"from the future", signedSlackRequest(testSigningSecret, time.Now().Add(6*time.Minute), body), http.StatusUnauthorized},
+		{"other secret", signedSlackRequest("another secret", time.Now(), body), http.StatusUnauthorized},
+		{"tampered", tampered, http.StatusUnauthorized},
+		{"unsigned", unsigned, http.StatusUnauthorized},
+		{"GET", get, http.StatusMethodNotAllowed},
+	}
+	app := &slackApp{signingSecret: testSigningSecret}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		got, ok := app.verify(w, test.r)
+		if w.Code != test.status {
+			t.Errorf("%s: status %d, want %d", test.name, w.Code, test.status)
+		}
+		if ok != (test.status == http.StatusOK) {
+			t.Errorf("%s: verified = %v", test.name, ok)
+		}
+		if ok && string(got) != body {
+			t.Errorf("%s: body %q, want %q", test.name, got, body)
+		}
+	}
+}
+
+func TestSlackAppAcknowledge(t *testing.T) {
+	suppressions, err := openSuppressionStore(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &slackApp{signingSecret: testSigningSecret, suppressions: suppressions}
+	payload := `{"type":"block_actions","user":{"id":"U123","username":"alice"},` +
+		`"actions":[{"action_id":"certstream_ack","value":"{\"rule\":\"acme\",\"fingerprint\":\"AB:CD\"}"}]}`
+	body := url.Values{"payload": {payload}}.Encode()
+
+	// a request that isn't signed changes nothing
+	w := httptest.NewRecorder()
+	app.handleInteraction(w, signedSlackRequest("another secret", time.Now(), body))
+	if w.Code != http.StatusUnauthorized || suppressions.acknowledged("AB:CD", "acme") {
+		t.Fatalf("unsigned request: status %d, acknowledged %v", w.Code, suppressions.acknowledged("AB:CD", "acme"))
+	}
+
+	w = httptest.NewRecorder()
+	app.handleInteraction(w, signedSlackRequest(testSigningSecret, time.Now(), body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if !suppressions.acknowledged("AB:CD", "acme") {
+		t.Error("alert not acknowledged")
+	}
+	if a := suppressions.acks[ackKey("AB:CD", "acme")]; a == nil || a.By != "alice" {
+		t.Errorf("acknowledgement = %+v, want one by alice", a)
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/heptiolabs/certstream-slack/pkg/stream"
+
+	"github.com/pkg/errors"
+)
+
+// source delivers certificate updates to the watcher as certstream-style
+// JSON messages, so that every source shares the same matching pipeline.
+type source interface {
+	// run calls handle for each message until stop is called (returning
+	// nil) or the source gives up (returning an error)
+	run(handle func(msg *stream.Message)) error
+
+	// stop makes run return once the message being handled is done
+	stop()
+
+	// status reports whether the source is currently receiving updates and
+	// when the last message arrived (the zero time if none has)
+	status() (connected bool, lastMessage time.Time)
+}
+
+// multiSource runs several sources at once, delivering each certificate
+// only once however many of them deliver it, so that one source dropping
+// certificates doesn't leave a gap.
+type multiSource struct {
+	sources []source
+	names   []string // for logs and metrics, like "ct"
+	seen    *dedupCache
+}
+
+// Certificates are remembered for long enough for a slow source to catch
+// up with a fast one.
+const (
+	multiSourceDedupSize = 100000
+	multiSourceDedupTTL  = time.Hour
+)
+
+func newMultiSource(sources []source, names []string) *multiSource {
+	return &multiSource{
+		sources: sources,
+		names:   names,
+		seen:    newDedupCache(multiSourceDedupSize, multiSourceDedupTTL),
+	}
+}
+
+// run runs every source until they've all returned, carrying on with the
+// others if one gives up. It only returns an error if they all did.
+func (m *multiSource) run(handle func(msg *stream.Message)) error {
+	errs := make(chan error, len(m.sources))
+	for i, s := range m.sources {
+		go func(s source, name string) {
+			err := s.run(func(msg *stream.Message) {
+				if check, keys := multiSourceKeys(msg); len(keys) > 0 && m.seen.duplicateOf(check, keys) {
+					sourceDuplicates.inc(name)
+					return
+				}
+				handle(msg)
+			})
+			if err != nil {
+				log.WithError(err).WithField("source", name).Error("giving up on certificate source")
+			}
+			errs <- err
+		}(s, m.names[i])
+	}
+	failed := 0
+	for range m.sources {
+		if err := <-errs; err != nil {
+			failed++
+		}
+	}
+	if failed == len(m.sources) {
+		return errors.New("every source gave up")
+	}
+	return nil
+}
+
+func (m *multiSource) stop() {
+	for _, s := range m.sources {
+		s.stop()
+	}
+}
+
+// status reports the sources as connected while any of them is, with the
+// last message from any of them.
+func (m *multiSource) status() (bool, time.Time) {
+	connected, last := false, time.Time{}
+	for _, s := range m.sources {
+		ok, t := s.status()
+		connected = connected || ok
+		if t.After(last) {
+			last = t
+		}
+	}
+	return connected, last
+}
+
+// multiSourceKeys identifies the certificate in a message across sources,
+// returning the keys to check for it and every key to remember it by. Not
+// every source knows the same things about a certificate: certstream gives
+// its SHA-1 fingerprint, Cert Spotter its SHA-256 fingerprint, and crt.sh
+// only its issuer and serial number, so it's remembered by all of those it
+// has, with the SHA-256 fingerprint worked out from the DER encoding if
+// need be. A precertificate shares its issuer and serial with its final
+// certificate, so certificates with fingerprints are told apart by them,
+// and only matched by issuer and serial against ones without. Messages
+// with none of these, like the domains-only stream's, are always delivered.
+func multiSourceKeys(msg *stream.Message) (check, keys []string) {
+	if msg.Data == nil {
+		return nil, nil
+	}
+	leaf := &msg.Data.LeafCert
+	sha256Hex := fingerprintHex(leaf.SHA256)
+	if sha256Hex == "" && leaf.AsDER != "" {
+		if der, err := base64.StdEncoding.DecodeString(leaf.AsDER); err == nil {
+			sum := sha256.Sum256(der)
+			sha256Hex = hex.EncodeToString(sum[:])
+		}
+	}
+	if sha256Hex != "" {
+		keys = append(keys, "sha256:"+sha256Hex)
+	}
+	if sha1Hex := fingerprintHex(leaf.Fingerprint); sha1Hex != "" {
+		keys = append(keys, "sha1:"+sha1Hex)
+	}
+	serial := strings.TrimLeft(fingerprintHex(leaf.SerialNumber), "0")
+	if serial == "" {
+		return keys, keys
+	}
+	serial = strings.ToLower(leaf.Issuer.O+"/"+leaf.Issuer.CN) + "/" + serial
+	if len(keys) == 0 {
+		// without a fingerprint, it's the same as any certificate with
+		// its issuer and serial
+		keys = []string{"serial:" + serial, "fingerprinted-serial:" + serial}
+		return keys, keys[:1]
+	}
+	check = append(keys[:len(keys):len(keys)], "serial:"+serial)
+	return check, append(keys, "fingerprinted-serial:"+serial)
+}
+
+// fingerprintHex normalizes a fingerprint or serial number, however it's
+// written, like "AA:BB:..." or "aabb...", as lowercase hex.
+func fingerprintHex(s string) string {
+	return strings.ToLower(strings.Replace(s, ":", "", -1))
+}
@@ -0,0 +1,335 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// matchRecord is a certificate that matched a rule, as kept in the match
+// store.
+type matchRecord struct {
+	Time        time.Time `json:"time"` // when the match was found
+	Seen        time.Time `json:"seen"` // when the certificate was logged
+	Rule        string    `json:"rule"`
+	Severity    string    `json:"severity"`
+	Domains     []string  `json:"domains"`
+	AllDomains  []string  `json:"all_domains"`
+	Fingerprint string    `json:"fingerprint"`
+	CertURL     string    `json:"cert_url"`
+	Issuer      string    `json:"issuer"`
+	Serial      string    `json:"serial,omitempty"`
+	NotBefore   time.Time `json:"not_before,omitempty"`
+	NotAfter    time.Time `json:"not_after,omitempty"`
+	SourceName  string    `json:"source_name,omitempty"`
+	SourceURL   string    `json:"source_url,omitempty"`
+	CertIndex   int       `json:"cert_index"`
+}
+
+func newMatchRecord(a *alert) *matchRecord {
+	return &matchRecord{
+		Time:        time.Now(),
+		Seen:        a.Seen,
+		Rule:        a.Rule,
+		Severity:    a.Severity.String(),
+		Domains:     a.Domains,
+		AllDomains:  a.AllDomains,
+		Fingerprint: a.Fingerprint,
+		CertURL:     a.CertURL,
+		Issuer:      a.Issuer,
+		Serial:      a.Serial,
+		NotBefore:   a.NotBefore,
+		NotAfter:    a.NotAfter,
+		SourceName:  a.SourceName,
+		SourceURL:   a.SourceURL,
+		CertIndex:   a.CertIndex,
+	}
+}
+
+// matchStore keeps a record of every match in a bbolt database, so that
+// alerts aren't the only record of what was found. Matches are keyed by
+// when they were found, and indexed by rule, so queries read only the
+// matches they return, straight from disk. Those older than the retention
+// period are pruned at startup and then hourly.
+type matchStore struct {
+	db        *bolt.DB
+	retention time.Duration // zero keeps records forever
+}
+
+var (
+	// matchesBucket holds the records as JSON, keyed by matchKey
+	matchesBucket = []byte("matches")
+	// rulesBucket holds a bucket for each rule with the keys of its
+	// records
+	rulesBucket = []byte("rules")
+)
+
+// matchKey is the key for a record found at t: the time in nanoseconds
+// and then seq, which tells apart records found at the same time, so that
+// keys sort by time.
+func matchKey(t time.Time, seq uint64) []byte {
+	key := make([]byte, 16)
+	if t.After(time.Unix(0, 0)) {
+		binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	}
+	binary.BigEndian.PutUint64(key[8:], seq)
+	return key
+}
+
+// openMatchStore opens the database at path, creating it if needed. A
+// file of JSON lines, as older versions kept, is converted first.
+func openMatchStore(path string, retention time.Duration) (*matchStore, error) {
+	if err := convertMatchLines(path); err != nil {
+		return nil, errors.Wrap(err, "could not convert match history")
+	}
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err == bolt.ErrTimeout {
+		return nil, errors.Errorf("%s is in use by another process", path)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not open %s", path)
+	}
+	if err := createMatchBuckets(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	s := &matchStore{db: db, retention: retention}
+	if err := s.prune(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if retention > 0 {
+		go func() {
+			for range time.Tick(time.Hour) {
+				if err := s.prune(); err != nil {
+					log.WithError(err).Error("could not prune match store")
+				}
+			}
+		}()
+	}
+	return s, nil
+}
+
+func createMatchBuckets(db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{matchesBucket, rulesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// convertMatchLines converts a file of JSON lines at path into a database,
+// keeping the old file beside it with ".old" appended to its name.
+func convertMatchLines(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	if first, err := r.Peek(1); err != nil || first[0] != '{' {
+		return nil
+	}
+
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	db, err := bolt.Open(tmp, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return err
+	}
+	err = createMatchBuckets(db)
+	// a transaction for every thousand records, rather than each one
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	converted := 0
+	for line := 1; err == nil; {
+		batch := []*matchRecord{}
+		for len(batch) < 1000 && scanner.Scan() {
+			record := &matchRecord{}
+			if err = json.Unmarshal(scanner.Bytes(), record); err != nil {
+				err = errors.Wrapf(err, "%s:%d", path, line)
+				break
+			}
+			batch = append(batch, record)
+			line++
+		}
+		if err != nil || len(batch) == 0 {
+			break
+		}
+		err = db.Update(func(tx *bolt.Tx) error {
+			for _, record := range batch {
+				if err := putMatch(tx, record); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		converted += len(batch)
+	}
+	if err == nil {
+		err = scanner.Err()
+	}
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	f.Close()
+	if err == nil {
+		err = os.Rename(path, path+".old")
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	log.WithField("matches", converted).WithField("old", path+".old").Info("converted match history to a database")
+	return nil
+}
+
+func (s *matchStore) observe(r *matchRecord) {
+	if err := s.add(r); err != nil {
+		log.WithError(err).Error("could not record match")
+	}
+}
+
+// add records a match.
+func (s *matchStore) add(r *matchRecord) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putMatch(tx, r)
+	})
+}
+
+// putMatch adds a record, and its rule's index entry, in tx.
+func putMatch(tx *bolt.Tx, r *matchRecord) error {
+	value, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	matches := tx.Bucket(matchesBucket)
+	seq, err := matches.NextSequence()
+	if err != nil {
+		return err
+	}
+	key := matchKey(r.Time, seq)
+	if err := matches.Put(key, value); err != nil {
+		return err
+	}
+	if r.Rule == "" {
+		return nil
+	}
+	byRule, err := tx.Bucket(rulesBucket).CreateBucketIfNotExists([]byte(r.Rule))
+	if err != nil {
+		return err
+	}
+	return byRule.Put(key, []byte{})
+}
+
+// each calls fn with up to limit records for rule (or any rule, if empty)
+// found since the given time, newest first, reading each as it goes. A
+// limit of zero means every record. An error from fn stops it.
+func (s *matchStore) each(since time.Time, rule string, limit int, fn func(*matchRecord) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		matches := tx.Bucket(matchesBucket)
+		keys := matches
+		if rule != "" {
+			if keys = tx.Bucket(rulesBucket).Bucket([]byte(rule)); keys == nil {
+				return nil
+			}
+		}
+		first := matchKey(since, 0)
+		c := keys.Cursor()
+		n := 0
+		for k, _ := c.Last(); k != nil && bytes.Compare(k, first) >= 0 && (limit == 0 || n < limit); k, _ = c.Prev() {
+			r := &matchRecord{}
+			if err := json.Unmarshal(matches.Get(k), r); err != nil {
+				return errors.Wrapf(err, "invalid record %x", k)
+			}
+			if err := fn(r); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+}
+
+// pruneBatch is how many records prune drops in each transaction, so
+// recording matches doesn't wait long for it.
+const pruneBatch = 1000
+
+// prune drops records older than the retention period.
+func (s *matchStore) prune() error {
+	if s.retention <= 0 {
+		return nil
+	}
+	cutoff := matchKey(time.Now().Add(-s.retention), 0)
+	pruned := 0
+	for done := false; !done; {
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			rules := tx.Bucket(rulesBucket)
+			c := tx.Bucket(matchesBucket).Cursor()
+			for i := 0; i < pruneBatch; i++ {
+				// deleting moves the cursor on, so the first is the next
+				k, v := c.First()
+				if k == nil || bytes.Compare(k, cutoff) >= 0 {
+					done = true
+					return nil
+				}
+				var r struct {
+					Rule string `json:"rule"`
+				}
+				json.Unmarshal(v, &r)
+				if byRule := rules.Bucket([]byte(r.Rule)); r.Rule != "" && byRule != nil {
+					if err := byRule.Delete(k); err != nil {
+						return err
+					}
+				}
+				if err := c.Delete(); err != nil {
+					return err
+				}
+				pruned++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if pruned > 0 {
+		log.WithField("pruned", pruned).Debug("pruned match store")
+	}
+	return nil
+}
+
+// close closes the database.
+func (s *matchStore) close() error {
+	return s.db.Close()
+}
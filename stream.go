@@ -0,0 +1,66 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/heptiolabs/certstream-slack/pkg/stream"
+)
+
+// certstreamEndpoint is a certstream server to connect to.
+type certstreamEndpoint struct {
+	url    string
+	header http.Header
+}
+
+// certstreamSource receives certificate updates from a certstream server,
+// updating the metrics as it goes.
+type certstreamSource struct {
+	client *stream.Client
+}
+
+func newCertstreamSource(cfg *config, endpoint certstreamEndpoint) *certstreamSource {
+	return &certstreamSource{client: &stream.Client{
+		URL:          endpoint.url,
+		Header:       endpoint.header,
+		Dialer:       newWebsocketDialer(endpoint.url, cfg.streamTLS),
+		MaxAttempts:  cfg.MaxReconnectAttempts,
+		PingInterval: cfg.StreamPingInterval,
+		ReadTimeout:  cfg.StreamReadTimeout,
+		MinBackoff:   time.Second,
+		MaxBackoff:   2 * time.Minute,
+		Log:          log,
+		OnReconnect:  func() { streamReconnects.inc() },
+		OnMalformed:  func() { malformedMessages.inc() },
+	}}
+}
+
+func (s *certstreamSource) run(handle func(msg *stream.Message)) error {
+	return s.client.Run(func(msg *stream.Message) {
+		lastMessageTime.set(float64(time.Now().UnixNano()) / 1e9)
+		handle(msg)
+	})
+}
+
+func (s *certstreamSource) stop() {
+	s.client.Stop()
+}
+
+func (s *certstreamSource) status() (connected bool, lastMessage time.Time) {
+	return s.client.Status()
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ackRetention is how long acknowledgements are kept.
+const ackRetention = 90 * 24 * time.Hour
+
+var (
+	// suppressionsBucket holds mutesBucket, with the mutes as JSON keyed by
+	// registrable domain, and acksBucket, with the acknowledgements as JSON
+	// keyed by ackKey
+	suppressionsBucket = []byte("suppressions")
+	mutesBucket        = []byte("mutes")
+	acksBucket         = []byte("acks")
+)
+
+// suppressionStore keeps the registrable domains muted, and the alerts
+// acknowledged, from Slack. If the match store has a database, they're
+// kept in it too, so they survive restarts.
+type suppressionStore struct {
+	db *bolt.DB
+
+	mu    sync.Mutex
+	mutes map[string]*domainMute      // keyed by registrable domain
+	acks  map[string]*acknowledgement // keyed by ackKey
+}
+
+// domainMute is a registrable domain whose alerts are suppressed until a
+// time.
+type domainMute struct {
+	Until time.Time `json:"until"`
+	By    string    `json:"by"`   // who muted it
+	Time  time.Time `json:"time"` // when it was muted
+	Rule  string    `json:"rule,omitempty"`
+}
+
+// acknowledgement records that someone has handled a rule's alert for a
+// certificate.
+type acknowledgement struct {
+	By   string    `json:"by"`
+	Time time.Time `json:"time"`
+	Rule string    `json:"rule,omitempty"`
+}
+
+// ackKey is the key for the acknowledgement of a rule's alert for the
+// certificate with a fingerprint.
+func ackKey(fingerprint, rule string) string {
+	return fingerprint + "\x00" + rule
+}
+
+// openSuppressionStore reads the suppressions kept in the match store's
+// database. With no match store, they're only kept in memory.
+func openSuppressionStore(store *matchStore) (*suppressionStore, error) {
+	s := &suppressionStore{mutes: map[string]*domainMute{}, acks: map[string]*acknowledgement{}}
+	if store == nil {
+		return s, nil
+	}
+	s.db = store.db
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(suppressionsBucket)
+		if err != nil {
+			return err
+		}
+		mutes, err := b.CreateBucketIfNotExists(mutesBucket)
+		if err != nil {
+			return err
+		}
+		acks, err := b.CreateBucketIfNotExists(acksBucket)
+		if err != nil {
+			return err
+		}
+		// skip any that can't be parsed, rather than refusing to start
+		mutes.ForEach(func(k, v []byte) error {
+			m := &domainMute{}
+			if json.Unmarshal(v, m) == nil {
+				s.mutes[string(k)] = m
+			}
+			return nil
+		})
+		acks.ForEach(func(k, v []byte) error {
+			a := &acknowledgement{}
+			if json.Unmarshal(v, a) == nil {
+				s.acks[string(k)] = a
+			}
+			return nil
+		})
+		return s.prune(mutes, acks)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// mute suppresses alerts for registrable domains until a time.
+func (s *suppressionStore) mute(registrables []string, until time.Time, by, rule string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	return s.update(func(mutes, acks *bolt.Bucket) error {
+		for _, registrable := range registrables {
+			m := &domainMute{Until: until, By: by, Time: now, Rule: rule}
+			s.mutes[registrable] = m
+			if err := putSuppression(mutes, registrable, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// unmute lifts mutes on registrable domains, reporting whether any were
+// muted.
+func (s *suppressionStore) unmute(registrables []string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	found := false
+	err := s.update(func(mutes, acks *bolt.Bucket) error {
+		for _, registrable := range registrables {
+			if _, ok := s.mutes[registrable]; !ok {
+				continue
+			}
+			delete(s.mutes, registrable)
+			found = true
+			if mutes != nil {
+				if err := mutes.Delete([]byte(registrable)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return found, err
+}
+
+// acknowledge records that someone handled a rule's alert for a
+// certificate, so the rule doesn't alert on it again.
+func (s *suppressionStore) acknowledge(fingerprint, by, rule string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.update(func(mutes, acks *bolt.Bucket) error {
+		a := &acknowledgement{By: by, Time: time.Now(), Rule: rule}
+		s.acks[ackKey(fingerprint, rule)] = a
+		return putSuppression(acks, ackKey(fingerprint, rule), a)
+	})
+}
+
+// acknowledged reports whether a rule's alert for the certificate with a
+// fingerprint has been acknowledged.
+func (s *suppressionStore) acknowledged(fingerprint, rule string) bool {
+	if fingerprint == "" {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.acks[ackKey(fingerprint, rule)]
+	return ok && time.Since(a.Time) <= ackRetention
+}
+
+// unmuted returns the domains whose registrable domains aren't muted.
+func (s *suppressionStore) unmuted(domains []string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.mutes) == 0 {
+		return domains
+	}
+	now := time.Now()
+	kept := []string{}
+	for _, domain := range domains {
+		if m, ok := s.mutes[registrableDomains([]string{domain})[0]]; ok && now.Before(m.Until) {
+			continue
+		}
+		kept = append(kept, domain)
+	}
+	return kept
+}
+
+// update prunes the suppressions and then calls fn to change them, with
+// their buckets if there's a database, in one transaction. Without one,
+// the buckets are nil. It's called with mu held.
+func (s *suppressionStore) update(fn func(mutes, acks *bolt.Bucket) error) error {
+	if s.db == nil {
+		s.prune(nil, nil)
+		return fn(nil, nil)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(suppressionsBucket)
+		mutes, acks := b.Bucket(mutesBucket), b.Bucket(acksBucket)
+		if err := s.prune(mutes, acks); err != nil {
+			return err
+		}
+		return fn(mutes, acks)
+	})
+}
+
+// prune drops expired mutes and old acknowledgements, from their buckets
+// too unless they're nil. It's called with mu held.
+func (s *suppressionStore) prune(mutes, acks *bolt.Bucket) error {
+	now := time.Now()
+	for registrable, m := range s.mutes {
+		if now.Before(m.Until) {
+			continue
+		}
+		delete(s.mutes, registrable)
+		if mutes != nil {
+			if err := mutes.Delete([]byte(registrable)); err != nil {
+				return err
+			}
+		}
+	}
+	for key, a := range s.acks {
+		if now.Sub(a.Time) <= ackRetention {
+			continue
+		}
+		delete(s.acks, key)
+		if acks != nil {
+			if err := acks.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// putSuppression writes a mute or acknowledgement to its bucket as JSON,
+// unless the bucket is nil.
+func putSuppression(b *bolt.Bucket, key string, v interface{}) error {
+	if b == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), data)
+}
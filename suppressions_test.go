@@ -0,0 +1,137 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// reopenSuppressions closes the match store at path, if one is open, and
+// opens it and its suppressions again.
+func reopenSuppressions(t *testing.T, path string, store *matchStore) (*matchStore, *suppressionStore) {
+	if store != nil {
+		if err := store.close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store, err := openMatchStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := openSuppressionStore(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, s
+}
+
+func TestSuppressionsKeptInMatchStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "matches.db")
+	store, s := reopenSuppressions(t, path, nil)
+	defer func() { store.close() }()
+
+	if err := s.mute([]string{"acme-secure.com", "acme-login.com"}, time.Now().Add(time.Hour), "alice", "acme"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.acknowledge("AB:CD", "bob", "acme"); err != nil {
+		t.Fatal(err)
+	}
+	store, s = reopenSuppressions(t, path, store)
+
+	domains := []string{"login.acme-secure.com", "www.acme-login.com", "example.com"}
+	if got, want := s.unmuted(domains), []string{"example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unmuted = %q, want %q", got, want)
+	}
+	if !s.acknowledged("AB:CD", "acme") {
+		t.Error("alert not acknowledged after reopening")
+	}
+	if s.acknowledged("AB:CD", "other") {
+		t.Error("another rule's alert for the certificate acknowledged")
+	}
+	if s.acknowledged("EF:01", "acme") {
+		t.Error("alert for another certificate acknowledged")
+	}
+
+	if found, err := s.unmute([]string{"acme-login.com"}); err != nil || !found {
+		t.Fatalf("unmute = %v, %v, want true", found, err)
+	}
+	if found, err := s.unmute([]string{"example.com"}); err != nil || found {
+		t.Fatalf("unmute of an unmuted domain = %v, %v, want false", found, err)
+	}
+	store, s = reopenSuppressions(t, path, store)
+	if got, want := s.unmuted(domains), []string{"www.acme-login.com", "example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unmuted after unmuting = %q, want %q", got, want)
+	}
+}
+
+func TestSuppressionsPruned(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "matches.db")
+	store, s := reopenSuppressions(t, path, nil)
+	defer func() { store.close() }()
+
+	if err := s.mute([]string{"acme-secure.com"}, time.Now().Add(-time.Minute), "alice", "acme"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.acknowledge("AB:CD", "bob", "acme"); err != nil {
+		t.Fatal(err)
+	}
+	s.acks[ackKey("AB:CD", "acme")].Time = time.Now().Add(-ackRetention - time.Hour)
+	if got := s.unmuted([]string{"acme-secure.com"}); len(got) != 1 {
+		t.Errorf("unmuted = %q, want the domain whose mute ended", got)
+	}
+	if s.acknowledged("AB:CD", "acme") {
+		t.Error("alert still acknowledged after the retention period")
+	}
+
+	// the next change prunes them from the database
+	if err := s.acknowledge("EF:01", "bob", "acme"); err != nil {
+		t.Fatal(err)
+	}
+	err := store.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(suppressionsBucket)
+		if n := b.Bucket(mutesBucket).Stats().KeyN; n != 0 {
+			t.Errorf("%d mutes kept, want 0", n)
+		}
+		if n := b.Bucket(acksBucket).Stats().KeyN; n != 1 {
+			t.Errorf("%d acknowledgements kept, want 1", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSuppressionsInMemory(t *testing.T) {
+	s, err := openSuppressionStore(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.acknowledge("AB:CD", "bob", "acme"); err != nil {
+		t.Fatal(err)
+	}
+	if !s.acknowledged("AB:CD", "acme") {
+		t.Error("alert not acknowledged")
+	}
+	if s.acknowledged("", "acme") {
+		t.Error("alert without a fingerprint acknowledged")
+	}
+}
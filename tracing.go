@@ -0,0 +1,224 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/heptiolabs/certstream-slack/pkg/enrich"
+	"github.com/heptiolabs/certstream-slack/pkg/notify"
+)
+
+// tracer records spans of how each certificate is processed, from receiving
+// it to notifying the sinks, using the OpenTelemetry SDK, and exports them
+// to a collector using OTLP over HTTP. A nil *tracer, and the nil spans it
+// starts, do nothing.
+type tracer struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+}
+
+// Spans are exported in batches of up to traceBatchSize, at least every
+// traceFlushInterval, holding up to traceQueueSize waiting to be exported
+// before dropping them.
+const (
+	traceBatchSize     = 512
+	traceFlushInterval = 5 * time.Second
+	traceQueueSize     = 4096
+)
+
+// newTracer starts a tracer exporting to the collector at endpoint, like
+// "http://localhost:4318", or returns nil if endpoint is empty.
+func newTracer(endpoint string, headers map[string]string, sampleRatio float64) *tracer {
+	if endpoint == "" {
+		return nil
+	}
+	url := endpoint
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url = strings.TrimSuffix(url, "/") + "/v1/traces"
+	}
+	exporter, err := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(url),
+		otlptracehttp.WithHeaders(headers),
+		otlptracehttp.WithProxy(proxyForRequest))
+	if err != nil {
+		log.WithError(err).Error("could not export traces")
+		return nil
+	}
+	return newTracerWithExporter(exporter, sampleRatio)
+}
+
+// newTracerWithExporter starts a tracer exporting with exporter, in
+// batches.
+func newTracerWithExporter(exporter sdktrace.SpanExporter, sampleRatio float64) *tracer {
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(countingExporter{exporter},
+			sdktrace.WithMaxExportBatchSize(traceBatchSize),
+			sdktrace.WithBatchTimeout(traceFlushInterval),
+			sdktrace.WithMaxQueueSize(traceQueueSize)),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "certstream-slack"))),
+	)
+	return &tracer{provider: provider, tracer: provider.Tracer("github.com/heptiolabs/certstream-slack")}
+}
+
+// countingExporter logs spans that couldn't be exported and counts them in
+// spansDropped.
+type countingExporter struct {
+	sdktrace.SpanExporter
+}
+
+func (e countingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	if err != nil {
+		log.WithError(err).WithField("spans", len(spans)).Warn("could not export traces")
+		spansDropped.add(float64(len(spans)))
+	}
+	return err
+}
+
+func init() {
+	// the SDK reports its other errors here, which would otherwise go to
+	// the standard logger
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		log.WithError(err).Debug("OpenTelemetry error")
+	}))
+}
+
+// span is a single timed operation in a trace.
+type span struct {
+	trace.Span
+	tracer *tracer
+}
+
+// start begins a new trace with a root span that started at start, or
+// returns nil if the trace isn't sampled.
+func (t *tracer) start(name string, start time.Time) *span {
+	if t == nil {
+		return nil
+	}
+	return t.startSpan(context.Background(), name, start)
+}
+
+func (t *tracer) startSpan(ctx context.Context, name string, start time.Time) *span {
+	_, s := t.tracer.Start(ctx, name, trace.WithTimestamp(start))
+	if !s.IsRecording() {
+		return nil
+	}
+	return &span{Span: s, tracer: t}
+}
+
+// child begins a span within s.
+func (s *span) child(name string) *span {
+	return s.childSince(name, time.Now())
+}
+
+// childSince begins a span within s that started at start.
+func (s *span) childSince(name string, start time.Time) *span {
+	if s == nil {
+		return nil
+	}
+	return s.tracer.startSpan(trace.ContextWithSpan(context.Background(), s.Span), name, start)
+}
+
+// set records an attribute of the span, a string, bool, int, or float64.
+func (s *span) set(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	switch value := value.(type) {
+	case string:
+		s.SetAttributes(attribute.String(key, value))
+	case bool:
+		s.SetAttributes(attribute.Bool(key, value))
+	case int:
+		s.SetAttributes(attribute.Int(key, value))
+	case float64:
+		s.SetAttributes(attribute.Float64(key, value))
+	default:
+		s.SetAttributes(attribute.String(key, fmt.Sprint(value)))
+	}
+}
+
+// fail marks the span as failed with err, if it's not nil.
+func (s *span) fail(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.SetStatus(codes.Error, err.Error())
+}
+
+// finish ends the span and queues it to be exported.
+func (s *span) finish() {
+	if s == nil {
+		return
+	}
+	s.End()
+}
+
+type spanContextKey struct{}
+
+// contextWithSpan returns a context carrying s, for the enrichers.
+func contextWithSpan(ctx context.Context, s *span) context.Context {
+	if s == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanContextKey{}, s)
+}
+
+// spanFromContext returns the span ctx carries, or nil.
+func spanFromContext(ctx context.Context) *span {
+	s, _ := ctx.Value(spanContextKey{}).(*span)
+	return s
+}
+
+// tracedEnricher records a span for each time an enricher runs, within the
+// span its context carries.
+type tracedEnricher struct {
+	enrich.Enricher
+}
+
+func (e tracedEnricher) Enrich(ctx context.Context, a *notify.Alert) ([]notify.Enrichment, error) {
+	s := spanFromContext(ctx).child("enrich " + e.Name())
+	defer s.finish()
+	found, err := e.Enricher.Enrich(ctx, a)
+	s.set("enrichments", len(found))
+	s.fail(err)
+	return found, err
+}
+
+// close exports the spans still waiting to be exported.
+func (t *tracer) close() {
+	if t == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := t.provider.Shutdown(ctx); err != nil {
+		log.WithError(err).Warn("could not export traces")
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracer(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tr := newTracerWithExporter(exporter, 1)
+	received := time.Now().Add(-time.Second)
+	root := tr.start("certificate", received)
+	parse := root.child("parse")
+	parse.set("domains", 3)
+	parse.set("source", "certstream")
+	parse.fail(errors.New("bad message"))
+	parse.finish()
+	root.finish()
+	// closing would also reset the exporter
+	if err := tr.provider.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+	child, parent := spans[0], spans[1]
+	if parent.Name != "certificate" || !parent.StartTime.Equal(received) || parent.Parent.IsValid() {
+		t.Errorf("root span %q started %v with parent %v, want a certificate span started %v", parent.Name, parent.StartTime, parent.Parent.SpanID(), received)
+	}
+	if child.Name != "parse" || child.Parent.SpanID() != parent.SpanContext.SpanID() || child.SpanContext.TraceID() != parent.SpanContext.TraceID() {
+		t.Errorf("child span %q isn't within the root span", child.Name)
+	}
+	want := []attribute.KeyValue{attribute.Int("domains", 3), attribute.String("source", "certstream")}
+	if len(child.Attributes) != 2 || child.Attributes[0] != want[0] || child.Attributes[1] != want[1] {
+		t.Errorf("child attributes %v, want %v", child.Attributes, want)
+	}
+	if child.Status.Code != codes.Error || child.Status.Description != "bad message" {
+		t.Errorf("child status %v, want an error", child.Status)
+	}
+	if got := spans[1].Resource.Attributes(); len(got) != 1 || got[0] != attribute.String("service.name", "certstream-slack") {
+		t.Errorf("resource %v, want the service name", got)
+	}
+}
+
+func TestTracerSampling(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tr := newTracerWithExporter(exporter, 0)
+	s := tr.start("certificate", time.Now())
+	if s != nil {
+		t.Error("started a span that isn't sampled")
+	}
+	// unsampled and nil spans do nothing
+	c := s.child("parse")
+	c.set("domains", 1)
+	c.finish()
+	if spanFromContext(contextWithSpan(context.Background(), c)) != nil {
+		t.Error("carried a nil span")
+	}
+	var none *tracer
+	none.start("certificate", time.Now()).finish()
+	none.close()
+	tr.provider.ForceFlush(context.Background())
+	if spans := exporter.GetSpans(); len(spans) != 0 {
+		t.Errorf("exported %d spans, want none", len(spans))
+	}
+}
+
+func TestTracerExport(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+	}))
+	defer server.Close()
+
+	tr := newTracer(server.URL, map[string]string{"X-API-Key": "secret"}, 1)
+	tr.start("certificate", time.Now()).finish()
+	tr.close()
+	select {
+	case r := <-requests:
+		if r.URL.Path != "/v1/traces" || r.Header.Get("X-API-Key") != "secret" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("exported to %s with headers %v, want /v1/traces with the API key", r.URL.Path, r.Header)
+		}
+	default:
+		t.Error("exported nothing")
+	}
+}
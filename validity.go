@@ -0,0 +1,56 @@
+/*
+Copyright 2017 by the contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"time"
+
+	"github.com/dustin/go-humanize/english"
+
+	"github.com/heptiolabs/certstream-slack/pkg/stream"
+)
+
+// validityAllowed reports whether the rule matches a certificate, as
+// certstream describes it, by how long it's valid: for longer than
+// ValidityOver or shorter than ValidityUnder, if either is set. If so, it
+// returns the validity to note in alerts.
+func (r *rule) validityAllowed(cert *stream.Certificate) (string, bool) {
+	if r.ValidityOver == 0 && r.ValidityUnder == 0 {
+		return "", true
+	}
+	if cert.NotBefore == 0 || cert.NotAfter == 0 {
+		return "", false
+	}
+	validity := time.Duration((cert.NotAfter - cert.NotBefore) * float64(time.Second))
+	if (r.ValidityOver > 0 && validity > r.ValidityOver) || (r.ValidityUnder > 0 && validity < r.ValidityUnder) {
+		return "valid for " + formatValidity(validity), true
+	}
+	return "", false
+}
+
+// formatValidity describes a validity period in days, or in hours or
+// minutes if it's short.
+func formatValidity(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return english.Plural(int(d/(24*time.Hour)), "day", "")
+	case d >= 2*time.Hour:
+		return english.Plural(int(d/time.Hour), "hour", "")
+	case d >= time.Minute:
+		return english.Plural(int(d/time.Minute), "minute", "")
+	}
+	return d.String()
+}